@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newArchiveCommand() *cobra.Command {
+	var (
+		rehydrate bool
+		stats     bool
+		req       service.RehydrateRequest
+	)
+
+	cmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Move old embeddings into the compressed archive, or bring them back",
+		Example: `  review-vectorizer archive
+  review-vectorizer archive --stats
+  review-vectorizer archive --rehydrate --app-id com.example.app`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case stats:
+				archived, err := svc.ArchiveStats(cmd.Context())
+				if err != nil {
+					return fmt.Errorf("failed to get archive stats: %w", err)
+				}
+				return printJSON(cmd, archived)
+			case rehydrate:
+				result, err := svc.RehydrateEmbeddings(cmd.Context(), req)
+				if err != nil {
+					return fmt.Errorf("rehydration failed: %w", err)
+				}
+				return printJSON(cmd, result)
+			default:
+				result, err := svc.ArchiveEmbeddings(cmd.Context())
+				if err != nil {
+					return fmt.Errorf("archiving failed: %w", err)
+				}
+				return printJSON(cmd, result)
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.BoolVar(&stats, "stats", false, "print the size of the archive instead")
+	flags.BoolVar(&rehydrate, "rehydrate", false, "move archived embeddings back instead of archiving")
+	flags.StringVar(&req.AppID, "app-id", "", "with --rehydrate, app whose embeddings to bring back")
+	flags.StringSliceVar(&req.ReviewIDs, "review-ids", nil, "with --rehydrate, reviews whose embeddings to bring back")
+	cmd.MarkFlagsMutuallyExclusive("stats", "rehydrate")
+
+	return cmd
+}
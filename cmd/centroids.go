@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newCentroidsCommand() *cobra.Command {
+	var req payloads.CentroidsRequest
+
+	cmd := &cobra.Command{
+		Use:     "centroids",
+		Short:   "Recompute an app's centroid vectors per ISO week and rating bucket",
+		Example: `  review-vectorizer centroids --app-id com.example.app --from 2024-01-01`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			completed, err := svc.ComputeCentroids(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("centroid aggregation failed: %w", err)
+			}
+
+			return printJSON(cmd, completed)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.AppID, "app-id", "", "app whose centroids to compute")
+	flags.StringVar(&req.DateFrom, "from", "", "only recompute the weeks from the one of this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only recompute the weeks up to the one of this date")
+	cmd.MarkFlagRequired("app-id")
+
+	return cmd
+}
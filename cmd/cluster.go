@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newClusterCommand() *cobra.Command {
+	var req service.ClusterRequest
+
+	cmd := &cobra.Command{
+		Use:     "cluster",
+		Short:   "Cluster an app's embedded reviews with k-means and print the cluster sizes",
+		Example: `  review-vectorizer cluster --app-id com.example.app --k 30 --from 2024-01-01`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			result, err := svc.Cluster(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("clustering failed: %w", err)
+			}
+
+			return printJSON(cmd, result)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.AppID, "app-id", "", "app whose reviews to cluster")
+	flags.IntVar(&req.K, "k", 0, "number of clusters (default clustering.k)")
+	flags.StringVar(&req.DateFrom, "from", "", "only cluster reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only cluster reviews up to this date")
+	cmd.MarkFlagRequired("app-id")
+
+	return cmd
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/consumer"
+	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
+	"github.com/spf13/cobra"
+)
+
+func newDLQCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dlq",
+		Short: "Work with dead-lettered messages",
+	}
+
+	cmd.AddCommand(newDLQReplayCommand())
+
+	return cmd
+}
+
+func newDLQReplayCommand() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:     "replay TOPIC",
+		Short:   "Publish the dead letters of a topic back to it",
+		Example: `  review-vectorizer dlq replay pipeline.vectorize_reviews.request --limit 10`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			producer, err := producer.NewProducer(cfg.Kafka, retry.New(cfg.Retry, nil))
+			if err != nil {
+				return fmt.Errorf("failed to create Kafka producer: %w", err)
+			}
+			defer producer.Close()
+
+			replayed, err := consumer.Replay(cmd.Context(), cfg.Kafka, producer, args[0], limit, logger)
+			if err != nil {
+				return fmt.Errorf("replay failed after %d messages: %w", replayed, err)
+			}
+
+			return printJSON(cmd, map[string]any{"topic": args[0], "replayed": replayed})
+		},
+	}
+
+	cmd.Flags().IntVar(&limit, "limit", 0, "replay at most this many messages (default all)")
+
+	return cmd
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newDriftCommand() *cobra.Command {
+	var (
+		appID string
+		list  bool
+		reset bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Check recent embeddings for drift from their app's baseline",
+		Example: `  review-vectorizer drift
+  review-vectorizer drift --app-id com.example.app --list
+  review-vectorizer drift --app-id com.example.app --reset`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case list:
+				baselines, err := svc.DriftBaselines(cmd.Context(), appID)
+				if err != nil {
+					return fmt.Errorf("failed to list drift baselines: %w", err)
+				}
+				return printJSON(cmd, baselines)
+			case reset:
+				deleted, err := svc.ResetDriftBaselines(cmd.Context(), appID)
+				if err != nil {
+					return fmt.Errorf("failed to reset drift baselines: %w", err)
+				}
+				return printJSON(cmd, map[string]int64{"deleted": deleted})
+			default:
+				checks, err := svc.CheckDrift(cmd.Context(), appID)
+				if err != nil {
+					return fmt.Errorf("drift check failed: %w", err)
+				}
+				return printJSON(cmd, checks)
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&appID, "app-id", "", "only this app instead of every app")
+	flags.BoolVar(&list, "list", false, "print the baselines and the outcome of their last check instead")
+	flags.BoolVar(&reset, "reset", false, "delete the baselines, so that the next check takes new ones")
+	cmd.MarkFlagsMutuallyExclusive("list", "reset")
+
+	return cmd
+}
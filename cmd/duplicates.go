@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newDuplicatesCommand() *cobra.Command {
+	var req service.DuplicatesRequest
+
+	cmd := &cobra.Command{
+		Use:     "duplicates",
+		Short:   "Flag near-duplicate reviews of an app and print a summary",
+		Example: `  review-vectorizer duplicates --app-id com.example.app --threshold 0.95 --from 2024-03-01`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			summary, err := svc.DetectDuplicates(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("near-duplicate detection failed: %w", err)
+			}
+
+			return printJSON(cmd, summary)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.AppID, "app-id", "", "app whose reviews to compare")
+	flags.Float64Var(&req.Threshold, "threshold", 0, "cosine similarity from which reviews count as duplicates (default duplicates.threshold)")
+	flags.StringVar(&req.DateFrom, "from", "", "only compare reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only compare reviews up to this date")
+	cmd.MarkFlagRequired("app-id")
+
+	return cmd
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newExportCommand() *cobra.Command {
+	var req payloads.ExportRequest
+
+	cmd := &cobra.Command{
+		Use:   "export DESTINATION",
+		Short: "Export embeddings with their metadata to a JSONL or Parquet file",
+		Example: `  review-vectorizer export s3://datasets/reviews/2024-01.parquet --app-id com.example.app --from 2024-01-01 --to 2024-01-31
+  review-vectorizer export embeddings.jsonl --app-id com.example.app`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.Destination = args[0]
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			completed, err := svc.Export(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("export failed: %w", err)
+			}
+
+			return printJSON(cmd, completed)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.Format, "format", "", "jsonl or parquet (default from the destination's extension)")
+	flags.StringVar(&req.AppID, "app-id", "", "only export embeddings of this app")
+	flags.StringVar(&req.Language, "language", "", "only export reviews in this language")
+	flags.StringVar(&req.Country, "country", "", "only export reviews from this country")
+	flags.IntVar(&req.MinRating, "min-rating", 0, "only export reviews with at least this rating")
+	flags.IntVar(&req.MaxRating, "max-rating", 0, "only export reviews with at most this rating")
+	flags.StringVar(&req.DateFrom, "from", "", "only export reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only export reviews up to this date")
+
+	return cmd
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newImportCommand() *cobra.Command {
+	var req payloads.ImportRequest
+
+	cmd := &cobra.Command{
+		Use:     "import SOURCE",
+		Short:   "Load precomputed embeddings from a JSONL or Parquet file",
+		Example: `  review-vectorizer import s3://datasets/offline/embeddings.parquet --model text-embedding-3-small`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.Source = args[0]
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			completed, err := svc.Import(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("import failed after %d embeddings: %w", completed.Imported, err)
+			}
+
+			return printJSON(cmd, completed)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.Format, "format", "", "jsonl or parquet (default from the source's extension)")
+	flags.StringVar(&req.Model, "model", "", "model of records that don't name theirs")
+
+	return cmd
+}
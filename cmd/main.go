@@ -2,57 +2,144 @@ package main
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"fmt"
 	"log/slog"
+	"os"
 	"os/signal"
+	"os/user"
 	"syscall"
+	"time"
 
 	"github.com/quiby-ai/review-vectorizer/config"
-	"github.com/quiby-ai/review-vectorizer/internal/consumer"
-	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
+	"github.com/quiby-ai/review-vectorizer/internal/secrets"
 	"github.com/quiby-ai/review-vectorizer/internal/service"
 	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"github.com/spf13/cobra"
 )
 
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
+	// Runs drain their batches in flight after the first signal; a second
+	// one exits right away.
+	context.AfterFunc(ctx, stop)
 
-	cfg, err := config.Load()
+	if err := newRootCommand().ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+// configPaths are the configuration files given with --config, later ones
+// overriding earlier ones; without any, config.Load searches its default
+// locations.
+var configPaths []string
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "review-vectorizer",
+		Short:        "Vectorizes app reviews into pgvector embeddings",
+		SilenceUsage: true,
+		// Without a subcommand the service runs as before.
+		RunE: runServe,
+	}
+	root.PersistentFlags().StringSliceVar(&configPaths, "config", nil, "configuration file in TOML, YAML or JSON; repeat to layer files (default config.{toml,yaml,json} in /, /etc/review-vectorizer or the working directory)")
+
+	root.AddCommand(
+		newServeCommand(),
+		newRunOnceCommand(),
+		newVectorizeReviewCommand(),
+		newStatsCommand(),
+		newRunsCommand(),
+		newSearchCommand(),
+		newSimilarCommand(),
+		newClusterCommand(),
+		newProjectCommand(),
+		newDuplicatesCommand(),
+		newShadowReportCommand(),
+		newCentroidsCommand(),
+		newExportCommand(),
+		newImportCommand(),
+		newDLQCommand(),
+		newMigrateCommand(),
+		newMigrateModelCommand(),
+		newArchiveCommand(),
+		newDriftCommand(),
+	)
+
+	return root
+}
+
+// setup loads the configuration, installs the logger and connects to the
+// database, creating missing tables.
+func setup() (*config.Config, *slog.Logger, storage.Repository, error) {
+	cfg, err := config.Load(configPaths...)
 	if err != nil {
-		log.Fatalf("config: %v", err)
+		return nil, nil, nil, fmt.Errorf("config: %w", err)
 	}
 
-	logger := slog.New(slog.NewTextHandler(log.Writer(), &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	logger, err := telemetry.NewLogger(cfg.Logging, os.Stderr)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("logging: %w", err)
+	}
 	slog.SetDefault(logger)
 
+	if err := secrets.NewResolver(cfg.Secrets, logger).ResolveConfig(context.Background(), cfg); err != nil {
+		return nil, nil, nil, fmt.Errorf("secrets: %w", err)
+	}
+	logger.Info("Configuration loaded", "config", cfg.Dump())
+
 	logger.Info("Connecting to database and initializing tables...")
-	repo, err := storage.NewPostgresRepository(cfg.Postgres.DSN)
+	dbRetry := retry.New(cfg.Retry, nil)
+	dbRetry.OnRetry = func(attempt int, delay time.Duration, err error) {
+		logger.Warn("Database operation failed, retrying", "attempt", attempt, "delay", delay, "error", err)
+	}
+	timeouts := storage.Timeouts{
+		Statement: cfg.Postgres.StatementTimeout,
+		Fetch:     cfg.Postgres.FetchTimeout,
+		Write:     cfg.Postgres.WriteTimeout,
+		Stats:     cfg.Postgres.StatsTimeout,
+	}
+	repo, err := storage.NewPostgresRepository(cfg.Postgres.DSN, cfg.Postgres.DSNSource, dbRetry, timeouts)
 	if err != nil {
 		logger.Error("Failed to connect to database", "error", err)
-		log.Fatalf("database: %v", err)
+		return nil, nil, nil, fmt.Errorf("database: %w", err)
 	}
-	defer repo.Close()
 
 	logger.Info("Database connection established and tables initialized successfully")
 
-	stats, err := repo.GetTableStats(context.Background())
+	current, err := repo.GetCurrentModel(context.Background())
 	if err != nil {
-		logger.Warn("Failed to get table stats", "error", err)
-	} else {
-		logger.Info("Table statistics", "stats", stats)
+		repo.Close()
+		return nil, nil, nil, fmt.Errorf("database: %w", err)
+	}
+	if current != "" && current != cfg.Vectorizer.Model {
+		logger.Warn("Using the model marked as current by a model migration instead of vectorizer.model",
+			"model", current,
+			"configured_model", cfg.Vectorizer.Model)
+		cfg.Vectorizer.Model = current
+		cfg.OpenAI.Model = current
 	}
 
-	producer := producer.NewProducer(cfg.Kafka)
-	defer producer.Close()
-
-	svc := service.NewVectorizeService(repo, cfg, logger, producer)
+	return cfg, logger, repo, nil
+}
 
-	cons := consumer.NewKafkaConsumer(cfg.Kafka, svc)
-	if err := cons.Run(ctx); err != nil {
-		logger.Error("Consumer exited with error", "error", err)
-		log.Fatalf("consumer exited with error: %v", err)
+// cliContext returns the command's context, attributing the operations run
+// with it to the user running the command in the audit log.
+func cliContext(cmd *cobra.Command) context.Context {
+	actor := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		actor = u.Username
 	}
+	return service.WithAuditSource(cmd.Context(), "cli:"+actor, cmd.CommandPath())
+}
+
+// printJSON writes v to stdout as indented JSON, for commands whose output
+// is meant to be read or piped into jq.
+func printJSON(cmd *cobra.Command, v any) error {
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateModelCommand() *cobra.Command {
+	var req service.MigrateModelRequest
+
+	cmd := &cobra.Command{
+		Use:   "migrate-model MODEL",
+		Short: "Re-embed every review with another model, then make it the current model",
+		Long: `Re-embed every review embedded with the current model with MODEL next to
+the production embeddings, then swap them in and mark MODEL as current in one
+transaction. Running instances switch to MODEL within vectorizer.model_poll_interval.
+An interrupted migration resumes where it stopped when run again.`,
+		Example: `  review-vectorizer migrate-model text-embedding-3-large
+  review-vectorizer migrate-model text-embedding-3-large --no-flip`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.To = args[0]
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			migration, err := svc.MigrateModel(cliContext(cmd), req)
+			if err != nil {
+				return fmt.Errorf("migration failed: %w", err)
+			}
+
+			return printJSON(cmd, migration)
+		},
+	}
+
+	cmd.Flags().BoolVar(&req.NoFlip, "no-flip", false, "only stage the new embeddings; run again without it to flip")
+
+	return cmd
+}
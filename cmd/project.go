@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newProjectCommand() *cobra.Command {
+	var (
+		req     service.ProjectionRequest
+		showMap bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "Compute the 2D coordinates of an app's embedded reviews for review maps",
+		Example: `  review-vectorizer project --app-id com.example.app --from 2024-01-01
+  review-vectorizer project --app-id com.example.app --map > map.json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			if showMap {
+				projection, err := svc.LatestProjection(cmd.Context(), req.AppID)
+				if err != nil {
+					return fmt.Errorf("failed to get projection: %w", err)
+				}
+				return printJSON(cmd, projection)
+			}
+
+			result, err := svc.Project(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("projection failed: %w", err)
+			}
+
+			return printJSON(cmd, result)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.AppID, "app-id", "", "app whose reviews to project")
+	flags.StringVar(&req.DateFrom, "from", "", "only project reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only project reviews up to this date")
+	flags.BoolVar(&showMap, "map", false, "print the latest projection with the coordinates of its reviews instead")
+	cmd.MarkFlagRequired("app-id")
+
+	return cmd
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newVectorizeReviewCommand() *cobra.Command {
+	var evt payloads.VectorizeReview
+
+	cmd := &cobra.Command{
+		Use:   "vectorize-review REVIEW_ID",
+		Short: "Embed a single review right away and print the result",
+		Example: `  review-vectorizer vectorize-review 123456
+  review-vectorizer vectorize-review 123456 --app-id com.example.app --content "Crashes on launch"`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			evt.ReviewID = args[0]
+			if err := evt.Validate(); err != nil {
+				return err
+			}
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			completed, err := svc.VectorizeReview(cmd.Context(), evt)
+			if err != nil {
+				return fmt.Errorf("vectorization failed: %w", err)
+			}
+
+			return printJSON(cmd, completed)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&evt.AppID, "app-id", "", "app of the review")
+	flags.StringVar(&evt.Content, "content", "", "embed this text instead of the review's text in clean_reviews")
+	flags.StringVar(&evt.Response, "response", "", "developer response to embed with --content")
+	flags.StringVar(&evt.Title, "title", "", "review title to embed with --content")
+	flags.StringVar(&evt.Language, "language", "", "language of --content")
+	flags.StringVar(&evt.Country, "country", "", "country of the review given with --content")
+	flags.Int16Var(&evt.Rating, "rating", 0, "rating of the review given with --content")
+
+	return cmd
+}
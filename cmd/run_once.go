@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newRunOnceCommand() *cobra.Command {
+	var req service.VectorizeRequest
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "run-once",
+		Short: "Run a single vectorization without Kafka and print the result",
+		Example: `  review-vectorizer run-once --app-id com.example.app --from 2024-01-01 --to 2024-01-31
+  review-vectorizer run-once --app-id com.example.app --dry-run`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			// No producer: runs started from the command line are not part
+			// of a saga, so no events are published.
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			if timeout > 0 {
+				req.Deadline = time.Now().Add(timeout)
+			}
+
+			result, err := svc.RunOnce(cliContext(cmd), req)
+			if err != nil {
+				return fmt.Errorf("run failed: %w", err)
+			}
+
+			return printJSON(cmd, result)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.TenantID, "tenant-id", "", "only vectorize reviews and touch embeddings of this tenant")
+	flags.StringVar(&req.AppID, "app-id", "", "only vectorize reviews of this app")
+	flags.StringSliceVar(&req.Countries, "countries", nil, "only vectorize reviews from these countries")
+	flags.StringSliceVar(&req.Languages, "languages", nil, "only vectorize reviews in these languages")
+	flags.StringVar(&req.DateFrom, "from", "", "only vectorize reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only vectorize reviews up to this date")
+	flags.IntVar(&req.MinRating, "min-rating", 0, "only vectorize reviews with at least this rating")
+	flags.IntVar(&req.MaxRating, "max-rating", 0, "only vectorize reviews with at most this rating")
+	flags.StringSliceVar(&req.ReviewIDs, "review-ids", nil, "only vectorize these reviews")
+	flags.BoolVar(&req.OnlyWithResponse, "only-with-response", false, "only vectorize reviews with a developer response")
+	flags.Float64Var(&req.SamplePercent, "sample-percent", 0, "only vectorize a reproducible sample of this percentage of the reviews, from 0.01 to 100")
+	flags.Int64Var(&req.SampleSeed, "sample-seed", 0, "seed picking the --sample-percent sample")
+	flags.StringVar(&req.Order, "order", "", "process reviews newest_first (default), oldest_first, lowest_rating_first or highest_rating_first")
+	flags.IntVar(&req.Limit, "limit", 0, "page size when fetching reviews")
+	flags.BoolVar(&req.ForceRecompute, "force", false, "re-embed reviews that already have an embedding")
+	flags.BoolVar(&req.StaleModel, "stale-model", false, "re-embed reviews embedded with another model")
+	flags.BoolVar(&req.ResponseBackfill, "response-backfill", false, "only embed responses added after vectorization")
+	flags.BoolVar(&req.OnlyFailed, "only-failed", false, "only retry reviews in the error ledger")
+	flags.BoolVar(&req.Incremental, "incremental", false, "only vectorize reviews newer than the watermark")
+	flags.BoolVar(&req.DryRun, "dry-run", false, "estimate tokens and cost without embedding")
+	flags.DurationVar(&timeout, "timeout", 0, "stop fetching processing.deadline_margin before this long has passed and keep what was stored")
+
+	return cmd
+}
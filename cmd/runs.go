@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newRunsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Inspect the run history",
+	}
+
+	cmd.AddCommand(newRunsListCommand(), newRunsErrorsCommand())
+
+	return cmd
+}
+
+func newRunsListCommand() *cobra.Command {
+	var query service.RunQuery
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Print runs, most recently started first",
+		Example: `  review-vectorizer runs list --app-id com.example.app --date-from 2024-06-01
+  review-vectorizer runs list --status failed --limit 10`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			runs, err := svc.ListRuns(cmd.Context(), query)
+			if err != nil {
+				return fmt.Errorf("failed to list runs: %w", err)
+			}
+
+			return printJSON(cmd, map[string]any{"runs": runs})
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&query.AppID, "app-id", "", "only runs over this app")
+	flags.StringVar(&query.Status, "status", "", "only runs with this status (running, completed, failed or cancelled)")
+	flags.StringVar(&query.DateFrom, "date-from", "", "only runs started at or after this date or RFC 3339 time")
+	flags.StringVar(&query.DateTo, "date-to", "", "only runs started on or before this date or RFC 3339 time")
+	flags.IntVar(&query.Limit, "limit", 0, "print at most this many runs (default 50, at most 500)")
+
+	return cmd
+}
+
+func newRunsErrorsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "errors ID",
+		Short: "Print the review failures a run left unresolved",
+		Long:  "Print the review failures a run left unresolved. ID is a run ID or a saga ID, which stands for the saga's latest run.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			run, reviewErrors, err := svc.GetRunErrors(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to get run errors: %w", err)
+			}
+			if run == nil {
+				return fmt.Errorf("run %s not found", args[0])
+			}
+
+			return printJSON(cmd, map[string]any{"run_id": run.RunID, "errors": reviewErrors})
+		},
+	}
+
+	return cmd
+}
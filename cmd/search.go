@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newSearchCommand() *cobra.Command {
+	var req service.SearchRequest
+
+	cmd := &cobra.Command{
+		Use:   `search ["query"]`,
+		Short: "Print the reviews most similar to a text or to a review",
+		Example: `  review-vectorizer search "app crashes on login" --app-id com.example.app --max-rating 2
+  review-vectorizer search --review-id 123456`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				req.Text = args[0]
+			}
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			results, err := svc.Search(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("search failed: %w", err)
+			}
+
+			return printJSON(cmd, results)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&req.ReviewID, "review-id", "", "search for reviews similar to this review instead of a text")
+	flags.BoolVar(&req.Rerank, "rerank", false, "rerank the vector hits with the configured reranker")
+	flags.IntVar(&req.RerankCandidates, "rerank-candidates", 0, "number of vector hits to rerank (default rerank.candidates)")
+	addSearchFilterFlags(cmd, &req)
+
+	return cmd
+}
+
+func newSimilarCommand() *cobra.Command {
+	var req service.SearchRequest
+
+	cmd := &cobra.Command{
+		Use:     "similar REVIEW_ID",
+		Short:   "Print the reviews most similar to an embedded review",
+		Example: `  review-vectorizer similar 123456 --limit 20`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req.ReviewID = args[0]
+
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			results, err := svc.Search(cmd.Context(), req)
+			if err != nil {
+				return fmt.Errorf("search failed: %w", err)
+			}
+
+			return printJSON(cmd, results)
+		},
+	}
+
+	addSearchFilterFlags(cmd, &req)
+
+	return cmd
+}
+
+// addSearchFilterFlags registers the result limit and filter flags shared by
+// the search commands.
+func addSearchFilterFlags(cmd *cobra.Command, req *service.SearchRequest) {
+	flags := cmd.Flags()
+	flags.IntVar(&req.Limit, "limit", 0, "number of results (default 10)")
+	flags.StringVar(&req.AppID, "app-id", "", "only return reviews of this app")
+	flags.StringVar(&req.Language, "language", "", "only return reviews in this language")
+	flags.StringVar(&req.Country, "country", "", "only return reviews from this country")
+	flags.IntVar(&req.MinRating, "min-rating", 0, "only return reviews with at least this rating")
+	flags.IntVar(&req.MaxRating, "max-rating", 0, "only return reviews with at most this rating")
+	flags.StringVar(&req.DateFrom, "from", "", "only return reviews from this date on")
+	flags.StringVar(&req.DateTo, "to", "", "only return reviews up to this date")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/api"
+	"github.com/quiby-ai/review-vectorizer/internal/cdc"
+	"github.com/quiby-ai/review-vectorizer/internal/consumer"
+	"github.com/quiby-ai/review-vectorizer/internal/leader"
+	"github.com/quiby-ai/review-vectorizer/internal/outbox"
+	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
+	"github.com/quiby-ai/review-vectorizer/internal/scheduler"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"github.com/spf13/cobra"
+)
+
+func newServeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "serve",
+		Short: "Consume vectorization events from Kafka and serve the admin API",
+		Args:  cobra.NoArgs,
+		RunE:  runServe,
+	}
+}
+
+func runServe(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+
+	cfg, logger, repo, err := setup()
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	shutdownTracing, err := telemetry.SetupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.WithoutCancel(ctx)); err != nil {
+			logger.Warn("Failed to flush traces", "error", err)
+		}
+	}()
+
+	shutdownErrorReporting, err := telemetry.SetupErrorReporting(cfg.ErrorReporting, logger)
+	if err != nil {
+		return fmt.Errorf("error reporting: %w", err)
+	}
+	defer func() {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.ErrorReporting.Timeout)
+		defer cancel()
+		if err := shutdownErrorReporting(flushCtx); err != nil {
+			logger.Warn("Failed to flush error reports", "error", err)
+		}
+	}()
+
+	stats, err := repo.GetTableStats(ctx)
+	if err != nil {
+		logger.Warn("Failed to get table stats", "error", err)
+	} else {
+		logger.Info("Table statistics", "stats", stats)
+	}
+
+	producer, err := producer.NewProducer(cfg.Kafka, retry.New(cfg.Retry, nil))
+	if err != nil {
+		logger.Error("Failed to create Kafka producer", "error", err)
+		return fmt.Errorf("failed to create Kafka producer: %w", err)
+	}
+	defer producer.Close()
+
+	svc, err := service.NewVectorizeService(repo, cfg, logger, producer)
+	if err != nil {
+		logger.Error("Failed to create vectorize service", "error", err)
+		return err
+	}
+
+	go func() {
+		if err := config.Watch(ctx, func(reloaded *config.Config) {
+			logger.Info("Configuration file changed, applying tuning, feature flags and log level")
+			svc.Retune(reloaded)
+			svc.SetFlags(reloaded.Flags)
+			if err := telemetry.SetLogLevel(reloaded.Logging.Level); err != nil {
+				logger.Warn("Failed to apply reloaded log level", "error", err)
+			}
+		}, func(err error) {
+			logger.Warn("Ignoring configuration change", "error", err)
+		}); err != nil {
+			logger.Error("Config watcher exited with error", "error", err)
+		}
+	}()
+
+	go func() {
+		if err := svc.WatchModel(ctx, cfg.Vectorizer.ModelPollInterval); err != nil {
+			logger.Error("Model watcher exited with error", "error", err)
+		}
+	}()
+
+	if cfg.Partitioning.Enabled {
+		go func() {
+			if err := svc.WatchPartitions(ctx); err != nil {
+				logger.Error("Partition watcher exited with error", "error", err)
+			}
+		}()
+	}
+
+	var elector *leader.Elector
+	if cfg.LeaderElection.Enabled {
+		elector = leader.NewElector(repo, cfg.LeaderElection, logger)
+		go func() {
+			if err := elector.Run(ctx); err != nil {
+				logger.Error("Leader election exited with error", "error", err)
+			}
+		}()
+	}
+
+	relay := outbox.NewRelay(repo, producer, elector, cfg.Outbox, logger)
+	go func() {
+		if err := relay.Run(ctx); err != nil {
+			logger.Error("Outbox relay exited with error", "error", err)
+		}
+	}()
+
+	if cfg.CDC.Enabled {
+		listener := cdc.NewListener(repo, svc, cfg.CDC, logger)
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				logger.Error("CDC listener exited with error", "error", err)
+			}
+		}()
+	}
+
+	if cfg.Scheduler.Enabled {
+		// Partitioned schedules run on every replica, each over its own
+		// apps.
+		schedLeader := elector
+		if cfg.Partitioning.Enabled {
+			schedLeader = nil
+		}
+		sched, err := scheduler.NewScheduler(cfg.Scheduler, svc, schedLeader, logger)
+		if err != nil {
+			return fmt.Errorf("scheduler: %w", err)
+		}
+		go func() {
+			if err := sched.Run(ctx); err != nil {
+				logger.Error("Scheduler exited with error", "error", err)
+			}
+		}()
+	}
+
+	cons, err := consumer.NewKafkaConsumer(cfg.Kafka, svc, producer, logger)
+	if err != nil {
+		logger.Error("Failed to create Kafka consumer", "error", err)
+		return fmt.Errorf("failed to create Kafka consumer: %w", err)
+	}
+
+	if cfg.HTTP.Enabled {
+		server := api.NewServer(cfg.HTTP, svc, cons, logger)
+		go func() {
+			if err := server.Run(ctx); err != nil {
+				logger.Error("Admin API exited with error", "error", err)
+			}
+		}()
+	}
+
+	if err := cons.Run(ctx); err != nil {
+		logger.Error("Consumer exited with error", "error", err)
+		return fmt.Errorf("consumer exited with error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newShadowReportCommand() *cobra.Command {
+	var appID, model string
+
+	cmd := &cobra.Command{
+		Use:   "shadow-report",
+		Short: "Compare the shadow model with the production model on the reviews embedded with both",
+		Example: `  review-vectorizer shadow-report --app-id com.example.app
+  review-vectorizer shadow-report --model text-embedding-3-large`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			report, err := svc.ShadowReport(cmd.Context(), appID, model)
+			if err != nil {
+				return fmt.Errorf("failed to build shadow report: %w", err)
+			}
+
+			return printJSON(cmd, report)
+		},
+	}
+
+	cmd.Flags().StringVar(&appID, "app-id", "", "only compare reviews of this app")
+	cmd.Flags().StringVar(&model, "model", "", "candidate model to compare (default shadow.model)")
+
+	return cmd
+}
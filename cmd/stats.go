@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/spf13/cobra"
+)
+
+func newStatsCommand() *cobra.Command {
+	var appID string
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Print embedding statistics and, for an app, its coverage report",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, logger, repo, err := setup()
+			if err != nil {
+				return err
+			}
+			defer repo.Close()
+
+			svc, err := service.NewVectorizeService(repo, cfg, logger, nil)
+			if err != nil {
+				return err
+			}
+
+			stats, err := svc.Stats(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to get stats: %w", err)
+			}
+
+			output := map[string]any{"embeddings": stats}
+
+			if appID != "" {
+				coverage, err := svc.CoverageReport(cmd.Context(), appID)
+				if err != nil {
+					return fmt.Errorf("failed to get coverage report: %w", err)
+				}
+				output["coverage"] = coverage
+			}
+
+			return printJSON(cmd, output)
+		},
+	}
+
+	cmd.Flags().StringVar(&appID, "app-id", "", "also print the coverage report of this app")
+
+	return cmd
+}
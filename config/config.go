@@ -1,80 +1,762 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Kafka      KafkaConfig
-	Postgres   PostgresConfig
-	Processing ProcessingConfig
-	Vectorizer VectorizerConfig
-	OpenAI     OpenAIConfig
+	Kafka          KafkaConfig          `mapstructure:"kafka"`
+	Postgres       PostgresConfig       `mapstructure:"postgres"`
+	Processing     ProcessingConfig     `mapstructure:"processing"`
+	Vectorizer     VectorizerConfig     `mapstructure:"vectorizer"`
+	Preprocessing  PreprocessingConfig  `mapstructure:"preprocessing"`
+	Redaction      RedactionConfig      `mapstructure:"redaction"`
+	OpenAI         OpenAIConfig         `mapstructure:"openai"`
+	CDC            CDCConfig            `mapstructure:"cdc"`
+	HTTP           HTTPConfig           `mapstructure:"http"`
+	Tracing        TracingConfig        `mapstructure:"tracing"`
+	ErrorReporting ErrorReportingConfig `mapstructure:"error_reporting"`
+	Logging        LoggingConfig        `mapstructure:"logging"`
+	Clustering     ClusteringConfig     `mapstructure:"clustering"`
+	Duplicates     DuplicatesConfig     `mapstructure:"duplicates"`
+	Projection     ProjectionConfig     `mapstructure:"projection"`
+	Export         ExportConfig         `mapstructure:"export"`
+	Scheduler      SchedulerConfig      `mapstructure:"scheduler"`
+	Outbox         OutboxConfig         `mapstructure:"outbox"`
+	Secrets        SecretsConfig        `mapstructure:"secrets"`
+	Flags          FlagsConfig          `mapstructure:"flags"`
+	Shadow         ShadowConfig         `mapstructure:"shadow"`
+	Cache          CacheConfig          `mapstructure:"cache"`
+	Partitioning   PartitioningConfig   `mapstructure:"partitioning"`
+	LeaderElection LeaderElectionConfig `mapstructure:"leader_election"`
+	Backpressure   BackpressureConfig   `mapstructure:"backpressure"`
+	Quotas         QuotasConfig         `mapstructure:"quotas"`
+	Retry          RetryConfig          `mapstructure:"retry"`
+	Archive        ArchiveConfig        `mapstructure:"archive"`
+	Sparse         SparseConfig         `mapstructure:"sparse"`
+	Rerank         RerankConfig         `mapstructure:"rerank"`
+	Drift          DriftConfig          `mapstructure:"drift"`
+	Artifacts      ArtifactsConfig      `mapstructure:"artifacts"`
 }
 
 type KafkaConfig struct {
-	Brokers []string
-	GroupID string
+	Brokers            []string      `mapstructure:"brokers"`
+	GroupID            string        `mapstructure:"group_id"`
+	MaxAttempts        int           `mapstructure:"max_attempts"`
+	RetryBackoff       time.Duration `mapstructure:"retry_backoff"`
+	RetryBackoffMax    time.Duration `mapstructure:"retry_backoff_max"`
+	RetryBackoffFactor float64       `mapstructure:"retry_backoff_factor"`
+	// MaintenanceBackoff is how long requests deferred in maintenance mode
+	// wait on their retry topic before being delivered again.
+	MaintenanceBackoff time.Duration `mapstructure:"maintenance_backoff"`
+
+	// TopicPrefix is prepended to every topic name, e.g. "staging.". Topics
+	// overrides the name of individual topics, prefix included.
+	TopicPrefix string          `mapstructure:"topic_prefix"`
+	Topics      []TopicOverride `mapstructure:"topics"`
+
+	// Consumer tuning; zero values keep the client defaults.
+	SessionTimeout   time.Duration `mapstructure:"session_timeout"`
+	RebalanceTimeout time.Duration `mapstructure:"rebalance_timeout"`
+	FetchMinBytes    int           `mapstructure:"fetch_min_bytes"`
+	FetchMaxBytes    int           `mapstructure:"fetch_max_bytes"`
+	FetchMaxWait     time.Duration `mapstructure:"fetch_max_wait"`
+	// StartOffset is where a consumer group without committed offsets starts
+	// reading: "earliest" (default) or "latest".
+	StartOffset string `mapstructure:"start_offset"`
+
+	// PropagateHeaders are copied from a consumed message onto the events
+	// published while handling it, e.g. correlation IDs. Headers are attached
+	// to every published event, e.g. tenant or environment.
+	PropagateHeaders []string          `mapstructure:"propagate_headers"`
+	Headers          map[string]string `mapstructure:"headers"`
+
+	// Encoding is how events are published: "json" (default), "avro" or
+	// "protobuf", the latter two with schemas from the schema registry.
+	// Topics may override it.
+	Encoding       string               `mapstructure:"encoding"`
+	SchemaRegistry SchemaRegistryConfig `mapstructure:"schema_registry"`
+
+	TLS  KafkaTLSConfig  `mapstructure:"tls"`
+	SASL KafkaSASLConfig `mapstructure:"sasl"`
+}
+
+// SchemaRegistryConfig locates the Confluent-compatible schema registry that
+// Avro and Protobuf encoded events refer to. Schemas are looked up by ID for
+// consuming and as the latest version of the topic's "<topic>-value" subject
+// for publishing, which is refreshed after CacheTTL.
+type SchemaRegistryConfig struct {
+	URL      string        `mapstructure:"url"`
+	Username string        `mapstructure:"username"`
+	Password string        `mapstructure:"password"`
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// KafkaTLSConfig enables TLS to the brokers. The CA file defaults to the
+// system roots; the certificate and key are only needed for mutual TLS.
+type KafkaTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// KafkaSASLConfig authenticates to the brokers with PLAIN, SCRAM-SHA-256 or
+// SCRAM-SHA-512; an empty mechanism disables SASL.
+type KafkaSASLConfig struct {
+	Mechanism string `mapstructure:"mechanism"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// TopicOverride names the topic events of one type are published to and
+// consumed from, and the encoding they are published with. Empty fields keep
+// the defaults.
+type TopicOverride struct {
+	Event    string `mapstructure:"event"`
+	Topic    string `mapstructure:"topic"`
+	Encoding string `mapstructure:"encoding"`
+}
+
+// Topic returns the topic events of eventType are published to and consumed
+// from. By default that is the event type itself, as for the shared topics.
+func (c KafkaConfig) Topic(eventType string) string {
+	for _, override := range c.Topics {
+		if override.Event == eventType && override.Topic != "" {
+			return override.Topic
+		}
+	}
+	return c.TopicPrefix + eventType
+}
+
+// EventEncoding returns the encoding events of eventType are published with.
+func (c KafkaConfig) EventEncoding(eventType string) string {
+	for _, override := range c.Topics {
+		if override.Event == eventType && override.Encoding != "" {
+			return override.Encoding
+		}
+	}
+	return c.Encoding
 }
 
 type PostgresConfig struct {
-	DSN string
+	DSN string `mapstructure:"dsn"`
+	// DSNSource, when set, returns the current DSN for every new connection,
+	// so that rotated credentials are picked up.
+	DSNSource func(ctx context.Context) (string, error) `mapstructure:"-"`
+
+	// StatementTimeout is enforced by the server on every statement;
+	// FetchTimeout, WriteTimeout and StatsTimeout bound the review reads of
+	// a batch, the embedding and run writes, and counts and statistics.
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+	FetchTimeout     time.Duration `mapstructure:"fetch_timeout"`
+	WriteTimeout     time.Duration `mapstructure:"write_timeout"`
+	StatsTimeout     time.Duration `mapstructure:"stats_timeout"`
 }
 
 type ProcessingConfig struct {
-	BatchSize       int
-	TimeoutPerBatch time.Duration
+	BatchSize       int           `mapstructure:"batch_size"`
+	TimeoutPerBatch time.Duration `mapstructure:"timeout_seconds"`
+	Workers         int           `mapstructure:"workers"`
+	QueueSize       int           `mapstructure:"queue_size"`
+	ProgressEvery   int           `mapstructure:"progress_every_batches"`
+	// ShutdownGrace is how long a run may take on shutdown to embed and
+	// store the batches it already fetched.
+	ShutdownGrace time.Duration `mapstructure:"shutdown_grace"`
+	// DeadlineMargin is how long before a request's deadline its run stops
+	// fetching, leaving it that long to embed and store the batches it
+	// already fetched and to report.
+	DeadlineMargin time.Duration `mapstructure:"deadline_margin"`
+	// EmbedSlots caps the batches embedded at once by all runs of the
+	// process, handing free slots to single reviews first, then requested
+	// runs, then scheduled ones; 0 lets every worker embed right away.
+	EmbedSlots int `mapstructure:"embed_slots"`
 }
 
 type VectorizerConfig struct {
-	Model           string
-	BatchSize       int
-	TimeoutPerBatch time.Duration
-	MaxVectorLength int
+	Model                 string        `mapstructure:"model"`
+	BatchSize             int           `mapstructure:"batch_size"`
+	TimeoutPerBatch       time.Duration `mapstructure:"timeout_seconds"`
+	MaxVectorLength       int           `mapstructure:"max_vector_length"`
+	PricePerMillionTokens float64       `mapstructure:"price_per_million_tokens"`
+	TextSource            string        `mapstructure:"text_source"`
+	EmbedTitles           bool          `mapstructure:"embed_titles"`
+	EmbedResponses        bool          `mapstructure:"embed_responses"`
+	ChunkMaxTokens        int           `mapstructure:"chunk_max_tokens"`
+	ChunkOverlapTokens    int           `mapstructure:"chunk_overlap_tokens"`
+	DedupeCacheSize       int           `mapstructure:"dedupe_cache_size"`
+	// Normalize scales vectors to unit length before they are stored.
+	Normalize bool `mapstructure:"normalize"`
+	// SkipUnchanged skips reviews whose stored embedding was made with the
+	// current model from the same texts and settings, even in
+	// force_recompute runs.
+	SkipUnchanged bool `mapstructure:"skip_unchanged"`
+	// ModelPollInterval is how often serve checks whether a model migration
+	// made another model current.
+	ModelPollInterval time.Duration `mapstructure:"model_poll_interval"`
+	// InputTemplates wrap the texts sent to particular models.
+	InputTemplates []InputTemplate `mapstructure:"input_templates"`
+	// Pricing overrides PricePerMillionTokens for particular models.
+	Pricing []ModelPrice `mapstructure:"pricing"`
+	// Autotune adapts BatchSize to the provider while runs go on.
+	Autotune AutotuneConfig `mapstructure:"autotune"`
+}
+
+// AutotuneConfig bounds the batch sizes tried by batch-size auto-tuning.
+type AutotuneConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	MinBatchSize int  `mapstructure:"min_batch_size"`
+	MaxBatchSize int  `mapstructure:"max_batch_size"`
+	// TargetLatency is the embedding time per batch aimed at: batches
+	// embedded in under half of it grow, slower ones shrink.
+	TargetLatency time.Duration `mapstructure:"target_latency"`
+}
+
+// ModelPrice is the provider price of one model.
+type ModelPrice struct {
+	Model                 string  `mapstructure:"model"`
+	PricePerMillionTokens float64 `mapstructure:"price_per_million_tokens"`
+}
+
+// Price returns the price in USD per million tokens of model, from Pricing
+// or else PricePerMillionTokens.
+func (c VectorizerConfig) Price(model string) float64 {
+	for _, price := range c.Pricing {
+		if price.Model == model {
+			return price.PricePerMillionTokens
+		}
+	}
+	return c.PricePerMillionTokens
+}
+
+// InputTemplate wraps the texts sent to one model, for instruct-style models
+// such as e5 or bge that expect a prefix like "passage: " or "query: ".
+// "{text}" in a template stands for the text; an empty template sends texts
+// as they are.
+type InputTemplate struct {
+	Model string `mapstructure:"model"`
+	// Document wraps review texts, responses, titles and translations.
+	Document string `mapstructure:"document"`
+	// Query wraps search texts.
+	Query string `mapstructure:"query"`
+}
+
+// InputTemplate returns the input template of model, if it has one.
+func (c VectorizerConfig) InputTemplate(model string) (InputTemplate, bool) {
+	for _, template := range c.InputTemplates {
+		if template.Model == model {
+			return template, true
+		}
+	}
+	return InputTemplate{}, false
 }
 
 type OpenAIConfig struct {
-	APIKey     string
-	BaseURL    string
-	Model      string
-	MaxRetries int
-	Timeout    time.Duration
+	APIKey     string          `mapstructure:"api_key"`
+	BaseURL    string          `mapstructure:"base_url"`
+	Model      string          `mapstructure:"model"`
+	MaxRetries int             `mapstructure:"max_retries"`
+	Timeout    time.Duration   `mapstructure:"timeout_seconds"`
+	RateLimit  RateLimitConfig `mapstructure:"rate_limit"`
+	// APIKeySource, when set, returns the current key for every request, so
+	// that a rotated key is picked up.
+	APIKeySource func(ctx context.Context) (string, error) `mapstructure:"-"`
+	// Throttle, when set, is called before every embedding request with its
+	// estimated tokens and blocks until the rate limits allow it.
+	Throttle func(ctx context.Context, tokens int) error `mapstructure:"-"`
+}
+
+// RateLimitConfig caps the embedding requests and tokens sent to OpenAI per
+// minute, across all workers; 0 leaves a limit off. With Shared, replicas
+// count against the same limits through Postgres.
+type RateLimitConfig struct {
+	TokensPerMinute   int  `mapstructure:"tokens_per_minute"`
+	RequestsPerMinute int  `mapstructure:"requests_per_minute"`
+	Shared            bool `mapstructure:"shared"`
+}
+
+// ClusteringConfig controls the k-means clustering of an app's embeddings.
+type ClusteringConfig struct {
+	K          int `mapstructure:"k"`
+	SampleSize int `mapstructure:"sample_size"`
+	BatchSize  int `mapstructure:"batch_size"`
+	Iterations int `mapstructure:"iterations"`
+	PageSize   int `mapstructure:"page_size"`
 }
 
-func Load() (*Config, error) {
-	viper.SetConfigName("config")
-	viper.SetConfigType("toml")
-	viper.AddConfigPath("/")
+// DuplicatesConfig controls near-duplicate review detection.
+type DuplicatesConfig struct {
+	Threshold float64 `mapstructure:"threshold"`
+	Neighbors int     `mapstructure:"neighbors"`
+	PageSize  int     `mapstructure:"page_size"`
+}
 
+// ProjectionConfig controls the 2D projections of an app's embeddings for
+// review maps.
+type ProjectionConfig struct {
+	SampleSize int `mapstructure:"sample_size"`
+	Iterations int `mapstructure:"iterations"`
+	PageSize   int `mapstructure:"page_size"`
+}
+
+// ShadowConfig controls shadow mode, where a candidate embedding model is run
+// next to the production one on a sample of reviews, to compare the two
+// before switching.
+type ShadowConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Model   string `mapstructure:"model"`
+	// SamplePercent is the share of reviews, from 0 to 100, embedded with
+	// Model as well. Reviews are picked by their ID, so the same reviews are
+	// sampled on every run.
+	SamplePercent float64 `mapstructure:"sample_percent"`
+}
+
+// ExportConfig controls embedding exports to and imports from object
+// storage. Credentials come from the standard AWS environment variables or
+// profile.
+type ExportConfig struct {
+	S3Endpoint  string `mapstructure:"s3_endpoint"`
+	S3Region    string `mapstructure:"s3_region"`
+	S3PathStyle bool   `mapstructure:"s3_path_style"`
+	PageSize    int    `mapstructure:"page_size"`
+}
+
+// SchedulerConfig controls incremental vectorization on cron schedules.
+type SchedulerConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Timezone string        `mapstructure:"timezone"`
+	Jobs     []ScheduleJob `mapstructure:"jobs"`
+	// SpendReportCron publishes the previous month's spend report as a
+	// pipeline.spend_report event; empty disables it.
+	SpendReportCron string `mapstructure:"spend_report_cron"`
+	// ArchiveCron archives old embeddings, see ArchiveConfig; empty
+	// disables it.
+	ArchiveCron string `mapstructure:"archive_cron"`
+	// DriftCron checks every app's recent embeddings for drift, see
+	// DriftConfig; empty disables it.
+	DriftCron string `mapstructure:"drift_cron"`
+}
+
+// ScheduleJob is one cron schedule; an empty AppID covers every app.
+type ScheduleJob struct {
+	Cron      string   `mapstructure:"cron"`
+	AppID     string   `mapstructure:"app_id"`
+	Countries []string `mapstructure:"countries"`
+	Languages []string `mapstructure:"languages"`
+}
+
+// LoggingConfig controls the log format, level and sampling.
+type LoggingConfig struct {
+	Format      string `mapstructure:"format"`
+	Level       string `mapstructure:"level"`
+	SampleEvery int    `mapstructure:"sample_every"`
+}
+
+// TracingConfig controls OpenTelemetry trace export over OTLP HTTP.
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	ServiceName string  `mapstructure:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// ErrorReportingConfig controls where run failures, handler panics and
+// embedding provider errors are reported besides the log: to Sentry when
+// SentryDSN is set, and as JSON to WebhookURL when that is set.
+type ErrorReportingConfig struct {
+	SentryDSN   string        `mapstructure:"sentry_dsn"`
+	WebhookURL  string        `mapstructure:"webhook_url"`
+	Environment string        `mapstructure:"environment"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+}
+
+// Enabled reports whether errors are reported anywhere.
+func (c ErrorReportingConfig) Enabled() bool {
+	return c.SentryDSN != "" || c.WebhookURL != ""
+}
+
+// HTTPConfig controls the admin API server.
+type HTTPConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Addr    string `mapstructure:"addr"`
+}
+
+// CDCConfig controls near-real-time vectorization of reviews announced on a
+// Postgres NOTIFY channel.
+type CDCConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Channel       string        `mapstructure:"channel"`
+	BatchSize     int           `mapstructure:"batch_size"`
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// OutboxConfig controls the relay publishing the events queued in the outbox
+// together with the run results they announce.
+type OutboxConfig struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	Retention    time.Duration `mapstructure:"retention"`
+}
+
+// searchPaths are the directories searched for a config file, in order.
+var searchPaths = []string{"/", "/etc/review-vectorizer", "."}
+
+// Load reads the configuration from the given files, each overriding the
+// settings of the ones before it, or, without any, from config.toml,
+// config.yaml or config.json in the first of the search paths that has one.
+// The format follows the file extension. Every key can be overridden by an
+// environment variable named after it in upper case with dots replaced by
+// underscores, e.g. KAFKA_BROKERS or VECTORIZER_MODEL; lists are
+// comma-separated.
+// FlagsConfig toggles features that are rolled out per environment. The
+// flags are read again when the config file changes.
+type FlagsConfig struct {
+	// ResponseVectors embeds developer responses into response_vec, unless
+	// vectorizer.embed_responses is off.
+	ResponseVectors bool `mapstructure:"enable_response_vectors"`
+	// TitleVectors embeds review titles into title_vec; it defaults to
+	// vectorizer.embed_titles.
+	TitleVectors bool `mapstructure:"enable_title_vectors"`
+	// TranslationVectors embeds the English translation of reviews that
+	// have one into content_en_vec, next to content_vec.
+	TranslationVectors bool `mapstructure:"enable_translation_vectors"`
+	// Cache reuses the vectors of texts embedded earlier in a run.
+	Cache bool `mapstructure:"enable_cache"`
+	// UsageEvents publishes the provider usage of every batch as a
+	// metrics.embedding_usage event.
+	UsageEvents bool `mapstructure:"enable_usage_events"`
+	// Maintenance defers every request instead of handling it, see
+	// kafka.maintenance_backoff.
+	Maintenance bool `mapstructure:"maintenance_mode"`
+}
+
+// CacheConfig points at a Redis shared by all replicas that remembers the
+// vectors of embedded texts for TTL, keyed by model and text hash, while
+// flags.enable_cache is on. Without RedisURL, texts are only remembered
+// within a run.
+type CacheConfig struct {
+	RedisURL  string        `mapstructure:"redis_url"`
+	TTL       time.Duration `mapstructure:"ttl"`
+	KeyPrefix string        `mapstructure:"key_prefix"`
+}
+
+// PartitioningConfig splits the apps among the replicas for events every
+// replica receives: apps are hashed into Partitions partitions, which are
+// dealt out to the replicas heartbeating in vectorize_replicas, and each
+// replica only vectorizes the apps of its own partitions.
+type PartitioningConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// ReplicaID names the replica; it defaults to the host name.
+	ReplicaID         string        `mapstructure:"replica_id"`
+	Partitions        int           `mapstructure:"partitions"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// ReplicaTTL is how long after its last heartbeat a replica is
+	// considered gone and its partitions are dealt out again.
+	ReplicaTTL time.Duration `mapstructure:"replica_ttl"`
+}
+
+// LeaderElectionConfig lets a single replica, the one holding the Postgres
+// advisory lock derived from Key, run the scheduler and the outbox purge.
+// Without it, every replica runs them.
+type LeaderElectionConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Key     string `mapstructure:"key"`
+	// CheckInterval is how often a follower tries to take the lead and the
+	// leader checks that it still holds it.
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+// PreprocessingConfig selects the steps review texts, responses, titles and
+// search texts go through before they are embedded. Changing them changes
+// the content hash of the affected reviews, so they are embedded again.
+type PreprocessingConfig struct {
+	// NormalizeUnicode brings texts into Unicode normalization form C.
+	NormalizeUnicode bool `mapstructure:"normalize_unicode"`
+	// StripMarkup removes HTML tags and markdown syntax.
+	StripMarkup bool `mapstructure:"strip_markup"`
+	// Emoji is "keep" or "remove".
+	Emoji              string `mapstructure:"emoji"`
+	CollapseWhitespace bool   `mapstructure:"collapse_whitespace"`
+	// MaxLength truncates texts to this many characters; 0 keeps them whole.
+	MaxLength int `mapstructure:"max_length"`
+
+	// Reviews whose processed text has fewer than MinTokens words, a share
+	// of letters below MinLetterRatio, or a share of characters repeated
+	// three or more times in a row above MaxRepeatedRatio are skipped. 0
+	// disables a threshold.
+	MinTokens        int     `mapstructure:"min_tokens"`
+	MinLetterRatio   float64 `mapstructure:"min_letter_ratio"`
+	MaxRepeatedRatio float64 `mapstructure:"max_repeated_ratio"`
+
+	// AllowedLanguages, when set, are the only review languages embedded;
+	// DeniedLanguages are never embedded. Both apply to every run on top of
+	// its languages filter.
+	AllowedLanguages []string `mapstructure:"allowed_languages"`
+	DeniedLanguages  []string `mapstructure:"denied_languages"`
+}
+
+// RedactionConfig replaces personal data in every text sent to the
+// embedding provider with a placeholder such as "[EMAIL]".
+type RedactionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Emails  bool `mapstructure:"emails"`
+	Phones  bool `mapstructure:"phones"`
+	// OrderIDPattern is a regular expression matching order IDs; empty
+	// leaves them alone.
+	OrderIDPattern string `mapstructure:"order_id_pattern"`
+	// NamePatterns are regular expressions matching names, e.g. of the
+	// signatures support staff put under responses.
+	NamePatterns []string `mapstructure:"name_patterns"`
+}
+
+// BackpressureConfig slows down the storing of batches while Postgres is
+// overloaded: its replication lag exceeds MaxReplicationLag or more than
+// MaxActiveConnections sessions are running a query. 0 disables a threshold.
+type BackpressureConfig struct {
+	MaxReplicationLag    time.Duration `mapstructure:"max_replication_lag"`
+	MaxActiveConnections int           `mapstructure:"max_active_connections"`
+	// CheckInterval is how often the load is sampled.
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// MaxDelay caps the pause before each batch, which doubles at every
+	// check the database is still overloaded and halves once it is not.
+	MaxDelay time.Duration `mapstructure:"max_delay"`
+}
+
+// RetryConfig is the backoff shared by embedding requests, database writes
+// and Kafka publishes: up to MaxAttempts attempts in all, waiting BaseDelay
+// after the first failure and twice as long after every further one, up to
+// MaxDelay, spread by up to Jitter (a fraction) either way.
+type RetryConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	BaseDelay   time.Duration `mapstructure:"base_delay"`
+	MaxDelay    time.Duration `mapstructure:"max_delay"`
+	Jitter      float64       `mapstructure:"jitter"`
+}
+
+// ArchiveConfig moves embeddings last made OlderThanMonths months ago out of
+// review_embeddings into a compressed archive table, BatchSize rows per
+// transaction. 0 months disables archiving.
+type ArchiveConfig struct {
+	OlderThanMonths int `mapstructure:"older_than_months"`
+	BatchSize       int `mapstructure:"batch_size"`
+}
+
+// SparseConfig turns on sparse companion vectors, stored in sparse_vec next
+// to content_vec. Provider "bm25" weighs the terms of each text locally,
+// hashed into Dimensions dimensions; "http" asks a sparse embedding server
+// such as a SPLADE model behind text-embeddings-inference at URL, whose
+// vocabulary size is Dimensions.
+type SparseConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Provider   string        `mapstructure:"provider"`
+	URL        string        `mapstructure:"url"`
+	Dimensions int           `mapstructure:"dimensions"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// RerankConfig sets up the rerank stage text searches can ask for. Provider
+// "cohere" calls the Cohere Rerank API at URL with Model and APIKey; "http"
+// posts to a self-hosted cross-encoder at URL answering like the /rerank
+// route of text-embeddings-inference. The top Candidates vector hits are
+// reranked unless a search asks for another number. An empty provider
+// leaves reranking off.
+type RerankConfig struct {
+	Provider   string        `mapstructure:"provider"`
+	URL        string        `mapstructure:"url"`
+	APIKey     string        `mapstructure:"api_key"`
+	Model      string        `mapstructure:"model"`
+	Candidates int           `mapstructure:"candidates"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+}
+
+// DriftConfig sets up the embedding drift monitor, which compares the
+// content vectors an app got in the last Window with a baseline sample of
+// the same model, to catch a provider silently updating a model. Up to
+// SampleSize of the most recent vectors are sampled, and apps with fewer
+// than MinSamples are left alone. An app drifts when the cosine distance
+// between the mean vectors exceeds MeanThreshold, or the total variation
+// distance between the histograms of vector norms exceeds NormThreshold.
+type DriftConfig struct {
+	Window        time.Duration `mapstructure:"window"`
+	SampleSize    int           `mapstructure:"sample_size"`
+	MinSamples    int           `mapstructure:"min_samples"`
+	MeanThreshold float64       `mapstructure:"mean_threshold"`
+	NormThreshold float64       `mapstructure:"norm_threshold"`
+}
+
+// ArtifactsConfig controls the bundle written for every completed saga run:
+// its manifest, processed and failed review IDs and usage, under
+// Destination/<saga_id>/. Destination is an s3:// or gs:// prefix or a
+// local directory, written with the export settings; empty leaves the
+// processed review IDs in Postgres only.
+type ArtifactsConfig struct {
+	Destination string        `mapstructure:"destination"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	PageSize    int           `mapstructure:"page_size"`
+}
+
+// QuotasConfig caps what runs may embed per calendar month (UTC).
+type QuotasConfig struct {
+	Limits []Quota `mapstructure:"limits"`
+}
+
+// Quota caps the tokens and reviews embedded in a month for one app or one
+// tenant; 0 leaves a limit off.
+type Quota struct {
+	AppID          string `mapstructure:"app_id"`
+	TenantID       string `mapstructure:"tenant_id"`
+	MonthlyTokens  int64  `mapstructure:"monthly_tokens"`
+	MonthlyReviews int64  `mapstructure:"monthly_reviews"`
+}
+
+// Scope names what the quota applies to, e.g. "app com.example.app".
+func (q Quota) Scope() string {
+	if q.TenantID != "" {
+		return "tenant " + q.TenantID
+	}
+	return "app " + q.AppID
+}
+
+// SecretsConfig controls how secret references in OPENAI_API_KEY and PG_DSN
+// are resolved: "vault:<path>#<field>" reads a field of a Vault secret,
+// "aws-sm:<secret id>[#<field>]" an AWS Secrets Manager secret or a field of
+// its JSON value. Resolved secrets are fetched again after RefreshInterval.
+type SecretsConfig struct {
+	RefreshInterval time.Duration    `mapstructure:"refresh_interval"`
+	Vault           VaultConfig      `mapstructure:"vault"`
+	AWS             AWSSecretsConfig `mapstructure:"aws"`
+}
+
+// VaultConfig locates Vault and authenticates with a token or, when
+// KubernetesRole is set, with the pod's service account.
+type VaultConfig struct {
+	Address         string `mapstructure:"address"`
+	Token           string `mapstructure:"token"`
+	Namespace       string `mapstructure:"namespace"`
+	KubernetesRole  string `mapstructure:"kubernetes_role"`
+	KubernetesMount string `mapstructure:"kubernetes_mount"`
+}
+
+// AWSSecretsConfig selects the AWS Secrets Manager region; credentials come
+// from the standard AWS environment variables, profile or instance role.
+type AWSSecretsConfig struct {
+	Region string `mapstructure:"region"`
+}
+
+func Load(paths ...string) (*Config, error) {
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
-	if err := viper.ReadInConfig(); err != nil {
-		fmt.Printf("Warning: No config file found, using defaults: %v\n", err)
+	if err := readConfigFiles(paths); err != nil {
+		return nil, err
 	}
 
+	return build()
+}
+
+// build assembles the configuration from the files read and the
+// environment.
+func build() (*Config, error) {
 	viper.BindEnv("OPENAI_API_KEY")
 	viper.BindEnv("PG_DSN")
+	viper.BindEnv("KAFKA_SASL_PASSWORD")
+	viper.BindEnv("SCHEMA_REGISTRY_PASSWORD")
+	viper.BindEnv("VAULT_TOKEN")
+	viper.BindEnv("error_reporting.sentry_dsn", "SENTRY_DSN")
+
+	viper.SetDefault("vectorizer.skip_unchanged", true)
+	viper.SetDefault("vectorizer.embed_responses", true)
+	viper.SetDefault("preprocessing.collapse_whitespace", true)
+	viper.SetDefault("redaction.emails", true)
+	viper.SetDefault("redaction.phones", true)
+	viper.SetDefault("flags.enable_response_vectors", true)
+	viper.SetDefault("flags.enable_title_vectors", viper.GetBool("vectorizer.embed_titles"))
+	viper.SetDefault("flags.enable_cache", true)
 
 	var config = &Config{
 		Kafka: KafkaConfig{
-			Brokers: viper.GetStringSlice("kafka.brokers"),
-			GroupID: viper.GetString("kafka.group_id"),
+			Brokers:            getStringSlice("kafka.brokers"),
+			GroupID:            viper.GetString("kafka.group_id"),
+			MaxAttempts:        viper.GetInt("kafka.max_attempts"),
+			RetryBackoff:       viper.GetDuration("kafka.retry_backoff"),
+			RetryBackoffMax:    viper.GetDuration("kafka.retry_backoff_max"),
+			RetryBackoffFactor: viper.GetFloat64("kafka.retry_backoff_factor"),
+			MaintenanceBackoff: viper.GetDuration("kafka.maintenance_backoff"),
+			TopicPrefix:        viper.GetString("kafka.topic_prefix"),
+			SessionTimeout:     viper.GetDuration("kafka.session_timeout"),
+			RebalanceTimeout:   viper.GetDuration("kafka.rebalance_timeout"),
+			FetchMinBytes:      viper.GetInt("kafka.fetch_min_bytes"),
+			FetchMaxBytes:      viper.GetInt("kafka.fetch_max_bytes"),
+			FetchMaxWait:       viper.GetDuration("kafka.fetch_max_wait"),
+			StartOffset:        viper.GetString("kafka.start_offset"),
+			PropagateHeaders:   getStringSlice("kafka.propagate_headers"),
+			Headers:            viper.GetStringMapString("kafka.headers"),
+			Encoding:           viper.GetString("kafka.encoding"),
+			SchemaRegistry: SchemaRegistryConfig{
+				URL:      viper.GetString("kafka.schema_registry.url"),
+				Username: viper.GetString("kafka.schema_registry.username"),
+				Password: viper.GetString("SCHEMA_REGISTRY_PASSWORD"),
+				CacheTTL: viper.GetDuration("kafka.schema_registry.cache_ttl"),
+			},
+			TLS: KafkaTLSConfig{
+				Enabled:            viper.GetBool("kafka.tls.enabled"),
+				CAFile:             viper.GetString("kafka.tls.ca_file"),
+				CertFile:           viper.GetString("kafka.tls.cert_file"),
+				KeyFile:            viper.GetString("kafka.tls.key_file"),
+				InsecureSkipVerify: viper.GetBool("kafka.tls.insecure_skip_verify"),
+			},
+			SASL: KafkaSASLConfig{
+				Mechanism: viper.GetString("kafka.sasl.mechanism"),
+				Username:  viper.GetString("kafka.sasl.username"),
+				Password:  viper.GetString("KAFKA_SASL_PASSWORD"),
+			},
 		},
 		Postgres: PostgresConfig{
-			DSN: viper.GetString("PG_DSN"),
+			DSN:              viper.GetString("PG_DSN"),
+			StatementTimeout: viper.GetDuration("postgres.statement_timeout"),
+			FetchTimeout:     viper.GetDuration("postgres.fetch_timeout"),
+			WriteTimeout:     viper.GetDuration("postgres.write_timeout"),
+			StatsTimeout:     viper.GetDuration("postgres.stats_timeout"),
 		},
 		Processing: ProcessingConfig{
 			BatchSize:       viper.GetInt("processing.batch_size"),
 			TimeoutPerBatch: viper.GetDuration("processing.timeout_seconds"),
+			Workers:         viper.GetInt("processing.workers"),
+			QueueSize:       viper.GetInt("processing.queue_size"),
+			ProgressEvery:   viper.GetInt("processing.progress_every_batches"),
+			ShutdownGrace:   viper.GetDuration("processing.shutdown_grace"),
+			DeadlineMargin:  viper.GetDuration("processing.deadline_margin"),
+			EmbedSlots:      viper.GetInt("processing.embed_slots"),
 		},
 		Vectorizer: VectorizerConfig{
-			Model:           viper.GetString("vectorizer.model"),
-			BatchSize:       viper.GetInt("vectorizer.batch_size"),
-			MaxVectorLength: viper.GetInt("vectorizer.max_vector_length"),
-			TimeoutPerBatch: viper.GetDuration("vectorizer.timeout_seconds"),
+			Model:                 viper.GetString("vectorizer.model"),
+			BatchSize:             viper.GetInt("vectorizer.batch_size"),
+			MaxVectorLength:       viper.GetInt("vectorizer.max_vector_length"),
+			TimeoutPerBatch:       viper.GetDuration("vectorizer.timeout_seconds"),
+			PricePerMillionTokens: viper.GetFloat64("vectorizer.price_per_million_tokens"),
+			TextSource:            viper.GetString("vectorizer.text_source"),
+			EmbedTitles:           viper.GetBool("vectorizer.embed_titles"),
+			EmbedResponses:        viper.GetBool("vectorizer.embed_responses"),
+			ChunkMaxTokens:        viper.GetInt("vectorizer.chunk_max_tokens"),
+			ChunkOverlapTokens:    viper.GetInt("vectorizer.chunk_overlap_tokens"),
+			DedupeCacheSize:       viper.GetInt("vectorizer.dedupe_cache_size"),
+			Normalize:             viper.GetBool("vectorizer.normalize"),
+			SkipUnchanged:         viper.GetBool("vectorizer.skip_unchanged"),
+			ModelPollInterval:     viper.GetDuration("vectorizer.model_poll_interval"),
+			Autotune: AutotuneConfig{
+				Enabled:       viper.GetBool("vectorizer.autotune.enabled"),
+				MinBatchSize:  viper.GetInt("vectorizer.autotune.min_batch_size"),
+				MaxBatchSize:  viper.GetInt("vectorizer.autotune.max_batch_size"),
+				TargetLatency: viper.GetDuration("vectorizer.autotune.target_latency"),
+			},
 		},
 		OpenAI: OpenAIConfig{
 			APIKey:     viper.GetString("OPENAI_API_KEY"),
@@ -82,8 +764,259 @@ func Load() (*Config, error) {
 			Model:      viper.GetString("openai.model"),
 			MaxRetries: viper.GetInt("openai.max_retries"),
 			Timeout:    viper.GetDuration("openai.timeout_seconds"),
+			RateLimit: RateLimitConfig{
+				TokensPerMinute:   viper.GetInt("openai.rate_limit.tokens_per_minute"),
+				RequestsPerMinute: viper.GetInt("openai.rate_limit.requests_per_minute"),
+				Shared:            viper.GetBool("openai.rate_limit.shared"),
+			},
+		},
+		CDC: CDCConfig{
+			Enabled:       viper.GetBool("cdc.enabled"),
+			Channel:       viper.GetString("cdc.channel"),
+			BatchSize:     viper.GetInt("cdc.batch_size"),
+			FlushInterval: viper.GetDuration("cdc.flush_interval"),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: viper.GetDuration("outbox.poll_interval"),
+			BatchSize:    viper.GetInt("outbox.batch_size"),
+			Retention:    viper.GetDuration("outbox.retention"),
+		},
+		Secrets: SecretsConfig{
+			RefreshInterval: viper.GetDuration("secrets.refresh_interval"),
+			Vault: VaultConfig{
+				Address:         viper.GetString("secrets.vault.address"),
+				Token:           viper.GetString("VAULT_TOKEN"),
+				Namespace:       viper.GetString("secrets.vault.namespace"),
+				KubernetesRole:  viper.GetString("secrets.vault.kubernetes_role"),
+				KubernetesMount: viper.GetString("secrets.vault.kubernetes_mount"),
+			},
+			AWS: AWSSecretsConfig{
+				Region: viper.GetString("secrets.aws.region"),
+			},
+		},
+		Flags: FlagsConfig{
+			ResponseVectors:    viper.GetBool("flags.enable_response_vectors"),
+			TitleVectors:       viper.GetBool("flags.enable_title_vectors"),
+			TranslationVectors: viper.GetBool("flags.enable_translation_vectors"),
+			Cache:              viper.GetBool("flags.enable_cache"),
+			UsageEvents:        viper.GetBool("flags.enable_usage_events"),
+			Maintenance:        viper.GetBool("flags.maintenance_mode"),
+		},
+		Shadow: ShadowConfig{
+			Enabled:       viper.GetBool("shadow.enabled"),
+			Model:         viper.GetString("shadow.model"),
+			SamplePercent: viper.GetFloat64("shadow.sample_percent"),
+		},
+		Cache: CacheConfig{
+			RedisURL:  viper.GetString("cache.redis_url"),
+			TTL:       viper.GetDuration("cache.ttl"),
+			KeyPrefix: viper.GetString("cache.key_prefix"),
+		},
+		Partitioning: PartitioningConfig{
+			Enabled:           viper.GetBool("partitioning.enabled"),
+			ReplicaID:         viper.GetString("partitioning.replica_id"),
+			Partitions:        viper.GetInt("partitioning.partitions"),
+			HeartbeatInterval: viper.GetDuration("partitioning.heartbeat_interval"),
+			ReplicaTTL:        viper.GetDuration("partitioning.replica_ttl"),
+		},
+		Preprocessing: PreprocessingConfig{
+			NormalizeUnicode:   viper.GetBool("preprocessing.normalize_unicode"),
+			StripMarkup:        viper.GetBool("preprocessing.strip_markup"),
+			Emoji:              viper.GetString("preprocessing.emoji"),
+			CollapseWhitespace: viper.GetBool("preprocessing.collapse_whitespace"),
+			MaxLength:          viper.GetInt("preprocessing.max_length"),
+			MinTokens:          viper.GetInt("preprocessing.min_tokens"),
+			MinLetterRatio:     viper.GetFloat64("preprocessing.min_letter_ratio"),
+			MaxRepeatedRatio:   viper.GetFloat64("preprocessing.max_repeated_ratio"),
+			AllowedLanguages:   getStringSlice("preprocessing.allowed_languages"),
+			DeniedLanguages:    getStringSlice("preprocessing.denied_languages"),
+		},
+		Redaction: RedactionConfig{
+			Enabled:        viper.GetBool("redaction.enabled"),
+			Emails:         viper.GetBool("redaction.emails"),
+			Phones:         viper.GetBool("redaction.phones"),
+			OrderIDPattern: viper.GetString("redaction.order_id_pattern"),
+			NamePatterns:   viper.GetStringSlice("redaction.name_patterns"),
+		},
+		Retry: RetryConfig{
+			MaxAttempts: viper.GetInt("retry.max_attempts"),
+			BaseDelay:   viper.GetDuration("retry.base_delay"),
+			MaxDelay:    viper.GetDuration("retry.max_delay"),
+			Jitter:      viper.GetFloat64("retry.jitter"),
+		},
+		Backpressure: BackpressureConfig{
+			MaxReplicationLag:    viper.GetDuration("backpressure.max_replication_lag"),
+			MaxActiveConnections: viper.GetInt("backpressure.max_active_connections"),
+			CheckInterval:        viper.GetDuration("backpressure.check_interval"),
+			MaxDelay:             viper.GetDuration("backpressure.max_delay"),
+		},
+		LeaderElection: LeaderElectionConfig{
+			Enabled:       viper.GetBool("leader_election.enabled"),
+			Key:           viper.GetString("leader_election.key"),
+			CheckInterval: viper.GetDuration("leader_election.check_interval"),
 		},
+		HTTP: HTTPConfig{
+			Enabled: viper.GetBool("http.enabled"),
+			Addr:    viper.GetString("http.addr"),
+		},
+		Tracing: TracingConfig{
+			Enabled:     viper.GetBool("tracing.enabled"),
+			Endpoint:    viper.GetString("tracing.endpoint"),
+			ServiceName: viper.GetString("tracing.service_name"),
+			SampleRatio: viper.GetFloat64("tracing.sample_ratio"),
+		},
+		ErrorReporting: ErrorReportingConfig{
+			SentryDSN:   viper.GetString("error_reporting.sentry_dsn"),
+			WebhookURL:  viper.GetString("error_reporting.webhook_url"),
+			Environment: viper.GetString("error_reporting.environment"),
+			Timeout:     viper.GetDuration("error_reporting.timeout"),
+		},
+		Logging: LoggingConfig{
+			Format:      viper.GetString("logging.format"),
+			Level:       viper.GetString("logging.level"),
+			SampleEvery: viper.GetInt("logging.sample_every"),
+		},
+		Clustering: ClusteringConfig{
+			K:          viper.GetInt("clustering.k"),
+			SampleSize: viper.GetInt("clustering.sample_size"),
+			BatchSize:  viper.GetInt("clustering.batch_size"),
+			Iterations: viper.GetInt("clustering.iterations"),
+			PageSize:   viper.GetInt("clustering.page_size"),
+		},
+		Duplicates: DuplicatesConfig{
+			Threshold: viper.GetFloat64("duplicates.threshold"),
+			Neighbors: viper.GetInt("duplicates.neighbors"),
+			PageSize:  viper.GetInt("duplicates.page_size"),
+		},
+		Projection: ProjectionConfig{
+			SampleSize: viper.GetInt("projection.sample_size"),
+			Iterations: viper.GetInt("projection.iterations"),
+			PageSize:   viper.GetInt("projection.page_size"),
+		},
+		Export: ExportConfig{
+			S3Endpoint:  viper.GetString("export.s3_endpoint"),
+			S3Region:    viper.GetString("export.s3_region"),
+			S3PathStyle: viper.GetBool("export.s3_path_style"),
+			PageSize:    viper.GetInt("export.page_size"),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:         viper.GetBool("scheduler.enabled"),
+			Timezone:        viper.GetString("scheduler.timezone"),
+			SpendReportCron: viper.GetString("scheduler.spend_report_cron"),
+			ArchiveCron:     viper.GetString("scheduler.archive_cron"),
+			DriftCron:       viper.GetString("scheduler.drift_cron"),
+		},
+		Sparse: SparseConfig{
+			Enabled:    viper.GetBool("sparse.enabled"),
+			Provider:   viper.GetString("sparse.provider"),
+			URL:        viper.GetString("sparse.url"),
+			Dimensions: viper.GetInt("sparse.dimensions"),
+			Timeout:    viper.GetDuration("sparse.timeout"),
+		},
+		Rerank: RerankConfig{
+			Provider:   viper.GetString("rerank.provider"),
+			URL:        viper.GetString("rerank.url"),
+			APIKey:     viper.GetString("rerank.api_key"),
+			Model:      viper.GetString("rerank.model"),
+			Candidates: viper.GetInt("rerank.candidates"),
+			Timeout:    viper.GetDuration("rerank.timeout"),
+		},
+		Drift: DriftConfig{
+			Window:        viper.GetDuration("drift.window"),
+			SampleSize:    viper.GetInt("drift.sample_size"),
+			MinSamples:    viper.GetInt("drift.min_samples"),
+			MeanThreshold: viper.GetFloat64("drift.mean_threshold"),
+			NormThreshold: viper.GetFloat64("drift.norm_threshold"),
+		},
+		Artifacts: ArtifactsConfig{
+			Destination: viper.GetString("artifacts.destination"),
+			Timeout:     viper.GetDuration("artifacts.timeout"),
+			PageSize:    viper.GetInt("artifacts.page_size"),
+		},
+		Archive: ArchiveConfig{
+			OlderThanMonths: viper.GetInt("archive.older_than_months"),
+			BatchSize:       viper.GetInt("archive.batch_size"),
+		},
+	}
+
+	if err := viper.UnmarshalKey("kafka.topics", &config.Kafka.Topics); err != nil {
+		return nil, fmt.Errorf("invalid kafka topics: %w", err)
+	}
+
+	if err := viper.UnmarshalKey("scheduler.jobs", &config.Scheduler.Jobs); err != nil {
+		return nil, fmt.Errorf("invalid scheduler jobs: %w", err)
+	}
+
+	if err := viper.UnmarshalKey("vectorizer.input_templates", &config.Vectorizer.InputTemplates); err != nil {
+		return nil, fmt.Errorf("invalid input templates: %w", err)
+	}
+
+	if err := viper.UnmarshalKey("vectorizer.pricing", &config.Vectorizer.Pricing); err != nil {
+		return nil, fmt.Errorf("invalid vectorizer pricing: %w", err)
+	}
+
+	if err := viper.UnmarshalKey("quotas.limits", &config.Quotas.Limits); err != nil {
+		return nil, fmt.Errorf("invalid quotas: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
 	}
 
 	return config, nil
 }
+
+// configFiles are the files the configuration was read from, which Watch
+// watches.
+var configFiles []string
+
+func readConfigFiles(paths []string) error {
+	if len(paths) == 0 {
+		viper.SetConfigName("config")
+		for _, dir := range searchPaths {
+			viper.AddConfigPath(dir)
+		}
+
+		if err := viper.ReadInConfig(); err != nil {
+			var notFound viper.ConfigFileNotFoundError
+			if !errors.As(err, &notFound) {
+				return fmt.Errorf("failed to read config file: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: No config file found, using defaults: %v\n", err)
+			return nil
+		}
+		configFiles = []string{viper.ConfigFileUsed()}
+		return nil
+	}
+
+	for i, path := range paths {
+		viper.SetConfigFile(path)
+
+		read := viper.MergeInConfig
+		if i == 0 {
+			read = viper.ReadInConfig
+		}
+		if err := read(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	}
+	configFiles = paths
+	return nil
+}
+
+// getStringSlice returns a list setting, splitting a comma-separated value
+// as environment variables provide it.
+func getStringSlice(key string) []string {
+	value, ok := viper.Get(key).(string)
+	if !ok {
+		return viper.GetStringSlice(key)
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
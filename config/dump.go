@@ -0,0 +1,98 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// redacted replaces secrets in Dump.
+const redacted = "xxxxx"
+
+// dsnPassword matches the password of a keyword/value Postgres DSN.
+var dsnPassword = regexp.MustCompile(`password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Dump returns the configuration keyed like the config file, with defaults
+// applied and secrets redacted, for logging and the admin API.
+func (c *Config) Dump() map[string]any {
+	clean := *c
+	clean.Kafka.SASL.Password = redact(c.Kafka.SASL.Password)
+	clean.Kafka.SchemaRegistry.URL = redactURL(c.Kafka.SchemaRegistry.URL)
+	clean.Kafka.SchemaRegistry.Password = redact(c.Kafka.SchemaRegistry.Password)
+	clean.Postgres.DSN = redactDSN(c.Postgres.DSN)
+	clean.Cache.RedisURL = redactURL(c.Cache.RedisURL)
+	clean.OpenAI.APIKey = redact(c.OpenAI.APIKey)
+	clean.Secrets.Vault.Token = redact(c.Secrets.Vault.Token)
+	clean.ErrorReporting.SentryDSN = redact(c.ErrorReporting.SentryDSN)
+	clean.ErrorReporting.WebhookURL = redactURL(c.ErrorReporting.WebhookURL)
+	clean.Sparse.URL = redactURL(c.Sparse.URL)
+	clean.Rerank.URL = redactURL(c.Rerank.URL)
+	clean.Rerank.APIKey = redact(c.Rerank.APIKey)
+
+	return dumpValue(reflect.ValueOf(clean)).(map[string]any)
+}
+
+func dumpValue(v reflect.Value) any {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]any, v.NumField())
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			key := field.Tag.Get("mapstructure")
+			if key == "" || key == "-" || field.Type.Kind() == reflect.Func {
+				continue
+			}
+			fields[key] = dumpValue(v.Field(i))
+		}
+		return fields
+	case reflect.Slice:
+		items := make([]any, v.Len())
+		for i := range v.Len() {
+			items[i] = dumpValue(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// redactDSN hides the password of a URL or keyword/value Postgres DSN.
+func redactDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redacted
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return redactURL(u.String())
+	}
+	return dsnPassword.ReplaceAllString(dsn, "password="+redacted)
+}
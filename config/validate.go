@@ -0,0 +1,563 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Validate fills unset settings with the defaults documented in config.toml
+// and checks the rest, so that a broken configuration fails at startup
+// rather than deep inside a run. It reports every problem at once, each
+// prefixed with its configuration key.
+func (c *Config) Validate() error {
+	v := &validation{}
+
+	c.Kafka.validate(v)
+	c.Processing.validate(v)
+	c.Vectorizer.validate(v)
+	c.Preprocessing.validate(v)
+	c.Redaction.validate(v)
+	c.OpenAI.validate(v)
+	c.CDC.validate(v)
+	c.Outbox.validate(v)
+	c.HTTP.validate(v)
+	c.Tracing.validate(v)
+	c.Logging.validate(v)
+	c.Clustering.validate(v)
+	c.Duplicates.validate(v)
+	c.Projection.validate(v)
+	c.Export.validate(v)
+	c.Scheduler.validate(v)
+	c.Secrets.validate(v)
+	c.Shadow.validate(v, c.Vectorizer.Model)
+	c.Cache.validate(v)
+	c.Partitioning.validate(v)
+	c.LeaderElection.validate(v)
+	c.Backpressure.validate(v)
+	c.Quotas.validate(v)
+	c.Retry.validate(v)
+	c.Postgres.validate(v)
+	c.ErrorReporting.validate(v)
+	c.Archive.validate(v)
+	c.Sparse.validate(v)
+	c.Rerank.validate(v)
+	c.Drift.validate(v)
+	c.Artifacts.validate(v)
+
+	return errors.Join(v.errs...)
+}
+
+func (c *KafkaConfig) validate(v *validation) {
+	if len(c.Brokers) == 0 {
+		v.fail("kafka.brokers", "at least one broker is required")
+	}
+	for i, broker := range c.Brokers {
+		if strings.TrimSpace(broker) == "" {
+			v.fail(fmt.Sprintf("kafka.brokers[%d]", i), "must not be empty")
+		}
+	}
+
+	defaultString(&c.GroupID, "review-vectorizer")
+	v.positive("kafka.max_attempts", &c.MaxAttempts, 5)
+	v.duration("kafka.retry_backoff", &c.RetryBackoff, 30*time.Second)
+	v.duration("kafka.retry_backoff_max", &c.RetryBackoffMax, 30*time.Minute)
+	if c.RetryBackoffMax < c.RetryBackoff {
+		v.fail("kafka.retry_backoff_max", "must not be shorter than kafka.retry_backoff (%s)", c.RetryBackoff)
+	}
+	if c.RetryBackoffFactor == 0 {
+		c.RetryBackoffFactor = 2
+	}
+	if c.RetryBackoffFactor < 1 {
+		v.fail("kafka.retry_backoff_factor", "must be at least 1, got %v", c.RetryBackoffFactor)
+	}
+	v.duration("kafka.maintenance_backoff", &c.MaintenanceBackoff, time.Minute)
+
+	v.nonNegativeDuration("kafka.session_timeout", c.SessionTimeout)
+	v.nonNegativeDuration("kafka.rebalance_timeout", c.RebalanceTimeout)
+	v.nonNegativeDuration("kafka.fetch_max_wait", c.FetchMaxWait)
+	v.nonNegative("kafka.fetch_min_bytes", c.FetchMinBytes)
+	v.nonNegative("kafka.fetch_max_bytes", c.FetchMaxBytes)
+	if c.FetchMaxBytes > 0 && c.FetchMinBytes > c.FetchMaxBytes {
+		v.fail("kafka.fetch_min_bytes", "must not exceed kafka.fetch_max_bytes (%d)", c.FetchMaxBytes)
+	}
+
+	defaultString(&c.StartOffset, "earliest")
+	v.oneOf("kafka.start_offset", c.StartOffset, "earliest", "latest")
+
+	defaultString(&c.Encoding, "json")
+	c.validateEncoding(v, "kafka.encoding", c.Encoding)
+	for i, override := range c.Topics {
+		key := fmt.Sprintf("kafka.topics[%d]", i)
+		if override.Event == "" {
+			v.fail(key+".event", "is required")
+		}
+		if override.Encoding != "" {
+			c.validateEncoding(v, key+".encoding", override.Encoding)
+		}
+	}
+	v.duration("kafka.schema_registry.cache_ttl", &c.SchemaRegistry.CacheTTL, 5*time.Minute)
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		v.fail("kafka.tls", "cert_file and key_file must be set together")
+	}
+	if c.SASL.Mechanism != "" {
+		v.oneOf("kafka.sasl.mechanism", strings.ToUpper(c.SASL.Mechanism), "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512")
+		if c.SASL.Username == "" {
+			v.fail("kafka.sasl.username", "is required with kafka.sasl.mechanism")
+		}
+		if c.SASL.Password == "" {
+			v.fail("kafka.sasl", "KAFKA_SASL_PASSWORD is required with kafka.sasl.mechanism")
+		}
+	}
+}
+
+func (c *KafkaConfig) validateEncoding(v *validation, key, encoding string) {
+	if !v.oneOf(key, encoding, "json", "avro", "protobuf") {
+		return
+	}
+	if encoding != "json" && c.SchemaRegistry.URL == "" {
+		v.fail(key, "%s encoding requires kafka.schema_registry.url", encoding)
+	}
+}
+
+func (c *ProcessingConfig) validate(v *validation) {
+	v.positive("processing.batch_size", &c.BatchSize, 100)
+	v.duration("processing.timeout_seconds", &c.TimeoutPerBatch, 30*time.Second)
+	v.positive("processing.workers", &c.Workers, 4)
+	v.positive("processing.queue_size", &c.QueueSize, 8)
+	v.nonNegative("processing.progress_every_batches", c.ProgressEvery)
+	v.duration("processing.shutdown_grace", &c.ShutdownGrace, 30*time.Second)
+	v.duration("processing.deadline_margin", &c.DeadlineMargin, 30*time.Second)
+	v.nonNegative("processing.embed_slots", c.EmbedSlots)
+}
+
+func (c *VectorizerConfig) validate(v *validation) {
+	defaultString(&c.Model, "text-embedding-3-small")
+	v.positive("vectorizer.batch_size", &c.BatchSize, 50)
+	v.duration("vectorizer.timeout_seconds", &c.TimeoutPerBatch, 60*time.Second)
+	v.positive("vectorizer.max_vector_length", &c.MaxVectorLength, 1536)
+	if c.PricePerMillionTokens < 0 {
+		v.fail("vectorizer.price_per_million_tokens", "must not be negative, got %v", c.PricePerMillionTokens)
+	}
+
+	defaultString(&c.TextSource, "content_clean")
+	v.oneOf("vectorizer.text_source", c.TextSource, "content_clean", "content_en", "content_en_fallback")
+
+	v.nonNegative("vectorizer.chunk_max_tokens", c.ChunkMaxTokens)
+	v.nonNegative("vectorizer.chunk_overlap_tokens", c.ChunkOverlapTokens)
+	if c.ChunkMaxTokens > 0 && c.ChunkOverlapTokens >= c.ChunkMaxTokens {
+		v.fail("vectorizer.chunk_overlap_tokens", "must be below vectorizer.chunk_max_tokens (%d)", c.ChunkMaxTokens)
+	}
+	v.nonNegative("vectorizer.dedupe_cache_size", c.DedupeCacheSize)
+	v.duration("vectorizer.model_poll_interval", &c.ModelPollInterval, 30*time.Second)
+
+	models := make(map[string]bool)
+	for i, template := range c.InputTemplates {
+		key := fmt.Sprintf("vectorizer.input_templates[%d]", i)
+		if template.Model == "" {
+			v.fail(key+".model", "is required")
+		} else if models[template.Model] {
+			v.fail(key+".model", "duplicate template for %s", template.Model)
+		}
+		models[template.Model] = true
+		if template.Document != "" && !strings.Contains(template.Document, "{text}") {
+			v.fail(key+".document", "must contain {text}")
+		}
+		if template.Query != "" && !strings.Contains(template.Query, "{text}") {
+			v.fail(key+".query", "must contain {text}")
+		}
+	}
+
+	priced := make(map[string]bool)
+	for i, price := range c.Pricing {
+		key := fmt.Sprintf("vectorizer.pricing[%d]", i)
+		if price.Model == "" {
+			v.fail(key+".model", "is required")
+		} else if priced[price.Model] {
+			v.fail(key+".model", "duplicate price for %s", price.Model)
+		}
+		priced[price.Model] = true
+		if price.PricePerMillionTokens < 0 {
+			v.fail(key+".price_per_million_tokens", "must not be negative, got %v", price.PricePerMillionTokens)
+		}
+	}
+
+	v.positive("vectorizer.autotune.min_batch_size", &c.Autotune.MinBatchSize, 1)
+	v.positive("vectorizer.autotune.max_batch_size", &c.Autotune.MaxBatchSize, 4*c.BatchSize)
+	if c.Autotune.MaxBatchSize < c.Autotune.MinBatchSize {
+		v.fail("vectorizer.autotune.max_batch_size", "must not be below vectorizer.autotune.min_batch_size (%d)", c.Autotune.MinBatchSize)
+	}
+	v.duration("vectorizer.autotune.target_latency", &c.Autotune.TargetLatency, 5*time.Second)
+}
+
+func (c *OpenAIConfig) validate(v *validation) {
+	defaultString(&c.BaseURL, "https://api.openai.com/v1")
+	defaultString(&c.Model, "text-embedding-3-small")
+	v.nonNegative("openai.max_retries", c.MaxRetries)
+	v.duration("openai.timeout_seconds", &c.Timeout, 30*time.Second)
+	v.nonNegative("openai.rate_limit.tokens_per_minute", c.RateLimit.TokensPerMinute)
+	v.nonNegative("openai.rate_limit.requests_per_minute", c.RateLimit.RequestsPerMinute)
+}
+
+func (c *CDCConfig) validate(v *validation) {
+	if !c.Enabled {
+		return
+	}
+	defaultString(&c.Channel, "clean_reviews_changed")
+	v.positive("cdc.batch_size", &c.BatchSize, 100)
+	v.duration("cdc.flush_interval", &c.FlushInterval, 2*time.Second)
+}
+
+func (c *OutboxConfig) validate(v *validation) {
+	v.duration("outbox.poll_interval", &c.PollInterval, time.Second)
+	v.positive("outbox.batch_size", &c.BatchSize, 100)
+	v.nonNegativeDuration("outbox.retention", c.Retention)
+}
+
+func (c *HTTPConfig) validate(v *validation) {
+	if c.Enabled {
+		defaultString(&c.Addr, ":8080")
+	}
+}
+
+func (c *TracingConfig) validate(v *validation) {
+	defaultString(&c.ServiceName, "review-vectorizer")
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		v.fail("tracing.sample_ratio", "must be between 0 and 1, got %v", c.SampleRatio)
+	}
+}
+
+func (c *ErrorReportingConfig) validate(v *validation) {
+	v.duration("error_reporting.timeout", &c.Timeout, 5*time.Second)
+	if c.SentryDSN != "" {
+		u, err := url.Parse(c.SentryDSN)
+		if err != nil || u.User == nil || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			v.fail("error_reporting.sentry_dsn", "must look like https://<key>@<host>/<project>")
+		}
+	}
+}
+
+func (c *LoggingConfig) validate(v *validation) {
+	defaultString(&c.Level, "info")
+	v.oneOf("logging.level", strings.ToLower(c.Level), "debug", "info", "warn", "error")
+	if c.Format != "" {
+		v.oneOf("logging.format", strings.ToLower(c.Format), "text", "json")
+	}
+	v.nonNegative("logging.sample_every", c.SampleEvery)
+}
+
+func (c *ClusteringConfig) validate(v *validation) {
+	v.positive("clustering.k", &c.K, 20)
+	v.positive("clustering.sample_size", &c.SampleSize, 20000)
+	v.positive("clustering.batch_size", &c.BatchSize, 1024)
+	v.positive("clustering.iterations", &c.Iterations, 100)
+	v.positive("clustering.page_size", &c.PageSize, 1000)
+}
+
+func (c *DuplicatesConfig) validate(v *validation) {
+	if c.Threshold == 0 {
+		c.Threshold = 0.97
+	}
+	if c.Threshold < 0 || c.Threshold > 1 {
+		v.fail("duplicates.threshold", "must be between 0 and 1, got %v", c.Threshold)
+	}
+	v.positive("duplicates.neighbors", &c.Neighbors, 10)
+	v.positive("duplicates.page_size", &c.PageSize, 500)
+}
+
+func (c *ProjectionConfig) validate(v *validation) {
+	v.positive("projection.sample_size", &c.SampleSize, 5000)
+	v.positive("projection.iterations", &c.Iterations, 50)
+	v.positive("projection.page_size", &c.PageSize, 1000)
+}
+
+func (c *ExportConfig) validate(v *validation) {
+	defaultString(&c.S3Region, "us-east-1")
+	v.positive("export.page_size", &c.PageSize, 1000)
+}
+
+func (c *SchedulerConfig) validate(v *validation) {
+	defaultString(&c.Timezone, "UTC")
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		v.fail("scheduler.timezone", "unknown time zone %q", c.Timezone)
+	}
+	if !c.Enabled {
+		return
+	}
+	for i, job := range c.Jobs {
+		if strings.TrimSpace(job.Cron) == "" {
+			v.fail(fmt.Sprintf("scheduler.jobs[%d].cron", i), "is required")
+		}
+	}
+}
+
+func (c *SecretsConfig) validate(v *validation) {
+	v.duration("secrets.refresh_interval", &c.RefreshInterval, 5*time.Minute)
+	if c.Vault.KubernetesRole != "" {
+		defaultString(&c.Vault.KubernetesMount, "kubernetes")
+	}
+}
+
+func (c *ShadowConfig) validate(v *validation, productionModel string) {
+	if c.SamplePercent == 0 {
+		c.SamplePercent = 5
+	}
+	if c.SamplePercent < 0 || c.SamplePercent > 100 {
+		v.fail("shadow.sample_percent", "must be between 0 and 100, got %v", c.SamplePercent)
+	}
+	if !c.Enabled {
+		return
+	}
+	if c.Model == "" {
+		v.fail("shadow.model", "is required when shadow mode is enabled")
+	} else if c.Model == productionModel {
+		v.fail("shadow.model", "must differ from vectorizer.model (%s)", productionModel)
+	}
+}
+
+func (c *CacheConfig) validate(v *validation) {
+	if c.RedisURL == "" {
+		return
+	}
+	if u, err := url.Parse(c.RedisURL); err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		v.fail("cache.redis_url", "must be a redis:// or rediss:// URL")
+	}
+	v.duration("cache.ttl", &c.TTL, 7*24*time.Hour)
+	defaultString(&c.KeyPrefix, "review-vectorizer:vector:")
+}
+
+func (c *PartitioningConfig) validate(v *validation) {
+	v.positive("partitioning.partitions", &c.Partitions, 64)
+	v.duration("partitioning.heartbeat_interval", &c.HeartbeatInterval, 10*time.Second)
+	v.duration("partitioning.replica_ttl", &c.ReplicaTTL, 30*time.Second)
+	if c.Enabled && c.ReplicaTTL <= c.HeartbeatInterval {
+		v.fail("partitioning.replica_ttl", "must be longer than partitioning.heartbeat_interval (%s)", c.HeartbeatInterval)
+	}
+}
+
+func (c *LeaderElectionConfig) validate(v *validation) {
+	defaultString(&c.Key, "review-vectorizer:leader")
+	v.duration("leader_election.check_interval", &c.CheckInterval, 10*time.Second)
+}
+
+func (c *PreprocessingConfig) validate(v *validation) {
+	defaultString(&c.Emoji, "keep")
+	v.oneOf("preprocessing.emoji", c.Emoji, "keep", "remove")
+	v.nonNegative("preprocessing.max_length", c.MaxLength)
+	v.nonNegative("preprocessing.min_tokens", c.MinTokens)
+	if c.MinLetterRatio < 0 || c.MinLetterRatio > 1 {
+		v.fail("preprocessing.min_letter_ratio", "must be between 0 and 1, got %v", c.MinLetterRatio)
+	}
+	if c.MaxRepeatedRatio < 0 || c.MaxRepeatedRatio > 1 {
+		v.fail("preprocessing.max_repeated_ratio", "must be between 0 and 1, got %v", c.MaxRepeatedRatio)
+	}
+}
+
+func (c *RedactionConfig) validate(v *validation) {
+	if c.OrderIDPattern != "" {
+		if _, err := regexp.Compile(c.OrderIDPattern); err != nil {
+			v.fail("redaction.order_id_pattern", "invalid regular expression: %v", err)
+		}
+	}
+	for i, pattern := range c.NamePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.fail(fmt.Sprintf("redaction.name_patterns[%d]", i), "invalid regular expression: %v", err)
+		}
+	}
+}
+
+func (c *BackpressureConfig) validate(v *validation) {
+	v.nonNegativeDuration("backpressure.max_replication_lag", c.MaxReplicationLag)
+	v.nonNegative("backpressure.max_active_connections", c.MaxActiveConnections)
+	v.duration("backpressure.check_interval", &c.CheckInterval, 5*time.Second)
+	v.duration("backpressure.max_delay", &c.MaxDelay, 30*time.Second)
+}
+
+func (c *ArchiveConfig) validate(v *validation) {
+	v.nonNegative("archive.older_than_months", c.OlderThanMonths)
+	v.positive("archive.batch_size", &c.BatchSize, 1000)
+}
+
+func (c *SparseConfig) validate(v *validation) {
+	defaultString(&c.Provider, "bm25")
+	if !v.oneOf("sparse.provider", c.Provider, "bm25", "http") {
+		return
+	}
+	dimensions := 1 << 18
+	if c.Provider == "http" {
+		// The vocabulary of BERT-based SPLADE models.
+		dimensions = 30522
+		if c.Enabled && c.URL == "" {
+			v.fail("sparse.url", "is required for the http provider")
+		}
+	}
+	v.positive("sparse.dimensions", &c.Dimensions, dimensions)
+	v.duration("sparse.timeout", &c.Timeout, 30*time.Second)
+}
+
+func (c *RerankConfig) validate(v *validation) {
+	if !v.oneOf("rerank.provider", c.Provider, "", "cohere", "http") {
+		return
+	}
+	switch c.Provider {
+	case "cohere":
+		defaultString(&c.URL, "https://api.cohere.com/v2/rerank")
+		defaultString(&c.Model, "rerank-v3.5")
+		if c.APIKey == "" {
+			v.fail("rerank.api_key", "is required for the cohere provider")
+		}
+	case "http":
+		if c.URL == "" {
+			v.fail("rerank.url", "is required for the http provider")
+		}
+	}
+	v.positive("rerank.candidates", &c.Candidates, 50)
+	if c.Candidates > 1000 {
+		v.fail("rerank.candidates", "must be at most 1000, got %d", c.Candidates)
+	}
+	v.duration("rerank.timeout", &c.Timeout, 10*time.Second)
+}
+
+func (c *DriftConfig) validate(v *validation) {
+	v.duration("drift.window", &c.Window, 7*24*time.Hour)
+	v.positive("drift.sample_size", &c.SampleSize, 1000)
+	v.positive("drift.min_samples", &c.MinSamples, 100)
+	if c.MinSamples > c.SampleSize {
+		v.fail("drift.min_samples", "must not exceed drift.sample_size (%d), got %d", c.SampleSize, c.MinSamples)
+	}
+	if c.MeanThreshold == 0 {
+		c.MeanThreshold = 0.05
+	}
+	if c.MeanThreshold < 0 || c.MeanThreshold > 2 {
+		v.fail("drift.mean_threshold", "must be between 0 and 2, got %v", c.MeanThreshold)
+	}
+	if c.NormThreshold == 0 {
+		c.NormThreshold = 0.2
+	}
+	if c.NormThreshold < 0 || c.NormThreshold > 1 {
+		v.fail("drift.norm_threshold", "must be between 0 and 1, got %v", c.NormThreshold)
+	}
+}
+
+func (c *ArtifactsConfig) validate(v *validation) {
+	v.duration("artifacts.timeout", &c.Timeout, time.Minute)
+	v.positive("artifacts.page_size", &c.PageSize, 10000)
+	if c.Destination == "" {
+		return
+	}
+	u, err := url.Parse(c.Destination)
+	if err != nil {
+		v.fail("artifacts.destination", "invalid location %q", c.Destination)
+		return
+	}
+	switch u.Scheme {
+	case "", "file":
+	case "s3", "gs":
+		if u.Host == "" {
+			v.fail("artifacts.destination", "expected %s://bucket/prefix, got %q", u.Scheme, c.Destination)
+		}
+	default:
+		v.fail("artifacts.destination", "unsupported scheme %q, expected s3, gs or a local path", u.Scheme)
+	}
+}
+
+func (c *QuotasConfig) validate(v *validation) {
+	scopes := make(map[string]bool)
+	for i, quota := range c.Limits {
+		key := fmt.Sprintf("quotas.limits[%d]", i)
+		if (quota.AppID == "") == (quota.TenantID == "") {
+			v.fail(key, "exactly one of app_id and tenant_id is required")
+			continue
+		}
+		if scopes[quota.Scope()] {
+			v.fail(key, "duplicate quota for %s", quota.Scope())
+		}
+		scopes[quota.Scope()] = true
+		if quota.MonthlyTokens < 0 {
+			v.fail(key+".monthly_tokens", "must not be negative, got %d", quota.MonthlyTokens)
+		}
+		if quota.MonthlyReviews < 0 {
+			v.fail(key+".monthly_reviews", "must not be negative, got %d", quota.MonthlyReviews)
+		}
+	}
+}
+
+func (c *PostgresConfig) validate(v *validation) {
+	v.duration("postgres.statement_timeout", &c.StatementTimeout, 10*time.Minute)
+	v.duration("postgres.fetch_timeout", &c.FetchTimeout, 2*time.Minute)
+	v.duration("postgres.write_timeout", &c.WriteTimeout, time.Minute)
+	v.duration("postgres.stats_timeout", &c.StatsTimeout, 5*time.Minute)
+}
+
+func (c *RetryConfig) validate(v *validation) {
+	v.positive("retry.max_attempts", &c.MaxAttempts, 4)
+	v.duration("retry.base_delay", &c.BaseDelay, time.Second)
+	v.duration("retry.max_delay", &c.MaxDelay, 30*time.Second)
+	if c.MaxDelay < c.BaseDelay {
+		v.fail("retry.max_delay", "must not be shorter than retry.base_delay (%s)", c.BaseDelay)
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		v.fail("retry.jitter", "must be between 0 and 1, got %v", c.Jitter)
+	}
+}
+
+// validation collects the problems found by Validate.
+type validation struct {
+	errs []error
+}
+
+func (v *validation) fail(key, format string, args ...any) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+// positive defaults an unset value and rejects a negative one.
+func (v *validation) positive(key string, value *int, def int) {
+	if *value == 0 {
+		*value = def
+	}
+	if *value < 0 {
+		v.fail(key, "must be positive, got %d", *value)
+	}
+}
+
+// duration defaults an unset duration and rejects a negative one.
+func (v *validation) duration(key string, value *time.Duration, def time.Duration) {
+	if *value == 0 {
+		*value = def
+	}
+	v.nonNegativeDuration(key, *value)
+}
+
+// nonNegative rejects a negative value of a setting that 0 disables.
+func (v *validation) nonNegative(key string, value int) {
+	if value < 0 {
+		v.fail(key, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validation) nonNegativeDuration(key string, value time.Duration) {
+	if value < 0 {
+		v.fail(key, "must not be negative, got %s", value)
+	}
+}
+
+// oneOf reports whether value is one of allowed, failing otherwise.
+func (v *validation) oneOf(key, value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	v.fail(key, "unknown value %q, expected one of %s", value, strings.Join(allowed, ", "))
+	return false
+}
+
+func defaultString(value *string, def string) {
+	if *value == "" {
+		*value = def
+	}
+}
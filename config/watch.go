@@ -0,0 +1,87 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay lets the writes of an editor or a ConfigMap update settle
+// before the configuration is read again.
+const reloadDelay = 500 * time.Millisecond
+
+// Watch reloads the configuration whenever a file Load read it from changes,
+// until ctx is done, and passes it to onChange. A configuration that fails to
+// load or validate is passed to onError instead, and the service carries on
+// with the previous one. Watch returns right away when Load found no file.
+//
+// The directories of the files are watched rather than the files, so that
+// files replaced by renaming them, as Kubernetes does for ConfigMaps, are
+// followed.
+func Watch(ctx context.Context, onChange func(*Config), onError func(error)) error {
+	paths := configFiles
+	if len(paths) == 0 {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	for _, path := range paths {
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+	}
+
+	contents := readAll(paths)
+	reload := time.NewTimer(0)
+	<-reload.C
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			onError(fmt.Errorf("config watcher: %w", err))
+		case <-watcher.Events:
+			reload.Reset(reloadDelay)
+		case <-reload.C:
+			// Other files in the same directories trigger events as well.
+			current := readAll(paths)
+			if bytes.Equal(current, contents) {
+				continue
+			}
+			contents = current
+
+			if err := readConfigFiles(paths); err != nil {
+				onError(err)
+				continue
+			}
+			cfg, err := build()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			onChange(cfg)
+		}
+	}
+}
+
+// readAll returns the contents of the files, to tell whether they changed.
+func readAll(paths []string) []byte {
+	var contents []byte
+	for _, path := range paths {
+		data, _ := os.ReadFile(path)
+		contents = append(contents, data...)
+		contents = append(contents, 0)
+	}
+	return contents
+}
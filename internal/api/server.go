@@ -0,0 +1,607 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// readinessTimeout bounds the dependency checks of GET /readyz.
+const readinessTimeout = 5 * time.Second
+
+// shutdownTimeout bounds how long in-flight requests may take once the
+// server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// Consumer is the Kafka consumer operators pause and resume.
+type Consumer interface {
+	Pause() bool
+	Resume() bool
+	PausedAt() *time.Time
+}
+
+// Server is the admin HTTP API for operators to trigger and inspect runs
+// without hand-crafting Kafka messages.
+type Server struct {
+	svc      *service.VectorizeService
+	consumer Consumer
+	logger   *slog.Logger
+	server   *http.Server
+
+	// runCtx is the context runs started over HTTP execute in; it outlives
+	// the request that started them.
+	runCtx context.Context
+}
+
+func NewServer(cfg config.HTTPConfig, svc *service.VectorizeService, consumer Consumer, logger *slog.Logger) *Server {
+	s := &Server{
+		svc:      svc,
+		consumer: consumer,
+		logger:   logger,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	mux.HandleFunc("POST /runs", s.handleCreateRun)
+	mux.HandleFunc("GET /runs", s.handleListRuns)
+	mux.HandleFunc("GET /runs/{id}", s.handleGetRun)
+	mux.HandleFunc("GET /runs/{id}/errors", s.handleRunErrors)
+	mux.HandleFunc("GET /stats", s.handleStats)
+	mux.HandleFunc("GET /search", s.handleSearch)
+	mux.HandleFunc("POST /search", s.handleSearch)
+	mux.HandleFunc("GET /reviews/{id}/similar", s.handleSimilar)
+	mux.HandleFunc("GET /shadow/report", s.handleShadowReport)
+	mux.HandleFunc("GET /projection", s.handleProjection)
+	mux.HandleFunc("GET /spend", s.handleSpend)
+	mux.HandleFunc("GET /audit", s.handleAudit)
+	mux.HandleFunc("GET /archive", s.handleArchiveStats)
+	mux.HandleFunc("POST /archive/rehydrate", s.handleRehydrate)
+	mux.HandleFunc("GET /drift", s.handleDriftBaselines)
+	mux.HandleFunc("POST /drift/check", s.handleCheckDrift)
+	mux.HandleFunc("POST /drift/reset", s.handleResetDrift)
+	mux.HandleFunc("GET /config", s.handleConfig)
+	mux.HandleFunc("GET /consumer", s.handleConsumer)
+	mux.HandleFunc("POST /consumer/pause", s.handlePauseConsumer)
+	mux.HandleFunc("POST /consumer/resume", s.handleResumeConsumer)
+
+	s.server = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// Run serves the API until ctx is done, then shuts the server down
+// gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	s.runCtx = ctx
+
+	errCh := make(chan error, 1)
+	go func() {
+		s.logger.Info("Admin API listening", "addr", s.server.Addr)
+		errCh <- s.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handleHealth reports that the process is up, for liveness probes.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether Postgres, Kafka and the embedder are
+// available, for readiness probes. It answers 503 with the failing checks
+// when any of them is not.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	status := http.StatusOK
+	checks := make(map[string]string)
+	for name, err := range s.svc.Readiness(ctx) {
+		if err != nil {
+			s.logger.Warn("Readiness check failed", "check", name, "error", err)
+			checks[name] = err.Error()
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		checks[name] = "ok"
+	}
+
+	writeJSON(w, status, map[string]any{"checks": checks})
+}
+
+// handleCreateRun starts a run from the same payload as a
+// pipeline.vectorize_reviews.request event. The run executes in the
+// background and publishes the usual saga events; the response carries the
+// saga ID to poll GET /runs/{id} with. The saga ID can be passed as the
+// saga_id query parameter and is generated otherwise.
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var req payloads.VectorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+
+	if s.svc.InMaintenance(r.Context()) {
+		writeError(w, http.StatusServiceUnavailable, service.ErrMaintenance.Error())
+		return
+	}
+
+	sagaID := r.URL.Query().Get("saga_id")
+	if sagaID == "" {
+		sagaID = uuid.New().String()
+	}
+
+	ctx := service.WithAuditSource(s.runCtx, requestActor(r), r.Method+" "+r.URL.Path)
+	go func() {
+		if err := s.svc.Handle(ctx, req, sagaID); err != nil {
+			s.logger.Error("Run started over HTTP failed", "saga_id", sagaID, "error", err)
+		}
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"saga_id": sagaID})
+}
+
+// handleGetRun returns a run by its run ID or saga ID.
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, err := s.svc.GetRun(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("Failed to get run", "id", r.PathValue("id"), "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get run")
+		return
+	}
+	if run == nil {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleListRuns returns the run history, most recently started first,
+// filtered by the tenant_id, app_id, status, date_from and date_to query
+// parameters and capped by limit.
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	runQuery := service.RunQuery{
+		TenantID: query.Get("tenant_id"),
+		AppID:    query.Get("app_id"),
+		Status:   query.Get("status"),
+		DateFrom: query.Get("date_from"),
+		DateTo:   query.Get("date_to"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %q", value))
+			return
+		}
+		runQuery.Limit = limit
+	}
+
+	runs, err := s.svc.ListRuns(r.Context(), runQuery)
+	switch {
+	case errors.Is(err, service.ErrInvalidRunQuery):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to list runs", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list runs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"runs": runs})
+}
+
+// handleAudit returns the audit log of destructive operations, most recent
+// first, filtered by the operation, actor, saga_id, date_from and date_to
+// query parameters and capped by limit.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	auditQuery := service.AuditQuery{
+		Operation: query.Get("operation"),
+		Actor:     query.Get("actor"),
+		SagaID:    query.Get("saga_id"),
+		DateFrom:  query.Get("date_from"),
+		DateTo:    query.Get("date_to"),
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid limit: %q", value))
+			return
+		}
+		auditQuery.Limit = limit
+	}
+
+	entries, err := s.svc.ListAudit(r.Context(), auditQuery)
+	switch {
+	case errors.Is(err, service.ErrInvalidAuditQuery):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to list audit entries", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list audit entries")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+// handleArchiveStats returns the size of the embedding archive.
+func (s *Server) handleArchiveStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.svc.ArchiveStats(r.Context())
+	if err != nil {
+		s.logger.Error("Failed to get archive stats", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get archive stats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleRehydrate moves archived embeddings of an app or of reviews back
+// into review_embeddings and returns once they are searchable again.
+func (s *Server) handleRehydrate(w http.ResponseWriter, r *http.Request) {
+	var req service.RehydrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	if s.svc.InMaintenance(r.Context()) {
+		writeError(w, http.StatusServiceUnavailable, service.ErrMaintenance.Error())
+		return
+	}
+
+	result, err := s.svc.RehydrateEmbeddings(r.Context(), req)
+	switch {
+	case errors.Is(err, service.ErrInvalidRehydrate):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to rehydrate embeddings", "app_id", req.AppID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to rehydrate embeddings")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleDriftBaselines returns the embedding drift baselines of the app_id
+// query parameter, or of every app, with the outcome of their last check.
+func (s *Server) handleDriftBaselines(w http.ResponseWriter, r *http.Request) {
+	baselines, err := s.svc.DriftBaselines(r.Context(), r.URL.Query().Get("app_id"))
+	if err != nil {
+		s.logger.Error("Failed to list drift baselines", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list drift baselines")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"baselines": baselines})
+}
+
+// handleCheckDrift checks the app_id query parameter, or every recently
+// embedded app, for embedding drift right away.
+func (s *Server) handleCheckDrift(w http.ResponseWriter, r *http.Request) {
+	appID := r.URL.Query().Get("app_id")
+	checks, err := s.svc.CheckDrift(r.Context(), appID)
+	if err != nil {
+		s.logger.Error("Drift check failed", "app_id", appID, "error", err)
+		writeError(w, http.StatusInternalServerError, "drift check failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"checks": checks})
+}
+
+// handleResetDrift deletes the drift baselines of the app_id query
+// parameter, or of every app, so that the next checks take new ones.
+func (s *Server) handleResetDrift(w http.ResponseWriter, r *http.Request) {
+	appID := r.URL.Query().Get("app_id")
+	deleted, err := s.svc.ResetDriftBaselines(r.Context(), appID)
+	if err != nil {
+		s.logger.Error("Failed to reset drift baselines", "app_id", appID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to reset drift baselines")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"deleted": deleted})
+}
+
+// requestActor names the caller of the admin API for the audit log: the
+// X-Actor header set by the gateway in front of it, or else the client's
+// address.
+func requestActor(r *http.Request) string {
+	if actor := r.Header.Get("X-Actor"); actor != "" {
+		return "http:" + actor
+	}
+	return "http:" + r.RemoteAddr
+}
+
+// handleRunErrors returns the per-review failures a run, given by its run ID
+// or saga ID, left unresolved.
+func (s *Server) handleRunErrors(w http.ResponseWriter, r *http.Request) {
+	run, reviewErrors, err := s.svc.GetRunErrors(r.Context(), r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("Failed to get run errors", "id", r.PathValue("id"), "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get run errors")
+		return
+	}
+	if run == nil {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"run_id": run.RunID, "errors": reviewErrors})
+}
+
+// handleConfig returns the configuration in effect, with secrets redacted.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.svc.ConfigDump())
+}
+
+// handleConsumer reports whether the Kafka consumer of this instance is
+// paused, and since when.
+func (s *Server) handleConsumer(w http.ResponseWriter, r *http.Request) {
+	pausedAt := s.consumer.PausedAt()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"paused":      pausedAt != nil,
+		"paused_at":   pausedAt,
+		"maintenance": s.svc.InMaintenance(r.Context()),
+	})
+}
+
+// handlePauseConsumer stops this instance from handling further requests
+// until it is resumed, without affecting its health. Runs in progress are
+// finished; pausing twice is harmless.
+func (s *Server) handlePauseConsumer(w http.ResponseWriter, r *http.Request) {
+	if s.consumer.Pause() {
+		s.logger.Warn("Consumer paused over HTTP", "remote_addr", r.RemoteAddr)
+	}
+	s.handleConsumer(w, r)
+}
+
+// handleResumeConsumer continues consumption after a pause.
+func (s *Server) handleResumeConsumer(w http.ResponseWriter, r *http.Request) {
+	if s.consumer.Resume() {
+		s.logger.Info("Consumer resumed over HTTP", "remote_addr", r.RemoteAddr)
+	}
+	s.handleConsumer(w, r)
+}
+
+// handleStats returns the embedding table statistics and, when app_id is
+// given, the app's coverage report.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.svc.Stats(r.Context())
+	if err != nil {
+		s.logger.Error("Failed to get table stats", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get stats")
+		return
+	}
+
+	response := map[string]any{"embeddings": stats}
+	if cacheStats := s.svc.CacheStats(); cacheStats != nil {
+		response["cache"] = cacheStats
+	}
+	if queueStats := s.svc.QueueStats(); queueStats != nil {
+		response["queue"] = queueStats
+	}
+
+	if appID := r.URL.Query().Get("app_id"); appID != "" {
+		coverage, err := s.svc.CoverageReport(r.Context(), appID)
+		if err != nil {
+			s.logger.Error("Failed to get coverage report", "app_id", appID, "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to get coverage report")
+			return
+		}
+		response["coverage"] = coverage
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleProjection returns the latest 2D projection of the app_id query
+// parameter with the coordinates of all its reviews, for review maps.
+func (s *Server) handleProjection(w http.ResponseWriter, r *http.Request) {
+	appID := r.URL.Query().Get("app_id")
+	if appID == "" {
+		writeError(w, http.StatusBadRequest, "app_id is required")
+		return
+	}
+
+	projection, err := s.svc.LatestProjection(r.Context(), appID)
+	switch {
+	case errors.Is(err, service.ErrNoProjection):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to get projection", "app_id", appID, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get projection")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, projection)
+}
+
+// handleShadowReport compares the shadow model, or the model query
+// parameter, with the production model on the reviews of app_id, or of every
+// app, embedded with both.
+func (s *Server) handleShadowReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	report, err := s.svc.ShadowReport(r.Context(), query.Get("app_id"), query.Get("model"))
+	switch {
+	case errors.Is(err, service.ErrNoShadowModel):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to build shadow report", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build shadow report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleSpend returns the embedding spend of the month query parameter
+// (YYYY-MM, the current month by default) by app and model, narrowed by the
+// tenant_id and app_id query parameters.
+func (s *Server) handleSpend(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	month := query.Get("month")
+	if month == "" {
+		month = time.Now().UTC().Format(service.SpendMonthLayout)
+	}
+
+	report, err := s.svc.SpendReport(r.Context(), month, query.Get("tenant_id"), query.Get("app_id"))
+	switch {
+	case errors.Is(err, service.ErrInvalidMonth):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Failed to build spend report", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to build spend report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleSearch returns the reviews nearest to a review or free text. GET
+// takes the search as query parameters, POST as a JSON body with the same
+// names.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	var req service.SearchRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	} else {
+		var err error
+		if req, err = searchRequestFromQuery(r.URL.Query()); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	s.writeSearchResults(w, r, req)
+}
+
+// handleSimilar returns the reviews nearest to the review in the path. It
+// takes the same query parameters as GET /search except review_id and q.
+func (s *Server) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	req, err := searchRequestFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	req.ReviewID, req.Text = r.PathValue("id"), ""
+
+	s.writeSearchResults(w, r, req)
+}
+
+func (s *Server) writeSearchResults(w http.ResponseWriter, r *http.Request, req service.SearchRequest) {
+	results, err := s.svc.Search(r.Context(), req)
+	switch {
+	case errors.Is(err, service.ErrInvalidSearch), errors.Is(err, service.ErrInvalidRerank), errors.Is(err, service.ErrRerankDisabled):
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, storage.ErrNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		s.logger.Error("Search failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "search failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
+
+func searchRequestFromQuery(query url.Values) (service.SearchRequest, error) {
+	req := service.SearchRequest{
+		ReviewID: query.Get("review_id"),
+		Text:     query.Get("q"),
+		SearchFilters: storage.SearchFilters{
+			AppID:    query.Get("app_id"),
+			Language: query.Get("language"),
+			Country:  query.Get("country"),
+			DateFrom: query.Get("date_from"),
+			DateTo:   query.Get("date_to"),
+		},
+	}
+
+	if value := query.Get("rerank"); value != "" {
+		rerank, err := strconv.ParseBool(value)
+		if err != nil {
+			return service.SearchRequest{}, fmt.Errorf("invalid rerank: %q", value)
+		}
+		req.Rerank = rerank
+	}
+
+	for name, target := range map[string]*int{
+		"limit":             &req.Limit,
+		"min_rating":        &req.MinRating,
+		"max_rating":        &req.MaxRating,
+		"rerank_candidates": &req.RerankCandidates,
+	} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return service.SearchRequest{}, fmt.Errorf("invalid %s: %q", name, value)
+		}
+		*target = n
+	}
+
+	return req, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
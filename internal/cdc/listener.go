@@ -0,0 +1,136 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// reconnectDelay is how long the listener waits before subscribing again
+// after losing its connection.
+const reconnectDelay = 5 * time.Second
+
+// Listener vectorizes reviews in near real time as their IDs are announced
+// on a Postgres NOTIFY channel, instead of waiting for the next batch saga.
+// Notifications sent while the listener is disconnected are lost; scheduled
+// incremental runs pick those reviews up.
+type Listener struct {
+	repo   storage.Repository
+	svc    *service.VectorizeService
+	cfg    config.CDCConfig
+	logger *slog.Logger
+}
+
+func NewListener(repo storage.Repository, svc *service.VectorizeService, cfg config.CDCConfig, logger *slog.Logger) *Listener {
+	return &Listener{
+		repo:   repo,
+		svc:    svc,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Run collects announced review IDs and vectorizes them in batches of
+// cdc.batch_size, or whatever is pending every cdc.flush_interval, until ctx
+// is done.
+func (l *Listener) Run(ctx context.Context) error {
+	batchSize := max(l.cfg.BatchSize, 1)
+	ids := make(chan string, batchSize)
+
+	go l.listen(ctx, ids)
+
+	flushInterval := l.cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 2 * time.Second
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]struct{})
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-ids:
+			pending[id] = struct{}{}
+			if len(pending) >= batchSize {
+				l.flush(ctx, pending)
+			}
+		case <-ticker.C:
+			l.flush(ctx, pending)
+		}
+	}
+}
+
+// listen subscribes to the channel and resubscribes after connection
+// failures until ctx is done.
+func (l *Listener) listen(ctx context.Context, ids chan<- string) {
+	for {
+		l.logger.Info("Listening for review changes", "channel", l.cfg.Channel)
+
+		err := l.repo.Listen(ctx, l.cfg.Channel, func(payload string) {
+			if payload == "" {
+				return
+			}
+			select {
+			case ids <- payload:
+			case <-ctx.Done():
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		l.logger.Error("Review change listener stopped, reconnecting", "channel", l.cfg.Channel, "error", err)
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// flush vectorizes the pending reviews. When another run holds the lock the
+// reviews stay pending for the next flush; otherwise they are dropped, with
+// per-review failures kept in the error ledger.
+func (l *Listener) flush(ctx context.Context, pending map[string]struct{}) {
+	if len(pending) == 0 {
+		return
+	}
+
+	if l.svc.InMaintenance(ctx) {
+		l.logger.Debug("In maintenance mode, keeping changed reviews pending", "count", len(pending))
+		return
+	}
+
+	reviewIDs := make([]string, 0, len(pending))
+	for id := range pending {
+		reviewIDs = append(reviewIDs, id)
+	}
+
+	ctx = service.WithAuditSource(ctx, "cdc", "notify:"+l.cfg.Channel)
+	result, err := l.svc.VectorizeReviews(ctx, reviewIDs)
+	if errors.Is(err, service.ErrRunInProgress) || errors.Is(err, service.ErrPartitionsUnassigned) {
+		l.logger.Debug("Cannot run yet, keeping changed reviews pending", "count", len(reviewIDs), "error", err)
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrQuotaExceeded):
+		l.logger.Warn("Deferred changed reviews", "count", len(reviewIDs), "deferred", result.Deferred, "error", err)
+	case err != nil:
+		l.logger.Error("Failed to vectorize changed reviews", "count", len(reviewIDs), "error", err)
+	default:
+		l.logger.Info("Vectorized changed reviews",
+			"count", len(reviewIDs),
+			"processed", result.Processed,
+			"skipped", result.Skipped,
+			"failed", result.Failed)
+	}
+
+	clear(pending)
+}
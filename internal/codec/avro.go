@@ -0,0 +1,232 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+func (c *Codec) avroSchema(schema registrySchema) (avro.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if parsed, ok := c.avro[schema.ID]; ok {
+		return parsed, nil
+	}
+
+	parsed, err := avro.Parse(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Avro schema: %w", err)
+	}
+	c.avro[schema.ID] = parsed
+	return parsed, nil
+}
+
+func (c *Codec) encodeAvro(schema registrySchema, value []byte) ([]byte, error) {
+	parsed, err := c.avroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	native, err := avroNative(parsed, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return avro.Marshal(parsed, native)
+}
+
+func (c *Codec) decodeAvro(schema registrySchema, data []byte) ([]byte, error) {
+	parsed, err := c.avroSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err := avro.Unmarshal(parsed, data, &doc); err != nil {
+		return nil, err
+	}
+	unwrapPayload(doc)
+
+	return jsonMarshal(doc)
+}
+
+// avroNative converts a value decoded from JSON into the Go type the Avro
+// encoder expects for schema: numbers to the declared width, RFC 3339
+// timestamps to time.Time for timestamp logical types, and objects or arrays
+// to their JSON for strings.
+func avroNative(schema avro.Schema, v any) (any, error) {
+	switch s := schema.(type) {
+	case *avro.RefSchema:
+		return avroNative(s.Schema(), v)
+
+	case *avro.NullSchema:
+		if v != nil {
+			return nil, fmt.Errorf("expected null, got %T", v)
+		}
+		return nil, nil
+
+	case *avro.UnionSchema:
+		if v == nil && s.Nullable() {
+			return nil, nil
+		}
+		var errs []error
+		for _, branch := range s.Types() {
+			if branch.Type() == avro.Null {
+				continue
+			}
+			native, err := avroNative(branch, v)
+			if err == nil {
+				return native, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, fmt.Errorf("no union branch matches %T: %v", v, errs)
+
+	case *avro.RecordSchema:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected object for record %s, got %T", s.FullName(), v)
+		}
+		record := make(map[string]any, len(s.Fields()))
+		for _, field := range s.Fields() {
+			fv, ok := m[field.Name()]
+			if !ok {
+				// Left to the encoder, which uses the field's default.
+				continue
+			}
+			native, err := avroNative(field.Type(), fv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.Name(), err)
+			}
+			record[field.Name()] = native
+		}
+		return record, nil
+
+	case *avro.ArraySchema:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected array, got %T", v)
+		}
+		natives := make([]any, len(items))
+		for i, item := range items {
+			native, err := avroNative(s.Items(), item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			natives[i] = native
+		}
+		return natives, nil
+
+	case *avro.MapSchema:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected object for map, got %T", v)
+		}
+		natives := make(map[string]any, len(m))
+		for k, mv := range m {
+			native, err := avroNative(s.Values(), mv)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			natives[k] = native
+		}
+		return natives, nil
+
+	case *avro.EnumSchema:
+		if _, ok := v.(string); !ok {
+			return nil, fmt.Errorf("expected string for enum %s, got %T", s.FullName(), v)
+		}
+		return v, nil
+
+	case *avro.FixedSchema:
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string for fixed %s, got %T", s.FullName(), v)
+		}
+		return []byte(str), nil
+
+	case *avro.PrimitiveSchema:
+		return avroPrimitive(s, v)
+	}
+
+	return nil, fmt.Errorf("unsupported Avro schema type %s", schema.Type())
+}
+
+func avroPrimitive(s *avro.PrimitiveSchema, v any) (any, error) {
+	switch s.Type() {
+	case avro.Boolean:
+		if _, ok := v.(bool); !ok {
+			return nil, fmt.Errorf("expected boolean, got %T", v)
+		}
+		return v, nil
+
+	case avro.Int, avro.Long:
+		if s.Logical() != nil {
+			switch s.Logical().Type() {
+			case avro.TimestampMillis, avro.TimestampMicros:
+				str, ok := v.(string)
+				if !ok {
+					break
+				}
+				t, err := time.Parse(time.RFC3339Nano, str)
+				if err != nil {
+					return nil, fmt.Errorf("invalid timestamp: %w", err)
+				}
+				return t, nil
+			}
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected integer, got %T", v)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("expected integer, got %s", n)
+		}
+		if s.Type() == avro.Int {
+			return int(i), nil
+		}
+		return i, nil
+
+	case avro.Float, avro.Double:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("expected number, got %T", v)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("expected number, got %s", n)
+		}
+		if s.Type() == avro.Float {
+			return float32(f), nil
+		}
+		return f, nil
+
+	case avro.String:
+		if str, ok := v.(string); ok {
+			return str, nil
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+
+	case avro.Bytes:
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string for bytes, got %T", v)
+		}
+		return []byte(str), nil
+	}
+
+	return nil, fmt.Errorf("unsupported Avro type %s", s.Type())
+}
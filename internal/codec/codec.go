@@ -0,0 +1,197 @@
+// Package codec converts event envelopes between the JSON the service works
+// with and the encoding they travel in on Kafka: JSON as is, or Avro or
+// Protobuf in the schema registry wire format.
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"github.com/quiby-ai/review-vectorizer/config"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Encodings events can be published with.
+const (
+	EncodingJSON     = "json"
+	EncodingAvro     = "avro"
+	EncodingProtobuf = "protobuf"
+)
+
+// magicByte starts a message in the schema registry wire format. It is
+// followed by the big-endian ID of the schema the rest is encoded with.
+const magicByte = 0
+
+// payloadField is the envelope field holding the event payload. A schema may
+// declare it a string, in which case it holds the payload's JSON.
+const payloadField = "payload"
+
+// Codec encodes and decodes envelopes. Schemas are fetched from the schema
+// registry and parsed once.
+type Codec struct {
+	registry *registry
+
+	mu       sync.Mutex
+	avro     map[int]avro.Schema
+	protobuf map[int]protoreflect.FileDescriptor
+}
+
+// New checks that the configured encodings are known and that a schema
+// registry is configured when any of them needs one.
+func New(cfg config.KafkaConfig) (*Codec, error) {
+	encodings := []string{cfg.Encoding}
+	for _, override := range cfg.Topics {
+		encodings = append(encodings, override.Encoding)
+	}
+
+	for _, encoding := range encodings {
+		switch encoding {
+		case "", EncodingJSON:
+		case EncodingAvro, EncodingProtobuf:
+			if cfg.SchemaRegistry.URL == "" {
+				return nil, fmt.Errorf("%s encoding requires kafka.schema_registry.url", encoding)
+			}
+		default:
+			return nil, fmt.Errorf("unknown encoding %q, expected %s, %s or %s", encoding, EncodingJSON, EncodingAvro, EncodingProtobuf)
+		}
+	}
+
+	return &Codec{
+		registry: newRegistry(cfg.SchemaRegistry),
+		avro:     make(map[int]avro.Schema),
+		protobuf: make(map[int]protoreflect.FileDescriptor),
+	}, nil
+}
+
+// Encode encodes the JSON envelope for topic. Avro and Protobuf use the
+// latest schema of the topic's "<topic>-value" subject.
+func (c *Codec) Encode(ctx context.Context, topic, encoding string, value []byte) ([]byte, error) {
+	if encoding == "" || encoding == EncodingJSON {
+		return value, nil
+	}
+
+	schema, err := c.registry.latestSchema(ctx, topic+"-value")
+	if err != nil {
+		return nil, err
+	}
+
+	var want string
+	switch encoding {
+	case EncodingAvro:
+		want = schemaTypeAvro
+	case EncodingProtobuf:
+		want = schemaTypeProtobuf
+	default:
+		return nil, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	if schema.schemaType() != want {
+		return nil, fmt.Errorf("schema %d of %s is %s, not %s", schema.ID, topic, schema.schemaType(), want)
+	}
+
+	framed := binary.BigEndian.AppendUint32([]byte{magicByte}, uint32(schema.ID))
+	switch want {
+	case schemaTypeAvro:
+		data, err := c.encodeAvro(schema, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode Avro with schema %d: %w", schema.ID, err)
+		}
+		return append(framed, data...), nil
+	default:
+		data, err := c.encodeProtobuf(ctx, schema, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode Protobuf with schema %d: %w", schema.ID, err)
+		}
+		// The message indexes [0], for the first message of the schema,
+		// are written as a single zero.
+		framed = binary.AppendVarint(framed, 0)
+		return append(framed, data...), nil
+	}
+}
+
+// Decode returns the JSON envelope of a consumed message. Messages in the
+// schema registry wire format are decoded with the schema they name, others
+// are taken to be JSON already.
+func (c *Codec) Decode(ctx context.Context, data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != magicByte {
+		return data, nil
+	}
+	if len(data) < 5 {
+		return nil, errors.New("message too short for the schema registry wire format")
+	}
+
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	schema, err := c.registry.schemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch schema.schemaType() {
+	case schemaTypeAvro:
+		value, err := c.decodeAvro(schema, data[5:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Avro with schema %d: %w", id, err)
+		}
+		return value, nil
+	case schemaTypeProtobuf:
+		value, err := c.decodeProtobuf(ctx, schema, data[5:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Protobuf with schema %d: %w", id, err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unsupported schema type %s of schema %d", schema.schemaType(), id)
+	}
+}
+
+// decodeJSON decodes an envelope keeping numbers exact.
+func decodeJSON(value []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON envelope: %w", err)
+	}
+	return doc, nil
+}
+
+// unwrapPayload turns a payload declared as a string holding JSON back into
+// the JSON it holds.
+func unwrapPayload(doc map[string]any) {
+	if s, ok := doc[payloadField].(string); ok && json.Valid([]byte(s)) {
+		doc[payloadField] = json.RawMessage(s)
+	}
+}
+
+// wrapPayload encodes a structured payload as JSON for schemas declaring it
+// a string.
+func wrapPayload(doc map[string]any) error {
+	payload, ok := doc[payloadField]
+	if !ok {
+		return nil
+	}
+	if _, isString := payload.(string); isString {
+		return nil
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	doc[payloadField] = string(data)
+	return nil
+}
+
+func jsonMarshal(doc map[string]any) ([]byte, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON envelope: %w", err)
+	}
+	return data, nil
+}
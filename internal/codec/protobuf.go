@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufFile compiles the schema. Well-known types such as
+// google.protobuf.Timestamp and google.protobuf.Struct can be imported;
+// references to other registered schemas are not supported.
+func (c *Codec) protobufFile(ctx context.Context, schema registrySchema) (protoreflect.FileDescriptor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if fd, ok := c.protobuf[schema.ID]; ok {
+		return fd, nil
+	}
+
+	name := "schema-" + strconv.Itoa(schema.ID) + ".proto"
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{name: schema.Schema}),
+		}),
+	}
+	files, err := compiler.Compile(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Protobuf schema: %w", err)
+	}
+
+	fd := files[0]
+	if fd.Messages().Len() == 0 {
+		return nil, errors.New("schema declares no Protobuf message")
+	}
+	c.protobuf[schema.ID] = fd
+	return fd, nil
+}
+
+// encodeProtobuf encodes the envelope as the first message of the schema.
+func (c *Codec) encodeProtobuf(ctx context.Context, schema registrySchema, value []byte) ([]byte, error) {
+	fd, err := c.protobufFile(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+	md := fd.Messages().Get(0)
+
+	if field := md.Fields().ByName(payloadField); field != nil && field.Kind() == protoreflect.StringKind {
+		doc, err := decodeJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := wrapPayload(doc); err != nil {
+			return nil, err
+		}
+		if value, err = jsonMarshal(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(value, msg); err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(msg)
+}
+
+// decodeProtobuf decodes data, which starts with the message indexes locating
+// its message type in the schema.
+func (c *Codec) decodeProtobuf(ctx context.Context, schema registrySchema, data []byte) ([]byte, error) {
+	fd, err := c.protobufFile(ctx, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, n, err := messageIndexes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	md := fd.Messages().Get(0)
+	for i, index := range indexes {
+		messages := fd.Messages()
+		if i > 0 {
+			messages = md.Messages()
+		}
+		if index < 0 || index >= messages.Len() {
+			return nil, fmt.Errorf("message index %d out of range", index)
+		}
+		md = messages.Get(index)
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(data[n:], msg); err != nil {
+		return nil, err
+	}
+
+	value, err := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := decodeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+	unwrapPayload(doc)
+
+	return jsonMarshal(doc)
+}
+
+// messageIndexes reads the zigzag varint encoded message indexes and returns
+// them with the number of bytes read. A count of zero stands for [0].
+func messageIndexes(data []byte) ([]int, int, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, 0, errors.New("invalid message indexes")
+	}
+	if count == 0 {
+		return []int{0}, n, nil
+	}
+
+	indexes := make([]int, count)
+	for i := range indexes {
+		index, m := binary.Varint(data[n:])
+		if m <= 0 {
+			return nil, 0, errors.New("invalid message indexes")
+		}
+		indexes[i] = int(index)
+		n += m
+	}
+	return indexes, n, nil
+}
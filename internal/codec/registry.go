@@ -0,0 +1,143 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Schema types as named by the schema registry, which omits the type of
+// Avro schemas.
+const (
+	schemaTypeAvro     = "AVRO"
+	schemaTypeProtobuf = "PROTOBUF"
+)
+
+// ErrRegistryUnavailable is returned when the schema registry cannot be
+// reached or fails, as opposed to not knowing a schema.
+var ErrRegistryUnavailable = errors.New("schema registry unavailable")
+
+// registrySchema is a schema as returned by the schema registry.
+type registrySchema struct {
+	ID         int    `json:"id"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+func (s registrySchema) schemaType() string {
+	if s.SchemaType == "" {
+		return schemaTypeAvro
+	}
+	return s.SchemaType
+}
+
+type latestSchema struct {
+	schema    registrySchema
+	fetchedAt time.Time
+}
+
+// registry is a client of a Confluent-compatible schema registry. Schemas are
+// immutable once registered, so they are cached by ID for good; the latest
+// schema of a subject is cached for the configured TTL.
+type registry struct {
+	cfg    config.SchemaRegistryConfig
+	client *http.Client
+
+	mu     sync.Mutex
+	byID   map[int]registrySchema
+	latest map[string]latestSchema
+}
+
+func newRegistry(cfg config.SchemaRegistryConfig) *registry {
+	return &registry{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		byID:   make(map[int]registrySchema),
+		latest: make(map[string]latestSchema),
+	}
+}
+
+// schemaByID returns the schema registered under id.
+func (r *registry) schemaByID(ctx context.Context, id int) (registrySchema, error) {
+	r.mu.Lock()
+	schema, ok := r.byID[id]
+	r.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	if err := r.get(ctx, "/schemas/ids/"+strconv.Itoa(id), &schema); err != nil {
+		return registrySchema{}, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	schema.ID = id
+
+	r.mu.Lock()
+	r.byID[id] = schema
+	r.mu.Unlock()
+
+	return schema, nil
+}
+
+// latestSchema returns the latest version of the subject's schema.
+func (r *registry) latestSchema(ctx context.Context, subject string) (registrySchema, error) {
+	r.mu.Lock()
+	cached, ok := r.latest[subject]
+	r.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < r.cfg.CacheTTL {
+		return cached.schema, nil
+	}
+
+	var schema registrySchema
+	if err := r.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/latest", &schema); err != nil {
+		return registrySchema{}, fmt.Errorf("failed to fetch latest schema of %s: %w", subject, err)
+	}
+
+	r.mu.Lock()
+	r.latest[subject] = latestSchema{schema: schema, fetchedAt: time.Now()}
+	r.byID[schema.ID] = schema
+	r.mu.Unlock()
+
+	return schema, nil
+}
+
+func (r *registry) get(ctx context.Context, path string, v any) error {
+	if r.cfg.URL == "" {
+		return fmt.Errorf("no schema registry configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(r.cfg.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if r.cfg.Username != "" {
+		req.SetBasicAuth(r.cfg.Username, r.cfg.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRegistryUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("schema registry answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %w", ErrRegistryUnavailable, err)
+		}
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/kafkaconn"
+	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetterSuffix is appended to a topic's name to get the topic its
+// poison messages are forwarded to.
+const DeadLetterSuffix = ".dlq"
+
+// Headers added to a dead-lettered message, next to its original ones.
+const (
+	HeaderDeadLetterError     = "x-dlq-error"
+	HeaderDeadLetterTopic     = "x-dlq-original-topic"
+	HeaderDeadLetterPartition = "x-dlq-original-partition"
+	HeaderDeadLetterOffset    = "x-dlq-original-offset"
+	HeaderDeadLetterAttempts  = "x-dlq-attempts"
+	HeaderDeadLetterFailedAt  = "x-dlq-failed-at"
+)
+
+// replayIdleTimeout is how long Replay waits for another dead letter before
+// concluding the topic is drained.
+const replayIdleTimeout = 10 * time.Second
+
+func DeadLetterTopic(topic string) string {
+	return topic + DeadLetterSuffix
+}
+
+// newDeadLetter wraps the original message, unchanged, for its dead-letter
+// topic, with the error and attempt count in headers.
+func newDeadLetter(m kafka.Message, attempts int, cause error) kafka.Message {
+	headers := append([]kafka.Header(nil), m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDeadLetterFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	return kafka.Message{
+		Topic:   DeadLetterTopic(m.Topic),
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}
+}
+
+// fromDeadLetter restores the original message of a dead letter, to be
+// published to its original topic again with a fresh retry budget.
+func fromDeadLetter(m kafka.Message) kafka.Message {
+	original := kafka.Message{
+		Topic: strings.TrimSuffix(m.Topic, DeadLetterSuffix),
+		Key:   m.Key,
+		Value: m.Value,
+	}
+
+	for _, header := range m.Headers {
+		switch {
+		case header.Key == HeaderDeadLetterTopic:
+			original.Topic = string(header.Value)
+		case strings.HasPrefix(header.Key, "x-dlq-"), strings.HasPrefix(header.Key, "x-retry-"):
+		default:
+			original.Headers = append(original.Headers, header)
+		}
+	}
+
+	return original
+}
+
+// Replay publishes the messages of topic's dead-letter topic back to topic,
+// up to limit of them (0 for all), and returns how many it replayed. It
+// stops once no dead letter arrives for a while. Replayed messages are
+// committed under a dedicated consumer group, so a later replay continues
+// after them.
+func Replay(ctx context.Context, cfg config.KafkaConfig, producer *producer.Producer, topic string, limit int, logger *slog.Logger) (int, error) {
+	dialer, err := kafkaconn.NewDialer(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := newReader(cfg, dialer, cfg.GroupID+"-dlq-replay", DeadLetterTopic(topic))
+	defer reader.Close()
+
+	replayed := 0
+	for limit <= 0 || replayed < limit {
+		fetchCtx, cancel := context.WithTimeout(ctx, replayIdleTimeout)
+		m, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			break
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read dead letter: %w", err)
+		}
+
+		if err := producer.PublishMessage(ctx, fromDeadLetter(m)); err != nil {
+			return replayed, fmt.Errorf("failed to replay dead letter at offset %d: %w", m.Offset, err)
+		}
+		if err := reader.CommitMessages(ctx, m); err != nil {
+			return replayed, fmt.Errorf("failed to commit replayed dead letter at offset %d: %w", m.Offset, err)
+		}
+
+		replayed++
+		logger.Info("Replayed dead letter", "topic", topic, "offset", m.Offset, "key", string(m.Key))
+	}
+
+	return replayed, nil
+}
@@ -2,39 +2,486 @@ package consumer
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/quiby-ai/common/pkg/events"
 	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/codec"
+	"github.com/quiby-ai/review-vectorizer/internal/kafkaconn"
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/producer"
 	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
-type VectorizeServiceProcessor struct {
-	svc *service.VectorizeService
+// route decodes the payload of one event type and hands it to its handler.
+type route struct {
+	decode func(raw json.RawMessage) (any, error)
+	handle func(ctx context.Context, payload any, sagaID string) error
+	// control routes are handled in maintenance mode too.
+	control bool
 }
 
-func (p *VectorizeServiceProcessor) Handle(ctx context.Context, payload any, sagaID string) error {
-	if evt, ok := payload.(events.VectorizeRequest); ok {
-		return p.svc.Handle(ctx, evt, sagaID)
+// newRoute routes events whose payload decodes into T. Payloads that don't
+// decode or fail T's validation never reach handle.
+func newRoute[T interface{ Validate() error }](handle func(ctx context.Context, payload T, sagaID string) error) route {
+	return route{
+		decode: func(raw json.RawMessage) (any, error) {
+			var payload T
+			if err := json.Unmarshal(raw, &payload); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal %T: %w", payload, err)
+			}
+			if err := payload.Validate(); err != nil {
+				return nil, fmt.Errorf("%T validation failed: %w", payload, err)
+			}
+			return payload, nil
+		},
+		handle: func(ctx context.Context, payload any, sagaID string) error {
+			return handle(ctx, payload.(T), sagaID)
+		},
 	}
-	return fmt.Errorf("invalid payload type for vectorize service")
 }
 
+// KafkaConsumer reads event envelopes from every routed topic and dispatches
+// them by event type. The shared consumer only knows the shared payload
+// types, so envelopes are decoded here.
+//
+// Failed deliveries wait on the retry topic of their request topic, read
+// by a separate reader so that waiting retries don't hold up new requests.
+// Control events, such as cancellations, have a reader of their own too, so
+// they get through while a long run occupies the request reader, and so do
+// single-review requests, which are expected to be handled within a second.
 type KafkaConsumer struct {
-	consumer *events.KafkaConsumer
+	reader         *kafka.Reader
+	retryReader    *kafka.Reader
+	controlReader  *kafka.Reader
+	realtimeReader *kafka.Reader
+	routes         map[string]route
+	svc            *service.VectorizeService
+	codec          *codec.Codec
+	gate           *pauseGate
+	producer       *producer.Producer
+	cfg            config.KafkaConfig
+	logger         *slog.Logger
 }
 
-func NewKafkaConsumer(cfg config.KafkaConfig, svc *service.VectorizeService) *KafkaConsumer {
-	consumer := events.NewKafkaConsumer(cfg.Brokers, events.PipelineVectorizeRequest, cfg.GroupID)
-	processor := &VectorizeServiceProcessor{svc: svc}
-	consumer.SetProcessor(processor)
-	return &KafkaConsumer{consumer: consumer}
+func NewKafkaConsumer(cfg config.KafkaConfig, svc *service.VectorizeService, producer *producer.Producer, logger *slog.Logger) (*KafkaConsumer, error) {
+	dialer, err := kafkaconn.NewDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := codec.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := map[string]route{
+		events.PipelineVectorizeRequest:    newRoute(svc.Handle),
+		payloads.PipelineVectorizeRetry:    newRoute(svc.HandleRetry),
+		payloads.PipelineClusterRequest:    newRoute(svc.HandleCluster),
+		payloads.PipelineDuplicatesRequest: newRoute(svc.HandleDuplicates),
+		payloads.PipelineCentroidsRequest:  newRoute(svc.HandleCentroids),
+		payloads.PipelineProjectRequest:    newRoute(svc.HandleProjection),
+		payloads.PipelineExportRequest:     newRoute(svc.HandleExport),
+		payloads.PipelineImportRequest:     newRoute(svc.HandleImport),
+		payloads.PipelineReviewDeleted:     newRoute(svc.HandleReviewDeleted),
+		payloads.PipelineReembedRequest:    newRoute(svc.HandleReembed),
+	}
+
+	controlRoutes := map[string]route{
+		payloads.PipelineVectorizeCancel: newRoute(svc.HandleCancel),
+		payloads.PipelineMaintenance:     newRoute(svc.HandleMaintenance),
+	}
+
+	realtimeRoutes := map[string]route{
+		payloads.PipelineReviewRequest: newRoute(svc.HandleVectorizeReview),
+	}
+
+	topics := make([]string, 0, len(routes))
+	retryTopics := make([]string, 0, len(routes)+len(controlRoutes)+len(realtimeRoutes))
+	for eventType := range routes {
+		topics = append(topics, cfg.Topic(eventType))
+		retryTopics = append(retryTopics, RetryTopic(cfg.Topic(eventType)))
+	}
+
+	controlTopics := make([]string, 0, len(controlRoutes))
+	for eventType, r := range controlRoutes {
+		controlTopics = append(controlTopics, cfg.Topic(eventType))
+		retryTopics = append(retryTopics, RetryTopic(cfg.Topic(eventType)))
+		r.control = true
+		routes[eventType] = r
+	}
+
+	realtimeTopics := make([]string, 0, len(realtimeRoutes))
+	for eventType, r := range realtimeRoutes {
+		realtimeTopics = append(realtimeTopics, cfg.Topic(eventType))
+		retryTopics = append(retryTopics, RetryTopic(cfg.Topic(eventType)))
+		routes[eventType] = r
+	}
+
+	reader := newReader(cfg, dialer, cfg.GroupID, topics...)
+	retryReader := newReader(cfg, dialer, cfg.GroupID+"-retry", retryTopics...)
+	controlReader := newReader(cfg, dialer, cfg.GroupID+"-control", controlTopics...)
+	realtimeReader := newReader(cfg, dialer, cfg.GroupID+"-realtime", realtimeTopics...)
+
+	return &KafkaConsumer{
+		reader:         reader,
+		retryReader:    retryReader,
+		controlReader:  controlReader,
+		realtimeReader: realtimeReader,
+		routes:         routes,
+		svc:            svc,
+		codec:          codec,
+		gate:           newPauseGate(),
+		producer:       producer,
+		cfg:            cfg,
+		logger:         logger,
+	}, nil
 }
 
+// newReader creates a reader of the consumer group for the topics, tuned as
+// configured and connecting through the dialer.
+func newReader(cfg config.KafkaConfig, dialer *kafka.Dialer, groupID string, topics ...string) *kafka.Reader {
+	startOffset := kafka.FirstOffset
+	if cfg.StartOffset == "latest" {
+		startOffset = kafka.LastOffset
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:          cfg.Brokers,
+		Dialer:           dialer,
+		GroupID:          groupID,
+		GroupTopics:      topics,
+		SessionTimeout:   cfg.SessionTimeout,
+		RebalanceTimeout: cfg.RebalanceTimeout,
+		MinBytes:         cfg.FetchMinBytes,
+		MaxBytes:         cfg.FetchMaxBytes,
+		MaxWait:          cfg.FetchMaxWait,
+		StartOffset:      startOffset,
+	})
+}
+
+// Run consumes until ctx is done or a message cannot be settled. Offsets are
+// committed only once a message has been handled, or handed on to its retry
+// or dead-letter topic, so a message being handled when the consumer stops
+// is delivered again (at least once); redelivered requests are deduplicated
+// by saga.
 func (kc *KafkaConsumer) Run(ctx context.Context) error {
-	return kc.consumer.Run(ctx)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return kc.consume(gctx, kc.reader, kc.gate)
+	})
+	g.Go(func() error {
+		return kc.consume(gctx, kc.controlReader, nil)
+	})
+	g.Go(func() error {
+		return kc.consume(gctx, kc.realtimeReader, kc.gate)
+	})
+	g.Go(func() error {
+		return kc.runRetries(gctx)
+	})
+
+	return g.Wait()
+}
+
+// consume processes the reader's messages one at a time, committing each
+// once it is settled. With a gate, messages wait while it is paused.
+func (kc *KafkaConsumer) consume(ctx context.Context, reader *kafka.Reader, gate *pauseGate) error {
+	for {
+		m, err := reader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		if gate != nil {
+			if err := gate.wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := kc.process(ctx, m); err != nil {
+			return err
+		}
+		if err := kc.commit(ctx, reader, m); err != nil {
+			return err
+		}
+	}
+}
+
+// runRetries delivers the messages of the retry topics again once their
+// backoff has passed. Messages are read in order, so one with a long
+// backoff delays those behind it on the same partition.
+func (kc *KafkaConsumer) runRetries(ctx context.Context) error {
+	for {
+		m, err := kc.retryReader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, notBefore := retryState(m)
+		if err := waitUntil(ctx, notBefore); err != nil {
+			return err
+		}
+		if err := kc.gate.wait(ctx); err != nil {
+			return err
+		}
+
+		retried := m
+		retried.Topic = originalTopic(m)
+		if err := kc.process(ctx, retried); err != nil {
+			return err
+		}
+		if err := kc.commit(ctx, kc.retryReader, m); err != nil {
+			return err
+		}
+	}
+}
+
+// commit commits a settled message's offset. It is not cancelled with ctx,
+// so work finished during shutdown is not redone.
+func (kc *KafkaConsumer) commit(ctx context.Context, reader *kafka.Reader, m kafka.Message) error {
+	if err := reader.CommitMessages(context.WithoutCancel(ctx), m); err != nil {
+		return fmt.Errorf("failed to commit offset %d of %s/%d: %w", m.Offset, m.Topic, m.Partition, err)
+	}
+	return nil
+}
+
+// process handles a message and settles it: it returns nil once the message
+// was handled or forwarded to its retry or dead-letter topic, and an error
+// when it is left unsettled and must not be committed.
+func (kc *KafkaConsumer) process(ctx context.Context, m kafka.Message) error {
+	// Continue the producer's trace when the message carries one.
+	ctx = otel.GetTextMapPropagator().Extract(ctx, telemetry.HeaderCarrier{Headers: &m.Headers})
+	ctx, span := telemetry.Tracer().Start(ctx, "consume "+m.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.Int("messaging.kafka.destination.partition", m.Partition),
+			attribute.Int64("messaging.kafka.message.offset", m.Offset),
+		))
+	defer span.End()
+
+	value, err := kc.codec.Decode(ctx, m.Value)
+	if errors.Is(err, codec.ErrRegistryUnavailable) {
+		// Nothing wrong with the message; it is delivered again once the
+		// registry is back.
+		kc.logger.Error("Failed to decode message", "topic", m.Topic, "offset", m.Offset, "error", err)
+		return err
+	}
+	if err != nil {
+		kc.logger.Error("Undecodable message", "topic", m.Topic, "offset", m.Offset, "error", err)
+		return kc.deadLetter(ctx, m, 1, fmt.Errorf("undecodable message: %w", err))
+	}
+
+	var envelope events.Envelope[json.RawMessage]
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		kc.logger.Error("Invalid message format", "topic", m.Topic, "offset", m.Offset, "error", err)
+		return kc.deadLetter(ctx, m, 1, fmt.Errorf("invalid message format: %w", err))
+	}
+
+	if envelope.SagaID == "" {
+		kc.logger.Error("Missing saga_id in message", "topic", m.Topic, "offset", m.Offset)
+		return kc.deadLetter(ctx, m, 1, fmt.Errorf("missing saga_id"))
+	}
+	ctx = producer.WithHeaders(ctx, kc.propagatedHeaders(m, envelope.TraceID)...)
+	ctx = service.WithAuditSource(ctx, auditActor(envelope.Meta.Initiator), envelope.Type)
+
+	r, ok := kc.routes[envelope.Type]
+	if !ok {
+		kc.logger.Error("Unknown event type", "type", envelope.Type, "topic", m.Topic, "saga_id", envelope.SagaID)
+		return kc.deadLetter(ctx, m, 1, fmt.Errorf("unknown event type %q", envelope.Type))
+	}
+
+	payload, err := r.decode(envelope.Payload)
+	if err != nil {
+		kc.logger.Error("Payload validation failed", "type", envelope.Type, "saga_id", envelope.SagaID, "error", err)
+		kc.rejectInvalid(ctx, envelope.Type, envelope.SagaID, err)
+		return kc.deadLetter(ctx, m, 1, err)
+	}
+
+	if !r.control && kc.svc.InMaintenance(ctx) {
+		if kc.producer != nil {
+			return kc.park(ctx, m, envelope.Type, envelope.SagaID)
+		}
+		// Without a retry topic to park it on, the message waits here.
+		for kc.svc.InMaintenance(ctx) {
+			if err := waitUntil(ctx, time.Now().Add(kc.cfg.MaintenanceBackoff)); err != nil {
+				return err
+			}
+		}
+	}
+
+	kc.logger.Info("Processing message", "type", envelope.Type, "saga_id", envelope.SagaID)
+	span.SetAttributes(
+		attribute.String("event.type", envelope.Type),
+		attribute.String("saga.id", envelope.SagaID),
+	)
+
+	attempt, _ := retryState(m)
+	attempt++
+	maxAttempts := max(kc.cfg.MaxAttempts, 1)
+	if attempt < maxAttempts {
+		ctx = service.WithRetriesLeft(ctx)
+	}
+
+	err = kc.handle(ctx, r, payload, envelope.Type, envelope.SagaID)
+	if err == nil {
+		return nil
+	}
+
+	kc.logger.Error("Handle error",
+		"type", envelope.Type,
+		"saga_id", envelope.SagaID,
+		"attempt", attempt,
+		"max_attempts", maxAttempts,
+		"error", err)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	switch {
+	case ctx.Err() != nil:
+		// Shutting down; the message is delivered again after a restart and
+		// its run resumed.
+		return ctx.Err()
+	case attempt >= maxAttempts || service.IsPermanent(err):
+		return kc.deadLetter(ctx, m, attempt, err)
+	default:
+		return kc.retry(ctx, m, attempt, err)
+	}
+}
+
+// auditActor attributes the operations an event triggers to its initiator.
+func auditActor(initiator events.Initiator) string {
+	if initiator == "" {
+		return "kafka"
+	}
+	return "kafka:" + string(initiator)
+}
+
+// handle runs the route's handler, turning a panic into an error so that the
+// message is retried like any other failure instead of the consumer crashing.
+// Panics are reported with their stack.
+func (kc *KafkaConsumer) handle(ctx context.Context, r route, payload any, eventType, sagaID string) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			kc.logger.Error("Handler panicked", "type", eventType, "saga_id", sagaID, "panic", value)
+			telemetry.ReportPanic(ctx, "handler_panic", value, map[string]string{"saga_id": sagaID, "event_type": eventType})
+			err = fmt.Errorf("handler panicked: %v", value)
+		}
+	}()
+	return r.handle(ctx, payload, sagaID)
+}
+
+// propagatedHeaders returns the message's headers that are passed on to the
+// events published while handling it. The envelope's trace ID is passed on
+// when the message has no trace_id header.
+func (kc *KafkaConsumer) propagatedHeaders(m kafka.Message, traceID string) []kafka.Header {
+	var headers []kafka.Header
+	hasTraceID := false
+	for _, h := range m.Headers {
+		if slices.Contains(kc.cfg.PropagateHeaders, h.Key) {
+			headers = append(headers, h)
+			hasTraceID = hasTraceID || h.Key == "trace_id"
+		}
+	}
+
+	if traceID != "" && !hasTraceID && slices.Contains(kc.cfg.PropagateHeaders, "trace_id") {
+		headers = append(headers, kafka.Header{Key: "trace_id", Value: []byte(traceID)})
+	}
+
+	return headers
+}
+
+// retry publishes a message whose handling failed to its topic's retry
+// topic, to be delivered again after an exponentially growing backoff.
+func (kc *KafkaConsumer) retry(ctx context.Context, m kafka.Message, attempt int, cause error) error {
+	if kc.producer == nil {
+		return nil
+	}
+
+	backoff := retryBackoff(kc.cfg.RetryBackoff, kc.cfg.RetryBackoffMax, kc.cfg.RetryBackoffFactor, attempt)
+	if err := kc.producer.PublishMessage(context.WithoutCancel(ctx), newRetry(m, attempt, backoff, cause)); err != nil {
+		kc.logger.Error("Failed to schedule retry, dead-lettering message", "topic", m.Topic, "offset", m.Offset, "error", err)
+		return kc.deadLetter(ctx, m, attempt, cause)
+	}
+
+	kc.logger.Warn("Scheduled message for retry",
+		"topic", m.Topic,
+		"retry_topic", RetryTopic(m.Topic),
+		"offset", m.Offset,
+		"attempt", attempt,
+		"backoff", backoff)
+
+	return nil
+}
+
+// park defers a message in maintenance mode to its topic's retry topic, to
+// be delivered again after kafka.maintenance_backoff, without using up one
+// of its attempts.
+func (kc *KafkaConsumer) park(ctx context.Context, m kafka.Message, eventType, sagaID string) error {
+	attempts, _ := retryState(m)
+	if err := kc.producer.PublishMessage(context.WithoutCancel(ctx), newRetry(m, attempts, kc.cfg.MaintenanceBackoff, service.ErrMaintenance)); err != nil {
+		return fmt.Errorf("failed to park offset %d of %s: %w", m.Offset, m.Topic, err)
+	}
+
+	kc.logger.Info("Deferred message during maintenance",
+		"type", eventType,
+		"saga_id", sagaID,
+		"retry_topic", RetryTopic(m.Topic),
+		"backoff", kc.cfg.MaintenanceBackoff)
+	return nil
+}
+
+// rejectInvalid tells the saga that its request was rejected as invalid, so
+// it fails fast instead of waiting for a completed event that never comes.
+func (kc *KafkaConsumer) rejectInvalid(ctx context.Context, eventType, sagaID string, cause error) {
+	if kc.producer == nil {
+		return
+	}
+
+	event := payloads.InvalidRequest{Type: eventType, Message: cause.Error()}
+	var invalid *payloads.ValidationError
+	if errors.As(cause, &invalid) {
+		event.Errors = invalid.Fields
+	}
+
+	envelope := kc.producer.BuildInvalidRequestEnvelope(event, sagaID)
+	if err := kc.producer.PublishEvent(context.WithoutCancel(ctx), []byte(sagaID), envelope); err != nil {
+		kc.logger.Error("Failed to publish invalid request event", "type", eventType, "saga_id", sagaID, "error", err)
+	}
+}
+
+// deadLetter forwards a message that cannot be processed to its topic's
+// dead-letter topic, so it neither blocks the partition nor gets lost.
+func (kc *KafkaConsumer) deadLetter(ctx context.Context, m kafka.Message, attempts int, cause error) error {
+	if kc.producer == nil {
+		return nil
+	}
+
+	if err := kc.producer.PublishMessage(context.WithoutCancel(ctx), newDeadLetter(m, attempts, cause)); err != nil {
+		return fmt.Errorf("failed to dead-letter offset %d of %s: %w", m.Offset, m.Topic, err)
+	}
+
+	kc.logger.Warn("Forwarded message to dead-letter topic",
+		"topic", m.Topic,
+		"dead_letter_topic", DeadLetterTopic(m.Topic),
+		"offset", m.Offset,
+		"attempts", attempts)
+
+	return nil
 }
 
 func (kc *KafkaConsumer) Close() error {
-	return kc.consumer.Close()
+	return errors.Join(kc.reader.Close(), kc.retryReader.Close(), kc.controlReader.Close(), kc.realtimeReader.Close())
 }
@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pauseGate holds consumption while paused. Closing resumed lets waiting
+// readers continue.
+type pauseGate struct {
+	mu       sync.Mutex
+	pausedAt *time.Time
+	resumed  chan struct{}
+}
+
+func newPauseGate() *pauseGate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &pauseGate{resumed: resumed}
+}
+
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.pausedAt != nil {
+		return false
+	}
+	now := time.Now()
+	g.pausedAt = &now
+	g.resumed = make(chan struct{})
+	return true
+}
+
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.pausedAt == nil {
+		return false
+	}
+	g.pausedAt = nil
+	close(g.resumed)
+	return true
+}
+
+func (g *pauseGate) state() *time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.pausedAt
+}
+
+// wait blocks while the gate is paused.
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	resumed := g.resumed
+	g.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pause stops handling requests, retries and single-review requests until
+// Resume, e.g. during a provider outage or database maintenance. A message
+// already being handled is finished; the next one fetched waits, uncommitted.
+// Control events such as cancellations are still handled. It reports whether
+// the consumer was running.
+func (kc *KafkaConsumer) Pause() bool {
+	if !kc.gate.pause() {
+		return false
+	}
+	kc.logger.Warn("Consumer paused")
+	return true
+}
+
+// Resume continues consumption after Pause. It reports whether the consumer
+// was paused.
+func (kc *KafkaConsumer) Resume() bool {
+	if !kc.gate.resume() {
+		return false
+	}
+	kc.logger.Info("Consumer resumed")
+	return true
+}
+
+// PausedAt returns when the consumer was paused, or nil while it runs.
+func (kc *KafkaConsumer) PausedAt() *time.Time {
+	return kc.gate.state()
+}
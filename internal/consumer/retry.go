@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RetrySuffix is appended to a topic's name to get the topic its failed
+// messages wait on before being delivered again.
+const RetrySuffix = ".retry"
+
+// Headers added to a message sent to a retry topic.
+const (
+	HeaderRetryAttempt   = "x-retry-attempt"
+	HeaderRetryTopic     = "x-retry-original-topic"
+	HeaderRetryNotBefore = "x-retry-not-before"
+	HeaderRetryError     = "x-retry-error"
+)
+
+func RetryTopic(topic string) string {
+	return topic + RetrySuffix
+}
+
+// retryBackoff returns how long to wait before the next delivery after the
+// given failed attempt: the initial backoff, multiplied by factor for every
+// further attempt and capped at maxBackoff when that is set.
+func retryBackoff(initial, maxBackoff time.Duration, factor float64, attempt int) time.Duration {
+	if factor < 1 {
+		factor = 1
+	}
+
+	backoff := float64(initial) * math.Pow(factor, float64(attempt-1))
+	if maxBackoff > 0 && backoff > float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// newRetry wraps a message that failed its attempt-th delivery for its retry
+// topic, to be delivered again once backoff has passed.
+func newRetry(m kafka.Message, attempt int, backoff time.Duration, cause error) kafka.Message {
+	var headers []kafka.Header
+	for _, header := range m.Headers {
+		if !strings.HasPrefix(header.Key, "x-retry-") {
+			headers = append(headers, header)
+		}
+	}
+	headers = append(headers,
+		kafka.Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(attempt))},
+		kafka.Header{Key: HeaderRetryTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderRetryNotBefore, Value: []byte(time.Now().Add(backoff).UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: HeaderRetryError, Value: []byte(cause.Error())},
+	)
+
+	return kafka.Message{
+		Topic:   RetryTopic(m.Topic),
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}
+}
+
+// retryState returns the number of failed deliveries recorded on a message
+// and the time before which it must not be delivered again. Messages read
+// from a request topic have no failed deliveries.
+func retryState(m kafka.Message) (attempts int, notBefore time.Time) {
+	for _, header := range m.Headers {
+		switch header.Key {
+		case HeaderRetryAttempt:
+			attempts, _ = strconv.Atoi(string(header.Value))
+		case HeaderRetryNotBefore:
+			notBefore, _ = time.Parse(time.RFC3339Nano, string(header.Value))
+		}
+	}
+	return attempts, notBefore
+}
+
+// originalTopic returns the request topic a retried message was first
+// published to.
+func originalTopic(m kafka.Message) string {
+	for _, header := range m.Headers {
+		if header.Key == HeaderRetryTopic {
+			return string(header.Value)
+		}
+	}
+	return strings.TrimSuffix(m.Topic, RetrySuffix)
+}
+
+// waitUntil blocks until t or until ctx is done, whichever comes first.
+func waitUntil(ctx context.Context, t time.Time) error {
+	delay := time.Until(t)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
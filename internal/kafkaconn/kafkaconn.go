@@ -0,0 +1,122 @@
+// Package kafkaconn builds the TLS and SASL settings shared by every Kafka
+// reader, writer and admin connection of the service.
+package kafkaconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SASL mechanisms supported in kafka.sasl.mechanism.
+const (
+	MechanismPlain       = "PLAIN"
+	MechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	MechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+const dialTimeout = 10 * time.Second
+
+// NewDialer returns the dialer readers and direct broker connections use.
+func NewDialer(cfg config.KafkaConfig) (*kafka.Dialer, error) {
+	tlsConfig, mechanism, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// NewTransport returns the transport writers use.
+func NewTransport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	tlsConfig, mechanism, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+func security(cfg config.KafkaConfig) (*tls.Config, sasl.Mechanism, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Kafka TLS settings: %w", err)
+	}
+
+	mechanism, err := newMechanism(cfg.SASL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Kafka SASL settings: %w", err)
+	}
+
+	return tlsConfig, mechanism, nil
+}
+
+// newTLSConfig returns nil when TLS is disabled. Without a CA file the
+// system roots verify the brokers, as for managed clusters.
+func newTLSConfig(cfg config.KafkaTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// newMechanism returns nil when no SASL mechanism is configured.
+func newMechanism(cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "":
+		return nil, nil
+	case MechanismPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case MechanismSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.Username, cfg.Password)
+	case MechanismSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.Username, cfg.Password)
+	default:
+		return nil, fmt.Errorf("unsupported mechanism %q, expected %s, %s or %s",
+			cfg.Mechanism, MechanismPlain, MechanismSCRAMSHA256, MechanismSCRAMSHA512)
+	}
+}
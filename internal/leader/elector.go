@@ -0,0 +1,72 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// Elector picks one replica among those sharing the database to run the
+// periodic jobs, such as the scheduler and the outbox purge, by holding a
+// Postgres advisory lock. When the leader's session dies, Postgres drops the
+// lock and another replica takes over at its next attempt.
+type Elector struct {
+	repo    storage.Repository
+	cfg     config.LeaderElectionConfig
+	logger  *slog.Logger
+	leading atomic.Bool
+}
+
+func NewElector(repo storage.Repository, cfg config.LeaderElectionConfig, logger *slog.Logger) *Elector {
+	return &Elector{repo: repo, cfg: cfg, logger: logger}
+}
+
+// IsLeader reports whether the replica currently leads. A nil Elector, used
+// while leader election is off, always leads.
+func (e *Elector) IsLeader() bool {
+	return e == nil || e.leading.Load()
+}
+
+// Run tries to take the lead every leader_election.check_interval and, once
+// leading, checks as often that it still holds the lock, until ctx is done.
+// The lock is released on the way out so another replica can take over
+// right away.
+func (e *Elector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	var lease *storage.AdvisoryLease
+	defer func() {
+		if lease != nil {
+			e.leading.Store(false)
+			lease.Release()
+		}
+	}()
+
+	for {
+		if lease == nil {
+			var err error
+			if lease, err = e.repo.TryAdvisoryLease(ctx, e.cfg.Key); err != nil {
+				e.logger.Warn("Failed to take part in leader election", "error", err)
+			} else if lease != nil {
+				e.leading.Store(true)
+				e.logger.Info("Became leader, running periodic jobs")
+			}
+		} else if err := lease.Alive(ctx); err != nil && ctx.Err() == nil {
+			e.leading.Store(false)
+			lease.Release()
+			lease = nil
+			e.logger.Warn("Lost leadership, stopping periodic jobs", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
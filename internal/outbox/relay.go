@@ -0,0 +1,104 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/leader"
+	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// purgeInterval is how often sent messages past their retention are deleted.
+const purgeInterval = time.Hour
+
+// Relay publishes the events queued in the outbox together with the run
+// results they announce, so a saga learns how its run ended even when the
+// instance that ran it died before publishing. Messages are published at
+// least once; relays on several instances share the work, while only the
+// leading instance purges.
+type Relay struct {
+	repo     storage.Repository
+	producer *producer.Producer
+	leader   *leader.Elector
+	cfg      config.OutboxConfig
+	logger   *slog.Logger
+}
+
+// NewRelay returns a relay that purges while elector leads; with a nil
+// elector it always does.
+func NewRelay(repo storage.Repository, producer *producer.Producer, elector *leader.Elector, cfg config.OutboxConfig, logger *slog.Logger) *Relay {
+	return &Relay{
+		repo:     repo,
+		producer: producer,
+		leader:   elector,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// Run publishes pending messages every outbox.poll_interval and deletes sent
+// ones older than outbox.retention until ctx is done.
+func (r *Relay) Run(ctx context.Context) error {
+	pollInterval := r.cfg.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	purgeTicker := time.NewTicker(purgeInterval)
+	defer purgeTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.relay(ctx)
+		case <-purgeTicker.C:
+			r.purge(ctx)
+		}
+	}
+}
+
+// relay publishes batches of pending messages until none are left. A failed
+// batch stays pending for the next poll.
+func (r *Relay) relay(ctx context.Context) {
+	batchSize := max(r.cfg.BatchSize, 1)
+
+	for ctx.Err() == nil {
+		sent, err := r.repo.RelayOutbox(ctx, batchSize, func(messages []storage.OutboxMessage) error {
+			return r.producer.PublishOutbox(ctx, messages)
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Error("Failed to relay outbox", "error", err)
+			}
+			return
+		}
+		if sent > 0 {
+			r.logger.Debug("Relayed outbox messages", "count", sent)
+		}
+		if sent < batchSize {
+			return
+		}
+	}
+}
+
+func (r *Relay) purge(ctx context.Context) {
+	if r.cfg.Retention <= 0 || !r.leader.IsLeader() {
+		return
+	}
+
+	purged, err := r.repo.PurgeOutbox(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		r.logger.Warn("Failed to purge outbox", "error", err)
+		return
+	}
+	if purged > 0 {
+		r.logger.Info("Purged sent outbox messages", "count", purged)
+	}
+}
@@ -0,0 +1,494 @@
+package payloads
+
+import (
+	"time"
+
+	"github.com/quiby-ai/common/pkg/events"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// Topics for events that are specific to this service and not yet part of the
+// shared topic list.
+const (
+	PipelineVectorizeProgress  = "pipeline.vectorize_reviews.progress"
+	PipelineVectorizeRetry     = "pipeline.vectorize_reviews.retry"
+	PipelineVectorizeCancel    = "pipeline.vectorize_reviews.cancel"
+	PipelineVectorizeCancelled = "pipeline.vectorize_reviews.cancelled"
+	PipelineMaintenance        = "pipeline.vectorize_reviews.maintenance"
+	PipelineClusterRequest     = "pipeline.cluster_reviews.request"
+	PipelineClusterCompleted   = "pipeline.cluster_reviews.completed"
+	PipelineDuplicatesRequest  = "pipeline.detect_duplicates.request"
+	PipelineDuplicatesSummary  = "pipeline.detect_duplicates.completed"
+	PipelineProjectRequest     = "pipeline.project_embeddings.request"
+	PipelineProjectCompleted   = "pipeline.project_embeddings.completed"
+	PipelineCentroidsRequest   = "pipeline.aggregate_centroids.request"
+	PipelineCentroidsCompleted = "pipeline.aggregate_centroids.completed"
+	PipelineExportRequest      = "pipeline.export_embeddings.request"
+	PipelineExportCompleted    = "pipeline.export_embeddings.completed"
+	PipelineImportRequest      = "pipeline.import_embeddings.request"
+	PipelineImportCompleted    = "pipeline.import_embeddings.completed"
+	PipelineInvalidRequest     = "pipeline.invalid_request"
+	PipelineReviewDeleted      = "pipeline.review_deleted"
+	PipelineReembedRequest     = "pipeline.reembed_reviews.request"
+	PipelineReembedCompleted   = "pipeline.reembed_reviews.completed"
+	PipelineReviewRequest      = "pipeline.vectorize_review.request"
+	PipelineReviewCompleted    = "pipeline.vectorize_review.completed"
+	PipelineSpendReport        = "pipeline.spend_report"
+	PipelineQuotaExceeded      = "pipeline.vectorize_reviews.quota_exceeded"
+	PipelineEmbeddingDrift     = "pipeline.embedding_drift"
+	MetricsEmbeddingUsage      = "metrics.embedding_usage"
+)
+
+// VectorizeRequest represents the payload this service accepts for
+// pipeline.vectorize_reviews.request events: the shared payload plus optional
+// run options, which producers of the shared payload simply omit.
+type VectorizeRequest struct {
+	events.VectorizeRequest
+	// TenantID confines the run to the tenant's reviews and embeddings.
+	TenantID         string   `json:"tenant_id,omitempty"`
+	ForceRecompute   bool     `json:"force_recompute,omitempty"`
+	StaleModel       bool     `json:"stale_model,omitempty"`
+	ResponseBackfill bool     `json:"response_backfill,omitempty"`
+	Incremental      bool     `json:"incremental,omitempty"`
+	Limit            int      `json:"limit,omitempty" validate:"min=0"`
+	Languages        []string `json:"languages,omitempty" validate:"dive,required"`
+	DryRun           bool     `json:"dry_run,omitempty"`
+
+	// Targeting filters narrowing a run down to specific reviews.
+	MinRating        int      `json:"min_rating,omitempty" validate:"min=0,max=5"`
+	MaxRating        int      `json:"max_rating,omitempty" validate:"min=0,max=5"`
+	ReviewIDs        []string `json:"review_ids,omitempty" validate:"dive,required"`
+	OnlyWithResponse bool     `json:"only_with_response,omitempty"`
+
+	// Order is the order reviews are processed in: newest_first (the
+	// default), oldest_first, lowest_rating_first or highest_rating_first.
+	Order string `json:"order,omitempty" validate:"omitempty,oneof=newest_first oldest_first lowest_rating_first highest_rating_first"`
+
+	// SamplePercent vectorizes only a reproducible sample of about this
+	// percentage of the matching reviews, picked by SampleSeed.
+	SamplePercent float64 `json:"sample_percent,omitempty" validate:"min=0,max=100"`
+	SampleSeed    int64   `json:"sample_seed,omitempty"`
+
+	// Deadline is when the orchestrator gives up on the saga. The run stops
+	// in time to report its partial progress in a pipeline.failed event.
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// Validate checks the shared payload fields as well as the run options.
+func (r VectorizeRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// CostEstimate is the outcome of a dry run: what a run with the same filters
+// would send to the embedding provider and what it would cost.
+type CostEstimate struct {
+	Model            string  `json:"model"`
+	Reviews          int64   `json:"reviews"`
+	Responses        int64   `json:"responses"`
+	EstimatedTokens  int64   `json:"estimated_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// SpendReport is the embedding spend of a month (YYYY-MM) by app and model,
+// as returned by GET /spend and published monthly for pipeline.spend_report
+// events.
+type SpendReport struct {
+	Month    string               `json:"month"`
+	TenantID string               `json:"tenant_id,omitempty"`
+	AppID    string               `json:"app_id,omitempty"`
+	Reviews  int64                `json:"reviews"`
+	Tokens   int64                `json:"tokens"`
+	CostUSD  float64              `json:"cost_usd"`
+	Entries  []storage.SpendEntry `json:"entries"`
+}
+
+// EmbeddingDrift represents the payload for pipeline.embedding_drift events,
+// published when the recent content vectors of an app drift from its
+// baseline, typically because the provider changed the model behind its
+// name. MeanDistance is the cosine distance between the mean vectors and
+// NormDistance the total variation distance between the histograms of
+// vector norms.
+type EmbeddingDrift struct {
+	AppID             string    `json:"app_id"`
+	Model             string    `json:"model"`
+	Samples           int       `json:"samples"`
+	BaselineSamples   int       `json:"baseline_samples"`
+	BaselineCreatedAt time.Time `json:"baseline_created_at"`
+	MeanDistance      float64   `json:"mean_distance"`
+	NormDistance      float64   `json:"norm_distance"`
+	MeanThreshold     float64   `json:"mean_threshold"`
+	NormThreshold     float64   `json:"norm_threshold"`
+}
+
+// VectorizeCompleted represents the payload this service publishes for
+// pipeline.vectorize_reviews.completed events. It extends the shared payload
+// with the run counts; processed review IDs are not inlined but recorded in a
+// run artifact referenced by ReviewsArtifact. Failures are counted by reason,
+// and the first 100 failing review IDs are listed in FailedReviewIDs. With
+// artifacts.destination set, Bundle is the manifest of the run's bundle on
+// object storage, ReviewsArtifact its list of processed review IDs, and the
+// failing review IDs are only in the bundle.
+type VectorizeCompleted struct {
+	events.VectorizeCompleted
+	TenantID        string         `json:"tenant_id,omitempty"`
+	Processed       int            `json:"processed"`
+	Skipped         int            `json:"skipped"`
+	SkippedReasons  map[string]int `json:"skipped_reasons,omitempty"`
+	Failed          int            `json:"failed"`
+	FailedReasons   map[string]int `json:"failed_reasons,omitempty"`
+	FailedReviewIDs []string       `json:"failed_review_ids,omitempty"`
+	Tokens          int64          `json:"tokens,omitempty"`
+	CostUSD         float64        `json:"cost_usd,omitempty"`
+	ReviewsArtifact string         `json:"reviews_artifact,omitempty"`
+	Bundle          string         `json:"bundle,omitempty"`
+	DryRun          bool           `json:"dry_run,omitempty"`
+	Estimate        *CostEstimate  `json:"estimate,omitempty"`
+}
+
+// VectorizeProgress represents the payload for
+// pipeline.vectorize_reviews.progress events, published periodically while a
+// run is in flight.
+type VectorizeProgress struct {
+	AppID               string     `json:"app_id"`
+	RunID               string     `json:"run_id"`
+	Processed           int        `json:"processed"`
+	Skipped             int        `json:"skipped"`
+	Failed              int        `json:"failed"`
+	Remaining           int64      `json:"remaining"`
+	EstimatedCompletion *time.Time `json:"estimated_completion,omitempty"`
+}
+
+// VectorizeFailed represents the payload this service publishes for
+// pipeline.failed events when a run fails. Step, Code and Recoverable match
+// the shared Failed payload; the remaining fields describe the partial run.
+type VectorizeFailed struct {
+	Step        events.SagaStep   `json:"step"`
+	Code        events.FailedCode `json:"code"`
+	Recoverable bool              `json:"recoverable"`
+	AppID       string            `json:"app_id"`
+	RunID       string            `json:"run_id,omitempty"`
+	Message     string            `json:"message"`
+	Processed   int               `json:"processed"`
+	Skipped     int               `json:"skipped"`
+	Failed      int               `json:"failed"`
+	// Deferred counts the reviews a run stopped at its deadline did not get
+	// to.
+	Deferred int `json:"deferred,omitempty"`
+}
+
+// EmbeddingUsage represents the payload for metrics.embedding_usage events,
+// published per model for every batch a run embeds: the provider requests it
+// took, retries included, the failed ones, their total latency and the
+// tokens billed, priced by vectorizer.pricing.
+type EmbeddingUsage struct {
+	RunID     string    `json:"run_id"`
+	AppID     string    `json:"app_id,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Model     string    `json:"model"`
+	Reviews   int       `json:"reviews"`
+	Requests  int       `json:"requests"`
+	Errors    int       `json:"errors"`
+	Tokens    int64     `json:"tokens"`
+	CostUSD   float64   `json:"cost_usd"`
+	LatencyMS int64     `json:"latency_ms"`
+	At        time.Time `json:"at"`
+}
+
+// QuotaExceeded represents the payload for
+// pipeline.vectorize_reviews.quota_exceeded events, published when a run
+// stops because its next batch would exceed a monthly quota of its app or
+// tenant. Limit is "tokens" or "reviews"; Used is what the month used of it.
+// The Deferred reviews are left for a later run.
+type QuotaExceeded struct {
+	AppID         string `json:"app_id"`
+	TenantID      string `json:"tenant_id,omitempty"`
+	RunID         string `json:"run_id"`
+	QuotaAppID    string `json:"quota_app_id,omitempty"`
+	QuotaTenantID string `json:"quota_tenant_id,omitempty"`
+	Limit         string `json:"limit"`
+	Used          int64  `json:"used"`
+	Max           int64  `json:"max"`
+	Processed     int    `json:"processed"`
+	Deferred      int    `json:"deferred"`
+}
+
+// VectorizeRetry represents the payload for pipeline.vectorize_reviews.retry
+// events, which reprocess the reviews recorded in the error ledger. An empty
+// AppID retries failed reviews of every app.
+type VectorizeRetry struct {
+	AppID string `json:"app_id"`
+}
+
+func (r VectorizeRetry) Validate() error {
+	return validateStruct(r)
+}
+
+// VectorizeCancel represents the payload for pipeline.vectorize_reviews.cancel
+// events, which stop the running vectorization of the envelope's saga.
+type VectorizeCancel struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func (c VectorizeCancel) Validate() error {
+	return validateStruct(c)
+}
+
+// Maintenance represents the payload for pipeline.vectorize_reviews.maintenance
+// events, which switch maintenance mode on or off for every instance.
+type Maintenance struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (m Maintenance) Validate() error {
+	return validateStruct(m)
+}
+
+// VectorizeCancelled represents the payload this service publishes for
+// pipeline.vectorize_reviews.cancelled events when a run stops on a
+// cancellation request. The counts cover the work done until then, which the
+// run keeps.
+type VectorizeCancelled struct {
+	AppID     string `json:"app_id"`
+	RunID     string `json:"run_id"`
+	Processed int    `json:"processed"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+}
+
+// ClusterRequest represents the payload for pipeline.cluster_reviews.request
+// events, which cluster the embedded reviews of an app. K defaults to
+// clustering.k.
+type ClusterRequest struct {
+	AppID    string `json:"app_id" validate:"required"`
+	K        int    `json:"k,omitempty" validate:"min=0"`
+	DateFrom string `json:"date_from,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	DateTo   string `json:"date_to,omitempty" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (r ClusterRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// ClusterSize is the number of reviews in one cluster.
+type ClusterSize struct {
+	ClusterIndex int `json:"cluster_index"`
+	Size         int `json:"size"`
+}
+
+// ClusteringCompleted represents the payload this service publishes for
+// pipeline.cluster_reviews.completed events. The assignments and centroids
+// are stored under ClusteringID rather than inlined.
+type ClusteringCompleted struct {
+	AppID        string        `json:"app_id"`
+	ClusteringID string        `json:"clustering_id"`
+	Model        string        `json:"model"`
+	K            int           `json:"k"`
+	Reviews      int           `json:"reviews"`
+	Inertia      float64       `json:"inertia"`
+	Clusters     []ClusterSize `json:"clusters"`
+}
+
+// ProjectionRequest represents the payload for
+// pipeline.project_embeddings.request events, which compute the 2D
+// coordinates of the embedded reviews of an app for review maps.
+type ProjectionRequest struct {
+	AppID    string `json:"app_id" validate:"required"`
+	DateFrom string `json:"date_from,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	DateTo   string `json:"date_to,omitempty" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (r ProjectionRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// ProjectionCompleted represents the payload this service publishes for
+// pipeline.project_embeddings.completed events. The coordinates are stored
+// under ProjectionID rather than inlined.
+type ProjectionCompleted struct {
+	AppID             string  `json:"app_id"`
+	ProjectionID      string  `json:"projection_id"`
+	Model             string  `json:"model"`
+	Reviews           int     `json:"reviews"`
+	ExplainedVariance float64 `json:"explained_variance"`
+}
+
+// DuplicatesRequest represents the payload for
+// pipeline.detect_duplicates.request events, which flag near-duplicate
+// reviews of an app. Threshold defaults to duplicates.threshold.
+type DuplicatesRequest struct {
+	AppID     string  `json:"app_id" validate:"required"`
+	Threshold float64 `json:"threshold,omitempty" validate:"min=0,max=1"`
+	DateFrom  string  `json:"date_from,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	DateTo    string  `json:"date_to,omitempty" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (r DuplicatesRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// DuplicatesSummary represents the payload this service publishes for
+// pipeline.detect_duplicates.completed events. Groups counts sets of reviews
+// linked by near-duplicate pairs, such as one copy-paste campaign; the pairs
+// themselves are stored in review_duplicates.
+type DuplicatesSummary struct {
+	AppID          string  `json:"app_id"`
+	Model          string  `json:"model"`
+	Threshold      float64 `json:"threshold"`
+	Reviews        int     `json:"reviews"`
+	Pairs          int     `json:"pairs"`
+	FlaggedReviews int     `json:"flagged_reviews"`
+	Groups         int     `json:"groups"`
+	LargestGroup   int     `json:"largest_group"`
+}
+
+// CentroidsRequest represents the payload for
+// pipeline.aggregate_centroids.request events, which recompute an app's
+// centroids per ISO week and rating bucket, optionally only for the weeks of
+// a date range.
+type CentroidsRequest struct {
+	AppID    string `json:"app_id" validate:"required"`
+	DateFrom string `json:"date_from,omitempty" validate:"omitempty,datetime=2006-01-02"`
+	DateTo   string `json:"date_to,omitempty" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (r CentroidsRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// CentroidsCompleted represents the payload this service publishes for
+// pipeline.aggregate_centroids.completed events.
+type CentroidsCompleted struct {
+	CentroidsRequest
+	Model     string `json:"model"`
+	Centroids int64  `json:"centroids"`
+}
+
+// ExportRequest represents the payload for pipeline.export_embeddings.request
+// events, which write the embeddings matching the filters to a JSONL or
+// Parquet file at Destination (s3://bucket/key, gs://bucket/key or a local
+// path). Format defaults to the destination's extension.
+type ExportRequest struct {
+	Destination string `json:"destination" validate:"required"`
+	Format      string `json:"format,omitempty" validate:"omitempty,oneof=jsonl parquet"`
+	storage.SearchFilters
+}
+
+func (r ExportRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// ExportCompleted represents the payload this service publishes for
+// pipeline.export_embeddings.completed events.
+type ExportCompleted struct {
+	ExportRequest
+	Model string `json:"model"`
+	Rows  int64  `json:"rows"`
+}
+
+// ImportRequest represents the payload for pipeline.import_embeddings.request
+// events, which load precomputed embeddings from a JSONL or Parquet file at
+// Source (s3://bucket/key, gs://bucket/key or a local path). Model is assumed
+// for records that don't name theirs.
+type ImportRequest struct {
+	Source string `json:"source" validate:"required"`
+	Format string `json:"format,omitempty" validate:"omitempty,oneof=jsonl parquet"`
+	Model  string `json:"model,omitempty"`
+}
+
+func (r ImportRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// ImportCompleted represents the payload this service publishes for
+// pipeline.import_embeddings.completed events.
+type ImportCompleted struct {
+	ImportRequest
+	Imported        int64            `json:"imported"`
+	Rejected        int64            `json:"rejected"`
+	RejectedReasons map[string]int64 `json:"rejected_reasons,omitempty"`
+}
+
+// Reject counts a record rejected for the reason.
+func (c *ImportCompleted) Reject(reason string) {
+	if c.RejectedReasons == nil {
+		c.RejectedReasons = make(map[string]int64)
+	}
+	c.RejectedReasons[reason]++
+	c.Rejected++
+}
+
+// ReviewDeleted represents the payload for pipeline.review_deleted events,
+// announcing reviews removed upstream whose embeddings must go as well.
+type ReviewDeleted struct {
+	AppID     string   `json:"app_id,omitempty"`
+	ReviewIDs []string `json:"review_ids" validate:"required,min=1,dive,required"`
+}
+
+func (d ReviewDeleted) Validate() error {
+	return validateStruct(d)
+}
+
+// ReembedRequest represents the payload for pipeline.reembed_reviews.request
+// events, which recompute the embeddings of specific reviews, e.g. after
+// their text was corrected.
+type ReembedRequest struct {
+	AppID     string   `json:"app_id,omitempty"`
+	ReviewIDs []string `json:"review_ids" validate:"required,min=1,dive,required"`
+}
+
+func (r ReembedRequest) Validate() error {
+	return validateStruct(r)
+}
+
+// ReembedCompleted represents the payload this service publishes for
+// pipeline.reembed_reviews.completed events.
+type ReembedCompleted struct {
+	AppID     string `json:"app_id,omitempty"`
+	RunID     string `json:"run_id"`
+	Requested int    `json:"requested"`
+	Processed int    `json:"processed"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+}
+
+// InvalidRequest represents the payload this service publishes for
+// pipeline.invalid_request events when a request event is rejected before
+// being handled. Errors lists the invalid fields when the payload could be
+// decoded but failed validation.
+type InvalidRequest struct {
+	Type    string       `json:"type"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+}
+
+// VectorizeReview represents the payload for pipeline.vectorize_review.request
+// events, which embed a single review right away for real-time ingestion.
+// The review is read from clean_reviews unless its text is given inline in
+// Content, in which case the other fields describe it.
+type VectorizeReview struct {
+	ReviewID string `json:"review_id" validate:"required"`
+	AppID    string `json:"app_id,omitempty"`
+	Content  string `json:"content,omitempty"`
+	Response string `json:"response,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Language string `json:"language,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Rating   int16  `json:"rating,omitempty" validate:"min=0,max=5"`
+}
+
+func (r VectorizeReview) Validate() error {
+	return validateStruct(r)
+}
+
+// VectorizeReviewCompleted represents the payload this service publishes for
+// pipeline.vectorize_review.completed events. Skipped is the reason the
+// review was not embedded, empty when it was.
+type VectorizeReviewCompleted struct {
+	ReviewID  string `json:"review_id"`
+	AppID     string `json:"app_id,omitempty"`
+	Model     string `json:"model"`
+	Chunks    int    `json:"chunks"`
+	Skipped   string `json:"skipped,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+}
@@ -0,0 +1,95 @@
+package payloads
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by their JSON names, as producers know them.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return v
+}
+
+// FieldError describes why one field of a request payload is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request payload.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateStruct checks v against its validate tags and reports the
+// violations as a ValidationError.
+func validateStruct(v any) error {
+	err := validate.Struct(v)
+	if err == nil {
+		return nil
+	}
+
+	var violations validator.ValidationErrors
+	if !errors.As(err, &violations) {
+		return err
+	}
+
+	fields := make([]FieldError, len(violations))
+	for i, violation := range violations {
+		fields[i] = FieldError{
+			Field:   violation.Field(),
+			Rule:    violation.Tag(),
+			Message: ruleMessage(violation),
+		}
+	}
+	return &ValidationError{Fields: fields}
+}
+
+func ruleMessage(violation validator.FieldError) string {
+	param := violation.Param()
+	switch violation.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		if violation.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at least %s elements", param)
+		}
+		return "must be at least " + param
+	case "max":
+		return "must be at most " + param
+	case "len":
+		return fmt.Sprintf("must have length %s", param)
+	case "datetime":
+		return "must be a date formatted as " + param
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(param), ", ")
+	default:
+		return fmt.Sprintf("fails the %s rule", violation.Tag())
+	}
+}
@@ -0,0 +1,175 @@
+// Package preprocess cleans review texts before they are embedded. A
+// Pipeline runs the steps enabled in the preprocessing configuration in a
+// fixed order; each step is a plain string function so that it can be used
+// and tested on its own.
+package preprocess
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// MinLength is the length in bytes below which a processed text is
+// considered empty; such texts are not worth embedding.
+const MinLength = 3
+
+// Emoji handling modes.
+const (
+	EmojiKeep   = "keep"
+	EmojiRemove = "remove"
+)
+
+// Step is one transformation of a pipeline.
+type Step struct {
+	Name  string
+	Apply func(string) string
+}
+
+// Pipeline runs its steps in order, and judges the processed texts by its
+// content thresholds, see LowContent.
+type Pipeline struct {
+	steps []Step
+
+	minTokens        int
+	minLetterRatio   float64
+	maxRepeatedRatio float64
+}
+
+// New returns the pipeline of the steps cfg enables, in the order NFC
+// normalization, markup stripping, emoji removal, whitespace collapse and
+// truncation.
+func New(cfg config.PreprocessingConfig) *Pipeline {
+	p := &Pipeline{
+		minTokens:        cfg.MinTokens,
+		minLetterRatio:   cfg.MinLetterRatio,
+		maxRepeatedRatio: cfg.MaxRepeatedRatio,
+	}
+	if cfg.NormalizeUnicode {
+		p.steps = append(p.steps, Step{Name: "normalize_unicode", Apply: NormalizeUnicode})
+	}
+	if cfg.StripMarkup {
+		p.steps = append(p.steps, Step{Name: "strip_markup", Apply: StripMarkup})
+	}
+	if cfg.Emoji == EmojiRemove {
+		p.steps = append(p.steps, Step{Name: "remove_emoji", Apply: RemoveEmoji})
+	}
+	if cfg.CollapseWhitespace {
+		p.steps = append(p.steps, Step{Name: "collapse_whitespace", Apply: CollapseWhitespace})
+	}
+	if cfg.MaxLength > 0 {
+		maxLength := cfg.MaxLength
+		p.steps = append(p.steps, Step{Name: "truncate", Apply: func(text string) string {
+			return Truncate(text, maxLength)
+		}})
+	}
+	return p
+}
+
+// Steps returns the names of the pipeline's steps in order.
+func (p *Pipeline) Steps() []string {
+	names := make([]string, len(p.steps))
+	for i, step := range p.steps {
+		names[i] = step.Name
+	}
+	return names
+}
+
+// Process runs text through the steps and returns it trimmed, or "" when
+// less than MinLength bytes are left.
+func (p *Pipeline) Process(text string) string {
+	for _, step := range p.steps {
+		text = step.Apply(text)
+	}
+
+	text = strings.TrimSpace(text)
+	if len(text) < MinLength {
+		return ""
+	}
+	return text
+}
+
+// NormalizeUnicode brings text into Unicode normalization form C, so that
+// composed and decomposed spellings of the same character embed alike.
+func NormalizeUnicode(text string) string {
+	return norm.NFC.String(text)
+}
+
+var (
+	htmlTagPattern      = regexp.MustCompile(`<[^>]*>`)
+	markdownImage       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	markdownLink        = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markdownHeading     = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	markdownQuote       = regexp.MustCompile(`(?m)^\s{0,3}>\s?`)
+	markdownEmphasis    = regexp.MustCompile("(\\*{2,3}|_{2,3}|~~|`+)")
+	markdownHorizontals = regexp.MustCompile(`(?m)^\s{0,3}([-*_]\s*){3,}$`)
+)
+
+// StripMarkup removes HTML tags and markdown syntax, keeping the text of
+// links and images, and decodes HTML entities.
+func StripMarkup(text string) string {
+	text = htmlTagPattern.ReplaceAllString(text, " ")
+	text = markdownImage.ReplaceAllString(text, "$1")
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = markdownHeading.ReplaceAllString(text, "")
+	text = markdownQuote.ReplaceAllString(text, "")
+	text = markdownHorizontals.ReplaceAllString(text, "")
+	text = markdownEmphasis.ReplaceAllString(text, "")
+	return html.UnescapeString(text)
+}
+
+// RemoveEmoji replaces emoji, together with the joiners, variation
+// selectors and skin tone modifiers they are built from, by spaces.
+func RemoveEmoji(text string) string {
+	return strings.Map(func(r rune) rune {
+		if isEmoji(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+func isEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // pictographs, emoticons, flags, skin tones
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // miscellaneous symbols and dingbats
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF: // arrows and shapes such as ⭐
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tag sequences of subdivision flags
+		return true
+	case r == 0x200D || r == 0x20E3 || (r >= 0xFE00 && r <= 0xFE0F):
+		return true
+	}
+	return false
+}
+
+// CollapseWhitespace trims text and replaces every run of whitespace with a
+// single space.
+func CollapseWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Truncate cuts text to at most maxLength characters, at the last space
+// before the limit when there is one.
+func Truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	runes = runes[:maxLength]
+	for i := len(runes) - 1; i > maxLength/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			runes = runes[:i]
+			break
+		}
+	}
+	return string(runes)
+}
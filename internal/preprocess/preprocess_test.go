@@ -0,0 +1,164 @@
+package preprocess
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+func TestNormalizeUnicode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"composed stays", "caf\u00e9", "caf\u00e9"},
+		{"decomposed is composed", "cafe\u0301", "caf\u00e9"},
+		{"ascii unchanged", "plain text", "plain text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeUnicode(tt.text); got != tt.want {
+				t.Errorf("NormalizeUnicode(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripMarkup(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"html tags", "<p>Great <b>app</b></p>", " Great  app  "},
+		{"entities", "Fast &amp; stable", "Fast & stable"},
+		{"link keeps its text", "See [the docs](https://example.com)", "See the docs"},
+		{"image keeps its alt text", "![screenshot](a.png) broken", "screenshot broken"},
+		{"heading", "## Crashes on start", "Crashes on start"},
+		{"emphasis", "**really** _slow_", "really _slow_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripMarkup(tt.text); got != tt.want {
+				t.Errorf("StripMarkup(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveEmoji(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"pictograph", "love it \U0001F60D", "love it  "},
+		{"joined sequence", "team \U0001F468\u200D\U0001F469", "team    "},
+		{"star", "⭐⭐ stars", "   stars"},
+		{"no emoji", "just words", "just words"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RemoveEmoji(tt.text); got != tt.want {
+				t.Errorf("RemoveEmoji(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollapseWhitespace(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"runs of spaces", "too   many  spaces", "too many spaces"},
+		{"newlines and tabs", "line one\n\n\tline two", "line one line two"},
+		{"trimmed", "  padded  ", "padded"},
+		{"only whitespace", " \n\t ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CollapseWhitespace(tt.text); got != tt.want {
+				t.Errorf("CollapseWhitespace(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		want      string
+	}{
+		{"short enough", "short", 10, "short"},
+		{"at the last space", "the quick brown fox", 12, "the quick"},
+		{"no space to cut at", "abcdefghij", 4, "abcd"},
+		{"counts characters, not bytes", "héllo wörld", 8, "héllo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Truncate(tt.text, tt.maxLength); got != tt.want {
+				t.Errorf("Truncate(%q, %d) = %q, want %q", tt.text, tt.maxLength, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.PreprocessingConfig
+		text      string
+		wantSteps []string
+		want      string
+	}{
+		{
+			name:      "no steps",
+			text:      "  <b>as is</b>  ",
+			wantSteps: []string{},
+			want:      "<b>as is</b>",
+		},
+		{
+			name: "every step in order",
+			cfg: config.PreprocessingConfig{
+				NormalizeUnicode:   true,
+				StripMarkup:        true,
+				Emoji:              EmojiRemove,
+				CollapseWhitespace: true,
+				MaxLength:          14,
+			},
+			text:      "<p>Café is \U0001F60D   great</p> really",
+			wantSteps: []string{"normalize_unicode", "strip_markup", "remove_emoji", "collapse_whitespace", "truncate"},
+			want:      "Café is great",
+		},
+		{
+			name:      "too short is empty",
+			cfg:       config.PreprocessingConfig{Emoji: EmojiRemove},
+			text:      "ok \U0001F44D",
+			wantSteps: []string{"remove_emoji"},
+			want:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.cfg)
+			if steps := p.Steps(); !slices.Equal(steps, tt.wantSteps) {
+				t.Errorf("Steps() = %v, want %v", steps, tt.wantSteps)
+			}
+			if got := p.Process(tt.text); got != tt.want {
+				t.Errorf("Process(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
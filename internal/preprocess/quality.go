@@ -0,0 +1,78 @@
+package preprocess
+
+import (
+	"strings"
+	"unicode"
+)
+
+// repeatRun is the length from which a run of one character counts as
+// repeated, e.g. the "ooo" of "sooo".
+const repeatRun = 3
+
+// LowContent reports whether a processed text is too thin to be worth
+// embedding under the content thresholds of the pipeline: fewer than
+// min_tokens words, a share of letters below min_letter_ratio, or a share of
+// characters in runs of three or more of the same above max_repeated_ratio.
+// It catches texts like "aaaaaa", "!!!!!!" and keyboard mash.
+func (p *Pipeline) LowContent(text string) bool {
+	if p.minTokens > 0 && len(strings.Fields(text)) < p.minTokens {
+		return true
+	}
+	if p.minLetterRatio > 0 && LetterRatio(text) < p.minLetterRatio {
+		return true
+	}
+	if p.maxRepeatedRatio > 0 && RepeatedRatio(text) > p.maxRepeatedRatio {
+		return true
+	}
+	return false
+}
+
+// LetterRatio returns the share of letters among the characters of text
+// other than whitespace.
+func LetterRatio(text string) float64 {
+	var letters, total int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(letters) / float64(total)
+}
+
+// RepeatedRatio returns the share of the characters of text other than
+// whitespace that belong to runs of three or more of the same character,
+// ignoring case.
+func RepeatedRatio(text string) float64 {
+	var repeated, total, run int
+	var previous rune = -1
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			previous, run = -1, 0
+			continue
+		}
+		total++
+		r = unicode.ToLower(r)
+		if r == previous {
+			run++
+		} else {
+			previous, run = r, 1
+		}
+		switch {
+		case run == repeatRun:
+			repeated += repeatRun
+		case run > repeatRun:
+			repeated++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(repeated) / float64(total)
+}
@@ -0,0 +1,115 @@
+package preprocess
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Kinds of personal data a Redactor replaces.
+const (
+	KindEmail   = "email"
+	KindPhone   = "phone"
+	KindOrderID = "order_id"
+	KindName    = "name"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d ().-]{6,}\d`)
+)
+
+// Detector finds personal data of one kind in a text. Besides the regular
+// expressions of the configuration, a Detector can wrap a named entity
+// recognizer to find the names no pattern describes.
+type Detector interface {
+	Kind() string
+	// Find returns the [start, end) byte offsets of the matches, in order
+	// and not overlapping.
+	Find(text string) [][]int
+}
+
+type patternDetector struct {
+	kind    string
+	pattern *regexp.Regexp
+}
+
+// PatternDetector returns a Detector of the matches of pattern.
+func PatternDetector(kind string, pattern *regexp.Regexp) Detector {
+	return patternDetector{kind: kind, pattern: pattern}
+}
+
+func (d patternDetector) Kind() string { return d.kind }
+
+func (d patternDetector) Find(text string) [][]int {
+	return d.pattern.FindAllStringIndex(text, -1)
+}
+
+// Redactor replaces personal data with a placeholder naming its kind, e.g.
+// "[EMAIL]", before texts leave the service.
+type Redactor struct {
+	detectors []Detector
+}
+
+// NewRedactor returns the redactor of the kinds cfg enables, followed by
+// extra detectors, or nil when redaction is disabled.
+func NewRedactor(cfg config.RedactionConfig, extra ...Detector) (*Redactor, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	r := &Redactor{}
+	if cfg.Emails {
+		r.detectors = append(r.detectors, PatternDetector(KindEmail, emailPattern))
+	}
+	if cfg.OrderIDPattern != "" {
+		// Before phone numbers, which would claim numeric order IDs.
+		pattern, err := regexp.Compile(cfg.OrderIDPattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile order ID pattern: %w", err)
+		}
+		r.detectors = append(r.detectors, PatternDetector(KindOrderID, pattern))
+	}
+	if cfg.Phones {
+		r.detectors = append(r.detectors, PatternDetector(KindPhone, phonePattern))
+	}
+	for _, expr := range cfg.NamePatterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile name pattern %q: %w", expr, err)
+		}
+		r.detectors = append(r.detectors, PatternDetector(KindName, pattern))
+	}
+	r.detectors = append(r.detectors, extra...)
+	return r, nil
+}
+
+// Redact replaces what the detectors find in text, each on the output of
+// the previous one, and counts the replacements by kind.
+func (r *Redactor) Redact(text string, counts map[string]int) string {
+	if r == nil {
+		return text
+	}
+
+	for _, d := range r.detectors {
+		matches := d.Find(text)
+		if len(matches) == 0 {
+			continue
+		}
+
+		placeholder := "[" + strings.ToUpper(d.Kind()) + "]"
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(text[last:m[0]])
+			b.WriteString(placeholder)
+			last = m[1]
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+		counts[d.Kind()] += len(matches)
+	}
+	return text
+}
@@ -0,0 +1,113 @@
+package preprocess
+
+import (
+	"maps"
+	"regexp"
+	"testing"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+func TestRedactor(t *testing.T) {
+	all := config.RedactionConfig{
+		Enabled:        true,
+		Emails:         true,
+		Phones:         true,
+		OrderIDPattern: `ORD-\d+`,
+		NamePatterns:   []string{`(?i)\bcheers, \w+`},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.RedactionConfig
+		extra      []Detector
+		text       string
+		want       string
+		wantCounts map[string]int
+	}{
+		{
+			name:       "emails",
+			cfg:        all,
+			text:       "write to jane.doe@example.com or support@example.org",
+			want:       "write to [EMAIL] or [EMAIL]",
+			wantCounts: map[string]int{KindEmail: 2},
+		},
+		{
+			name:       "phone numbers",
+			cfg:        all,
+			text:       "call +1 (555) 123-4567 today",
+			want:       "call [PHONE] today",
+			wantCounts: map[string]int{KindPhone: 1},
+		},
+		{
+			name:       "order IDs before phone numbers",
+			cfg:        all,
+			text:       "order ORD-12345678 never arrived",
+			want:       "order [ORDER_ID] never arrived",
+			wantCounts: map[string]int{KindOrderID: 1},
+		},
+		{
+			name:       "names",
+			cfg:        all,
+			text:       "Sorry about that. Cheers, Alex",
+			want:       "Sorry about that. [NAME]",
+			wantCounts: map[string]int{KindName: 1},
+		},
+		{
+			name:       "kinds left off",
+			cfg:        config.RedactionConfig{Enabled: true, Emails: true},
+			text:       "mail a@b.io or call 555 123 4567",
+			want:       "mail [EMAIL] or call 555 123 4567",
+			wantCounts: map[string]int{KindEmail: 1},
+		},
+		{
+			name:       "extra detectors",
+			cfg:        config.RedactionConfig{Enabled: true},
+			extra:      []Detector{PatternDetector(KindName, regexp.MustCompile(`Sam`))},
+			text:       "Sam says hi",
+			want:       "[NAME] says hi",
+			wantCounts: map[string]int{KindName: 1},
+		},
+		{
+			name:       "nothing to redact",
+			cfg:        all,
+			text:       "works fine",
+			want:       "works fine",
+			wantCounts: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(tt.cfg, tt.extra...)
+			if err != nil {
+				t.Fatalf("NewRedactor: %v", err)
+			}
+
+			counts := map[string]int{}
+			if got := r.Redact(tt.text, counts); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if !maps.Equal(counts, tt.wantCounts) {
+				t.Errorf("counts = %v, want %v", counts, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	r, err := NewRedactor(config.RedactionConfig{Emails: true})
+	if err != nil || r != nil {
+		t.Errorf("disabled redaction = %v, %v, want nil, nil", r, err)
+	}
+	if got := r.Redact("a@b.io", map[string]int{}); got != "a@b.io" {
+		t.Errorf("nil redactor changed the text to %q", got)
+	}
+
+	if _, err := NewRedactor(config.RedactionConfig{Enabled: true, OrderIDPattern: "("}); err == nil {
+		t.Error("expected an error for an invalid order ID pattern")
+	}
+	if _, err := NewRedactor(config.RedactionConfig{Enabled: true, NamePatterns: []string{"["}}); err == nil {
+		t.Error("expected an error for an invalid name pattern")
+	}
+}
@@ -0,0 +1,43 @@
+package producer
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// traceIDHeader carries the envelope's trace ID.
+const traceIDHeader = "trace_id"
+
+type headersKey struct{}
+
+// WithHeaders returns a context whose published events carry the headers,
+// in addition to those of ctx. The consumer uses it to pass a request's
+// correlation and trace headers on to the events published in reply.
+func WithHeaders(ctx context.Context, headers ...kafka.Header) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+
+	inherited := headersFrom(ctx)
+	merged := make([]kafka.Header, 0, len(inherited)+len(headers))
+	merged = append(merged, inherited...)
+	merged = append(merged, headers...)
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+func headersFrom(ctx context.Context) []kafka.Header {
+	headers, _ := ctx.Value(headersKey{}).([]kafka.Header)
+	return headers
+}
+
+// headerValue returns the value of the last header named key, which is the
+// one that wins when headers are merged.
+func headerValue(headers []kafka.Header, key string) string {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Key == key {
+			return string(headers[i].Value)
+		}
+	}
+	return ""
+}
@@ -2,31 +2,328 @@ package producer
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/quiby-ai/common/pkg/events"
 	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/codec"
+	"github.com/quiby-ai/review-vectorizer/internal/kafkaconn"
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
 )
 
+// Producer publishes event envelopes, to the topic configured for their
+// type, and raw messages, such as dead letters, to the topic each names.
 type Producer struct {
-	producer *events.KafkaProducer
+	writer  *kafka.Writer
+	dialer  *kafka.Dialer
+	codec   *codec.Codec
+	cfg     config.KafkaConfig
+	brokers []string
+	retry   retry.Policy
 }
 
-func NewProducer(cfg config.KafkaConfig) *Producer {
-	producer := events.NewKafkaProducer(cfg.Brokers)
-	return &Producer{producer: producer}
+// NewProducer returns a producer that retries failed writes by policy, with
+// retryableWriteError as its classification.
+func NewProducer(cfg config.KafkaConfig, policy retry.Policy) (*Producer, error) {
+	transport, err := kafkaconn.NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer, err := kafkaconn.NewDialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := codec.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+		// Retries are up to the policy, which backs off between them.
+		MaxAttempts: 1,
+	}
+	policy.Retryable = retryableWriteError
+	return &Producer{writer: writer, dialer: dialer, codec: codec, cfg: cfg, brokers: cfg.Brokers, retry: policy}, nil
+}
+
+// write writes msgs, again while the failure is retryable. Messages written
+// before a failed attempt may be written twice, which consumers already
+// tolerate from the outbox.
+func (p *Producer) write(ctx context.Context, msgs ...kafka.Message) error {
+	return p.retry.Do(ctx, func(ctx context.Context) error {
+		return p.writer.WriteMessages(ctx, msgs...)
+	})
+}
+
+// retryableWriteError retries the errors the broker reports as temporary,
+// such as a leader election in progress, and failures to reach it at all.
+func retryableWriteError(err error) bool {
+	var writeErrs kafka.WriteErrors
+	if errors.As(err, &writeErrs) {
+		for _, err := range writeErrs {
+			if err != nil && !retryableWriteError(err) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// Ping succeeds when at least one of the brokers accepts a connection.
+func (p *Producer) Ping(ctx context.Context) error {
+	if len(p.brokers) == 0 {
+		return errors.New("no Kafka brokers configured")
+	}
+
+	var errs []error
+	for _, broker := range p.brokers {
+		conn, err := p.dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn.Close()
+		return nil
+	}
+
+	return fmt.Errorf("no Kafka broker reachable: %w", errors.Join(errs...))
 }
 
 func (p *Producer) Close() error {
-	return p.producer.Close()
+	return p.writer.Close()
 }
 
+// PublishEvent publishes the envelope the way the shared producer does, but
+// to the topic configured for its type rather than one named after it.
 func (p *Producer) PublishEvent(ctx context.Context, key []byte, envelope events.Envelope[any]) error {
-	return p.producer.PublishEvent(ctx, key, envelope)
+	m, err := p.newEventMessage(ctx, key, envelope)
+	if err != nil {
+		return err
+	}
+
+	return p.write(ctx, m)
+}
+
+// newEventMessage encodes the envelope with its own headers, overridden by
+// the configured headers, in turn overridden by those passed on through ctx,
+// and the trace context of ctx. An envelope without a trace ID takes the one
+// passed on.
+func (p *Producer) newEventMessage(ctx context.Context, key []byte, envelope events.Envelope[any]) (kafka.Message, error) {
+	propagated := headersFrom(ctx)
+	if envelope.TraceID == "" {
+		envelope.TraceID = headerValue(propagated, traceIDHeader)
+	}
+
+	value, err := events.MarshalEnvelope(envelope)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	topic := p.cfg.Topic(envelope.Type)
+	value, err = p.codec.Encode(ctx, topic, p.cfg.EventEncoding(envelope.Type), value)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("encode envelope: %w", err)
+	}
+
+	headers := make([]kafka.Header, 0, len(envelope.KafkaHeaders())+len(p.cfg.Headers)+len(propagated))
+	for _, h := range envelope.KafkaHeaders() {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+
+	carrier := telemetry.HeaderCarrier{Headers: &headers}
+	for _, k := range slices.Sorted(maps.Keys(p.cfg.Headers)) {
+		carrier.Set(k, p.cfg.Headers[k])
+	}
+	for _, h := range propagated {
+		carrier.Set(h.Key, string(h.Value))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return kafka.Message{
+		Topic:   topic,
+		Key:     key,
+		Value:   value,
+		Headers: headers,
+		Time:    time.Now(),
+	}, nil
 }
 
-func (p *Producer) BuildEnvelope(event events.VectorizeCompleted, sagaID string) events.Envelope[any] {
+// NewOutboxMessage encodes the envelope as PublishEvent would publish it, to
+// be recorded in the outbox and published later by PublishOutbox.
+func (p *Producer) NewOutboxMessage(ctx context.Context, key []byte, envelope events.Envelope[any]) (storage.OutboxMessage, error) {
+	m, err := p.newEventMessage(ctx, key, envelope)
+	if err != nil {
+		return storage.OutboxMessage{}, err
+	}
+
+	headers := make([]storage.OutboxHeader, len(m.Headers))
+	for i, h := range m.Headers {
+		headers[i] = storage.OutboxHeader{Key: h.Key, Value: h.Value}
+	}
+
+	return storage.OutboxMessage{
+		SagaID:  envelope.SagaID,
+		Topic:   m.Topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}, nil
+}
+
+// PublishOutbox publishes messages recorded in the outbox.
+func (p *Producer) PublishOutbox(ctx context.Context, messages []storage.OutboxMessage) error {
+	msgs := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		headers := make([]kafka.Header, len(m.Headers))
+		for j, h := range m.Headers {
+			headers[j] = kafka.Header{Key: h.Key, Value: h.Value}
+		}
+		msgs[i] = kafka.Message{
+			Topic:   m.Topic,
+			Key:     m.Key,
+			Value:   m.Value,
+			Headers: headers,
+			Time:    m.CreatedAt,
+		}
+	}
+
+	return p.write(ctx, msgs...)
+}
+
+// PublishMessage writes already encoded messages as they are, to the topic
+// each of them names.
+func (p *Producer) PublishMessage(ctx context.Context, msgs ...kafka.Message) error {
+	return p.write(ctx, msgs...)
+}
+
+func (p *Producer) BuildEnvelope(event payloads.VectorizeCompleted, sagaID string) events.Envelope[any] {
 	envelope := events.BuildEnvelope(event, events.PipelineVectorizeCompleted, sagaID)
 	envelope.Meta.AppID = event.AppID
 
 	return envelope
 }
+
+func (p *Producer) BuildProgressEnvelope(event payloads.VectorizeProgress, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineVectorizeProgress, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildCancelledEnvelope(event payloads.VectorizeCancelled, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineVectorizeCancelled, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildFailedEnvelope(event payloads.VectorizeFailed, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, events.PipelineFailed, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildClusteringCompletedEnvelope(event payloads.ClusteringCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineClusterCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildDuplicatesSummaryEnvelope(event payloads.DuplicatesSummary, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineDuplicatesSummary, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildProjectionCompletedEnvelope(event payloads.ProjectionCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineProjectCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildCentroidsCompletedEnvelope(event payloads.CentroidsCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineCentroidsCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildExportCompletedEnvelope(event payloads.ExportCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineExportCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildImportCompletedEnvelope(event payloads.ImportCompleted, sagaID string) events.Envelope[any] {
+	return events.BuildEnvelope(event, payloads.PipelineImportCompleted, sagaID)
+}
+
+func (p *Producer) BuildReviewCompletedEnvelope(event payloads.VectorizeReviewCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineReviewCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildReembedCompletedEnvelope(event payloads.ReembedCompleted, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineReembedCompleted, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildQuotaExceededEnvelope(event payloads.QuotaExceeded, sagaID string) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineQuotaExceeded, sagaID)
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildEmbeddingUsageEnvelope(event payloads.EmbeddingUsage) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.MetricsEmbeddingUsage, "")
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildSpendReportEnvelope(event payloads.SpendReport) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineSpendReport, "")
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildEmbeddingDriftEnvelope(event payloads.EmbeddingDrift) events.Envelope[any] {
+	envelope := events.BuildEnvelope(event, payloads.PipelineEmbeddingDrift, "")
+	envelope.Meta.AppID = event.AppID
+
+	return envelope
+}
+
+func (p *Producer) BuildInvalidRequestEnvelope(event payloads.InvalidRequest, sagaID string) events.Envelope[any] {
+	return events.BuildEnvelope(event, payloads.PipelineInvalidRequest, sagaID)
+}
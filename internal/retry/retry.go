@@ -0,0 +1,86 @@
+// Package retry runs operations again after transient failures. A Policy is
+// configured once, in the retry section, and shared by the embedding
+// provider client, the database writes and the Kafka producer, each of which
+// supplies its own classification of the errors worth retrying.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Policy retries an operation up to MaxAttempts times in all, waiting
+// BaseDelay after the first failed attempt and twice as long after every
+// further one, up to MaxDelay. Jitter spreads each wait by up to that
+// fraction either way, so replicas that failed together don't retry in
+// lockstep.
+type Policy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+	// Retryable tells the errors worth another attempt; nil retries every
+	// error.
+	Retryable func(error) bool
+	// OnRetry, when set, is called before waiting for the next attempt.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// New returns the policy of cfg that retries the errors retryable accepts.
+func New(cfg config.RetryConfig, retryable func(error) bool) Policy {
+	return Policy{
+		MaxAttempts: cfg.MaxAttempts,
+		BaseDelay:   cfg.BaseDelay,
+		MaxDelay:    cfg.MaxDelay,
+		Jitter:      cfg.Jitter,
+		Retryable:   retryable,
+	}
+}
+
+// Delay returns the wait after the attempt-th failed attempt, before jitter.
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Do calls op until it succeeds, fails with an error that is not retryable,
+// or has been attempted MaxAttempts times, and returns its last error. A
+// zero Policy attempts op once. Once ctx is done no further attempt is made,
+// and waiting for the next one ends early.
+func (p Policy) Do(ctx context.Context, op func(ctx context.Context) error) error {
+	attempts := max(p.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || (p.Retryable != nil && !p.Retryable(err)) {
+			return err
+		}
+
+		delay := p.jittered(p.Delay(attempt))
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p Policy) jittered(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 || delay <= 0 {
+		return delay
+	}
+	spread := float64(delay) * p.Jitter
+	return time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+}
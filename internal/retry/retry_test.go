@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	p := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{30, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	uncapped := Policy{BaseDelay: time.Second}
+	if got := uncapped.Delay(5); got != 16*time.Second {
+		t.Errorf("Delay(5) without MaxDelay = %v, want 16s", got)
+	}
+}
+
+func TestJittered(t *testing.T) {
+	p := Policy{Jitter: 0.2}
+	for range 100 {
+		if got := p.jittered(time.Second); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("jittered(1s) = %v, want within 20%%", got)
+		}
+	}
+
+	if got := (Policy{}).jittered(time.Second); got != time.Second {
+		t.Errorf("jittered(1s) without jitter = %v, want 1s", got)
+	}
+}
+
+func TestDo(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		retryable    func(error) bool
+		failures     []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "succeeds at once",
+			maxAttempts:  3,
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after failures",
+			maxAttempts:  3,
+			failures:     []error{errTransient, errTransient},
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after max attempts",
+			maxAttempts:  3,
+			failures:     []error{errTransient, errTransient, errTransient, errTransient},
+			wantAttempts: 3,
+			wantErr:      errTransient,
+		},
+		{
+			name:         "zero policy attempts once",
+			failures:     []error{errTransient},
+			wantAttempts: 1,
+			wantErr:      errTransient,
+		},
+		{
+			name:         "stops at an error that is not retryable",
+			maxAttempts:  5,
+			retryable:    func(err error) bool { return !errors.Is(err, errPermanent) },
+			failures:     []error{errTransient, errPermanent, errTransient},
+			wantAttempts: 2,
+			wantErr:      errPermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, Retryable: tt.retryable}
+
+			var retries []int
+			p.OnRetry = func(attempt int, _ time.Duration, _ error) { retries = append(retries, attempt) }
+
+			attempts := 0
+			err := p.Do(context.Background(), func(context.Context) error {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return tt.failures[attempts-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Do() = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if len(retries) != tt.wantAttempts-1 {
+				t.Errorf("OnRetry was called %d times, want %d", len(retries), tt.wantAttempts-1)
+			}
+		})
+	}
+}
+
+func TestDoStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Hour}
+	p.OnRetry = func(int, time.Duration, error) { cancel() }
+
+	attempts := 0
+	err := p.Do(ctx, func(context.Context) error {
+		attempts++
+		return errors.New("unavailable")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Do() = %v after %d attempts, want the error after 1", err, attempts)
+	}
+}
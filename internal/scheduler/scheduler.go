@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/leader"
+	"github.com/quiby-ai/review-vectorizer/internal/service"
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler runs incremental vectorization on cron schedules, so new reviews
+// are picked up even when no upstream saga asks for them. A schedule still
+// running when it is due again is skipped; across instances the run lock
+// keeps a schedule from running twice, and with a leader only the leading
+// instance runs schedules at all.
+type Scheduler struct {
+	svc    *service.VectorizeService
+	leader *leader.Elector
+	cron   *cron.Cron
+	logger *slog.Logger
+
+	// runCtx is the context scheduled runs execute in; it is cancelled once
+	// the scheduler stops.
+	runCtx context.Context
+}
+
+// NewScheduler registers the configured jobs, failing on invalid cron
+// expressions or time zones. Schedules only run while elector leads; a nil
+// elector runs them on every instance.
+func NewScheduler(cfg config.SchedulerConfig, svc *service.VectorizeService, elector *leader.Elector, logger *slog.Logger) (*Scheduler, error) {
+	location := time.UTC
+	if cfg.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid scheduler timezone %q: %w", cfg.Timezone, err)
+		}
+	}
+
+	s := &Scheduler{svc: svc, leader: elector, logger: logger}
+	cronLog := cronLogger{logger}
+	s.cron = cron.New(
+		cron.WithLocation(location),
+		cron.WithLogger(cronLog),
+		cron.WithChain(cron.Recover(cronLog), cron.SkipIfStillRunning(cronLog)),
+	)
+
+	for _, job := range cfg.Jobs {
+		if _, err := s.cron.AddFunc(job.Cron, func() { s.run(job) }); err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q for app %q: %w", job.Cron, job.AppID, err)
+		}
+	}
+
+	if cfg.SpendReportCron != "" {
+		if _, err := s.cron.AddFunc(cfg.SpendReportCron, s.publishSpendReport); err != nil {
+			return nil, fmt.Errorf("invalid spend report cron expression %q: %w", cfg.SpendReportCron, err)
+		}
+	}
+
+	if cfg.ArchiveCron != "" {
+		if _, err := s.cron.AddFunc(cfg.ArchiveCron, s.archive); err != nil {
+			return nil, fmt.Errorf("invalid archive cron expression %q: %w", cfg.ArchiveCron, err)
+		}
+	}
+
+	if cfg.DriftCron != "" {
+		if _, err := s.cron.AddFunc(cfg.DriftCron, s.checkDrift); err != nil {
+			return nil, fmt.Errorf("invalid drift cron expression %q: %w", cfg.DriftCron, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Run starts the schedules and blocks until ctx is done. Runs in progress
+// are then cancelled and waited for.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.Info("Scheduler started", "jobs", len(s.cron.Entries()))
+
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	s.runCtx = runCtx
+
+	s.cron.Start()
+	<-ctx.Done()
+
+	stopped := s.cron.Stop()
+	cancel()
+	<-stopped.Done()
+
+	return nil
+}
+
+func (s *Scheduler) run(job config.ScheduleJob) {
+	if !s.leader.IsLeader() {
+		s.logger.Debug("Skipping scheduled vectorization, another instance leads", "app_id", job.AppID)
+		return
+	}
+
+	req := service.VectorizeRequest{
+		AppID:       job.AppID,
+		Countries:   job.Countries,
+		Languages:   job.Languages,
+		Incremental: true,
+		Partitioned: true,
+		Priority:    service.PriorityBackground,
+	}
+
+	if s.svc.InMaintenance(s.runCtx) {
+		s.logger.Info("Skipping scheduled vectorization in maintenance mode", "app_id", job.AppID)
+		return
+	}
+
+	s.logger.Info("Scheduled vectorization", "app_id", job.AppID, "cron", job.Cron)
+
+	ctx := service.WithAuditSource(s.runCtx, "scheduler", "cron:"+job.Cron)
+	result, err := s.svc.RunOnce(ctx, req)
+	if errors.Is(err, service.ErrRunInProgress) {
+		s.logger.Info("Skipping scheduled vectorization, a run for this app is already in progress", "app_id", job.AppID)
+		return
+	}
+	if errors.Is(err, service.ErrPartitionsUnassigned) {
+		s.logger.Info("Skipping scheduled vectorization, this replica has no partitions yet", "app_id", job.AppID)
+		return
+	}
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		s.logger.Warn("Scheduled vectorization deferred", "app_id", job.AppID, "run_id", result.RunID, "deferred", result.Deferred, "error", err)
+		return
+	}
+	if err != nil {
+		s.logger.Error("Scheduled vectorization failed", "app_id", job.AppID, "run_id", result.RunID, "error", err)
+		return
+	}
+
+	s.logger.Info("Scheduled vectorization completed",
+		"app_id", job.AppID,
+		"run_id", result.RunID,
+		"processed", result.Processed,
+		"skipped", result.Skipped,
+		"failed", result.Failed)
+}
+
+// publishSpendReport publishes the previous month's spend report.
+func (s *Scheduler) publishSpendReport() {
+	if !s.leader.IsLeader() {
+		s.logger.Debug("Skipping spend report, another instance leads")
+		return
+	}
+
+	report, err := s.svc.PublishSpendReport(s.runCtx, time.Now())
+	if err != nil {
+		s.logger.Error("Failed to publish spend report", "error", err)
+		return
+	}
+
+	s.logger.Info("Published spend report", "month", report.Month, "tokens", report.Tokens, "cost_usd", report.CostUSD)
+}
+
+// archive moves old embeddings into the archive table.
+func (s *Scheduler) archive() {
+	if !s.leader.IsLeader() {
+		s.logger.Debug("Skipping archiving, another instance leads")
+		return
+	}
+	if s.svc.InMaintenance(s.runCtx) {
+		s.logger.Info("Skipping archiving in maintenance mode")
+		return
+	}
+
+	if _, err := s.svc.ArchiveEmbeddings(s.runCtx); err != nil {
+		s.logger.Error("Scheduled archiving failed", "error", err)
+	}
+}
+
+// checkDrift checks every recently embedded app for embedding drift.
+func (s *Scheduler) checkDrift() {
+	if !s.leader.IsLeader() {
+		s.logger.Debug("Skipping drift check, another instance leads")
+		return
+	}
+
+	// Apps that failed are logged by the check itself.
+	s.svc.CheckDrift(s.runCtx, "")
+}
+
+// cronLogger adapts slog to the cron package's logger.
+type cronLogger struct {
+	logger *slog.Logger
+}
+
+func (l cronLogger) Info(msg string, keysAndValues ...any) {
+	l.logger.Debug("cron: "+msg, keysAndValues...)
+}
+
+func (l cronLogger) Error(err error, msg string, keysAndValues ...any) {
+	l.logger.Error("cron: "+msg, append(keysAndValues, "error", err)...)
+}
@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// awsClient reads secrets from AWS Secrets Manager. The SDK client is only
+// created once a secret is read, so that services without AWS references
+// never look for AWS credentials.
+type awsClient struct {
+	cfg config.AWSSecretsConfig
+
+	mu     sync.Mutex
+	client *secretsmanager.Client
+}
+
+func newAWSClient(cfg config.AWSSecretsConfig) *awsClient {
+	return &awsClient{cfg: cfg}
+}
+
+// read returns the current string value of the secret with the ID or ARN.
+func (c *awsClient) read(ctx context.Context, id string) (string, error) {
+	client, err := c.secretsManager(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("failed to read AWS secret %q: %w", id, err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("AWS secret %q has no string value", id)
+	}
+	return *out.SecretString, nil
+}
+
+func (c *awsClient) secretsManager(ctx context.Context) (*secretsmanager.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if c.cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(c.cfg.Region))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+
+	c.client = secretsmanager.NewFromConfig(awsCfg)
+	return c.client, nil
+}
@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Prefixes of the secret references understood in configuration values.
+const (
+	PrefixVault = "vault:"
+	PrefixAWS   = "aws-sm:"
+)
+
+// IsReference reports whether value refers to a secret instead of holding
+// one.
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, PrefixVault) || strings.HasPrefix(value, PrefixAWS)
+}
+
+// Resolver resolves secret references, caching every secret for the
+// configured refresh interval.
+type Resolver struct {
+	cfg    config.SecretsConfig
+	vault  *vaultClient
+	aws    *awsClient
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+func NewResolver(cfg config.SecretsConfig, logger *slog.Logger) *Resolver {
+	return &Resolver{
+		cfg:    cfg,
+		vault:  newVaultClient(cfg.Vault),
+		aws:    newAWSClient(cfg.AWS),
+		logger: logger,
+		cache:  make(map[string]cachedSecret),
+	}
+}
+
+// ResolveConfig replaces the secret references in the OpenAI API key and the
+// Postgres DSN by their values, and installs sources that keep them current
+// as the secrets are rotated. Values that are not references are left alone.
+func (r *Resolver) ResolveConfig(ctx context.Context, cfg *config.Config) error {
+	if IsReference(cfg.OpenAI.APIKey) {
+		source := r.Source(cfg.OpenAI.APIKey)
+		key, err := source(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to resolve OPENAI_API_KEY: %w", err)
+		}
+		cfg.OpenAI.APIKey, cfg.OpenAI.APIKeySource = key, source
+	}
+
+	if IsReference(cfg.Postgres.DSN) {
+		source := r.Source(cfg.Postgres.DSN)
+		dsn, err := source(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to resolve PG_DSN: %w", err)
+		}
+		cfg.Postgres.DSN, cfg.Postgres.DSNSource = dsn, source
+	}
+
+	return nil
+}
+
+// Source returns a function resolving ref whenever called.
+func (r *Resolver) Source(ref string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		return r.Resolve(ctx, ref)
+	}
+}
+
+// Resolve returns the secret ref refers to. A secret is fetched again once
+// it is older than the refresh interval; if that fails, the previous value
+// is kept until the next attempt, so that an unavailable secret store does
+// not take the service down.
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached, ok := r.cache[ref]
+	if ok && time.Since(cached.fetchedAt) < r.cfg.RefreshInterval {
+		return cached.value, nil
+	}
+
+	value, err := r.fetch(ctx, ref)
+	if err != nil {
+		if !ok {
+			return "", err
+		}
+		r.logger.Warn("Failed to refresh secret, using the previous value", "ref", ref, "error", err)
+		r.cache[ref] = cachedSecret{value: cached.value, fetchedAt: time.Now()}
+		return cached.value, nil
+	}
+
+	if ok && value != cached.value {
+		r.logger.Info("Secret rotated", "ref", ref)
+	}
+	r.cache[ref] = cachedSecret{value: value, fetchedAt: time.Now()}
+	return value, nil
+}
+
+func (r *Resolver) fetch(ctx context.Context, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, PrefixVault):
+		path, field, _ := strings.Cut(strings.TrimPrefix(ref, PrefixVault), "#")
+		if path == "" || field == "" {
+			return "", fmt.Errorf("invalid secret reference %q, expected %s<path>#<field>", ref, PrefixVault)
+		}
+		return r.vault.read(ctx, path, field)
+	case strings.HasPrefix(ref, PrefixAWS):
+		id, field, _ := strings.Cut(strings.TrimPrefix(ref, PrefixAWS), "#")
+		if id == "" {
+			return "", fmt.Errorf("invalid secret reference %q, expected %s<secret id>[#<field>]", ref, PrefixAWS)
+		}
+		value, err := r.aws.read(ctx, id)
+		if err != nil || field == "" {
+			return value, err
+		}
+		return jsonField(value, field)
+	default:
+		return "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+}
+
+// jsonField returns a string field of a secret holding a JSON object.
+func jsonField(secret, field string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("failed to decode secret as JSON: %w", err)
+	}
+
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no string field %q", field)
+	}
+	return value, nil
+}
@@ -0,0 +1,174 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// serviceAccountTokenFile is where Kubernetes mounts the pod's service
+// account token, which Vault's Kubernetes auth method exchanges for a token.
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+const vaultTimeout = 10 * time.Second
+
+// errVaultForbidden is returned when Vault rejects the token, which is then
+// renewed by logging in again.
+var errVaultForbidden = errors.New("vault denied access")
+
+// vaultClient reads secrets through Vault's HTTP API, from KV version 1 or 2
+// mounts.
+type vaultClient struct {
+	cfg        config.VaultConfig
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+func newVaultClient(cfg config.VaultConfig) *vaultClient {
+	return &vaultClient{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: vaultTimeout},
+		token:      cfg.Token,
+	}
+}
+
+// read returns a field of the secret at path, e.g. "secret/data/app" for a
+// KV version 2 mount.
+func (c *vaultClient) read(ctx context.Context, path, field string) (string, error) {
+	if c.cfg.Address == "" {
+		return "", fmt.Errorf("vault secret %q requires secrets.vault.address", path)
+	}
+
+	data, err := c.readPath(ctx, path)
+	if errors.Is(err, errVaultForbidden) && c.cfg.KubernetesRole != "" {
+		// The token obtained by logging in may have expired.
+		c.setToken("")
+		data, err = c.readPath(ctx, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret under data.data, next to its metadata.
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %q has no string field %q", path, field)
+	}
+	return value, nil
+}
+
+func (c *vaultClient) readPath(ctx context.Context, path string) (map[string]any, error) {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, strings.TrimPrefix(path, "/"), token, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %q: %w", path, err)
+	}
+	return response.Data, nil
+}
+
+// currentToken returns the configured token or, with a Kubernetes role, one
+// obtained by logging in with the pod's service account.
+func (c *vaultClient) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" || c.cfg.KubernetesRole == "" {
+		return c.token, nil
+	}
+
+	jwt, err := os.ReadFile(serviceAccountTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	login := map[string]string{"role": c.cfg.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))}
+	if err := c.do(ctx, http.MethodPost, "auth/"+c.cfg.KubernetesMount+"/login", "", login, &response); err != nil {
+		return "", fmt.Errorf("failed to log in to vault: %w", err)
+	}
+
+	c.token = response.Auth.ClientToken
+	return c.token, nil
+}
+
+func (c *vaultClient) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+func (c *vaultClient) do(ctx context.Context, method, path, token string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.cfg.Address, "/")+"/v1/"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", errVaultForbidden, strings.TrimSpace(string(data)))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// ErrArchiveDisabled is returned by ArchiveEmbeddings while
+// archive.older_than_months is 0.
+var ErrArchiveDisabled = errors.New("archiving is disabled, archive.older_than_months is 0")
+
+// ErrInvalidRehydrate is returned for rehydration requests naming neither an
+// app nor reviews.
+var ErrInvalidRehydrate = errors.New("rehydration needs an app_id or review_ids")
+
+// ArchiveResult reports an archiving or rehydration pass.
+type ArchiveResult struct {
+	Rows       int64      `json:"rows"`
+	Cutoff     *time.Time `json:"cutoff,omitempty"`
+	DurationMS int64      `json:"duration_ms"`
+}
+
+// RehydrateRequest selects the archived embeddings to bring back.
+type RehydrateRequest struct {
+	AppID     string   `json:"app_id,omitempty"`
+	ReviewIDs []string `json:"review_ids,omitempty"`
+}
+
+// ArchiveEmbeddings moves every embedding last made
+// archive.older_than_months ago or earlier into the archive table, in
+// transactions of archive.batch_size rows, keeping review_embeddings and its
+// vector indexes small. Archived reviews are neither searched nor embedded
+// again by incremental runs until they are rehydrated. Stopping it leaves
+// the rows moved so far archived.
+func (s *VectorizeService) ArchiveEmbeddings(ctx context.Context) (ArchiveResult, error) {
+	cfg := s.cfg.Archive
+	if cfg.OlderThanMonths <= 0 {
+		return ArchiveResult{}, ErrArchiveDisabled
+	}
+
+	started := time.Now()
+	cutoff := started.UTC().AddDate(0, -cfg.OlderThanMonths, 0)
+	result := ArchiveResult{Cutoff: &cutoff}
+	s.logger.Info("Archiving embeddings", "cutoff", cutoff, "batch_size", cfg.BatchSize)
+
+	for {
+		moved, err := s.repo.ArchiveEmbeddings(ctx, cutoff, cfg.BatchSize)
+		result.Rows += moved
+		if err != nil {
+			return result, fmt.Errorf("archiving stopped after %d rows: %w", result.Rows, err)
+		}
+		if moved == 0 {
+			break
+		}
+		s.logger.Debug("Archived embeddings", "rows", moved, "total", result.Rows)
+	}
+
+	result.DurationMS = time.Since(started).Milliseconds()
+	s.logger.Info("Archived embeddings", "rows", result.Rows, "cutoff", cutoff, "duration_ms", result.DurationMS)
+	return result, nil
+}
+
+// RehydrateEmbeddings moves the archived embeddings of an app or of
+// particular reviews back into review_embeddings, where they are searched
+// again.
+func (s *VectorizeService) RehydrateEmbeddings(ctx context.Context, req RehydrateRequest) (ArchiveResult, error) {
+	if req.AppID == "" && len(req.ReviewIDs) == 0 {
+		return ArchiveResult{}, ErrInvalidRehydrate
+	}
+
+	started := time.Now()
+	filters := storage.ArchiveFilters{AppID: req.AppID, ReviewIDs: req.ReviewIDs}
+	var result ArchiveResult
+
+	for {
+		moved, err := s.repo.RehydrateEmbeddings(ctx, filters, s.cfg.Archive.BatchSize)
+		result.Rows += moved
+		if err != nil {
+			return result, fmt.Errorf("rehydration stopped after %d rows: %w", result.Rows, err)
+		}
+		if moved == 0 {
+			break
+		}
+	}
+
+	result.DurationMS = time.Since(started).Milliseconds()
+	s.logger.Info("Rehydrated embeddings", "app_id", req.AppID, "review_ids", len(req.ReviewIDs), "rows", result.Rows, "duration_ms", result.DurationMS)
+	return result, nil
+}
+
+// ArchiveStats returns the size of the archive.
+func (s *VectorizeService) ArchiveStats(ctx context.Context) (storage.ArchiveStats, error) {
+	return s.repo.GetArchiveStats(ctx)
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/transfer"
+)
+
+// Files of a run bundle, under artifacts.destination/<saga_id>/.
+const (
+	bundleManifestFile  = "manifest.json"
+	bundleProcessedFile = "processed_review_ids.txt"
+	bundleFailedFile    = "failed_reviews.jsonl"
+)
+
+// runBundle locates the bundle written for a completed run.
+type runBundle struct {
+	manifest string
+	reviews  string
+}
+
+// runManifest is the manifest.json of a run bundle: the run, what it
+// processed and what it cost, and the files of the bundle.
+type runManifest struct {
+	RunID          string                     `json:"run_id"`
+	SagaID         string                     `json:"saga_id"`
+	AppID          string                     `json:"app_id,omitempty"`
+	TenantID       string                     `json:"tenant_id,omitempty"`
+	Model          string                     `json:"model"`
+	Filters        storage.CleanReviewFilters `json:"filters"`
+	StartedAt      time.Time                  `json:"started_at"`
+	FinishedAt     *time.Time                 `json:"finished_at,omitempty"`
+	Processed      int                        `json:"processed"`
+	Skipped        int                        `json:"skipped"`
+	SkippedReasons map[string]int             `json:"skipped_reasons,omitempty"`
+	Failed         int                        `json:"failed"`
+	FailedReasons  map[string]int             `json:"failed_reasons,omitempty"`
+	Tokens         int64                      `json:"tokens"`
+	CostUSD        float64                    `json:"cost_usd"`
+	// ProcessedReviewIDs and FailedReviews name the two lists, and the
+	// counts their lines. Processed reviews are recorded per saga, so they
+	// include those of a resumed run before its restart.
+	ProcessedReviewIDs   string `json:"processed_review_ids"`
+	ProcessedReviewCount int    `json:"processed_review_count"`
+	FailedReviews        string `json:"failed_reviews"`
+	FailedReviewCount    int    `json:"failed_review_count"`
+}
+
+// writeRunBundle writes the bundle of a completed saga run: the processed
+// review IDs, one per line, the run's entries in the error ledger as JSON
+// lines and, last, the manifest, so that a bundle with a manifest is
+// complete. It is bounded by artifacts.timeout and detached from
+// cancellation, since the run is done.
+func (s *VectorizeService) writeRunBundle(ctx context.Context, run *storage.Run, result VectorizeResult) (*runBundle, error) {
+	cfg := s.cfg.Artifacts
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.Timeout)
+	defer cancel()
+
+	prefix := strings.TrimSuffix(cfg.Destination, "/") + "/" + run.SagaID + "/"
+	manifest := runManifest{
+		RunID:              run.RunID,
+		SagaID:             run.SagaID,
+		AppID:              run.AppID,
+		TenantID:           run.Filters.TenantID,
+		Model:              run.Filters.Model,
+		Filters:            run.Filters,
+		StartedAt:          run.StartedAt,
+		FinishedAt:         run.FinishedAt,
+		Processed:          result.Processed,
+		Skipped:            result.Skipped,
+		SkippedReasons:     result.SkippedReasons,
+		Failed:             result.Failed,
+		FailedReasons:      result.FailedReasons,
+		Tokens:             result.Tokens,
+		CostUSD:            result.CostUSD,
+		ProcessedReviewIDs: bundleProcessedFile,
+		FailedReviews:      bundleFailedFile,
+	}
+
+	err := s.writeArtifact(ctx, prefix+bundleProcessedFile, func(w *bufio.Writer) error {
+		var after string
+		for {
+			reviewIDs, err := s.repo.ListRunReviews(ctx, run.SagaID, after, cfg.PageSize)
+			if err != nil {
+				return err
+			}
+			if len(reviewIDs) == 0 {
+				return nil
+			}
+			for _, reviewID := range reviewIDs {
+				w.WriteString(reviewID)
+				w.WriteByte('\n')
+			}
+			manifest.ProcessedReviewCount += len(reviewIDs)
+			after = reviewIDs[len(reviewIDs)-1]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.writeArtifact(ctx, prefix+bundleFailedFile, func(w *bufio.Writer) error {
+		reviewErrors, err := s.repo.ListRunErrors(ctx, run.RunID)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(w)
+		for _, reviewError := range reviewErrors {
+			if err := encoder.Encode(reviewError); err != nil {
+				return fmt.Errorf("failed to encode review error: %w", err)
+			}
+		}
+		manifest.FailedReviewCount = len(reviewErrors)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.writeArtifact(ctx, prefix+bundleManifestFile, func(w *bufio.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(manifest); err != nil {
+			return fmt.Errorf("failed to encode run manifest: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &runBundle{manifest: prefix + bundleManifestFile, reviews: prefix + bundleProcessedFile}, nil
+}
+
+// writeArtifact creates the file at uri with what write writes, leaving no
+// partial file behind when it fails.
+func (s *VectorizeService) writeArtifact(ctx context.Context, uri string, write func(w *bufio.Writer) error) error {
+	destination, err := transfer.Create(ctx, uri, s.cfg.Export)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(destination)
+	if err := write(w); err != nil {
+		destination.Abort(err)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		destination.Abort(err)
+		return fmt.Errorf("failed to write %s: %w", uri, err)
+	}
+	return destination.Commit()
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// ErrInvalidAuditQuery is returned for audit log queries with an unknown
+// operation or a malformed date.
+var ErrInvalidAuditQuery = errors.New("invalid audit query")
+
+type auditSourceKey struct{}
+
+type auditSource struct {
+	actor   string
+	trigger string
+}
+
+// WithAuditSource records who triggered the operations run with ctx, e.g.
+// the initiator of an event or the caller of the admin API, and how, e.g.
+// the event type, for the audit log.
+func WithAuditSource(ctx context.Context, actor, trigger string) context.Context {
+	return context.WithValue(ctx, auditSourceKey{}, auditSource{actor: actor, trigger: trigger})
+}
+
+// audit appends the entry, attributed to the source recorded in ctx, to the
+// audit log. Failing to do so doesn't undo the operation, so it is only
+// logged.
+func (s *VectorizeService) audit(ctx context.Context, entry storage.AuditEntry) {
+	source, _ := ctx.Value(auditSourceKey{}).(auditSource)
+	entry.Actor, entry.Trigger = source.actor, source.trigger
+	if entry.Actor == "" {
+		entry.Actor = "unknown"
+	}
+	if entry.Trigger == "" {
+		entry.Trigger = "unknown"
+	}
+
+	if err := s.repo.RecordAudit(context.WithoutCancel(ctx), entry); err != nil {
+		s.logger.Error("Failed to record audit entry", "operation", entry.Operation, "saga_id", entry.SagaID, "error", err)
+	}
+}
+
+// AuditQuery selects entries from the audit log. Dates are either days
+// (2006-01-02), which cover the whole day in UTC, or RFC 3339 timestamps.
+type AuditQuery struct {
+	Operation string `json:"operation,omitempty"`
+	Actor     string `json:"actor,omitempty"`
+	SagaID    string `json:"saga_id,omitempty"`
+	DateFrom  string `json:"date_from,omitempty"`
+	DateTo    string `json:"date_to,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// ListAudit returns the audit entries matching the query, most recent first.
+func (s *VectorizeService) ListAudit(ctx context.Context, query AuditQuery) ([]storage.AuditEntry, error) {
+	filters := storage.AuditFilters{
+		Operation: query.Operation,
+		Actor:     query.Actor,
+		SagaID:    query.SagaID,
+		Limit:     query.Limit,
+	}
+
+	switch filters.Operation {
+	case "", storage.AuditDelete, storage.AuditForceRecompute, storage.AuditModelMigration:
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidAuditQuery, query.Operation)
+	}
+
+	if query.DateFrom != "" {
+		from, _, err := parseRunDate(query.DateFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date_from: %w", ErrInvalidAuditQuery, err)
+		}
+		filters.CreatedFrom = &from
+	}
+	if query.DateTo != "" {
+		to, day, err := parseRunDate(query.DateTo)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date_to: %w", ErrInvalidAuditQuery, err)
+		}
+		if day {
+			to = to.AddDate(0, 0, 1)
+		} else {
+			to = to.Add(time.Nanosecond)
+		}
+		filters.CreatedBefore = &to
+	}
+
+	if filters.Limit <= 0 {
+		filters.Limit = defaultAuditLimit
+	}
+	filters.Limit = min(filters.Limit, maxAuditLimit)
+
+	return s.repo.ListAudit(ctx, filters)
+}
+
+// auditFilters returns the JSON fields of filters, which describe what an
+// operation covers, for its audit entry.
+func auditFilters(filters any) map[string]any {
+	data, err := json.Marshal(filters)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
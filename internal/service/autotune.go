@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// batchSizer adapts the batch size of every model to how the provider copes
+// with it. Every model starts at vectorizer.batch_size; a batch the provider
+// rejects as too large or times out on halves it, a full batch embedded in
+// under half of the target latency grows it by a quarter and a slower one
+// shrinks it by a quarter, within the configured bounds.
+type batchSizer struct {
+	cfg    config.AutotuneConfig
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	start int
+	sizes map[string]int
+}
+
+// newBatchSizer returns nil when auto-tuning is off.
+func newBatchSizer(cfg config.AutotuneConfig, start int, logger *slog.Logger) *batchSizer {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &batchSizer{cfg: cfg, logger: logger, start: start, sizes: make(map[string]int)}
+}
+
+func (b *batchSizer) clamp(size int) int {
+	return min(max(size, b.cfg.MinBatchSize), b.cfg.MaxBatchSize)
+}
+
+// size returns the batch size for the model, caller holding b.mu.
+func (b *batchSizer) size(model string) int {
+	if size, ok := b.sizes[model]; ok {
+		return size
+	}
+	return b.clamp(b.start)
+}
+
+// get returns the batch size for the model.
+func (b *batchSizer) get(model string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size(model)
+}
+
+// reset starts every model over from a retuned vectorizer.batch_size.
+func (b *batchSizer) reset(start int) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.start = start
+	clear(b.sizes)
+}
+
+// observe adapts the model's batch size to a batch of n reviews embedded in
+// latency, and reports whether err says the batch was too large for the
+// provider.
+func (b *batchSizer) observe(model string, n int, latency time.Duration, err error) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous := b.size(model)
+	size, reason := previous, ""
+	tooLarge := err != nil && batchTooLarge(err)
+	switch {
+	case tooLarge:
+		size, reason = b.clamp(min(previous, n)/2), "too_large"
+	case err != nil:
+	case latency > b.cfg.TargetLatency:
+		size, reason = b.clamp(previous*3/4), "slow"
+	case latency < b.cfg.TargetLatency/2 && n >= previous:
+		size, reason = b.clamp(previous+max(previous/4, 1)), "fast"
+	}
+
+	if size != previous {
+		b.sizes[model] = size
+		b.logger.Info("Adjusted embedding batch size",
+			"model", model,
+			"batch_size", size,
+			"previous", previous,
+			"reason", reason,
+			"latency", latency)
+	}
+	return tooLarge
+}
+
+// batchTooLarge tells whether the provider failed a batch because it was too
+// large, or took too long over it.
+func batchTooLarge(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status == http.StatusRequestEntityTooLarge || se.status == http.StatusRequestTimeout || se.status == http.StatusGatewayTimeout
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// batchSize returns the number of reviews to embed per batch with the
+// current model.
+func (s *VectorizeService) batchSize() int {
+	if s.sizer == nil {
+		return s.tuner.get().BatchSize
+	}
+	return s.sizer.get(s.currentModel().name)
+}
+
+// embedTuned embeds reviews with embed, adapting the batch size to how long
+// it took. A batch the provider found too large is embedded once more in
+// batches of the shrunk size rather than failed.
+func (s *VectorizeService) embedTuned(ctx context.Context, reviews []storage.CleanReview, embed func(context.Context, []storage.CleanReview) ([]*storage.Vector, error)) ([]*storage.Vector, error) {
+	model := s.currentModel().name
+	started := time.Now()
+	vectors, err := embed(ctx, reviews)
+	// A run stopped or out of time says nothing about the provider.
+	if ctx.Err() != nil || !s.sizer.observe(model, len(reviews), time.Since(started), err) {
+		return vectors, err
+	}
+
+	size := s.sizer.get(model)
+	if size >= len(reviews) {
+		return nil, err
+	}
+	s.logger.Warn("Embedding batch too large, splitting it", "count", len(reviews), "batch_size", size, "error", err)
+
+	vectors = nil
+	for i := 0; i < len(reviews); i += size {
+		part := reviews[i:min(i+size, len(reviews))]
+		started := time.Now()
+		partVectors, err := embed(ctx, part)
+		if ctx.Err() == nil {
+			s.sizer.observe(model, len(part), time.Since(started), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, partVectors...)
+	}
+	return vectors, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// backpressureStep is the first pause once the database is found overloaded.
+const backpressureStep = 250 * time.Millisecond
+
+// backpressure paces the writers of all runs by the load of Postgres. While
+// the replication lag or the number of active sessions is over its
+// threshold, the pause before each batch doubles at every check, up to
+// backpressure.max_delay; once the load is back under, it halves until it is
+// gone.
+type backpressure struct {
+	repo   storage.Repository
+	cfg    config.BackpressureConfig
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	delay     time.Duration
+}
+
+// newBackpressure returns nil when no threshold is set.
+func newBackpressure(repo storage.Repository, cfg config.BackpressureConfig, logger *slog.Logger) *backpressure {
+	if cfg.MaxReplicationLag <= 0 && cfg.MaxActiveConnections <= 0 {
+		return nil
+	}
+	return &backpressure{repo: repo, cfg: cfg, logger: logger}
+}
+
+// wait pauses for the current delay, or until ctx is done.
+func (b *backpressure) wait(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	delay := b.currentDelay(ctx)
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// currentDelay samples the database load when the last sample is older than
+// backpressure.check_interval and adapts the delay to it. A failed sample
+// keeps the delay as it is.
+func (b *backpressure) currentDelay(ctx context.Context) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if time.Since(b.checkedAt) < b.cfg.CheckInterval {
+		return b.delay
+	}
+	b.checkedAt = time.Now()
+
+	load, err := b.repo.GetDatabaseLoad(ctx)
+	if err != nil {
+		b.logger.Warn("Failed to check database load", "error", err)
+		return b.delay
+	}
+
+	overloaded := (b.cfg.MaxReplicationLag > 0 && load.ReplicationLag > b.cfg.MaxReplicationLag) ||
+		(b.cfg.MaxActiveConnections > 0 && load.ActiveConnections > b.cfg.MaxActiveConnections)
+
+	previous := b.delay
+	switch {
+	case overloaded:
+		b.delay = min(max(2*b.delay, backpressureStep), b.cfg.MaxDelay)
+	case b.delay/2 < backpressureStep:
+		b.delay = 0
+	default:
+		b.delay /= 2
+	}
+
+	if b.delay != previous {
+		b.logger.Info("Adjusted write pace to database load",
+			"delay", b.delay,
+			"replication_lag", load.ReplicationLag,
+			"active_connections", load.ActiveConnections)
+	}
+	return b.delay
+}
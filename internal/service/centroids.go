@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// ComputeCentroids recomputes the app's centroid vectors per ISO week and
+// rating bucket. A date range is widened to whole ISO weeks, so that the
+// centroids of its first and last weeks average every review of them.
+func (s *VectorizeService) ComputeCentroids(ctx context.Context, req payloads.CentroidsRequest) (payloads.CentroidsCompleted, error) {
+	filters := storage.EmbeddingFilters{
+		AppID: req.AppID,
+		Model: s.currentModel().name,
+	}
+
+	var err error
+	if filters.DateFrom, err = isoWeekBound(req.DateFrom, false); err != nil {
+		return payloads.CentroidsCompleted{}, err
+	}
+	if filters.DateTo, err = isoWeekBound(req.DateTo, true); err != nil {
+		return payloads.CentroidsCompleted{}, err
+	}
+
+	centroids, err := s.repo.ComputeCentroids(ctx, filters)
+	if err != nil {
+		return payloads.CentroidsCompleted{}, err
+	}
+
+	return payloads.CentroidsCompleted{
+		CentroidsRequest: req,
+		Model:            filters.Model,
+		Centroids:        centroids,
+	}, nil
+}
+
+// isoWeekBound returns the first instant of the ISO week of the YYYY-MM-DD
+// date, or with end set its last instant, formatted for a reviewed_at
+// comparison. Empty dates stay empty.
+func isoWeekBound(date string, end bool) (string, error) {
+	if date == "" {
+		return "", nil
+	}
+
+	day, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q: %w", date, err)
+	}
+
+	// Weekday counts from Sunday, ISO weeks start on Monday.
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	if end {
+		return monday.AddDate(0, 0, 7).Add(-time.Nanosecond).Format(time.RFC3339Nano), nil
+	}
+	return monday.Format(time.RFC3339Nano), nil
+}
+
+// HandleCentroids recomputes the app's centroids for a
+// pipeline.aggregate_centroids.request event and publishes the completed
+// event.
+func (s *VectorizeService) HandleCentroids(ctx context.Context, evt payloads.CentroidsRequest, sagaID string) error {
+	s.logger.Info("Centroid aggregation request", "app_id", evt.AppID, "date_from", evt.DateFrom, "date_to", evt.DateTo, "saga_id", sagaID)
+
+	completed, err := s.ComputeCentroids(ctx, evt)
+	if err != nil {
+		s.logger.Error("Centroid aggregation failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("centroid aggregation failed: %w", err)
+	}
+
+	s.logger.Info("Centroid aggregation completed", "centroids", completed.Centroids, "saga_id", sagaID)
+
+	envelope := s.producer.BuildCentroidsCompletedEnvelope(completed, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish centroids completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// sentenceTerminators end a sentence when followed by a space or the end of
+// the text.
+const sentenceTerminators = ".!?…。！？"
+
+// chunkText splits text into chunks of at most maxChars bytes, breaking on
+// sentence boundaries where possible and on word boundaries otherwise. Each
+// chunk after the first repeats up to overlapChars of trailing sentences from
+// the previous one so context is not lost at the cut. A non-positive maxChars
+// disables chunking.
+//
+// Sizes are measured in bytes, which errs on the short side for non-ASCII
+// text.
+func chunkText(text string, maxChars, overlapChars int) []string {
+	if maxChars <= 0 || len(text) <= maxChars {
+		return []string{text}
+	}
+
+	var pieces []string
+	for _, sentence := range splitSentences(text) {
+		pieces = append(pieces, splitLong(sentence, maxChars)...)
+	}
+
+	var chunks []string
+	var current []string
+	size := 0
+	for _, piece := range pieces {
+		if size > 0 && size+1+len(piece) > maxChars {
+			chunks = append(chunks, strings.Join(current, " "))
+			current, size = overlapTail(current, min(overlapChars, maxChars-len(piece)-1))
+		}
+		if size > 0 {
+			size++
+		}
+		current = append(current, piece)
+		size += len(piece)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, " "))
+	}
+
+	return chunks
+}
+
+// splitSentences splits text after every sentence terminator that is
+// followed by a space, so runs like "..." or "?!" stay in one sentence.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+
+	for i, r := range text {
+		if !strings.ContainsRune(sentenceTerminators, r) {
+			continue
+		}
+		end := i + utf8.RuneLen(r)
+		if end < len(text) && text[end] != ' ' {
+			continue
+		}
+		if sentence := strings.TrimSpace(text[start:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	if rest := strings.TrimSpace(text[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+
+	return sentences
+}
+
+// splitLong breaks a sentence longer than maxChars on word boundaries, and a
+// single word longer than maxChars on rune boundaries.
+func splitLong(sentence string, maxChars int) []string {
+	if len(sentence) <= maxChars {
+		return []string{sentence}
+	}
+
+	var parts []string
+	var current strings.Builder
+	for _, word := range strings.Fields(sentence) {
+		for len(word) > maxChars {
+			cut := maxChars
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+			parts = append(parts, word[:cut])
+			word = word[cut:]
+		}
+
+		if current.Len() > 0 && current.Len()+1+len(word) > maxChars {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteByte(' ')
+		}
+		current.WriteString(word)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+
+	return parts
+}
+
+// overlapTail returns the trailing pieces that fit within budget bytes when
+// joined, along with their joined size.
+func overlapTail(pieces []string, budget int) ([]string, int) {
+	size := 0
+	start := len(pieces)
+	for start > 0 {
+		next := len(pieces[start-1])
+		if size > 0 {
+			next++
+		}
+		if size+next > budget {
+			break
+		}
+		size += next
+		start--
+	}
+
+	return append([]string(nil), pieces[start:]...), size
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	const review = "One fine day. Two bad days! Three okay days? Four."
+
+	tests := []struct {
+		name         string
+		text         string
+		maxChars     int
+		overlapChars int
+		want         []string
+	}{
+		{
+			name:     "chunking off",
+			text:     review,
+			maxChars: 0,
+			want:     []string{review},
+		},
+		{
+			name:     "short enough",
+			text:     "Short review.",
+			maxChars: 100,
+			want:     []string{"Short review."},
+		},
+		{
+			name:     "on sentence boundaries",
+			text:     review,
+			maxChars: 30,
+			want:     []string{"One fine day. Two bad days!", "Three okay days? Four."},
+		},
+		{
+			name:         "overlap repeats trailing sentences",
+			text:         review,
+			maxChars:     30,
+			overlapChars: 15,
+			want:         []string{"One fine day. Two bad days!", "Two bad days! Three okay days?", "Four."},
+		},
+		{
+			name:         "overlap leaves room for the next sentence",
+			text:         review,
+			maxChars:     30,
+			overlapChars: 100,
+			want:         []string{"One fine day. Two bad days!", "Two bad days! Three okay days?", "Three okay days? Four."},
+		},
+		{
+			name:     "terminators without a space",
+			text:     "Version 2.5 broke sync... Really?! Fix it now please.",
+			maxChars: 30,
+			want:     []string{"Version 2.5 broke sync...", "Really?! Fix it now please."},
+		},
+		{
+			name:     "long sentence on word boundaries",
+			text:     "a very long sentence without any terminator at all here",
+			maxChars: 20,
+			want:     []string{"a very long sentence", "without any", "terminator at all", "here"},
+		},
+		{
+			name:     "long word on rune boundaries",
+			text:     "ééééééééééé tail",
+			maxChars: 7,
+			want:     []string{"ééé", "ééé", "ééé", "éé", "tail"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkText(tt.text, tt.maxChars, tt.overlapChars)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chunkText(%q, %d, %d) = %q, want %q", tt.text, tt.maxChars, tt.overlapChars, got, tt.want)
+			}
+			for _, chunk := range got {
+				if tt.maxChars > 0 && len(chunk) > tt.maxChars {
+					t.Errorf("chunk %q is longer than %d bytes", chunk, tt.maxChars)
+				}
+			}
+		})
+	}
+}
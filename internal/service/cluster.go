@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// ErrNothingToCluster is returned when an app has no embedded reviews made
+// with the configured model in the requested range.
+var ErrNothingToCluster = errors.New("no embedded reviews to cluster")
+
+// ClusterRequest asks for the embedded reviews of an app to be grouped into
+// K clusters; K defaults to clustering.k.
+type ClusterRequest struct {
+	SagaID   string
+	AppID    string
+	K        int
+	DateFrom string
+	DateTo   string
+}
+
+// ClusterResult summarizes a finished clustering; its assignments and
+// centroids are stored under ClusteringID.
+type ClusterResult struct {
+	ClusteringID string                    `json:"clustering_id"`
+	Model        string                    `json:"model"`
+	K            int                       `json:"k"`
+	Reviews      int                       `json:"reviews"`
+	Inertia      float64                   `json:"inertia"`
+	Clusters     []storage.ClusterCentroid `json:"clusters"`
+}
+
+// Cluster fits k-means centroids to a random sample of the app's content
+// vectors, then assigns every embedded review of the app to its nearest
+// centroid and stores the assignments and centroids.
+func (s *VectorizeService) Cluster(ctx context.Context, req ClusterRequest) (ClusterResult, error) {
+	cfg := s.cfg.Clustering
+	k := req.K
+	if k <= 0 {
+		k = cfg.K
+	}
+	if k <= 0 {
+		return ClusterResult{}, fmt.Errorf("invalid number of clusters %d", k)
+	}
+
+	filters := storage.EmbeddingFilters{
+		AppID:    req.AppID,
+		Model:    s.currentModel().name,
+		DateFrom: req.DateFrom,
+		DateTo:   req.DateTo,
+	}
+
+	sample, err := s.repo.SampleContentVectors(ctx, filters, max(cfg.SampleSize, k))
+	if err != nil {
+		return ClusterResult{}, err
+	}
+	if len(sample) == 0 {
+		return ClusterResult{}, fmt.Errorf("%w for app %s", ErrNothingToCluster, req.AppID)
+	}
+	k = min(k, len(sample))
+
+	clustering := storage.NewClustering(req.SagaID, k, filters)
+	if err := s.repo.CreateClustering(ctx, clustering); err != nil {
+		return ClusterResult{}, err
+	}
+
+	s.logger.Info("Fitting clusters",
+		"clustering_id", clustering.ClusteringID,
+		"app_id", req.AppID,
+		"k", k,
+		"sample", len(sample))
+
+	vectors := make([][]float32, len(sample))
+	for i, review := range sample {
+		vectors[i] = review.Vector
+	}
+	centroids := miniBatchKMeans(vectors, k, cfg.BatchSize, cfg.Iterations)
+
+	sizes, inertia, err := s.assignClusters(ctx, clustering.ClusteringID, filters, centroids)
+
+	clusters := make([]storage.ClusterCentroid, len(centroids))
+	for i, centroid := range centroids {
+		clusters[i] = storage.ClusterCentroid{ClusterIndex: i, Size: sizes[i], Centroid: centroid}
+	}
+
+	now := time.Now()
+	clustering.FinishedAt = &now
+	clustering.Inertia = inertia
+	for _, size := range sizes {
+		clustering.Reviews += size
+	}
+	clustering.Status = storage.RunStatusCompleted
+	if err != nil {
+		clustering.Status = storage.RunStatusFailed
+		clustering.Error = err.Error()
+		clusters = nil
+	}
+
+	// Record the outcome even when the clustering was cancelled.
+	if finishErr := s.repo.FinishClustering(context.WithoutCancel(ctx), clustering, clusters); finishErr != nil {
+		if err == nil {
+			return ClusterResult{}, finishErr
+		}
+		s.logger.Error("Failed to record failed clustering", "clustering_id", clustering.ClusteringID, "error", finishErr)
+	}
+	if err != nil {
+		return ClusterResult{}, fmt.Errorf("failed to assign clusters: %w", err)
+	}
+
+	return ClusterResult{
+		ClusteringID: clustering.ClusteringID,
+		Model:        clustering.Model,
+		K:            k,
+		Reviews:      clustering.Reviews,
+		Inertia:      inertia,
+		Clusters:     clusters,
+	}, nil
+}
+
+// assignClusters pages through every content vector the filters select and
+// stores each review's nearest centroid. It returns the cluster sizes and the
+// inertia, the sum of squared distances of the reviews to their centroids.
+func (s *VectorizeService) assignClusters(ctx context.Context, clusteringID string, filters storage.EmbeddingFilters, centroids [][]float32) ([]int, float64, error) {
+	pageSize := s.cfg.Clustering.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	sizes := make([]int, len(centroids))
+	var inertia float64
+	var after string
+
+	for {
+		page, err := s.repo.ListContentVectors(ctx, filters, after, pageSize)
+		if err != nil {
+			return sizes, inertia, err
+		}
+		if len(page) == 0 {
+			return sizes, inertia, nil
+		}
+
+		assignments := make([]storage.ClusterAssignment, len(page))
+		for i, review := range page {
+			cluster, distance := nearestCentroid(centroids, review.Vector)
+			assignments[i] = storage.ClusterAssignment{
+				ReviewID:     review.ReviewID,
+				ClusterIndex: cluster,
+				Distance:     math.Sqrt(distance),
+			}
+			sizes[cluster]++
+			inertia += distance
+		}
+
+		if err := s.repo.RecordClusterAssignments(ctx, clusteringID, assignments); err != nil {
+			return sizes, inertia, err
+		}
+
+		after = page[len(page)-1].ReviewID
+	}
+}
+
+// HandleCluster clusters the app's reviews for a
+// pipeline.cluster_reviews.request event and publishes the completed event.
+func (s *VectorizeService) HandleCluster(ctx context.Context, evt payloads.ClusterRequest, sagaID string) error {
+	req := ClusterRequest{
+		SagaID:   sagaID,
+		AppID:    evt.AppID,
+		K:        evt.K,
+		DateFrom: evt.DateFrom,
+		DateTo:   evt.DateTo,
+	}
+
+	s.logger.Info("Clustering request", "app_id", req.AppID, "k", req.K, "saga_id", sagaID)
+
+	result, err := s.Cluster(ctx, req)
+	if err != nil {
+		s.logger.Error("Clustering failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("clustering failed: %w", err)
+	}
+
+	s.logger.Info("Clustering completed",
+		"clustering_id", result.ClusteringID,
+		"reviews", result.Reviews,
+		"k", result.K,
+		"saga_id", sagaID)
+
+	completedEvent := payloads.ClusteringCompleted{
+		AppID:        req.AppID,
+		ClusteringID: result.ClusteringID,
+		Model:        result.Model,
+		K:            result.K,
+		Reviews:      result.Reviews,
+		Inertia:      result.Inertia,
+		Clusters:     make([]payloads.ClusterSize, len(result.Clusters)),
+	}
+	for i, cluster := range result.Clusters {
+		completedEvent.Clusters[i] = payloads.ClusterSize{ClusterIndex: cluster.ClusterIndex, Size: cluster.Size}
+	}
+
+	envelope := s.producer.BuildClusteringCompletedEnvelope(completedEvent, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish clustering completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
+)
+
+// vectorCache remembers the vectors of texts embedded earlier in a run, so
+// duplicate texts across batches are embedded once. It is shared by the
+// embedder workers and stops accepting entries once capacity is reached to
+// bound memory; a nil cache only counts duplicates within a batch.
+type vectorCache struct {
+	mu           sync.Mutex
+	vectors      map[string][]float32
+	capacity     int
+	deduplicated int
+}
+
+func newVectorCache(capacity int) *vectorCache {
+	return &vectorCache{
+		vectors:  make(map[string][]float32),
+		capacity: capacity,
+	}
+}
+
+func (c *vectorCache) get(key string) ([]float32, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vector, ok := c.vectors[key]
+	return vector, ok
+}
+
+func (c *vectorCache) put(key string, vector []float32) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.vectors) < c.capacity {
+		c.vectors[key] = vector
+	}
+}
+
+// countDeduplicated records texts that were not sent to the embedder because
+// an identical text was embedded already.
+func (c *vectorCache) countDeduplicated(n int) {
+	if c == nil || n == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deduplicated += n
+}
+
+func (c *vectorCache) deduplicatedCount() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.deduplicated
+}
+
+// dedupeKey normalizes text so that reviews differing only in whitespace or
+// case share one embedding.
+func dedupeKey(text string) string {
+	return strings.ToLower(preprocess.CollapseWhitespace(text))
+}
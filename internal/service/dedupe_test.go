@@ -0,0 +1,53 @@
+package service
+
+import "testing"
+
+func TestDedupeKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"identical", "Great app", "Great app", true},
+		{"case", "Great App", "great app", true},
+		{"whitespace", "great   app\n", " great app", true},
+		{"different words", "great app", "great apps", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := dedupeKey(tt.a) == dedupeKey(tt.b); same != tt.same {
+				t.Errorf("dedupeKey(%q) == dedupeKey(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+			}
+		})
+	}
+
+	if key := dedupeKey(" \n "); key != "" {
+		t.Errorf("dedupeKey of whitespace = %q, want empty", key)
+	}
+}
+
+func TestVectorCache(t *testing.T) {
+	cache := newVectorCache(1)
+	cache.put("first", []float32{1})
+	cache.put("second", []float32{2})
+
+	if vector, ok := cache.get("first"); !ok || vector[0] != 1 {
+		t.Errorf("get(first) = %v, %v, want [1], true", vector, ok)
+	}
+	if _, ok := cache.get("second"); ok {
+		t.Error("cache kept more vectors than its capacity")
+	}
+
+	cache.countDeduplicated(2)
+	cache.countDeduplicated(1)
+	if n := cache.deduplicatedCount(); n != 3 {
+		t.Errorf("deduplicatedCount() = %d, want 3", n)
+	}
+
+	var none *vectorCache
+	none.put("first", []float32{1})
+	if _, ok := none.get("first"); ok {
+		t.Error("nil cache returned a vector")
+	}
+}
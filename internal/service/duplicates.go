@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// DuplicatesRequest asks for the near-duplicate reviews of an app; Threshold
+// defaults to duplicates.threshold.
+type DuplicatesRequest struct {
+	AppID     string
+	Threshold float64
+	DateFrom  string
+	DateTo    string
+}
+
+// DetectDuplicates compares every embedded review of the app with its
+// nearest neighbors, records the pairs at least as similar as the threshold
+// in review_duplicates and summarizes them.
+func (s *VectorizeService) DetectDuplicates(ctx context.Context, req DuplicatesRequest) (payloads.DuplicatesSummary, error) {
+	cfg := s.cfg.Duplicates
+	threshold := req.Threshold
+	if threshold <= 0 {
+		threshold = cfg.Threshold
+	}
+	if threshold <= 0 || threshold > 1 {
+		return payloads.DuplicatesSummary{}, fmt.Errorf("invalid duplicate threshold %v", threshold)
+	}
+
+	pageSize := cfg.PageSize
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	neighbors := max(cfg.Neighbors, 1)
+
+	filters := storage.EmbeddingFilters{
+		AppID:    req.AppID,
+		Model:    s.currentModel().name,
+		DateFrom: req.DateFrom,
+		DateTo:   req.DateTo,
+	}
+
+	summary := payloads.DuplicatesSummary{
+		AppID:     req.AppID,
+		Model:     filters.Model,
+		Threshold: threshold,
+	}
+	groups := newReviewGroups()
+	var after string
+
+	for {
+		reviewIDs, err := s.repo.ListEmbeddedReviewIDs(ctx, filters, after, pageSize)
+		if err != nil {
+			return summary, err
+		}
+		if len(reviewIDs) == 0 {
+			break
+		}
+
+		pairs, err := s.repo.FindNearDuplicates(ctx, filters, reviewIDs, neighbors, threshold)
+		if err != nil {
+			return summary, err
+		}
+		if err := s.repo.RecordDuplicates(ctx, req.AppID, filters.Model, pairs); err != nil {
+			return summary, err
+		}
+
+		for _, pair := range pairs {
+			groups.link(pair.ReviewIDA, pair.ReviewIDB)
+		}
+
+		summary.Reviews += len(reviewIDs)
+		after = reviewIDs[len(reviewIDs)-1]
+	}
+
+	summary.Pairs = len(groups.pairs)
+	summary.FlaggedReviews = len(groups.parent)
+	for _, size := range groups.sizes() {
+		summary.Groups++
+		summary.LargestGroup = max(summary.LargestGroup, size)
+	}
+
+	return summary, nil
+}
+
+// HandleDuplicates detects the app's near-duplicate reviews for a
+// pipeline.detect_duplicates.request event and publishes the summary.
+func (s *VectorizeService) HandleDuplicates(ctx context.Context, evt payloads.DuplicatesRequest, sagaID string) error {
+	req := DuplicatesRequest{
+		AppID:     evt.AppID,
+		Threshold: evt.Threshold,
+		DateFrom:  evt.DateFrom,
+		DateTo:    evt.DateTo,
+	}
+
+	s.logger.Info("Near-duplicate detection request", "app_id", req.AppID, "threshold", req.Threshold, "saga_id", sagaID)
+
+	summary, err := s.DetectDuplicates(ctx, req)
+	if err != nil {
+		s.logger.Error("Near-duplicate detection failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("near-duplicate detection failed: %w", err)
+	}
+
+	s.logger.Info("Near-duplicate detection completed",
+		"reviews", summary.Reviews,
+		"pairs", summary.Pairs,
+		"groups", summary.Groups,
+		"largest_group", summary.LargestGroup,
+		"saga_id", sagaID)
+
+	envelope := s.producer.BuildDuplicatesSummaryEnvelope(summary, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish duplicates summary event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
+
+// reviewGroups is a union-find over review IDs, grouping reviews that are
+// linked by near-duplicate pairs directly or through other reviews.
+type reviewGroups struct {
+	parent map[string]string
+	pairs  map[[2]string]bool
+}
+
+func newReviewGroups() *reviewGroups {
+	return &reviewGroups{
+		parent: make(map[string]string),
+		pairs:  make(map[[2]string]bool),
+	}
+}
+
+func (g *reviewGroups) find(id string) string {
+	root, ok := g.parent[id]
+	if !ok {
+		g.parent[id] = id
+		return id
+	}
+	if root != id {
+		root = g.find(root)
+		g.parent[id] = root
+	}
+	return root
+}
+
+func (g *reviewGroups) link(a, b string) {
+	g.pairs[[2]string{a, b}] = true
+	if rootA, rootB := g.find(a), g.find(b); rootA != rootB {
+		g.parent[rootA] = rootB
+	}
+}
+
+// sizes returns the number of reviews in each group.
+func (g *reviewGroups) sizes() map[string]int {
+	sizes := make(map[string]int)
+	for id := range g.parent {
+		sizes[g.find(id)]++
+	}
+	return sizes
+}
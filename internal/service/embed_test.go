@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// fakeEmbedder embeds the i-th text it is sent as the vector {i}, so that
+// every vector can be traced back to its text. It returns short vectors
+// fewer than it is sent.
+type fakeEmbedder struct {
+	mu    sync.Mutex
+	texts []string
+	short int
+}
+
+func (e *fakeEmbedder) EmbedBatch(_ context.Context, inputs []string) ([][]float32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	vectors := make([][]float32, 0, len(inputs))
+	for _, input := range inputs {
+		vectors = append(vectors, []float32{float32(len(e.texts))})
+		e.texts = append(e.texts, input)
+	}
+	return vectors[:max(len(vectors)-e.short, 0)], nil
+}
+
+func (e *fakeEmbedder) Check(context.Context) error {
+	return nil
+}
+
+// textOf returns the text vector was made from, or "" for no vector.
+func (e *fakeEmbedder) textOf(vector []float32) string {
+	if vector == nil {
+		return ""
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.texts[int(vector[0])]
+}
+
+func newTestService(embedder Embedder) *VectorizeService {
+	cfg := &config.Config{}
+	cfg.Vectorizer.Model = "test-model"
+	cfg.Vectorizer.EmbedResponses = true
+	cfg.Vectorizer.ChunkMaxTokens = 8
+	cfg.Vectorizer.MaxVectorLength = 1
+	cfg.Preprocessing.CollapseWhitespace = true
+	cfg.Flags.ResponseVectors = true
+
+	s := &VectorizeService{
+		cfg:          cfg,
+		logger:       slog.New(slog.DiscardHandler),
+		preprocessor: preprocess.New(cfg.Preprocessing),
+	}
+	s.model.Store(&embeddingModel{name: cfg.Vectorizer.Model, embedder: embedder})
+	flags := cfg.Flags
+	s.flags.Store(&flags)
+	return s
+}
+
+func TestEmbedPresent(t *testing.T) {
+	tests := []struct {
+		name    string
+		texts   []string
+		short   int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "all present",
+			texts: []string{"first text", "second text"},
+			want:  []string{"first text", "second text"},
+		},
+		{
+			name:  "empty texts are skipped",
+			texts: []string{"", "first text", "   ", "second text", ""},
+			want:  []string{"", "first text", "", "second text", ""},
+		},
+		{
+			name:  "identical texts share a vector",
+			texts: []string{"same text", "", "other text", "Same  TEXT"},
+			want:  []string{"same text", "", "other text", "same text"},
+		},
+		{
+			name:  "nothing to embed",
+			texts: []string{"", " "},
+			want:  []string{"", ""},
+		},
+		{
+			name:    "fewer vectors than texts",
+			texts:   []string{"first text", "", "second text"},
+			short:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder := &fakeEmbedder{short: tt.short}
+			s := newTestService(embedder)
+
+			vectors, err := s.embedPresent(context.Background(), tt.texts, newVectorCache(100))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(vectors) != len(tt.texts) {
+				t.Fatalf("got %d vectors for %d texts", len(vectors), len(tt.texts))
+			}
+			for i, vector := range vectors {
+				if got := embedder.textOf(vector); got != tt.want[i] {
+					t.Errorf("vector %d is of %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEmbedBatch(t *testing.T) {
+	response := func(text string) *string { return &text }
+
+	// wantVector is a stored row: the text of its content and response
+	// vectors.
+	type wantVector struct {
+		reviewID string
+		chunk    int
+		content  string
+		response string
+	}
+
+	tests := []struct {
+		name    string
+		reviews []storage.CleanReview
+		short   int
+		want    []wantVector
+		wantErr bool
+	}{
+		{
+			name: "reviews with and without responses",
+			reviews: []storage.CleanReview{
+				{ID: "r1", ContentClean: "alpha review", ResponseContentClean: response("alpha reply")},
+				{ID: "r2", ContentClean: "bravo review"},
+				{ID: "r3", ContentClean: "charlie review", ResponseContentClean: response(" ")},
+				{ID: "r4", ContentClean: "delta review", ResponseContentClean: response("delta reply")},
+			},
+			want: []wantVector{
+				{"r1", 0, "alpha review", "alpha reply"},
+				{"r2", 0, "bravo review", ""},
+				{"r3", 0, "charlie review", ""},
+				{"r4", 0, "delta review", "delta reply"},
+			},
+		},
+		{
+			name: "review split into chunks",
+			reviews: []storage.CleanReview{
+				{ID: "r1", ContentClean: "echo review", ResponseContentClean: response("echo reply")},
+				{ID: "r2", ContentClean: "Foxtrot one is short. Foxtrot two is here. Foxtrot three ends.", ResponseContentClean: response("foxtrot reply")},
+				{ID: "r3", ContentClean: "golf review", ResponseContentClean: response("golf reply")},
+			},
+			want: []wantVector{
+				{"r1", 0, "echo review", "echo reply"},
+				{"r2", 0, "Foxtrot one is short.", "foxtrot reply"},
+				{"r2", 1, "Foxtrot two is here.", ""},
+				{"r2", 2, "Foxtrot three ends.", ""},
+				{"r3", 0, "golf review", "golf reply"},
+			},
+		},
+		{
+			name: "fewer vectors than texts",
+			reviews: []storage.CleanReview{
+				{ID: "r1", ContentClean: "hotel review", ResponseContentClean: response("hotel reply")},
+				{ID: "r2", ContentClean: "india review"},
+			},
+			short:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder := &fakeEmbedder{short: tt.short}
+			s := newTestService(embedder)
+
+			vectors, err := s.embedBatch(context.Background(), tt.reviews, newVectorCache(100))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(vectors) != len(tt.want) {
+				t.Fatalf("got %d vectors, want %d", len(vectors), len(tt.want))
+			}
+			for i, want := range tt.want {
+				vector := vectors[i]
+				if vector.ReviewID != want.reviewID || vector.ChunkIndex != want.chunk {
+					t.Errorf("vector %d is of review %s chunk %d, want review %s chunk %d",
+						i, vector.ReviewID, vector.ChunkIndex, want.reviewID, want.chunk)
+				}
+				if got := embedder.textOf(vector.ContentVec); got != want.content {
+					t.Errorf("content vector %d is of %q, want %q", i, got, want.content)
+				}
+				if got := embedder.textOf(vector.ResponseVec); got != want.response {
+					t.Errorf("response vector %d is of %q, want %q", i, got, want.response)
+				}
+			}
+		})
+	}
+}
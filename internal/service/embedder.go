@@ -6,10 +6,68 @@ import (
 	"log/slog"
 	"math/rand"
 	"strings"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
 )
 
 type Embedder interface {
 	EmbedBatch(ctx context.Context, inputs []string) ([][]float32, error)
+	// Check reports whether the embedder can currently serve requests.
+	Check(ctx context.Context) error
+}
+
+type queryKey struct{}
+
+// withQuery returns a context whose embeddings are of search queries rather
+// than documents, for the input templates.
+func withQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryKey{}, true)
+}
+
+// templatedEmbedder wraps the inputs in the input template of its model
+// before they reach the wrapped embedder: the query template for contexts
+// from withQuery, the document template otherwise.
+type templatedEmbedder struct {
+	Embedder
+	template config.InputTemplate
+}
+
+func (e *templatedEmbedder) EmbedBatch(ctx context.Context, inputs []string) ([][]float32, error) {
+	template := e.template.Document
+	if query, _ := ctx.Value(queryKey{}).(bool); query {
+		template = e.template.Query
+	}
+	if template == "" {
+		return e.Embedder.EmbedBatch(ctx, inputs)
+	}
+
+	wrapped := make([]string, len(inputs))
+	for i, input := range inputs {
+		wrapped[i] = strings.ReplaceAll(template, "{text}", input)
+	}
+	return e.Embedder.EmbedBatch(ctx, wrapped)
+}
+
+// redactingEmbedder replaces personal data in the inputs before they reach
+// the wrapped embedder, and logs how much of it each batch had.
+type redactingEmbedder struct {
+	Embedder
+	redactor *preprocess.Redactor
+	logger   *slog.Logger
+}
+
+func (e *redactingEmbedder) EmbedBatch(ctx context.Context, inputs []string) ([][]float32, error) {
+	counts := make(map[string]int)
+	redacted := make([]string, len(inputs))
+	for i, input := range inputs {
+		redacted[i] = e.redactor.Redact(input, counts)
+	}
+
+	if len(counts) > 0 {
+		e.logger.Info("Redacted personal data before embedding", "inputs", len(inputs), "redactions", counts)
+	}
+	return e.Embedder.EmbedBatch(ctx, redacted)
 }
 
 type OpenAIEmbedder struct {
@@ -31,7 +89,7 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, inputs []string) ([][]f
 
 	processedInputs := make([]string, 0, len(inputs))
 	for _, input := range inputs {
-		if processed := preprocessText(input); processed != "" {
+		if processed := preprocess.CollapseWhitespace(input); processed != "" {
 			processedInputs = append(processedInputs, processed)
 		}
 	}
@@ -51,6 +109,13 @@ func (e *OpenAIEmbedder) EmbedBatch(ctx context.Context, inputs []string) ([][]f
 	return vectors, nil
 }
 
+func (e *OpenAIEmbedder) Check(ctx context.Context) error {
+	if err := e.client.CheckCredentials(ctx); err != nil {
+		return fmt.Errorf("OpenAI credential check failed: %w", err)
+	}
+	return nil
+}
+
 type StubEmbedder struct {
 	dim    int
 	logger *slog.Logger
@@ -83,13 +148,6 @@ func (e *StubEmbedder) EmbedBatch(ctx context.Context, inputs []string) ([][]flo
 	return vectors, nil
 }
 
-func preprocessText(text string) string {
-	text = strings.TrimSpace(text)
-	text = strings.Join(strings.Fields(text), " ")
-
-	if len(text) < 3 {
-		return ""
-	}
-
-	return text
+func (e *StubEmbedder) Check(ctx context.Context) error {
+	return nil
 }
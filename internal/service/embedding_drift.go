@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+const (
+	// normBucketWidth is the width of the buckets of vector norm histograms;
+	// the last of normBuckets buckets also counts every longer vector.
+	normBucketWidth = 0.05
+	normBuckets     = 40
+)
+
+// DriftCheck is the outcome of comparing the recent content vectors of an
+// app with its baseline. Baseline is set when the check took the baseline
+// instead, the app having none yet.
+type DriftCheck struct {
+	AppID        string  `json:"app_id"`
+	Model        string  `json:"model"`
+	Samples      int     `json:"samples"`
+	Baseline     bool    `json:"baseline,omitempty"`
+	MeanDistance float64 `json:"mean_distance"`
+	NormDistance float64 `json:"norm_distance"`
+	Drifted      bool    `json:"drifted"`
+}
+
+// CheckDrift compares the content vectors embedded with the current model
+// in the last drift.window with the baseline of their app, for the app or
+// every app embedded in that window when appID is empty. A provider updating
+// a model behind the same name moves the mean vector or changes the vector
+// norms, while the reviews themselves change slowly. Apps that drift are
+// published as pipeline.embedding_drift events; the first check of an app
+// and model takes its baseline, which is kept until it is reset. An app that
+// cannot be checked does not keep the others from being checked.
+func (s *VectorizeService) CheckDrift(ctx context.Context, appID string) ([]DriftCheck, error) {
+	cfg := s.cfg.Drift
+	model := s.currentModel().name
+	since := time.Now().Add(-cfg.Window)
+
+	apps := []string{appID}
+	if appID == "" {
+		var err error
+		if apps, err = s.repo.ListRecentlyEmbeddedApps(ctx, model, since); err != nil {
+			return nil, err
+		}
+	}
+
+	var checks []DriftCheck
+	var errs []error
+	for _, app := range apps {
+		check, err := s.checkAppDrift(ctx, app, model, since)
+		if err != nil {
+			s.logger.Error("Drift check failed", "app_id", app, "model", model, "error", err)
+			errs = append(errs, fmt.Errorf("app %s: %w", app, err))
+			continue
+		}
+		if check != nil {
+			checks = append(checks, *check)
+		}
+	}
+
+	drifted := 0
+	for _, check := range checks {
+		if check.Drifted {
+			drifted++
+		}
+	}
+	s.logger.Info("Checked embedding drift", "model", model, "apps", len(checks), "drifted", drifted)
+	return checks, errors.Join(errs...)
+}
+
+// checkAppDrift checks one app, returning nil when it has too few recent
+// vectors to tell.
+func (s *VectorizeService) checkAppDrift(ctx context.Context, appID, model string, since time.Time) (*DriftCheck, error) {
+	cfg := s.cfg.Drift
+	vectors, err := s.repo.ListRecentContentVectors(ctx, appID, model, since, cfg.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) < cfg.MinSamples {
+		s.logger.Debug("Too few recent embeddings to check for drift", "app_id", appID, "samples", len(vectors), "min_samples", cfg.MinSamples)
+		return nil, nil
+	}
+
+	mean, histogram := vectorDistribution(vectors)
+	check := &DriftCheck{AppID: appID, Model: model, Samples: len(vectors)}
+
+	baseline, err := s.repo.GetDriftBaseline(ctx, appID, model)
+	if err != nil {
+		return nil, err
+	}
+	if baseline == nil {
+		check.Baseline = true
+		err := s.repo.SaveDriftBaseline(ctx, storage.DriftBaseline{
+			AppID:         appID,
+			Model:         model,
+			Samples:       len(vectors),
+			Mean:          mean,
+			NormHistogram: histogram,
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Info("Took embedding drift baseline", "app_id", appID, "model", model, "samples", len(vectors))
+		return check, nil
+	}
+
+	// Vectors of another dimension are as far apart as vectors get.
+	check.MeanDistance = 2
+	if len(mean) == len(baseline.Mean) {
+		check.MeanDistance = 1 - dotProduct(unitVector(mean), unitVector(baseline.Mean))
+	}
+	check.NormDistance = totalVariation(histogram, baseline.NormHistogram)
+	check.Drifted = check.MeanDistance > cfg.MeanThreshold || check.NormDistance > cfg.NormThreshold
+
+	if err := s.repo.RecordDriftCheck(ctx, appID, model, check.MeanDistance, check.NormDistance, check.Drifted); err != nil {
+		return nil, err
+	}
+	if !check.Drifted {
+		return check, nil
+	}
+
+	s.logger.Warn("Embedding drift detected",
+		"app_id", appID,
+		"model", model,
+		"mean_distance", check.MeanDistance,
+		"norm_distance", check.NormDistance)
+
+	if s.producer == nil {
+		return check, nil
+	}
+	envelope := s.producer.BuildEmbeddingDriftEnvelope(payloads.EmbeddingDrift{
+		AppID:             appID,
+		Model:             model,
+		Samples:           check.Samples,
+		BaselineSamples:   baseline.Samples,
+		BaselineCreatedAt: baseline.CreatedAt,
+		MeanDistance:      check.MeanDistance,
+		NormDistance:      check.NormDistance,
+		MeanThreshold:     cfg.MeanThreshold,
+		NormThreshold:     cfg.NormThreshold,
+	})
+	if err := s.producer.PublishEvent(ctx, []byte(appID), envelope); err != nil {
+		s.logger.Error("Failed to publish embedding drift event", "app_id", appID, "error", err)
+	}
+	return check, nil
+}
+
+// vectorDistribution returns the mean of vectors, all of the first one's
+// dimension, and the share of them in each bucket of vector norms.
+func vectorDistribution(vectors [][]float32) ([]float32, []float64) {
+	sum := make([]float64, len(vectors[0]))
+	histogram := make([]float64, normBuckets)
+	for _, vector := range vectors {
+		for i := range min(len(vector), len(sum)) {
+			sum[i] += float64(vector[i])
+		}
+		bucket := int(math.Sqrt(dotProduct(vector, vector)) / normBucketWidth)
+		histogram[min(bucket, normBuckets-1)]++
+	}
+
+	mean := make([]float32, len(sum))
+	for i, x := range sum {
+		mean[i] = float32(x / float64(len(vectors)))
+	}
+	for i := range histogram {
+		histogram[i] /= float64(len(vectors))
+	}
+	return mean, histogram
+}
+
+// totalVariation returns the total variation distance between two
+// histograms of shares, from 0 for equal ones to 1 for disjoint ones.
+func totalVariation(a, b []float64) float64 {
+	var sum float64
+	for i := range max(len(a), len(b)) {
+		var x, y float64
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		sum += math.Abs(x - y)
+	}
+	return sum / 2
+}
+
+// DriftBaselines returns the drift baselines of the app, or of every app
+// when appID is empty, with the outcome of their last check.
+func (s *VectorizeService) DriftBaselines(ctx context.Context, appID string) ([]storage.DriftBaseline, error) {
+	return s.repo.ListDriftBaselines(ctx, appID)
+}
+
+// ResetDriftBaselines deletes the drift baselines of the app, or of every
+// app when appID is empty, e.g. once a drift was looked into and accepted;
+// the next check takes new ones.
+func (s *VectorizeService) ResetDriftBaselines(ctx context.Context, appID string) (int64, error) {
+	deleted, err := s.repo.DeleteDriftBaselines(ctx, appID)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info("Reset embedding drift baselines", "app_id", appID, "baselines", deleted)
+	return deleted, nil
+}
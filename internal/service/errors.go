@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/quiby-ai/common/pkg/events"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// failure tags a run error with the code reported to the saga orchestrator in
+// pipeline.failed events.
+type failure struct {
+	code        events.FailedCode
+	recoverable bool
+	err         error
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+func (f *failure) Unwrap() error {
+	return f.err
+}
+
+func newFailure(code events.FailedCode, recoverable bool, err error) error {
+	return &failure{code: code, recoverable: recoverable, err: err}
+}
+
+// classifyFailure returns the failure code of a run error and whether
+// retrying the saga may succeed. Cancelled runs and runs stopped at their
+// deadline are recoverable: they were interrupted, not rejected, and so are
+// requests that found another run of their app in progress. Repository
+// errors are classified by their kind.
+func classifyFailure(err error) (events.FailedCode, bool) {
+	var f *failure
+	if errors.As(err, &f) {
+		return f.code, f.recoverable
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrDeadlineReached):
+		return events.FailedCodeUnknown, true
+	case errors.Is(err, ErrRunInProgress):
+		return events.FailedCodeUnknown, true
+	case errors.Is(err, storage.ErrTransient):
+		return events.FailedCodeTempStorageUnavailable, true
+	case errors.Is(err, storage.ErrDimensionMismatch):
+		return events.FailedCodeSchemaMismatch, false
+	case errors.Is(err, storage.ErrConflict):
+		return events.FailedCodeWriteFailed, false
+	}
+
+	return events.FailedCodeUnknown, false
+}
+
+// IsPermanent reports whether err was explicitly classified as one that
+// retrying the request cannot fix, or is a repository error of a kind no
+// retry fixes. Other errors, such as provider or database outages, are worth
+// retrying.
+func IsPermanent(err error) bool {
+	var f *failure
+	if errors.As(err, &f) {
+		return !f.recoverable
+	}
+	return errors.Is(err, storage.ErrDimensionMismatch) || errors.Is(err, storage.ErrConflict)
+}
+
+type retriesLeftKey struct{}
+
+// WithRetriesLeft marks ctx as handling a delivery that the consumer
+// redelivers later if it fails recoverably, so handlers hold back the
+// pipeline.failed event until the last attempt.
+func WithRetriesLeft(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retriesLeftKey{}, true)
+}
+
+// willRetry reports whether a failed request is redelivered, so its failure
+// is not final yet.
+func willRetry(ctx context.Context, err error) bool {
+	retriesLeft, _ := ctx.Value(retriesLeftKey{}).(bool)
+	return retriesLeft && !IsPermanent(err)
+}
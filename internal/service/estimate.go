@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+)
+
+// charsPerToken approximates how many characters make up one token for
+// OpenAI's embedding tokenizers on typical review text.
+const charsPerToken = 4
+
+// Estimate computes how many reviews and responses a run with the request's
+// filters would embed, the tokens that would be sent to the provider and their
+// cost, without calling the embedder or writing anything.
+func (s *VectorizeService) Estimate(ctx context.Context, req VectorizeRequest) (payloads.CostEstimate, error) {
+	volume, err := s.repo.GetTextVolume(ctx, req.filters(s.currentModel().name), s.cfg.Vectorizer.TextSource)
+	if err != nil {
+		return payloads.CostEstimate{}, fmt.Errorf("failed to estimate run: %w", err)
+	}
+
+	// Response backfills leave the review content alone.
+	if req.ResponseBackfill {
+		volume.Reviews, volume.ContentChars = 0, 0
+	} else if !s.embedResponses(s.Flags()) {
+		volume.Responses, volume.ResponseChars = 0, 0
+	}
+
+	tokens := (volume.ContentChars + volume.ResponseChars + charsPerToken - 1) / charsPerToken
+
+	return payloads.CostEstimate{
+		Model:            s.currentModel().name,
+		Reviews:          volume.Reviews,
+		Responses:        volume.Responses,
+		EstimatedTokens:  tokens,
+		EstimatedCostUSD: tokenCost(tokens, s.cfg.Vectorizer.Price(s.currentModel().name)),
+	}, nil
+}
+
+// estimateTokens approximates the tokens of the texts, for rate limiting.
+func estimateTokens(texts []string) int {
+	var chars int64
+	for _, text := range texts {
+		chars += int64(len(text))
+	}
+	return int((chars + charsPerToken - 1) / charsPerToken)
+}
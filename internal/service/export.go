@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/transfer"
+)
+
+// ErrInvalidTransfer is returned for exports or imports without a file
+// location or with a format that cannot be determined.
+var ErrInvalidTransfer = errors.New("invalid export or import request")
+
+// Export streams the embeddings made with the configured model that match
+// the request's filters into a JSONL or Parquet file at the destination. The
+// format defaults to the destination's extension.
+func (s *VectorizeService) Export(ctx context.Context, req payloads.ExportRequest) (payloads.ExportCompleted, error) {
+	completed := payloads.ExportCompleted{ExportRequest: req}
+	if req.Destination == "" {
+		return completed, fmt.Errorf("%w: destination is required", ErrInvalidTransfer)
+	}
+	if completed.Format == "" {
+		completed.Format = transfer.FormatFromPath(req.Destination)
+	}
+	if completed.Format == "" {
+		return completed, fmt.Errorf("%w: format is required for %s", ErrInvalidTransfer, req.Destination)
+	}
+
+	filters := req.SearchFilters
+	filters.Model = s.currentModel().name
+	completed.Model = filters.Model
+
+	destination, err := transfer.Create(ctx, req.Destination, s.cfg.Export)
+	if err != nil {
+		return completed, err
+	}
+
+	writer, err := transfer.NewRecordWriter(completed.Format, destination)
+	if err != nil {
+		destination.Abort(err)
+		return completed, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+
+	if err := s.writeExport(ctx, writer, filters, &completed); err != nil {
+		destination.Abort(err)
+		return completed, err
+	}
+	if err := destination.Commit(); err != nil {
+		return completed, err
+	}
+
+	return completed, nil
+}
+
+// writeExport pages through the matching embeddings into writer and closes
+// it, counting the rows in completed.
+func (s *VectorizeService) writeExport(ctx context.Context, writer transfer.RecordWriter, filters storage.SearchFilters, completed *payloads.ExportCompleted) error {
+	pageSize := s.cfg.Export.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	var cursor storage.EmbeddingCursor
+	for {
+		embeddings, err := s.repo.ListEmbeddings(ctx, filters, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(embeddings) == 0 {
+			break
+		}
+
+		records := make([]transfer.Record, len(embeddings))
+		for i, embedding := range embeddings {
+			records[i] = transfer.NewRecord(embedding)
+		}
+		if err := writer.Write(records); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+
+		completed.Rows += int64(len(records))
+		last := embeddings[len(embeddings)-1]
+		cursor = storage.EmbeddingCursor{ReviewID: last.ReviewID, ChunkIndex: last.ChunkIndex}
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finish export: %w", err)
+	}
+	return nil
+}
+
+// HandleExport exports embeddings for a pipeline.export_embeddings.request
+// event and publishes the completed event.
+func (s *VectorizeService) HandleExport(ctx context.Context, evt payloads.ExportRequest, sagaID string) error {
+	s.logger.Info("Export request",
+		"destination", evt.Destination,
+		"format", evt.Format,
+		"app_id", evt.AppID,
+		"saga_id", sagaID)
+
+	completed, err := s.Export(ctx, evt)
+	if err != nil {
+		s.logger.Error("Export failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	s.logger.Info("Export completed", "destination", completed.Destination, "rows", completed.Rows, "saga_id", sagaID)
+
+	envelope := s.producer.BuildExportCompletedEnvelope(completed, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish export completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+)
+
+// Flags returns the feature flags in effect.
+func (s *VectorizeService) Flags() config.FlagsConfig {
+	return *s.flags.Load()
+}
+
+// SetFlags applies reloaded feature flags from the next batch, or for the
+// cache the next run, on.
+func (s *VectorizeService) SetFlags(flags config.FlagsConfig) {
+	if previous := s.flags.Swap(&flags); *previous != flags {
+		s.logger.Info("Applied reloaded feature flags",
+			"enable_response_vectors", flags.ResponseVectors,
+			"enable_title_vectors", flags.TitleVectors,
+			"enable_translation_vectors", flags.TranslationVectors,
+			"enable_cache", flags.Cache,
+			"enable_usage_events", flags.UsageEvents,
+			"maintenance_mode", flags.Maintenance)
+	}
+}
+
+// ConfigDump returns the configuration in effect with secrets redacted: the
+// one the service started with, updated with the reloaded tuning, feature
+// flags and log level and the model made current by a model migration.
+func (s *VectorizeService) ConfigDump() map[string]any {
+	cfg := *s.cfg
+	tuning := s.tuner.get()
+	cfg.Vectorizer.BatchSize = tuning.BatchSize
+	cfg.Processing.Workers = tuning.Workers
+	cfg.Processing.QueueSize = tuning.QueueSize
+	cfg.Processing.ProgressEvery = tuning.ProgressEvery
+	cfg.Flags = s.Flags()
+	cfg.Vectorizer.Model = s.currentModel().name
+	cfg.Logging.Level = strings.ToLower(telemetry.LogLevel().String())
+
+	return cfg.Dump()
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/transfer"
+)
+
+// Reasons an imported record is rejected instead of stored.
+const (
+	RejectReasonMissingReviewID = "missing_review_id"
+	RejectReasonMissingAppID    = "missing_app_id"
+	RejectReasonModelMismatch   = "model_mismatch"
+	RejectReasonDimMismatch     = "dim_mismatch"
+)
+
+// Import bulk-loads precomputed embeddings from a JSONL or Parquet file,
+// skipping the embedder. Records made with a model other than the
+// configured one, or whose vectors don't have the configured dimension, are
+// rejected and counted. The chunks of a review must be adjacent in the file,
+// as they are in exports.
+func (s *VectorizeService) Import(ctx context.Context, req payloads.ImportRequest) (payloads.ImportCompleted, error) {
+	completed := payloads.ImportCompleted{ImportRequest: req}
+	if req.Source == "" {
+		return completed, fmt.Errorf("%w: source is required", ErrInvalidTransfer)
+	}
+	if completed.Format == "" {
+		completed.Format = transfer.FormatFromPath(req.Source)
+	}
+	if completed.Format == "" {
+		return completed, fmt.Errorf("%w: format is required for %s", ErrInvalidTransfer, req.Source)
+	}
+
+	source, err := transfer.Open(ctx, req.Source, s.cfg.Export)
+	if err != nil {
+		return completed, err
+	}
+	defer source.Close()
+
+	reader, err := transfer.NewRecordReader(completed.Format, source)
+	if err != nil {
+		return completed, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+
+	pageSize := s.cfg.Export.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+
+	var pending []*storage.Vector
+	for {
+		records, err := reader.Read(pageSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return completed, err
+		}
+
+		for _, record := range records {
+			if record.Model == "" {
+				record.Model = req.Model
+			}
+			if reason := s.rejectReason(record); reason != "" {
+				completed.Reject(reason)
+				continue
+			}
+			pending = append(pending, record.Vector())
+		}
+
+		// Hold back the last review, whose remaining chunks may follow in
+		// the next page, so that it is written in one go.
+		split := len(pending)
+		for split > 0 && pending[split-1].ReviewID == pending[len(pending)-1].ReviewID {
+			split--
+		}
+		if split == 0 && len(pending) < 2*pageSize {
+			continue
+		}
+		if split == 0 {
+			split = len(pending)
+		}
+
+		if err := s.repo.UpsertEmbeddings(ctx, pending[:split]); err != nil {
+			return completed, fmt.Errorf("failed to store imported embeddings: %w", err)
+		}
+		completed.Imported += int64(split)
+		pending = append([]*storage.Vector(nil), pending[split:]...)
+	}
+
+	if err := s.repo.UpsertEmbeddings(ctx, pending); err != nil {
+		return completed, fmt.Errorf("failed to store imported embeddings: %w", err)
+	}
+	completed.Imported += int64(len(pending))
+
+	return completed, nil
+}
+
+// rejectReason returns why the record cannot be imported, or "" if it can.
+func (s *VectorizeService) rejectReason(record transfer.Record) string {
+	dim := s.cfg.Vectorizer.MaxVectorLength
+
+	switch {
+	case record.ReviewID == "":
+		return RejectReasonMissingReviewID
+	case record.AppID == "":
+		return RejectReasonMissingAppID
+	case record.Model != s.currentModel().name:
+		return RejectReasonModelMismatch
+	case len(record.ContentVec) != dim,
+		record.Dim != 0 && int(record.Dim) != dim,
+		len(record.ResponseVec) != 0 && len(record.ResponseVec) != dim,
+		len(record.TitleVec) != 0 && len(record.TitleVec) != dim,
+		len(record.ContentENVec) != 0 && len(record.ContentENVec) != dim:
+		return RejectReasonDimMismatch
+	default:
+		return ""
+	}
+}
+
+// HandleImport imports embeddings for a pipeline.import_embeddings.request
+// event and publishes the completed event.
+func (s *VectorizeService) HandleImport(ctx context.Context, evt payloads.ImportRequest, sagaID string) error {
+	s.logger.Info("Import request", "source", evt.Source, "format", evt.Format, "saga_id", sagaID)
+
+	completed, err := s.Import(ctx, evt)
+	if err != nil {
+		s.logger.Error("Import failed", "error", err, "imported", completed.Imported, "saga_id", sagaID)
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	s.logger.Info("Import completed",
+		"source", completed.Source,
+		"imported", completed.Imported,
+		"rejected", completed.Rejected,
+		"rejected_reasons", completed.RejectedReasons,
+		"saga_id", sagaID)
+
+	envelope := s.producer.BuildImportCompletedEnvelope(completed, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish import completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
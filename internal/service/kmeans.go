@@ -0,0 +1,106 @@
+package service
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// miniBatchKMeans fits k centroids to vectors with mini-batch k-means
+// (Sculley, "Web-scale k-means clustering", 2010): every iteration assigns a
+// random batch to its nearest centroids and moves each centroid towards its
+// batch members with a per-centroid learning rate that decays as it absorbs
+// more of them. Centroids are seeded with k-means++.
+func miniBatchKMeans(vectors [][]float32, k, batchSize, iterations int) [][]float32 {
+	if len(vectors) == 0 || k <= 0 {
+		return nil
+	}
+	k = min(k, len(vectors))
+	batchSize = min(max(batchSize, 1), len(vectors))
+
+	centroids := kMeansPlusPlus(vectors, k)
+	counts := make([]int, k)
+	batch := make([][]float32, batchSize)
+	nearest := make([]int, batchSize)
+
+	for range iterations {
+		for i := range batch {
+			batch[i] = vectors[rand.IntN(len(vectors))]
+			nearest[i], _ = nearestCentroid(centroids, batch[i])
+		}
+
+		for i, v := range batch {
+			c := nearest[i]
+			counts[c]++
+			eta := float32(1) / float32(counts[c])
+			for j := range centroids[c] {
+				centroids[c][j] += eta * (v[j] - centroids[c][j])
+			}
+		}
+	}
+
+	return centroids
+}
+
+// kMeansPlusPlus picks k initial centroids among vectors, each next one with
+// a probability proportional to its squared distance to the closest centroid
+// picked so far.
+func kMeansPlusPlus(vectors [][]float32, k int) [][]float32 {
+	centroids := make([][]float32, 0, k)
+	centroids = append(centroids, cloneVector(vectors[rand.IntN(len(vectors))]))
+
+	distances := make([]float64, len(vectors))
+	for i, v := range vectors {
+		distances[i] = squaredDistance(v, centroids[0])
+	}
+
+	for len(centroids) < k {
+		var total float64
+		for _, d := range distances {
+			total += d
+		}
+
+		next := rand.IntN(len(vectors))
+		if total > 0 {
+			target := rand.Float64() * total
+			for i, d := range distances {
+				if target -= d; target <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+
+		centroid := cloneVector(vectors[next])
+		centroids = append(centroids, centroid)
+		for i, v := range vectors {
+			distances[i] = min(distances[i], squaredDistance(v, centroid))
+		}
+	}
+
+	return centroids
+}
+
+// nearestCentroid returns the index of the centroid closest to v and the
+// squared Euclidean distance to it.
+func nearestCentroid(centroids [][]float32, v []float32) (int, float64) {
+	best, bestDistance := 0, math.Inf(1)
+	for i, centroid := range centroids {
+		if d := squaredDistance(v, centroid); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best, bestDistance
+}
+
+func squaredDistance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i] - b[i])
+		sum += d * d
+	}
+	return sum
+}
+
+func cloneVector(v []float32) []float32 {
+	return append([]float32(nil), v...)
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNearestCentroid(t *testing.T) {
+	centroids := [][]float32{{0, 0}, {10, 0}, {0, 10}}
+
+	tests := []struct {
+		name         string
+		v            []float32
+		want         int
+		wantDistance float64
+	}{
+		{"on a centroid", []float32{10, 0}, 1, 0},
+		{"closest to the first", []float32{1, 2}, 0, 5},
+		{"closest to the last", []float32{1, 8}, 2, 5},
+		{"tie goes to the first", []float32{5, 0}, 0, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, distance := nearestCentroid(centroids, tt.v)
+			if got != tt.want || distance != tt.wantDistance {
+				t.Errorf("nearestCentroid(%v) = %d, %v, want %d, %v", tt.v, got, distance, tt.want, tt.wantDistance)
+			}
+		})
+	}
+}
+
+func TestMiniBatchKMeans(t *testing.T) {
+	// Three tight groups far apart: every centroid ends up inside one group,
+	// since it only ever moves towards the members assigned to it.
+	groups := [][]float32{{0, 0}, {100, 0}, {0, 100}}
+	var vectors [][]float32
+	for _, center := range groups {
+		for _, offset := range [][]float32{{0, 0}, {0.1, 0}, {0, 0.1}, {0.1, 0.1}} {
+			vectors = append(vectors, []float32{center[0] + offset[0], center[1] + offset[1]})
+		}
+	}
+
+	tests := []struct {
+		name       string
+		vectors    [][]float32
+		k          int
+		wantGroups int
+	}{
+		{"one centroid per group", vectors, 3, 3},
+		{"k above the vector count", vectors[:2], 5, 1},
+		{"no vectors", nil, 3, 0},
+		{"no clusters", vectors, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			centroids := miniBatchKMeans(tt.vectors, tt.k, 4, 50)
+			if tt.wantGroups == 0 {
+				if centroids != nil {
+					t.Fatalf("got %d centroids, want none", len(centroids))
+				}
+				return
+			}
+			if len(centroids) != min(tt.k, len(tt.vectors)) {
+				t.Fatalf("got %d centroids, want %d", len(centroids), min(tt.k, len(tt.vectors)))
+			}
+
+			covered := make(map[int]bool)
+			for _, centroid := range centroids {
+				group, distance := nearestCentroid(groups, centroid)
+				if distance > 0.1*0.1*2 {
+					t.Errorf("centroid %v is outside every group", centroid)
+				}
+				covered[group] = true
+			}
+			if len(covered) != tt.wantGroups {
+				t.Errorf("centroids cover %d groups, want %d", len(covered), tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestMiniBatchKMeansUpdate(t *testing.T) {
+	// With a single centroid every vector is assigned to it, and the decaying
+	// learning rate keeps it at the running mean of the sampled vectors.
+	vectors := [][]float32{{2, 4}, {2, 4}, {2, 4}}
+
+	centroids := miniBatchKMeans(vectors, 1, 2, 10)
+	if len(centroids) != 1 {
+		t.Fatalf("got %d centroids, want 1", len(centroids))
+	}
+	for j, want := range []float32{2, 4} {
+		if math.Abs(float64(centroids[0][j]-want)) > 1e-6 {
+			t.Errorf("centroid = %v, want [2 4]", centroids[0])
+		}
+	}
+
+	centroids[0][0] = 99
+	if vectors[0][0] != 2 {
+		t.Error("centroids share memory with the vectors")
+	}
+}
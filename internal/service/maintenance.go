@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// maintenanceCheckInterval is how long the maintenance mode read from the
+// database is trusted before it is read again.
+const maintenanceCheckInterval = 5 * time.Second
+
+// ErrMaintenance is returned for work that is deferred because the service
+// is in maintenance mode.
+var ErrMaintenance = errors.New("service is in maintenance mode")
+
+// maintenanceMode caches the maintenance mode switched by control events.
+type maintenanceMode struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	state     storage.Maintenance
+}
+
+// InMaintenance reports whether the service is in maintenance mode, by
+// flags.maintenance_mode or by the last maintenance event. While it is, no
+// request is handled: Kafka requests are parked on their retry topic and
+// scheduled and CDC runs are skipped, so that schema migrations and index
+// rebuilds run without writes. A failed read of the mode keeps the last one
+// read.
+func (s *VectorizeService) InMaintenance(ctx context.Context) bool {
+	if s.Flags().Maintenance {
+		return true
+	}
+
+	m := &s.maintenance
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.checkedAt) < maintenanceCheckInterval {
+		return m.state.Enabled
+	}
+	m.checkedAt = time.Now()
+
+	state, err := s.repo.GetMaintenance(ctx)
+	if err != nil {
+		s.logger.Warn("Failed to check maintenance mode", "error", err)
+		return m.state.Enabled
+	}
+	if state.Enabled != m.state.Enabled {
+		s.logger.Info("Maintenance mode switched", "enabled", state.Enabled, "reason", state.Reason)
+	}
+	m.state = state
+	return state.Enabled
+}
+
+// HandleMaintenance switches maintenance mode on or off for every instance.
+// Instances notice within maintenanceCheckInterval; runs already in progress
+// finish.
+func (s *VectorizeService) HandleMaintenance(ctx context.Context, evt payloads.Maintenance, sagaID string) error {
+	if err := s.repo.SetMaintenance(ctx, evt.Enabled, evt.Reason); err != nil {
+		return fmt.Errorf("maintenance switch failed: %w", err)
+	}
+
+	s.maintenance.mu.Lock()
+	s.maintenance.checkedAt = time.Time{}
+	s.maintenance.mu.Unlock()
+
+	s.logger.Info("Switched maintenance mode", "enabled", evt.Enabled, "reason", evt.Reason, "saga_id", sagaID)
+	return nil
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// migrationPasses bounds the passes of a model migration over the reviews
+// left to migrate. The second pass picks up reviews embedded with the old
+// model while the first one went on.
+const migrationPasses = 2
+
+// ErrInvalidModelMigration is returned for model migrations without a target
+// model or to the current model.
+var ErrInvalidModelMigration = errors.New("invalid model migration")
+
+// embeddingModel is the model reviews are embedded and searched with, and
+// the embedder that makes its vectors.
+type embeddingModel struct {
+	name     string
+	embedder Embedder
+}
+
+func (s *VectorizeService) currentModel() *embeddingModel {
+	return s.model.Load()
+}
+
+// SyncModel switches to the model a model migration marked as current, when
+// it differs from the one in use. Batches already being embedded are stored
+// with the model they were embedded with.
+func (s *VectorizeService) SyncModel(ctx context.Context) error {
+	name, err := s.repo.GetCurrentModel(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" || name == s.currentModel().name {
+		return nil
+	}
+
+	previous := s.model.Swap(&embeddingModel{name: name, embedder: newEmbedder(s.cfg, name, s.redactor, s.logger)})
+	s.logger.Warn("Switched to the model marked as current by a model migration",
+		"model", name,
+		"previous_model", previous.name)
+	return nil
+}
+
+// WatchModel checks for a new current model every interval until ctx is
+// done, so that running instances follow a model migration without a
+// restart.
+func (s *VectorizeService) WatchModel(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := s.SyncModel(ctx); err != nil {
+				s.logger.Warn("Failed to check the current model", "error", err)
+			}
+		}
+	}
+}
+
+// MigrateModelRequest asks to migrate every embedding of the current model
+// to To.
+type MigrateModelRequest struct {
+	To string `json:"to"`
+	// NoFlip stages the new embeddings without swapping them in, so that the
+	// flip can be timed separately by migrating again later.
+	NoFlip bool `json:"no_flip,omitempty"`
+}
+
+// MigrateModel re-embeds the reviews embedded with the current model with
+// req.To into review_embeddings_migration, leaving production reads on the
+// current model meanwhile, then swaps the new embeddings in and marks req.To
+// as current in one transaction. Progress is tracked in model_migrations.
+//
+// Staged embeddings are kept when the migration fails or is interrupted, so
+// running it again resumes where it stopped. Reviews that could not be
+// migrated keep their old embeddings; a run with stale_model re-embeds them
+// after the flip.
+func (s *VectorizeService) MigrateModel(ctx context.Context, req MigrateModelRequest) (*storage.ModelMigration, error) {
+	from := s.currentModel().name
+	if req.To == "" {
+		return nil, fmt.Errorf("%w: a target model is required", ErrInvalidModelMigration)
+	}
+	if req.To == from {
+		return nil, fmt.Errorf("%w: %s is already the current model", ErrInvalidModelMigration, from)
+	}
+
+	remaining, staged, err := s.repo.CountModelMigration(ctx, from, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	migration := storage.NewModelMigration(from, req.To)
+	migration.Total = remaining + staged
+	migration.Migrated = staged
+	if err := s.repo.CreateModelMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Model migration started",
+		"migration_id", migration.MigrationID,
+		"from_model", from,
+		"to_model", req.To,
+		"total", migration.Total,
+		"already_staged", staged)
+
+	target, err := s.forModel(req.To)
+	if err != nil {
+		return nil, err
+	}
+	err = s.stageMigration(ctx, target, migration)
+	if err == nil && !req.NoFlip {
+		if err = s.repo.FlipModel(ctx, migration); err == nil {
+			s.model.Store(target.currentModel())
+			s.logger.Info("Model migration flipped the current model",
+				"migration_id", migration.MigrationID,
+				"model", req.To,
+				"swapped", migration.Swapped,
+				"failed", migration.Failed)
+			s.auditMigration(ctx, req, migration)
+			return migration, nil
+		}
+	}
+
+	now := time.Now()
+	migration.FinishedAt = &now
+	switch {
+	case err == nil:
+		migration.Status = storage.RunStatusCompleted
+		s.logger.Info("Model migration staged, current model unchanged",
+			"migration_id", migration.MigrationID,
+			"migrated", migration.Migrated,
+			"failed", migration.Failed)
+	case ctx.Err() != nil:
+		migration.Status = storage.RunStatusCancelled
+		migration.Error = err.Error()
+	default:
+		migration.Status = storage.RunStatusFailed
+		migration.Error = err.Error()
+	}
+	if updateErr := s.repo.UpdateModelMigration(context.WithoutCancel(ctx), migration); updateErr != nil {
+		s.logger.Warn("Failed to record model migration outcome", "migration_id", migration.MigrationID, "error", updateErr)
+	}
+	s.auditMigration(ctx, req, migration)
+
+	if err != nil {
+		return migration, fmt.Errorf("model migration %s failed: %w", migration.MigrationID, err)
+	}
+	return migration, nil
+}
+
+// auditMigration records the outcome of a migration in the audit log; the
+// rows it affected are those swapped in, or staged when it did not flip.
+func (s *VectorizeService) auditMigration(ctx context.Context, req MigrateModelRequest, migration *storage.ModelMigration) {
+	affected := migration.Swapped
+	if affected == 0 {
+		affected = migration.Migrated
+	}
+	s.audit(ctx, storage.AuditEntry{
+		Operation: storage.AuditModelMigration,
+		Filters: map[string]any{
+			"migration_id": migration.MigrationID,
+			"from_model":   migration.FromModel,
+			"to_model":     migration.ToModel,
+			"no_flip":      req.NoFlip,
+		},
+		Affected: affected,
+		Error:    migration.Error,
+	})
+}
+
+// stageMigration embeds the reviews left to migrate with target and stages their embeddings, batch by batch.
+func (s *VectorizeService) stageMigration(ctx context.Context, target *VectorizeService, migration *storage.ModelMigration) error {
+	dim := s.cfg.Vectorizer.MaxVectorLength
+	// Reviews no longer vectorizable keep their old embeddings and come up
+	// again in every pass.
+	unmigratable := make(map[string]bool)
+
+	for range migrationPasses {
+		after := ""
+		for {
+			reviewIDs, err := s.repo.ListReviewsToMigrate(ctx, migration.FromModel, migration.ToModel, after, s.tuner.get().BatchSize)
+			if err != nil {
+				return err
+			}
+			if len(reviewIDs) == 0 {
+				break
+			}
+			after = reviewIDs[len(reviewIDs)-1]
+
+			filters := storage.CleanReviewFilters{
+				ForceRecompute: true,
+				Model:          migration.ToModel,
+				ReviewIDs:      reviewIDs,
+			}
+			reviews, err := s.repo.GetCleanReviewsForVectorization(ctx, filters, len(reviewIDs), nil)
+			if err != nil {
+				return err
+			}
+
+			embeddable := make([]storage.CleanReview, 0, len(reviews))
+			loaded := make(map[string]bool, len(reviews))
+			for _, review := range reviews {
+				loaded[review.ID] = true
+				if s.skipReason(review) == "" {
+					embeddable = append(embeddable, review)
+				} else {
+					unmigratable[review.ID] = true
+				}
+			}
+			for _, reviewID := range reviewIDs {
+				if !loaded[reviewID] {
+					unmigratable[reviewID] = true
+				}
+			}
+			migration.Failed = int64(len(unmigratable))
+
+			meterCtx, meter := withUsageMeter(ctx)
+			vectors, err := target.embedBatch(meterCtx, embeddable, nil)
+			s.addSpend(ctx, "", s.spendOf(embeddable, false, migration.ToModel, meter.tokens()))
+			if err != nil {
+				return err
+			}
+			for _, vector := range vectors {
+				if len(vector.ContentVec) != dim {
+					return fmt.Errorf("%s returned %d-dimensional vectors, review_embeddings stores %d", migration.ToModel, len(vector.ContentVec), dim)
+				}
+			}
+			vectors, rejected := s.rejectInvalidVectors(vectors, true)
+			for _, review := range rejected {
+				s.logger.Warn("Rejected invalid vector", "review_id", review.vector.ReviewID, "model", migration.ToModel, "error", review.err)
+				unmigratable[review.vector.ReviewID] = true
+			}
+			s.backpressure.wait(ctx)
+			if err := s.repo.StageMigrationEmbeddings(ctx, vectors); err != nil {
+				return err
+			}
+			// A vector rejected in the first pass may come out valid in the
+			// second.
+			for _, vector := range vectors {
+				delete(unmigratable, vector.ReviewID)
+			}
+			migration.Failed = int64(len(unmigratable))
+
+			migration.Migrated += int64(len(embeddable) - len(rejected))
+			if err := s.repo.UpdateModelMigration(ctx, migration); err != nil {
+				s.logger.Warn("Failed to update model migration progress", "migration_id", migration.MigrationID, "error", err)
+			}
+			s.logger.Info("Model migration progress",
+				"migration_id", migration.MigrationID,
+				"migrated", migration.Migrated,
+				"failed", migration.Failed,
+				"total", migration.Total)
+		}
+	}
+
+	return nil
+}
+
+// forModel returns a service embedding with the given model, for staging the
+// embeddings of a model migration.
+func (s *VectorizeService) forModel(model string) (*VectorizeService, error) {
+	cfg := *s.cfg
+	cfg.Vectorizer.Model = model
+	cfg.OpenAI.Model = model
+	cfg.Shadow.Enabled = false
+	cfg.Flags = s.Flags()
+
+	target, err := NewVectorizeService(s.repo, &cfg, s.logger.With("model", model), nil)
+	if err != nil {
+		return nil, err
+	}
+	target.queue = s.queue
+	return target, nil
+}
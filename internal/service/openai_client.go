@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
 )
 
 type OpenAIClient struct {
@@ -16,19 +21,31 @@ type OpenAIClient struct {
 	baseURL    string
 	httpClient *http.Client
 	cfg        OpenAIConfig
+	logger     *slog.Logger
 }
 
 type OpenAIConfig struct {
-	APIKey     string
-	BaseURL    string
-	Model      string
-	MaxRetries int
-	Timeout    time.Duration
+	APIKey  string
+	BaseURL string
+	Model   string
+	// Retry retries failed requests, see retryableProviderError.
+	Retry   retry.Policy
+	Timeout time.Duration
+	// Dimensions, when positive, asks for vectors shortened to that many
+	// dimensions; only the text-embedding-3 models support it.
+	Dimensions int
+	// APIKeySource, when set, supplies the key for every request instead of
+	// APIKey, so that a rotated key is picked up.
+	APIKeySource func(ctx context.Context) (string, error)
+	// Throttle, when set, is waited on before every request, retries
+	// included, with the request's estimated tokens.
+	Throttle func(ctx context.Context, tokens int) error
 }
 
 type EmbeddingRequest struct {
-	Input any    `json:"input"`
-	Model string `json:"model"`
+	Input      any    `json:"input"`
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions,omitempty"`
 }
 
 type EmbeddingResponse struct {
@@ -53,7 +70,7 @@ type OpenAIError struct {
 	} `json:"error"`
 }
 
-func NewOpenAIClient(cfg OpenAIConfig) (*OpenAIClient, error) {
+func NewOpenAIClient(cfg OpenAIConfig, logger *slog.Logger) (*OpenAIClient, error) {
 	if cfg.APIKey == "" {
 		return nil, fmt.Errorf("OpenAI API key is required")
 	}
@@ -67,7 +84,8 @@ func NewOpenAIClient(cfg OpenAIConfig) (*OpenAIClient, error) {
 	}
 
 	httpClient := &http.Client{
-		Timeout: cfg.Timeout,
+		Timeout:   cfg.Timeout,
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
 	}
 
 	return &OpenAIClient{
@@ -75,6 +93,7 @@ func NewOpenAIClient(cfg OpenAIConfig) (*OpenAIClient, error) {
 		baseURL:    cfg.BaseURL,
 		httpClient: httpClient,
 		cfg:        cfg,
+		logger:     logger,
 	}, nil
 }
 
@@ -99,7 +118,7 @@ func (c *OpenAIClient) CreateEmbeddings(ctx context.Context, texts []string) ([]
 		}
 
 		allVectors = append(allVectors, vectors...)
-		log.Printf("Processed batch %d-%d, total vectors: %d", i, end, len(allVectors))
+		c.logger.Debug("Processed OpenAI batch", "from", i, "to", end, "total_vectors", len(allVectors))
 
 		if end < len(texts) {
 			time.Sleep(100 * time.Millisecond)
@@ -111,34 +130,52 @@ func (c *OpenAIClient) CreateEmbeddings(ctx context.Context, texts []string) ([]
 
 func (c *OpenAIClient) processBatch(ctx context.Context, texts []string) ([][]float32, error) {
 	req := EmbeddingRequest{
-		Input: texts,
-		Model: c.cfg.Model,
+		Input:      texts,
+		Model:      c.cfg.Model,
+		Dimensions: c.cfg.Dimensions,
 	}
 
-	timeoutCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
-	defer cancel()
+	tokens := estimateTokens(texts)
 
 	var resp *EmbeddingResponse
-	var err error
+	var throttleErr error
+	policy := c.cfg.Retry
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		c.logger.Warn("OpenAI request failed, retrying", "attempt", attempt, "max_attempts", policy.MaxAttempts, "delay", delay, "error", err)
+	}
 
-	for attempt := 0; attempt <= c.cfg.MaxRetries; attempt++ {
-		if attempt > 0 {
-			log.Printf("Retrying OpenAI request, attempt %d/%d", attempt+1, c.cfg.MaxRetries+1)
-			time.Sleep(time.Duration(attempt) * time.Second)
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		if c.cfg.Throttle != nil {
+			if err := c.cfg.Throttle(ctx, tokens); err != nil {
+				throttleErr = err
+				return nil
+			}
 		}
 
+		// The timeout starts after the rate limit wait, which it would
+		// otherwise eat into.
+		timeoutCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+		sent := time.Now()
+		var err error
 		resp, err = c.makeRequest(timeoutCtx, req)
-		if err == nil {
-			break
-		}
-
-		log.Printf("OpenAI request failed (attempt %d): %v", attempt+1, err)
+		meterRequest(ctx, c.cfg.Model, time.Since(sent), err)
+		return err
+	})
+	if throttleErr != nil {
+		return nil, fmt.Errorf("failed to wait for the rate limit: %w", throttleErr)
 	}
-
 	if err != nil {
 		return nil, fmt.Errorf("all retry attempts failed: %w", err)
 	}
 
+	// Compatible providers may not report usage.
+	billed := resp.Usage.TotalTokens
+	if billed == 0 {
+		billed = tokens
+	}
+	meterTokens(ctx, c.cfg.Model, billed)
+
 	vectors := make([][]float32, len(resp.Data))
 	for i, embedding := range resp.Data {
 		vector := make([]float32, len(embedding.Embedding))
@@ -163,7 +200,9 @@ func (c *OpenAIClient) makeRequest(ctx context.Context, req EmbeddingRequest) (*
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.apiKey)
+	if err := c.authorize(httpReq); err != nil {
+		return nil, err
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -179,9 +218,9 @@ func (c *OpenAIClient) makeRequest(ctx context.Context, req EmbeddingRequest) (*
 	if resp.StatusCode != http.StatusOK {
 		var openAIErr OpenAIError
 		if err := json.Unmarshal(body, &openAIErr); err == nil && openAIErr.Error.Message != "" {
-			return nil, fmt.Errorf("OpenAI API error: %s (code: %s)", openAIErr.Error.Message, openAIErr.Error.Code)
+			return nil, &statusError{status: resp.StatusCode, err: fmt.Errorf("OpenAI API error: %s (code: %s)", openAIErr.Error.Message, openAIErr.Error.Code)}
 		}
-		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return nil, &statusError{status: resp.StatusCode, err: fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))}
 	}
 
 	var embeddingResp EmbeddingResponse
@@ -192,6 +231,71 @@ func (c *OpenAIClient) makeRequest(ctx context.Context, req EmbeddingRequest) (*
 	return &embeddingResp, nil
 }
 
+// statusError is a response of the API other than 200 OK.
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string { return e.err.Error() }
+
+func (e *statusError) Unwrap() error { return e.err }
+
+// retryableProviderError retries timeouts, rate limits and server errors,
+// and failures to get a response at all; other API errors, such as an
+// invalid key or an oversized input, fail the same way every time.
+func retryableProviderError(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.status == http.StatusRequestTimeout || se.status == http.StatusTooManyRequests || se.status >= 500
+	}
+	return true
+}
+
+// CheckCredentials verifies that the API is reachable and accepts the key by
+// looking up the configured model, which costs no tokens.
+func (c *OpenAIClient) CheckCredentials(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/models/"+c.cfg.Model, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	if err := c.authorize(httpReq); err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		var openAIErr OpenAIError
+		if err := json.Unmarshal(body, &openAIErr); err == nil && openAIErr.Error.Message != "" {
+			return fmt.Errorf("OpenAI API error: %s (code: %s)", openAIErr.Error.Message, openAIErr.Error.Code)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 func (c *OpenAIClient) Close() error {
 	return nil
 }
+
+// authorize sets the API key on the request, from the key source if any.
+func (c *OpenAIClient) authorize(req *http.Request) error {
+	apiKey := c.apiKey
+	if c.cfg.APIKeySource != nil {
+		var err error
+		if apiKey, err = c.cfg.APIKeySource(req.Context()); err != nil {
+			return fmt.Errorf("failed to get OpenAI API key: %w", err)
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return nil
+}
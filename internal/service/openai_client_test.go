@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestRetryableProviderError(t *testing.T) {
+	apiError := func(status int) error {
+		return fmt.Errorf("embedding request failed: %w", &statusError{status: status, err: errors.New(http.StatusText(status))})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"request timeout", apiError(http.StatusRequestTimeout), true},
+		{"rate limited", apiError(http.StatusTooManyRequests), true},
+		{"server error", apiError(http.StatusInternalServerError), true},
+		{"unavailable", apiError(http.StatusServiceUnavailable), true},
+		{"invalid key", apiError(http.StatusUnauthorized), false},
+		{"bad request", apiError(http.StatusBadRequest), false},
+		{"no response", errors.New("connection refused"), true},
+		{"deadline", context.DeadlineExceeded, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableProviderError(tt.err); got != tt.want {
+				t.Errorf("retryableProviderError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// ErrPartitionsUnassigned is returned by RunOnce for partitioned requests
+// before the replica has learned which partitions it owns.
+var ErrPartitionsUnassigned = errors.New("replica has no partitions assigned yet")
+
+// partitionAssignment is the share of the app partitions a replica owns.
+type partitionAssignment struct {
+	partitions []int
+	replicas   int
+}
+
+// ReplicaID returns the name the replica heartbeats under in
+// vectorize_replicas: partitioning.replica_id, or the host name.
+func (s *VectorizeService) ReplicaID() string {
+	if s.cfg.Partitioning.ReplicaID != "" {
+		return s.cfg.Partitioning.ReplicaID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "review-vectorizer"
+	}
+	return hostname
+}
+
+// WatchPartitions heartbeats the replica every partitioning.heartbeat_interval
+// until ctx is done and deals the app partitions out to the live replicas:
+// the replica at position i of n, by replica ID, owns the partitions p with
+// p mod n = i. Each replica computes the same split from the same replica
+// list, so no partition is claimed twice once the heartbeats settle. The
+// replica deregisters on the way out so that the others take over its
+// partitions right away.
+func (s *VectorizeService) WatchPartitions(ctx context.Context) error {
+	cfg := s.cfg.Partitioning
+	replicaID := s.ReplicaID()
+	s.logger.Info("Partitioning apps among replicas", "replica_id", replicaID, "partitions", cfg.Partitions)
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if err := s.repo.DeregisterReplica(ctx, replicaID); err != nil {
+			s.logger.Warn("Failed to deregister replica", "replica_id", replicaID, "error", err)
+		}
+	}()
+
+	ticker := time.NewTicker(cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.assignPartitions(ctx, replicaID); err != nil {
+			s.logger.Warn("Failed to update partition assignment, keeping the previous one", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *VectorizeService) assignPartitions(ctx context.Context, replicaID string) error {
+	if err := s.repo.HeartbeatReplica(ctx, replicaID); err != nil {
+		return err
+	}
+	replicas, err := s.repo.ListLiveReplicas(ctx, s.cfg.Partitioning.ReplicaTTL)
+	if err != nil {
+		return err
+	}
+
+	position := slices.Index(replicas, replicaID)
+	if position < 0 {
+		// Expired between the heartbeat and the listing; the next
+		// heartbeat registers it again.
+		return nil
+	}
+
+	assignment := &partitionAssignment{replicas: len(replicas)}
+	for p := position; p < s.cfg.Partitioning.Partitions; p += len(replicas) {
+		assignment.partitions = append(assignment.partitions, p)
+	}
+
+	previous := s.partitions.Swap(assignment)
+	if previous == nil || previous.replicas != assignment.replicas || !slices.Equal(previous.partitions, assignment.partitions) {
+		s.logger.Info("Partition assignment changed",
+			"replica_id", replicaID,
+			"replicas", assignment.replicas,
+			"partitions", assignment.partitions)
+	}
+	return nil
+}
+
+// partitionRequest confines a partitioned request to the partitions the
+// replica owns. Other requests, and all requests while partitioning is off,
+// are returned unchanged.
+func (s *VectorizeService) partitionRequest(req VectorizeRequest) (VectorizeRequest, error) {
+	if !req.Partitioned || !s.cfg.Partitioning.Enabled {
+		return req, nil
+	}
+
+	assignment := s.partitions.Load()
+	if assignment == nil {
+		return req, ErrPartitionsUnassigned
+	}
+
+	req.PartitionCount = s.cfg.Partitioning.Partitions
+	req.Partitions = assignment.partitions
+	return req, nil
+}
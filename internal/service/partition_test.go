@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// replicaRepository lists a fixed set of live replicas. The other methods of
+// the repository are not implemented.
+type replicaRepository struct {
+	storage.Repository
+	replicas     []string
+	heartbeatErr error
+}
+
+func (r *replicaRepository) HeartbeatReplica(context.Context, string) error {
+	return r.heartbeatErr
+}
+
+func (r *replicaRepository) ListLiveReplicas(context.Context, time.Duration) ([]string, error) {
+	return r.replicas, nil
+}
+
+func TestAssignPartitions(t *testing.T) {
+	errUnavailable := errors.New("database unavailable")
+
+	tests := []struct {
+		name         string
+		partitions   int
+		replicas     []string
+		replicaID    string
+		heartbeatErr error
+		// want is the partitions the replica owns, or nil when the
+		// assignment is left unset.
+		want         []int
+		wantReplicas int
+		wantErr      error
+	}{
+		{
+			name:         "single replica owns every partition",
+			partitions:   4,
+			replicas:     []string{"a"},
+			replicaID:    "a",
+			want:         []int{0, 1, 2, 3},
+			wantReplicas: 1,
+		},
+		{
+			name:         "partitions dealt out by position",
+			partitions:   8,
+			replicas:     []string{"a", "b", "c"},
+			replicaID:    "b",
+			want:         []int{1, 4, 7},
+			wantReplicas: 3,
+		},
+		{
+			name:         "uneven split",
+			partitions:   8,
+			replicas:     []string{"a", "b", "c"},
+			replicaID:    "c",
+			want:         []int{2, 5},
+			wantReplicas: 3,
+		},
+		{
+			name:         "more replicas than partitions, replica with a partition",
+			partitions:   3,
+			replicas:     []string{"a", "b", "c", "d", "e"},
+			replicaID:    "c",
+			want:         []int{2},
+			wantReplicas: 5,
+		},
+		{
+			name:         "more replicas than partitions, replica left without one",
+			partitions:   3,
+			replicas:     []string{"a", "b", "c", "d", "e"},
+			replicaID:    "e",
+			want:         []int{},
+			wantReplicas: 5,
+		},
+		{
+			name:       "replica missing from the list",
+			partitions: 4,
+			replicas:   []string{"a", "b"},
+			replicaID:  "c",
+		},
+		{
+			name:         "heartbeat fails",
+			partitions:   4,
+			replicas:     []string{"a"},
+			replicaID:    "a",
+			heartbeatErr: errUnavailable,
+			wantErr:      errUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Partitioning.Enabled = true
+			cfg.Partitioning.Partitions = tt.partitions
+
+			s := &VectorizeService{
+				cfg:    cfg,
+				repo:   &replicaRepository{replicas: tt.replicas, heartbeatErr: tt.heartbeatErr},
+				logger: slog.New(slog.DiscardHandler),
+			}
+
+			err := s.assignPartitions(context.Background(), tt.replicaID)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("assignPartitions() = %v, want %v", err, tt.wantErr)
+			}
+
+			assignment := s.partitions.Load()
+			if tt.want == nil {
+				if assignment != nil {
+					t.Fatalf("expected no assignment, got partitions %v", assignment.partitions)
+				}
+				if _, err := s.partitionRequest(VectorizeRequest{Partitioned: true}); !errors.Is(err, ErrPartitionsUnassigned) {
+					t.Errorf("partitionRequest() = %v, want %v", err, ErrPartitionsUnassigned)
+				}
+				return
+			}
+			if assignment == nil {
+				t.Fatal("expected an assignment")
+			}
+			if !slices.Equal(assignment.partitions, tt.want) {
+				t.Errorf("partitions = %v, want %v", assignment.partitions, tt.want)
+			}
+			if assignment.replicas != tt.wantReplicas {
+				t.Errorf("replicas = %d, want %d", assignment.replicas, tt.wantReplicas)
+			}
+
+			req, err := s.partitionRequest(VectorizeRequest{Partitioned: true})
+			if err != nil {
+				t.Fatalf("partitionRequest() = %v", err)
+			}
+			if req.PartitionCount != tt.partitions || len(req.Partitions) != len(tt.want) {
+				t.Errorf("request confined to %v of %d partitions, want %v of %d",
+					req.Partitions, req.PartitionCount, tt.want, tt.partitions)
+			}
+		})
+	}
+}
@@ -0,0 +1,697 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/common/pkg/events"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// reviewBatch is a slice of reviews handed from the fetcher to the embedder
+// workers. seq numbers batches in fetch order so the writer can tell when all
+// batches up to a point are stored.
+type reviewBatch struct {
+	seq     int
+	reviews []storage.CleanReview
+}
+
+// cursor returns the position right after the batch's last review.
+func (b reviewBatch) cursor() storage.ReviewCursor {
+	last := b.reviews[len(b.reviews)-1]
+	return storage.ReviewCursor{ReviewedAt: last.ReviewedAt, ID: last.ID, Rating: last.Rating}
+}
+
+// embeddedBatch carries the outcome of embedding one batch of reviews from the
+// embedder workers to the writer. Reviews without text to embed are not
+// embedded and only counted in skipped by reason. When err is set, vectors is
+// nil and every embeddable review counts as failed.
+type embeddedBatch struct {
+	reviewBatch
+	embeddable []storage.CleanReview
+	skipped    map[string]int
+	vectors    []*storage.Vector
+	shadow     []*storage.ShadowVector
+	spend      []storage.SpendEntry
+	err        error
+}
+
+// progress estimates how much of a run is left, based on the number of
+// reviews that matched when the pipeline started.
+type progress struct {
+	total     int64
+	done      int64
+	batches   int
+	startedAt time.Time
+}
+
+func (p *progress) remaining() int64 {
+	return max(p.total-p.done, 0)
+}
+
+// estimatedCompletion extrapolates the throughput so far; it is nil until
+// the first batch has been written.
+func (p *progress) estimatedCompletion() *time.Time {
+	if p.done == 0 {
+		return nil
+	}
+
+	perReview := time.Since(p.startedAt) / time.Duration(p.done)
+	eta := time.Now().Add(perReview * time.Duration(p.remaining()))
+	return &eta
+}
+
+// runPipeline vectorizes every review matching req in three concurrent stages:
+// a fetcher paging through clean_reviews, a pool of embedder workers, and a
+// single bulk writer. Bounded channels between the stages provide
+// backpressure, so a slow embedder or database throttles the fetcher instead
+// of buffering the whole backfill in memory. Without a page size, pages
+// follow the tuned batch size.
+//
+// When ctx is cancelled, e.g. on shutdown, the fetcher stops but the batches
+// already fetched are still embedded and stored, for up to
+// processing.shutdown_grace, so that embeddings already paid for are kept
+// and the checkpoint covers them. The run then fails with ctx's error, or
+// ErrDeadlineReached at the request's deadline, and resumes from the
+// checkpoint when requested again. Runs with a deadline only get
+// processing.deadline_margin, the time left until it, to finish.
+func (s *VectorizeService) runPipeline(ctx context.Context, run *storage.Run, pageSize int) (VectorizeResult, error) {
+	tuning := s.tuner.get()
+	queueSize := max(tuning.QueueSize, tuning.Workers)
+
+	batches := make(chan reviewBatch, queueSize)
+	embedded := make(chan embeddedBatch, queueSize)
+
+	grace := s.cfg.Processing.ShutdownGrace
+	if _, ok := ctx.Deadline(); ok {
+		grace = min(grace, s.cfg.Processing.DeadlineMargin)
+	}
+	drainCtx, cancelDrain := drainContext(ctx, grace)
+	defer cancelDrain()
+
+	g, gctx := errgroup.WithContext(drainCtx)
+	fetchCtx, cancelFetch := context.WithCancel(gctx)
+	defer cancelFetch()
+	stopFetch := context.AfterFunc(ctx, cancelFetch)
+	defer stopFetch()
+
+	filters, start := run.Filters, run.Checkpoint
+
+	total, err := s.repo.CountCleanReviewsForVectorization(ctx, filters, start)
+	if err != nil {
+		return VectorizeResult{}, newFailure(events.FailedCodeSourceUnavailable, true, fmt.Errorf("failed to count reviews to process: %w", err))
+	}
+	s.logger.Info("Reviews to process", "run_id", run.RunID, "count", total)
+	tracker := &progress{total: total, startedAt: time.Now()}
+
+	initial := VectorizeResult{
+		Processed: run.Processed,
+		Skipped:   run.Skipped,
+		Failed:    run.Failed,
+	}
+	// Reviews left out up front are counted once, when the run starts fresh;
+	// a resumed run already carries them in its skipped count.
+	if run.Checkpoint == nil && run.Skipped == 0 {
+		s.countSkipped(ctx, filters, &initial)
+	}
+
+	guard := s.newQuotaGuard(run)
+	var quotaErr error
+	g.Go(func() error {
+		defer close(batches)
+		err := s.fetchStage(fetchCtx, run, pageSize, start, guard, batches)
+		if errors.Is(err, ErrQuotaExceeded) {
+			s.logger.Warn("Stopped fetching at a quota, finishing batches in flight", "run_id", run.RunID, "error", err)
+			quotaErr = err
+			return nil
+		}
+		if err != nil && ctx.Err() != nil && gctx.Err() == nil {
+			s.logger.Info("Stopped fetching, finishing batches in flight", "run_id", run.RunID, "grace", grace, "cause", context.Cause(ctx))
+			return nil
+		}
+		return err
+	})
+
+	cacheSize := s.cfg.Vectorizer.DedupeCacheSize
+	if !s.Flags().Cache {
+		cacheSize = 0
+	}
+	cache := newVectorCache(cacheSize)
+
+	g.Go(func() error {
+		defer close(embedded)
+		s.embedStage(gctx, run, cache, batches, embedded)
+		return nil
+	})
+
+	var result VectorizeResult
+	g.Go(func() error {
+		result = s.writeStage(gctx, run, initial, tracker, embedded)
+		return nil
+	})
+
+	err = g.Wait()
+	if err == nil && ctx.Err() != nil {
+		s.logger.Info("Batches in flight stored", "run_id", run.RunID, "checkpoint", run.Checkpoint)
+		err = fmt.Errorf("run interrupted: %w", context.Cause(ctx))
+		if errors.Is(err, ErrDeadlineReached) {
+			result.Deferred = s.countDeferred(context.WithoutCancel(ctx), run)
+		}
+	}
+	if err == nil && quotaErr != nil {
+		result.Deferred = s.countDeferred(ctx, run)
+		err = quotaErr
+	}
+	if deduplicated := cache.deduplicatedCount(); deduplicated > 0 {
+		s.logger.Info("Reused embeddings of duplicate texts", "run_id", run.RunID, "count", deduplicated)
+	}
+	return result, err
+}
+
+// drainContext returns a context that is only cancelled grace after ctx is,
+// or when the returned cancel function is called.
+func drainContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-drainCtx.Done():
+		}
+	})
+
+	return drainCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// countSkipped adds the reviews a run leaves out before fetching anything to
+// the result: those already embedded and those excluded by the filters.
+func (s *VectorizeService) countSkipped(ctx context.Context, filters storage.CleanReviewFilters, result *VectorizeResult) {
+	alreadyEmbedded, filteredOut, err := s.repo.CountSkippedReviews(ctx, filters)
+	if err != nil {
+		s.logger.Warn("Failed to count skipped reviews", "error", err)
+		return
+	}
+
+	if !filters.ForceRecompute && !filters.ResponseBackfill {
+		result.skip(SkipReasonAlreadyEmbedded, int(alreadyEmbedded))
+	}
+	result.skip(SkipReasonFilteredOut, int(filteredOut))
+}
+
+// countDeferred counts the reviews a run stopped by a quota or its deadline
+// did not get to, those after its checkpoint.
+func (s *VectorizeService) countDeferred(ctx context.Context, run *storage.Run) int {
+	remaining, err := s.repo.CountCleanReviewsForVectorization(ctx, run.Filters, run.Checkpoint)
+	if err != nil {
+		s.logger.Warn("Failed to count deferred reviews", "run_id", run.RunID, "error", err)
+		return 0
+	}
+	return int(remaining)
+}
+
+// fetchStage pages through the matching reviews, starting after the cursor
+// when resuming, and splits every page into embedder-sized batches. Before
+// handing on a batch it checks whether the run has been cancelled and
+// whether the batch fits in the run's quotas; stopping for a cancellation
+// cancels the other stages as well.
+func (s *VectorizeService) fetchStage(ctx context.Context, run *storage.Run, pageSize int, cursor *storage.ReviewCursor, guard *quotaGuard, out chan<- reviewBatch) error {
+	filters := run.Filters
+	totalFetched := 0
+	seq := 0
+
+	for {
+		// The batch size may be retuned between pages.
+		embedBatchSize := s.batchSize()
+		limit := pageSize
+		if limit <= 0 {
+			limit = embedBatchSize
+		}
+
+		reviews, err := s.repo.GetCleanReviewsForVectorization(ctx, filters, limit, cursor)
+		if err != nil {
+			return newFailure(events.FailedCodeSourceUnavailable, true, fmt.Errorf("failed to fetch reviews page after %d reviews: %w", totalFetched, err))
+		}
+
+		if len(reviews) == 0 {
+			s.logger.Info("No more reviews to process", "total_fetched", totalFetched)
+			return nil
+		}
+
+		s.logger.Info("Fetched page of reviews",
+			"page_size", len(reviews),
+			"total_fetched", totalFetched)
+
+		for i := 0; i < len(reviews); i += embedBatchSize {
+			if err := s.checkCancelled(ctx, run); err != nil {
+				return err
+			}
+
+			end := min(i+embedBatchSize, len(reviews))
+			if err := guard.admit(ctx, reviews[i:end]); err != nil {
+				return err
+			}
+
+			select {
+			case out <- reviewBatch{seq: seq, reviews: reviews[i:end]}:
+				seq++
+			case <-ctx.Done():
+				s.logger.Info("Context cancelled, stopping review fetching", "total_fetched", totalFetched)
+				return ctx.Err()
+			}
+		}
+
+		totalFetched += len(reviews)
+
+		if len(reviews) < limit {
+			s.logger.Info("Reached end of reviews", "total_fetched", totalFetched)
+			return nil
+		}
+
+		last := reviews[len(reviews)-1]
+		cursor = &storage.ReviewCursor{ReviewedAt: last.ReviewedAt, ID: last.ID, Rating: last.Rating}
+	}
+}
+
+// checkCancelled returns ErrRunCancelled once the run has been flagged for
+// cancellation. A failed check is logged and the run carries on.
+func (s *VectorizeService) checkCancelled(ctx context.Context, run *storage.Run) error {
+	cancelled, err := s.repo.IsRunCancelRequested(ctx, run.RunID)
+	if err != nil {
+		s.logger.Warn("Failed to check run cancellation", "run_id", run.RunID, "error", err)
+		return nil
+	}
+	if cancelled {
+		s.logger.Info("Run cancellation requested, stopping", "run_id", run.RunID, "saga_id", run.SagaID)
+		return ErrRunCancelled
+	}
+	return nil
+}
+
+// embedStage hands every fetched batch to a worker until the fetcher is
+// done, running as many workers at once as currently tuned. The workers
+// share the run's cache of embedded texts.
+func (s *VectorizeService) embedStage(ctx context.Context, run *storage.Run, cache *vectorCache, in <-chan reviewBatch, out chan<- embeddedBatch) {
+	limiter := newWorkerLimiter(s.tuner)
+
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	for next := range in {
+		if err := limiter.acquire(ctx); err != nil {
+			return
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer limiter.release()
+
+			select {
+			case out <- s.embedReviewBatch(ctx, run, cache, next):
+			case <-ctx.Done():
+			}
+		}()
+	}
+}
+
+// embedReviewBatch embeds the reviews of a batch that can be embedded.
+// Response backfill runs only embed the developer responses.
+func (s *VectorizeService) embedReviewBatch(ctx context.Context, run *storage.Run, cache *vectorCache, next reviewBatch) embeddedBatch {
+	backfill := run.Filters.ResponseBackfill
+
+	batch := embeddedBatch{reviewBatch: next, skipped: make(map[string]int)}
+	batch.embeddable = make([]storage.CleanReview, 0, len(next.reviews))
+	for _, review := range next.reviews {
+		if reason := s.batchSkipReason(review, backfill); reason != "" {
+			batch.skipped[reason]++
+			continue
+		}
+		batch.embeddable = append(batch.embeddable, review)
+	}
+
+	if len(batch.embeddable) > 0 {
+		ctx, meter := withUsageMeter(ctx)
+		if backfill {
+			batch.vectors, batch.err = s.embedTuned(ctx, batch.embeddable, func(ctx context.Context, reviews []storage.CleanReview) ([]*storage.Vector, error) {
+				return s.embedResponseBatch(ctx, reviews, cache)
+			})
+		} else {
+			batch.vectors, batch.err = s.embedTuned(ctx, batch.embeddable, func(ctx context.Context, reviews []storage.CleanReview) ([]*storage.Vector, error) {
+				return s.embedBatch(ctx, reviews, cache)
+			})
+			if batch.err == nil && s.shadow != nil {
+				batch.shadow = s.embedShadow(ctx, batch.embeddable)
+			}
+		}
+		batch.spend = s.spendOf(batch.embeddable, backfill, run.Filters.Model, meter.tokens())
+		s.publishUsage(ctx, run, batch.embeddable, meter)
+	}
+
+	return batch
+}
+
+// batchSkipReason tells why a run leaves a fetched review out, or returns ""
+// when the review, or its response in response backfills, is embedded.
+func (s *VectorizeService) batchSkipReason(review storage.CleanReview, backfill bool) string {
+	if backfill {
+		return s.responseSkipReason(review)
+	}
+	reason := s.skipReason(review)
+	if reason == "" && s.unchanged(review) {
+		reason = SkipReasonUnchanged
+	}
+	return reason
+}
+
+// skipReason tells why a review cannot be embedded, or returns "" when it
+// can.
+func (s *VectorizeService) skipReason(review storage.CleanReview) string {
+	if s.cfg.Vectorizer.TextSource == storage.TextSourceContentEN && review.ContentEN == nil {
+		return SkipReasonMissingTranslation
+	}
+	if !s.supportedLanguage(review.Language) {
+		return SkipReasonUnsupportedLanguage
+	}
+	text := s.preprocessor.Process(review.Text(s.cfg.Vectorizer.TextSource))
+	if text == "" {
+		return SkipReasonEmptyText
+	}
+	if s.preprocessor.LowContent(text) {
+		return SkipReasonLowContent
+	}
+	return ""
+}
+
+// supportedLanguage checks a review language against
+// preprocessing.allowed_languages and denied_languages, ignoring case.
+func (s *VectorizeService) supportedLanguage(language string) bool {
+	cfg := s.cfg.Preprocessing
+	matches := func(languages []string) bool {
+		return slices.ContainsFunc(languages, func(l string) bool { return strings.EqualFold(l, language) })
+	}
+	if len(cfg.AllowedLanguages) > 0 && !matches(cfg.AllowedLanguages) {
+		return false
+	}
+	return !matches(cfg.DeniedLanguages)
+}
+
+// responseSkipReason tells why a review's response cannot be backfilled, or
+// returns "" when it can.
+func (s *VectorizeService) responseSkipReason(review storage.CleanReview) string {
+	if review.ResponseContentClean == nil || s.preprocessor.Process(*review.ResponseContentClean) == "" {
+		return SkipReasonEmptyText
+	}
+	return ""
+}
+
+// embedResponseBatch returns one vector per review carrying only the
+// response vector, for response backfill runs.
+func (s *VectorizeService) embedResponseBatch(ctx context.Context, reviews []storage.CleanReview, cache *vectorCache) ([]*storage.Vector, error) {
+	responses := make([]string, len(reviews))
+	for i, review := range reviews {
+		responses[i] = s.preprocessor.Process(*review.ResponseContentClean)
+	}
+
+	responseVectors, err := s.embedPresent(ctx, responses, cache)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate response embeddings: %w", err)
+	}
+
+	vectors := make([]*storage.Vector, len(reviews))
+	for i, review := range reviews {
+		vectors[i] = s.createVector(review, 0, nil, responseVectors[i], nil, nil)
+	}
+
+	return vectors, nil
+}
+
+// embedBatch returns one vector per chunk of every review, grouped by review
+// in batch order.
+func (s *VectorizeService) embedBatch(ctx context.Context, reviews []storage.CleanReview, cache *vectorCache) (_ []*storage.Vector, err error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "vectorize.embed_batch", trace.WithAttributes(
+		attribute.Int("batch.reviews", len(reviews)),
+	))
+	defer endSpan(span, &err)
+
+	release, err := s.queue.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for an embedding slot: %w", err)
+	}
+	defer release()
+
+	texts := s.prepareTexts(reviews)
+
+	embeddings, err := s.generateEmbeddings(ctx, texts, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(embeddings.content) != len(texts.chunks) {
+		return nil, fmt.Errorf("embedder returned %d content vectors for %d chunks", len(embeddings.content), len(texts.chunks))
+	}
+
+	vectors := make([]*storage.Vector, len(texts.chunks))
+	for i, chunk := range texts.chunks {
+		var responseVec, titleVec, translationVec []float32
+		if chunk.index == 0 {
+			responseVec, titleVec = embeddings.responses[chunk.review], embeddings.titles[chunk.review]
+			translationVec = embeddings.translations[chunk.review]
+		}
+		vectors[i] = s.createVector(reviews[chunk.review], chunk.index, embeddings.content[i], responseVec, titleVec, translationVec)
+		if embeddings.sparse != nil {
+			vectors[i].SparseVec = embeddings.sparse[i]
+		}
+	}
+
+	return vectors, nil
+}
+
+// writeStage stores embedded batches, accumulates the run result and keeps the
+// run's progress and checkpoint up to date. Reviews with an invalid vector
+// fail validation instead of being stored. A batch that fails as a whole is
+// retried row by row so one bad row doesn't fail its neighbours.
+//
+// Workers finish batches out of order, so the checkpoint only advances past a
+// batch once every batch fetched before it has been written as well.
+func (s *VectorizeService) writeStage(ctx context.Context, run *storage.Run, result VectorizeResult, tracker *progress, in <-chan embeddedBatch) VectorizeResult {
+	written := make(map[int]storage.ReviewCursor)
+	nextSeq := 0
+
+	for batch := range in {
+		for reason, count := range batch.skipped {
+			result.skip(reason, count)
+		}
+
+		var reviewErrors []storage.ReviewError
+		if batch.err != nil {
+			s.logger.Error("Failed to embed batch", "count", len(batch.embeddable), "error", batch.err)
+			if ctx.Err() == nil {
+				tags := runTags(run)
+				tags["model"] = s.currentModel().name
+				telemetry.ReportError(ctx, "provider_error", batch.err, tags, map[string]any{"filters": run.Filters, "reviews": len(batch.embeddable)})
+			}
+			for _, review := range batch.embeddable {
+				reviewErrors = append(reviewErrors, newReviewError(run, review.ID, review.AppID, storage.ErrorStageEmbed, batch.err))
+			}
+			result.fail(reviewErrors)
+		} else {
+			vectors, rejected := s.rejectInvalidVectors(batch.vectors, !run.Filters.ResponseBackfill)
+			for _, review := range rejected {
+				s.logger.Warn("Rejected invalid vector", "review_id", review.vector.ReviewID, "error", review.err)
+				reviewErrors = append(reviewErrors, newReviewError(run, review.vector.ReviewID, review.vector.AppID, storage.ErrorStageValidate, review.err))
+			}
+
+			s.backpressure.wait(ctx)
+			stored, storeErrors := s.storeBatch(ctx, run, vectors)
+			reviewErrors = append(reviewErrors, storeErrors...)
+			result.Processed += len(stored)
+			result.fail(reviewErrors)
+
+			if run.SagaID != "" {
+				if err := s.repo.RecordRunReviews(ctx, run.SagaID, stored); err != nil {
+					s.logger.Warn("Failed to record processed reviews", "saga_id", run.SagaID, "count", len(stored), "error", err)
+				}
+			}
+			if err := s.repo.ResolveReviewErrors(ctx, stored); err != nil {
+				s.logger.Warn("Failed to resolve review errors", "count", len(stored), "error", err)
+			}
+			if err := s.repo.UpsertShadowEmbeddings(ctx, batch.shadow); err != nil {
+				s.logger.Warn("Failed to store shadow embeddings", "count", len(batch.shadow), "error", err)
+			}
+		}
+
+		if err := s.repo.RecordReviewErrors(ctx, reviewErrors); err != nil {
+			s.logger.Warn("Failed to record review errors", "count", len(reviewErrors), "error", err)
+		}
+
+		// Tokens are billed whether or not the batch was stored.
+		for _, entry := range batch.spend {
+			result.Tokens += entry.Tokens
+			result.CostUSD += entry.CostUSD
+		}
+		s.addSpend(ctx, run.Filters.TenantID, batch.spend)
+
+		written[batch.seq] = batch.cursor()
+		for {
+			cursor, ok := written[nextSeq]
+			if !ok {
+				break
+			}
+			run.Checkpoint = &cursor
+			delete(written, nextSeq)
+			nextSeq++
+		}
+
+		run.Processed = result.Processed
+		run.Skipped = result.Skipped
+		run.Failed = result.Failed
+		if err := s.repo.UpdateRun(ctx, run); err != nil {
+			s.logger.Warn("Failed to update run progress", "run_id", run.RunID, "error", err)
+		}
+
+		tracker.done += int64(len(batch.reviews))
+		tracker.batches++
+		if every := s.tuner.get().ProgressEvery; every > 0 && tracker.batches%every == 0 {
+			s.publishProgressEvent(ctx, run, tracker)
+		}
+
+		s.logger.Debug("Batch stored",
+			"count", len(batch.reviews),
+			"processed", result.Processed,
+			"failed", result.Failed)
+	}
+
+	return result
+}
+
+// storeBatch writes the vectors and returns the IDs of the reviews that were
+// stored along with the failures of those that were not. When the batch
+// fails as a whole, every review is retried on its own so that its chunks are
+// still written together, unless the failure is transient or a dimension
+// mismatch, which would fail every review again.
+func (s *VectorizeService) storeBatch(ctx context.Context, run *storage.Run, vectors []*storage.Vector) ([]string, []storage.ReviewError) {
+	ctx, span := telemetry.Tracer().Start(ctx, "vectorize.store_batch", trace.WithAttributes(
+		attribute.Int("batch.vectors", len(vectors)),
+	))
+	defer span.End()
+
+	for _, vector := range vectors {
+		vector.TenantID = run.Filters.TenantID
+	}
+
+	write := s.repo.UpsertEmbeddings
+	if run.Filters.ResponseBackfill {
+		write = s.repo.UpdateResponseVectors
+	}
+
+	groups := groupByReview(vectors)
+	stored := make([]string, 0, len(groups))
+
+	err := write(ctx, vectors)
+	if err == nil {
+		for _, group := range groups {
+			stored = append(stored, group[0].ReviewID)
+		}
+		return stored, nil
+	}
+
+	var reviewErrors []storage.ReviewError
+	if errors.Is(err, storage.ErrTransient) || errors.Is(err, storage.ErrDimensionMismatch) {
+		// Every review would fail the same way: the database is out of reach
+		// after the retries, or the vectors don't fit the column.
+		s.logger.Error("Failed to store batch", "count", len(groups), "error", err)
+		for _, group := range groups {
+			reviewErrors = append(reviewErrors, newReviewError(run, group[0].ReviewID, group[0].AppID, storage.ErrorStageStore, err))
+		}
+		return stored, reviewErrors
+	}
+
+	s.logger.Warn("Bulk upsert failed, storing embeddings one review at a time", "count", len(groups), "error", err)
+
+	for _, group := range groups {
+		review := group[0]
+		if err := write(ctx, group); err != nil {
+			s.logger.Error("Failed to store embedding", "review_id", review.ReviewID, "error", err)
+			reviewErrors = append(reviewErrors, newReviewError(run, review.ReviewID, review.AppID, storage.ErrorStageStore, err))
+			continue
+		}
+		stored = append(stored, review.ReviewID)
+	}
+
+	return stored, reviewErrors
+}
+
+// groupByReview splits vectors into runs of chunks belonging to the same
+// review, relying on embedBatch keeping a review's chunks together.
+func groupByReview(vectors []*storage.Vector) [][]*storage.Vector {
+	var groups [][]*storage.Vector
+	for i, vector := range vectors {
+		if i == 0 || vector.ReviewID != vectors[i-1].ReviewID {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], vector)
+	}
+	return groups
+}
+
+// endSpan records a non-nil *err on the span before ending it; meant to be
+// deferred with a pointer to the named error result.
+func endSpan(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// failureReason classifies a review failure for the completed event. Provider
+// errors only carry a message, so token limit and empty input rejections are
+// told apart by its wording.
+func failureReason(reviewError storage.ReviewError) string {
+	switch reviewError.Stage {
+	case storage.ErrorStageStore:
+		return FailureReasonDBError
+	case storage.ErrorStageValidate:
+		return FailureReasonInvalidVector
+	}
+
+	message := strings.ToLower(reviewError.Error)
+	switch {
+	case strings.Contains(message, "context_length_exceeded"),
+		strings.Contains(message, "maximum context length"),
+		strings.Contains(message, "too many tokens"):
+		return FailureReasonTokenLimit
+	case strings.Contains(message, "'$.input' is invalid"),
+		strings.Contains(message, "input is empty"),
+		strings.Contains(message, "empty input"):
+		return FailureReasonEmptyText
+	default:
+		return FailureReasonProviderError
+	}
+}
+
+func newReviewError(run *storage.Run, reviewID, appID, stage string, err error) storage.ReviewError {
+	return storage.ReviewError{
+		ReviewID: reviewID,
+		AppID:    appID,
+		RunID:    run.RunID,
+		Stage:    stage,
+		Error:    err.Error(),
+	}
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+var (
+	// ErrNothingToProject is returned when an app has no embedded reviews
+	// made with the configured model in the requested range.
+	ErrNothingToProject = errors.New("no embedded reviews to project")
+	// ErrNoProjection is returned for the map of an app that has no
+	// completed projection with the configured model.
+	ErrNoProjection = errors.New("no projection of the app")
+)
+
+// ProjectionRequest asks for the 2D coordinates of the embedded reviews of
+// an app.
+type ProjectionRequest struct {
+	SagaID   string
+	AppID    string
+	DateFrom string
+	DateTo   string
+}
+
+// ProjectionResult summarizes a finished projection; its points are stored
+// under ProjectionID.
+type ProjectionResult struct {
+	ProjectionID      string  `json:"projection_id"`
+	Model             string  `json:"model"`
+	Reviews           int     `json:"reviews"`
+	ExplainedVariance float64 `json:"explained_variance"`
+}
+
+// ProjectionMap is a completed projection with the points of all its
+// reviews, as rendered by review maps.
+type ProjectionMap struct {
+	storage.Projection
+	Points []storage.ProjectionPoint `json:"points"`
+}
+
+// Project finds the two principal components of a random sample of the
+// app's content vectors, then projects every embedded review of the app onto
+// them and stores its coordinates, so that review maps need two numbers per
+// review rather than the whole vector. Reviews close in the embedding space
+// are close on the map, though reviews close on the map may differ in the
+// directions it leaves out. A completed projection replaces the app's
+// previous one.
+func (s *VectorizeService) Project(ctx context.Context, req ProjectionRequest) (ProjectionResult, error) {
+	cfg := s.cfg.Projection
+	filters := storage.EmbeddingFilters{
+		AppID:    req.AppID,
+		Model:    s.currentModel().name,
+		DateFrom: req.DateFrom,
+		DateTo:   req.DateTo,
+	}
+
+	sample, err := s.repo.SampleContentVectors(ctx, filters, cfg.SampleSize)
+	if err != nil {
+		return ProjectionResult{}, err
+	}
+	if len(sample) == 0 {
+		return ProjectionResult{}, fmt.Errorf("%w for app %s", ErrNothingToProject, req.AppID)
+	}
+
+	projection := storage.NewProjection(req.SagaID, filters)
+	if err := s.repo.CreateProjection(ctx, projection); err != nil {
+		return ProjectionResult{}, err
+	}
+
+	s.logger.Info("Fitting projection",
+		"projection_id", projection.ProjectionID,
+		"app_id", req.AppID,
+		"sample", len(sample))
+
+	vectors := make([][]float32, len(sample))
+	for i, review := range sample {
+		vectors[i] = review.Vector
+	}
+	mean, axes, explained := principalComponents(vectors, 2, cfg.Iterations)
+
+	reviews, err := s.projectReviews(ctx, projection.ProjectionID, filters, mean, axes)
+
+	now := time.Now()
+	projection.FinishedAt = &now
+	projection.Reviews = reviews
+	projection.ExplainedVariance = explained
+	projection.Status = storage.RunStatusCompleted
+	if err != nil {
+		projection.Status = storage.RunStatusFailed
+		projection.Error = err.Error()
+	}
+
+	// Record the outcome even when the projection was cancelled.
+	if finishErr := s.repo.FinishProjection(context.WithoutCancel(ctx), projection); finishErr != nil {
+		if err == nil {
+			return ProjectionResult{}, finishErr
+		}
+		s.logger.Error("Failed to record failed projection", "projection_id", projection.ProjectionID, "error", finishErr)
+	}
+	if err != nil {
+		return ProjectionResult{}, fmt.Errorf("failed to project reviews: %w", err)
+	}
+
+	return ProjectionResult{
+		ProjectionID:      projection.ProjectionID,
+		Model:             projection.Model,
+		Reviews:           reviews,
+		ExplainedVariance: explained,
+	}, nil
+}
+
+// projectReviews pages through every content vector the filters select and
+// stores each review's coordinates on the axes. It returns the number of
+// reviews projected.
+func (s *VectorizeService) projectReviews(ctx context.Context, projectionID string, filters storage.EmbeddingFilters, mean []float64, axes [][]float64) (int, error) {
+	var projected int
+	var after string
+
+	for {
+		page, err := s.repo.ListContentVectors(ctx, filters, after, s.cfg.Projection.PageSize)
+		if err != nil {
+			return projected, err
+		}
+		if len(page) == 0 {
+			return projected, nil
+		}
+
+		points := make([]storage.ProjectionPoint, len(page))
+		for i, review := range page {
+			points[i] = storage.ProjectionPoint{
+				ReviewID: review.ReviewID,
+				X:        float32(centeredDot(review.Vector, mean, axes[0])),
+				Y:        float32(centeredDot(review.Vector, mean, axes[1])),
+			}
+		}
+
+		if err := s.repo.RecordProjectionPoints(ctx, projectionID, points); err != nil {
+			return projected, err
+		}
+
+		projected += len(page)
+		after = page[len(page)-1].ReviewID
+	}
+}
+
+// principalComponents returns the mean of vectors, their first n principal
+// components and the share of their variance the components explain. Each
+// component is found by power iteration on the covariance of vectors, kept
+// orthogonal to the components before it, without forming the covariance
+// matrix itself. The iterations start from fixed seeds and every component
+// points the way its largest coordinate is positive, so that projecting
+// similar vectors twice gives maps the same way round.
+func principalComponents(vectors [][]float32, n, iterations int) ([]float64, [][]float64, float64) {
+	dim := len(vectors[0])
+	mean := make([]float64, dim)
+	for _, v := range vectors {
+		for j := range min(len(v), dim) {
+			mean[j] += float64(v[j])
+		}
+	}
+	for j := range mean {
+		mean[j] /= float64(len(vectors))
+	}
+
+	var total float64
+	for _, v := range vectors {
+		for j := range min(len(v), dim) {
+			d := float64(v[j]) - mean[j]
+			total += d * d
+		}
+	}
+
+	components := make([][]float64, 0, n)
+	var explained float64
+	for c := range n {
+		rng := rand.New(rand.NewPCG(uint64(c)+1, 0))
+		axis := make([]float64, dim)
+		for j := range axis {
+			axis[j] = rng.NormFloat64()
+		}
+		orthonormalize(axis, components)
+
+		var variance float64
+		for range iterations {
+			next := make([]float64, dim)
+			variance = 0
+			for _, v := range vectors {
+				score := centeredDot(v, mean, axis)
+				variance += score * score
+				for j := range min(len(v), dim) {
+					next[j] += score * (float64(v[j]) - mean[j])
+				}
+			}
+			if !orthonormalize(next, components) {
+				// The vectors vary in fewer directions than asked for.
+				break
+			}
+			axis = next
+		}
+
+		largest := 0
+		for j := range axis {
+			if math.Abs(axis[j]) > math.Abs(axis[largest]) {
+				largest = j
+			}
+		}
+		if axis[largest] < 0 {
+			for j := range axis {
+				axis[j] = -axis[j]
+			}
+		}
+
+		components = append(components, axis)
+		explained += variance
+	}
+
+	if total == 0 {
+		return mean, components, 0
+	}
+	return mean, components, min(explained/total, 1)
+}
+
+// orthonormalize removes from v its components along the orthonormal
+// vectors basis and scales the rest to unit length, reporting whether
+// anything was left of it.
+func orthonormalize(v []float64, basis [][]float64) bool {
+	for _, b := range basis {
+		var dot float64
+		for j := range v {
+			dot += v[j] * b[j]
+		}
+		for j := range v {
+			v[j] -= dot * b[j]
+		}
+	}
+
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	if norm < 1e-12 {
+		return false
+	}
+	for j := range v {
+		v[j] /= norm
+	}
+	return true
+}
+
+// centeredDot returns the dot product of v minus mean with axis.
+func centeredDot(v []float32, mean, axis []float64) float64 {
+	var sum float64
+	for j := range min(len(v), len(axis)) {
+		sum += (float64(v[j]) - mean[j]) * axis[j]
+	}
+	return sum
+}
+
+// LatestProjection returns the latest completed projection of the app with
+// the configured model, with all of its points.
+func (s *VectorizeService) LatestProjection(ctx context.Context, appID string) (ProjectionMap, error) {
+	projection, err := s.repo.GetLatestProjection(ctx, appID, s.currentModel().name)
+	if err != nil {
+		return ProjectionMap{}, err
+	}
+	if projection == nil {
+		return ProjectionMap{}, fmt.Errorf("%w %s", ErrNoProjection, appID)
+	}
+
+	result := ProjectionMap{Projection: *projection, Points: make([]storage.ProjectionPoint, 0, projection.Reviews)}
+	var after string
+	for {
+		page, err := s.repo.ListProjectionPoints(ctx, projection.ProjectionID, after, s.cfg.Projection.PageSize)
+		if err != nil {
+			return ProjectionMap{}, err
+		}
+		if len(page) == 0 {
+			return result, nil
+		}
+		result.Points = append(result.Points, page...)
+		after = page[len(page)-1].ReviewID
+	}
+}
+
+// HandleProjection projects the app's reviews for a
+// pipeline.project_embeddings.request event and publishes the completed
+// event.
+func (s *VectorizeService) HandleProjection(ctx context.Context, evt payloads.ProjectionRequest, sagaID string) error {
+	req := ProjectionRequest{
+		SagaID:   sagaID,
+		AppID:    evt.AppID,
+		DateFrom: evt.DateFrom,
+		DateTo:   evt.DateTo,
+	}
+
+	s.logger.Info("Projection request", "app_id", req.AppID, "saga_id", sagaID)
+
+	result, err := s.Project(ctx, req)
+	if err != nil {
+		s.logger.Error("Projection failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("projection failed: %w", err)
+	}
+
+	s.logger.Info("Projection completed",
+		"projection_id", result.ProjectionID,
+		"reviews", result.Reviews,
+		"explained_variance", result.ExplainedVariance,
+		"saga_id", sagaID)
+
+	envelope := s.producer.BuildProjectionCompletedEnvelope(payloads.ProjectionCompleted{
+		AppID:             req.AppID,
+		ProjectionID:      result.ProjectionID,
+		Model:             result.Model,
+		Reviews:           result.Reviews,
+		ExplainedVariance: result.ExplainedVariance,
+	}, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish projection completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// Priority orders the jobs waiting for an embedding slot; higher ones are
+// served first, and jobs of equal priority in the order they asked.
+type Priority int
+
+const (
+	// PriorityBackground is given to scheduled incremental runs, model
+	// migrations and other jobs nobody is waiting on.
+	PriorityBackground Priority = iota
+	// PriorityRequest is given to runs requested through a saga, a retry
+	// or CDC.
+	PriorityRequest
+	// PriorityRealtime is given to single-review requests, which are
+	// expected to complete within a second.
+	PriorityRealtime
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityRealtime:
+		return "realtime"
+	case PriorityRequest:
+		return "request"
+	default:
+		return "background"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose embedding jobs queue with priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// QueueStats reports the embedding slots in use and the jobs waiting for
+// one, by priority.
+type QueueStats struct {
+	Slots   int            `json:"slots"`
+	InUse   int            `json:"in_use"`
+	Waiting map[string]int `json:"waiting"`
+}
+
+// jobQueue hands out a fixed number of embedding slots, shared by every run
+// of the process, to the waiting job of the highest priority, so a backfill
+// holding the embedder cannot starve saga requests or single reviews. A job
+// keeps its slot for one batch, so a newly arrived job of higher priority
+// waits at most for the next batch to finish.
+type jobQueue struct {
+	mu      sync.Mutex
+	slots   int
+	inUse   int
+	seq     uint64
+	waiting waiters
+}
+
+type waiter struct {
+	priority Priority
+	seq      uint64
+	ready    chan struct{}
+	index    int
+}
+
+// newJobQueue returns a queue of slots embedding slots; with none, jobs never
+// wait.
+func newJobQueue(slots int) *jobQueue {
+	if slots <= 0 {
+		return nil
+	}
+	return &jobQueue{slots: slots}
+}
+
+// acquire waits for a slot for a job of the context's priority and returns
+// the function releasing it.
+func (q *jobQueue) acquire(ctx context.Context) (func(), error) {
+	if q == nil {
+		return func() {}, nil
+	}
+
+	q.mu.Lock()
+	if q.inUse < q.slots && q.waiting.Len() == 0 {
+		q.inUse++
+		q.mu.Unlock()
+		return q.release, nil
+	}
+
+	q.seq++
+	w := &waiter{priority: priorityFrom(ctx), seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiting, w)
+	q.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return q.release, nil
+	case <-ctx.Done():
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted a slot in the meantime; pass it on.
+			q.inUse--
+			q.grant()
+		default:
+			heap.Remove(&q.waiting, w.index)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (q *jobQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inUse--
+	q.grant()
+}
+
+// grant hands free slots to the first waiters; q.mu must be held.
+func (q *jobQueue) grant() {
+	for q.inUse < q.slots && q.waiting.Len() > 0 {
+		w := heap.Pop(&q.waiting).(*waiter)
+		q.inUse++
+		close(w.ready)
+	}
+}
+
+func (q *jobQueue) stats() *QueueStats {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := &QueueStats{Slots: q.slots, InUse: q.inUse, Waiting: make(map[string]int)}
+	for _, w := range q.waiting {
+		stats.Waiting[w.priority.String()]++
+	}
+	return stats
+}
+
+// waiters is a heap of waiting jobs, highest priority and then earliest
+// first.
+type waiters []*waiter
+
+func (h waiters) Len() int { return len(h) }
+
+func (h waiters) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h waiters) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *waiters) Push(x any) {
+	w := x.(*waiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *waiters) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return w
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// ErrQuotaExceeded is returned by RunOnce when a run stopped because its next
+// batch would have exceeded a monthly quota. The reviews it did not get to
+// are deferred: the run can be resumed once the quota allows.
+var ErrQuotaExceeded = errors.New("monthly quota exceeded")
+
+// QuotaExceededError tells which quota a run would have exceeded.
+type QuotaExceededError struct {
+	Quota config.Quota
+	// Limit is the exceeded limit, "tokens" or "reviews".
+	Limit string
+	// Used is what the month used of the limit before the batch, and Max the
+	// limit itself.
+	Used int64
+	Max  int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s would exceed its monthly quota of %d %s, %d used", e.Quota.Scope(), e.Max, e.Limit, e.Used)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+type quotaUsage struct {
+	reviews int64
+	tokens  int64
+}
+
+// quotaGuard admits the batches of a run while they fit in the quotas of its
+// tenant and apps. What a quota used this month is read from
+// vectorize_spend when the run first reaches it; from then on the guard adds
+// the reviews of every batch it admits and their estimated tokens, so
+// batches still in flight count as well.
+type quotaGuard struct {
+	svc       *VectorizeService
+	backfill  bool
+	quotas    []config.Quota
+	used      []quotaUsage
+	loaded    []bool
+	startedAt time.Time
+}
+
+// newQuotaGuard returns the guard of the quotas that may apply to the run, or
+// nil when none does.
+func (s *VectorizeService) newQuotaGuard(run *storage.Run) *quotaGuard {
+	var quotas []config.Quota
+	for _, quota := range s.cfg.Quotas.Limits {
+		switch {
+		case quota.TenantID != "" && quota.TenantID == run.Filters.TenantID:
+		case quota.AppID != "" && (run.Filters.AppID == "" || quota.AppID == run.Filters.AppID):
+		default:
+			continue
+		}
+		quotas = append(quotas, quota)
+	}
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	return &quotaGuard{
+		svc:       s,
+		backfill:  run.Filters.ResponseBackfill,
+		quotas:    quotas,
+		used:      make([]quotaUsage, len(quotas)),
+		loaded:    make([]bool, len(quotas)),
+		startedAt: time.Now().UTC(),
+	}
+}
+
+// admit counts the reviews of a batch that will be embedded against the
+// quotas they fall under, or returns a *QuotaExceededError, counting
+// nothing, when they would exceed one. A quota whose usage fails to be read
+// is left out for this batch.
+func (g *quotaGuard) admit(ctx context.Context, reviews []storage.CleanReview) error {
+	if g == nil {
+		return nil
+	}
+
+	adds := make([]quotaUsage, len(g.quotas))
+	for i, quota := range g.quotas {
+		for _, review := range reviews {
+			if quota.AppID != "" && review.AppID != quota.AppID {
+				continue
+			}
+			if g.svc.batchSkipReason(review, g.backfill) != "" {
+				continue
+			}
+			adds[i].reviews++
+			adds[i].tokens += int64(estimateTokens([]string{g.svc.embeddedText(review, g.backfill)}))
+		}
+		if adds[i].reviews == 0 {
+			continue
+		}
+
+		if !g.loaded[i] {
+			if err := g.load(ctx, i); err != nil {
+				g.svc.logger.Warn("Failed to read quota usage", "quota", quota.Scope(), "error", err)
+				adds[i] = quotaUsage{}
+				continue
+			}
+		}
+
+		used := g.used[i]
+		if quota.MonthlyReviews > 0 && used.reviews+adds[i].reviews > quota.MonthlyReviews {
+			return &QuotaExceededError{Quota: quota, Limit: "reviews", Used: used.reviews, Max: quota.MonthlyReviews}
+		}
+		if quota.MonthlyTokens > 0 && used.tokens+adds[i].tokens > quota.MonthlyTokens {
+			return &QuotaExceededError{Quota: quota, Limit: "tokens", Used: used.tokens, Max: quota.MonthlyTokens}
+		}
+	}
+
+	for i, add := range adds {
+		g.used[i].reviews += add.reviews
+		g.used[i].tokens += add.tokens
+	}
+	return nil
+}
+
+// load reads what the quota's tenant or app used in the month the run
+// started.
+func (g *quotaGuard) load(ctx context.Context, i int) error {
+	quota := g.quotas[i]
+	entries, err := g.svc.repo.GetSpend(ctx, g.startedAt, quota.TenantID, quota.AppID)
+	if err != nil {
+		return err
+	}
+
+	var used quotaUsage
+	for _, entry := range entries {
+		used.reviews += entry.Reviews
+		used.tokens += entry.Tokens
+	}
+	g.used[i] = used
+	g.loaded[i] = true
+	return nil
+}
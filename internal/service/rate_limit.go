@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// rateLimitRetention is how long shared rate limit windows are kept.
+const rateLimitRetention = time.Hour
+
+// rateLimiter holds embedding requests back to stay under the requests and
+// tokens per minute of openai.rate_limit. Requests are counted in one-minute
+// windows, in memory for the workers of this process or, when shared, in
+// Postgres for every replica. Every embedder of the process shares one, and
+// reloaded limits apply from the next request on.
+type rateLimiter struct {
+	// repo counts requests across replicas while the limits are shared.
+	repo   storage.Repository
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	limits   storage.RateLimits
+	shared   bool
+	window   time.Time
+	requests int
+	tokens   int
+	pruned   time.Time
+}
+
+func newRateLimiter(cfg config.RateLimitConfig, repo storage.Repository, logger *slog.Logger) *rateLimiter {
+	l := &rateLimiter{repo: repo, logger: logger}
+	l.setLimits(cfg)
+	return l
+}
+
+// setLimits replaces the limits, keeping what the current window counted.
+func (l *rateLimiter) setLimits(cfg config.RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = storage.RateLimits{Requests: cfg.RequestsPerMinute, Tokens: cfg.TokensPerMinute}
+	l.shared = cfg.Shared && l.repo != nil
+}
+
+// wait blocks until a request of the given tokens fits in the current window,
+// and counts it there. It returns right away while no limit is set.
+func (l *rateLimiter) wait(ctx context.Context, tokens int) error {
+	for {
+		window := time.Now().Truncate(time.Minute)
+		if l.reserve(ctx, window, tokens) {
+			return nil
+		}
+
+		delay := time.Until(window.Add(time.Minute))
+		l.logger.Debug("Embedding rate limit reached, waiting for the next window", "tokens", tokens, "delay", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve counts the request against the window if it fits. Should Postgres
+// be unavailable, shared limits fall back to counting locally rather than
+// stopping the embedding.
+func (l *rateLimiter) reserve(ctx context.Context, window time.Time, tokens int) bool {
+	l.mu.Lock()
+	limits, shared := l.limits, l.shared
+	l.mu.Unlock()
+
+	if limits.Requests == 0 && limits.Tokens == 0 {
+		return true
+	}
+
+	if shared {
+		l.prune(ctx, window)
+		ok, err := l.repo.ReserveRateLimit(ctx, window, tokens, limits)
+		if err == nil {
+			return ok
+		}
+		l.logger.Warn("Failed to reserve shared rate limit, limiting locally", "error", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !window.Equal(l.window) {
+		l.window, l.requests, l.tokens = window, 0, 0
+	}
+	if l.limits.Requests > 0 && l.requests >= l.limits.Requests {
+		return false
+	}
+	if l.limits.Tokens > 0 && l.requests > 0 && l.tokens+tokens > l.limits.Tokens {
+		return false
+	}
+	l.requests++
+	l.tokens += tokens
+	return true
+}
+
+// prune deletes old shared windows, once per window.
+func (l *rateLimiter) prune(ctx context.Context, window time.Time) {
+	l.mu.Lock()
+	due := !window.Equal(l.pruned)
+	l.pruned = window
+	l.mu.Unlock()
+
+	if due {
+		if err := l.repo.PruneRateLimits(ctx, window.Add(-rateLimitRetention)); err != nil {
+			l.logger.Warn("Failed to prune rate limit windows", "error", err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	type request struct {
+		minute int
+		tokens int
+		want   bool
+	}
+
+	tests := []struct {
+		name     string
+		limits   storage.RateLimits
+		requests []request
+	}{
+		{
+			name:   "requests per minute",
+			limits: storage.RateLimits{Requests: 2},
+			requests: []request{
+				{0, 100, true},
+				{0, 100, true},
+				{0, 100, false},
+			},
+		},
+		{
+			name:   "tokens per minute",
+			limits: storage.RateLimits{Tokens: 1000},
+			requests: []request{
+				{0, 600, true},
+				{0, 400, true},
+				{0, 1, false},
+			},
+		},
+		{
+			name:   "a request above the token limit still goes through alone",
+			limits: storage.RateLimits{Tokens: 1000},
+			requests: []request{
+				{0, 5000, true},
+				{0, 1, false},
+			},
+		},
+		{
+			name:   "both limits",
+			limits: storage.RateLimits{Requests: 3, Tokens: 1000},
+			requests: []request{
+				{0, 100, true},
+				{0, 950, false},
+				{0, 100, true},
+				{0, 100, true},
+				{0, 100, false},
+			},
+		},
+		{
+			name:   "a new window starts over",
+			limits: storage.RateLimits{Requests: 1, Tokens: 1000},
+			requests: []request{
+				{0, 900, true},
+				{0, 50, false},
+				{1, 900, true},
+				{1, 50, false},
+			},
+		},
+		{
+			name:   "no limits",
+			limits: storage.RateLimits{},
+			requests: []request{
+				{0, 1e6, true},
+				{0, 1e6, true},
+			},
+		},
+	}
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{limits: tt.limits, logger: slog.New(slog.DiscardHandler)}
+			for i, r := range tt.requests {
+				window := start.Add(time.Duration(r.minute) * time.Minute)
+				if got := l.reserve(context.Background(), window, r.tokens); got != r.want {
+					t.Errorf("request %d of %d tokens at minute %d: reserve() = %v, want %v", i, r.tokens, r.minute, got, r.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := &rateLimiter{limits: storage.RateLimits{Requests: 1}, logger: slog.New(slog.DiscardHandler)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	window := time.Now().Truncate(time.Minute)
+	if err := l.wait(ctx, 10); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	err := l.wait(ctx, 10)
+	if err == nil && !time.Now().Truncate(time.Minute).Equal(window) {
+		t.Skip("the second request fell into the next window")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second request = %v, want it to wait until the context is done", err)
+	}
+}
+
+func TestRateLimiterSetLimits(t *testing.T) {
+	l := newRateLimiter(config.RateLimitConfig{RequestsPerMinute: 2}, nil, slog.New(slog.DiscardHandler))
+	window := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if !l.reserve(context.Background(), window, 10) {
+		t.Fatal("first request should fit")
+	}
+
+	// Shared limits need a repository, and the window keeps its count.
+	l.setLimits(config.RateLimitConfig{RequestsPerMinute: 1, Shared: true})
+	if l.shared {
+		t.Error("limits are shared without a repository")
+	}
+	if l.reserve(context.Background(), window, 10) {
+		t.Error("a request over the reloaded limit went through")
+	}
+
+	l.setLimits(config.RateLimitConfig{})
+	if !l.reserve(context.Background(), window, 10) {
+		t.Error("a request was held back without limits")
+	}
+}
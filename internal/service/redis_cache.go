@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisCache remembers the vectors of embedded texts in Redis, shared by all
+// replicas. Entries are keyed by model and a hash of the normalized text and
+// expire after cache.ttl. The cache only ever saves embedding calls: when
+// Redis is unavailable, texts are embedded as if it were empty.
+type redisCache struct {
+	client *redis.Client
+	ttl    time.Duration
+	prefix string
+	logger *slog.Logger
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats counts the lookups of the shared cache since startup.
+type CacheStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// newRedisCache connects to the Redis of cfg, or returns nil when none is
+// configured.
+func newRedisCache(cfg config.CacheConfig, logger *slog.Logger) (*redisCache, error) {
+	if cfg.RedisURL == "" {
+		return nil, nil
+	}
+
+	options, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cache.redis_url: %w", err)
+	}
+
+	return &redisCache{
+		client: redis.NewClient(options),
+		ttl:    cfg.TTL,
+		prefix: cfg.KeyPrefix,
+		logger: logger,
+	}, nil
+}
+
+// checkEvictionPolicy warns when Redis would refuse writes instead of
+// evicting old vectors once it reaches maxmemory. Managed Redis often
+// disables CONFIG, in which case the policy is left unchecked.
+func (c *redisCache) checkEvictionPolicy(ctx context.Context) {
+	values, err := c.client.ConfigGet(ctx, "maxmemory-policy").Result()
+	if err != nil {
+		c.logger.Debug("Could not read the Redis eviction policy", "error", err)
+		return
+	}
+	if policy := values["maxmemory-policy"]; policy == "noeviction" {
+		c.logger.Warn("Redis does not evict keys, cache writes fail once it reaches maxmemory; use allkeys-lru or volatile-lru",
+			"maxmemory_policy", policy)
+	}
+}
+
+func (c *redisCache) key(model, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return c.prefix + model + ":" + hex.EncodeToString(sum[:])
+}
+
+// getMany returns the cached vectors of the given dedupe keys, by key.
+func (c *redisCache) getMany(ctx context.Context, model string, keys []string) (map[string][]float32, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	redisKeys := make([]string, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = c.key(model, key)
+	}
+
+	values, err := c.client.MGet(ctx, redisKeys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached vectors: %w", err)
+	}
+
+	vectors := make(map[string][]float32)
+	for i, value := range values {
+		encoded, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if vector := decodeVector(encoded); vector != nil {
+			vectors[keys[i]] = vector
+		}
+	}
+	c.hits.Add(int64(len(vectors)))
+	c.misses.Add(int64(len(keys) - len(vectors)))
+
+	return vectors, nil
+}
+
+// putMany caches the vectors of the given dedupe keys in one round trip.
+func (c *redisCache) putMany(ctx context.Context, model string, vectors map[string][]float32) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	for key, vector := range vectors {
+		pipe.Set(ctx, c.key(model, key), encodeVector(vector), c.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to cache vectors: %w", err)
+	}
+
+	return nil
+}
+
+func (c *redisCache) stats() CacheStats {
+	stats := CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
+
+// encodeVector packs a vector as little-endian float32s.
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, x := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+// decodeVector unpacks a vector packed by encodeVector, or returns nil for a
+// malformed value.
+func decodeVector(encoded string) []float32 {
+	if len(encoded) == 0 || len(encoded)%4 != 0 {
+		return nil
+	}
+	vector := make([]float32, len(encoded)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32([]byte(encoded[4*i : 4*i+4])))
+	}
+	return vector
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+var (
+	// ErrRerankDisabled is returned for searches asking for reranking while
+	// rerank.provider is empty.
+	ErrRerankDisabled = errors.New("reranking is disabled, rerank.provider is empty")
+	// ErrInvalidRerank is returned for searches asking for reranking of the
+	// reviews similar to a review, which have no query to rerank against.
+	ErrInvalidRerank = errors.New("rerank needs a text to search for")
+)
+
+// Reranker scores documents by their relevance to a query, typically with a
+// cross-encoder, which compares each document with the query rather than
+// their embeddings.
+type Reranker interface {
+	// Rerank returns the relevance score of every document, higher scores
+	// being more relevant.
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// newReranker returns the reranker of rerank.provider, or nil when it is
+// empty. The query and the documents are redacted with redactor, like the
+// texts sent to the embedder.
+func newReranker(cfg *config.Config, redactor *preprocess.Redactor) Reranker {
+	rerank := cfg.Rerank
+	if rerank.Provider == "" {
+		return nil
+	}
+
+	return &httpReranker{
+		provider: rerank.Provider,
+		url:      rerank.URL,
+		apiKey:   rerank.APIKey,
+		model:    rerank.Model,
+		client:   &http.Client{Timeout: rerank.Timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		redactor: redactor,
+	}
+}
+
+// httpReranker calls the Cohere Rerank API (provider "cohere") or a
+// self-hosted cross-encoder answering like the /rerank route of
+// text-embeddings-inference (provider "http").
+type httpReranker struct {
+	provider string
+	url      string
+	apiKey   string
+	model    string
+	client   *http.Client
+	redactor *preprocess.Redactor
+}
+
+// rerankScore is the score of the document at Index, in the shape of both
+// Cohere (relevance_score) and text-embeddings-inference (score).
+type rerankScore struct {
+	Index          int      `json:"index"`
+	Score          *float64 `json:"score"`
+	RelevanceScore *float64 `json:"relevance_score"`
+}
+
+func (r *httpReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	if r.redactor != nil {
+		counts := make(map[string]int)
+		query = r.redactor.Redact(query, counts)
+		redacted := make([]string, len(documents))
+		for i, document := range documents {
+			redacted[i] = r.redactor.Redact(document, counts)
+		}
+		documents = redacted
+	}
+
+	payload := map[string]any{"query": query, "texts": documents, "truncate": true}
+	if r.provider == "cohere" {
+		payload = map[string]any{"model": r.model, "query": query, "documents": documents, "top_n": len(documents)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &statusError{status: resp.StatusCode, err: fmt.Errorf("reranker HTTP %d: %s", resp.StatusCode, string(message))}
+	}
+
+	var scores []rerankScore
+	if r.provider == "cohere" {
+		var result struct {
+			Results []rerankScore `json:"results"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		scores = result.Results
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&scores)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(scores) != len(documents) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(documents))
+	}
+
+	relevance := make([]float64, len(documents))
+	scored := make([]bool, len(documents))
+	for _, score := range scores {
+		value := score.Score
+		if value == nil {
+			value = score.RelevanceScore
+		}
+		if score.Index < 0 || score.Index >= len(documents) || value == nil || scored[score.Index] {
+			return nil, fmt.Errorf("reranker returned an invalid score for document %d", score.Index)
+		}
+		relevance[score.Index], scored[score.Index] = *value, true
+	}
+	return relevance, nil
+}
+
+// rerank orders the vector hits of a text search by the reranker's score
+// and keeps the best limit. When the reranker fails, the hits keep their
+// vector order, so searches degrade to plain vector search rather than fail.
+func (s *VectorizeService) rerank(ctx context.Context, query string, hits []storage.SimilarReview, limit int) []storage.SimilarReview {
+	documents := make([]string, len(hits))
+	for i, hit := range hits {
+		documents[i] = hit.Content
+	}
+
+	scores, err := s.reranker.Rerank(ctx, query, documents)
+	if err != nil {
+		s.logger.Warn("Reranking failed, returning vector search order", "candidates", len(hits), "error", err)
+		return hits[:min(limit, len(hits))]
+	}
+
+	for i := range hits {
+		hits[i].RerankScore = &scores[i]
+	}
+	slices.SortStableFunc(hits, func(a, b storage.SimilarReview) int {
+		return cmp.Compare(*b.RerankScore, *a.RerankScore)
+	})
+	return hits[:min(limit, len(hits))]
+}
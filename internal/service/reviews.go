@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// HandleReviewDeleted removes the embeddings and derived rows of reviews
+// deleted upstream.
+func (s *VectorizeService) HandleReviewDeleted(ctx context.Context, evt payloads.ReviewDeleted, sagaID string) error {
+	deleted, err := s.repo.DeleteReviews(ctx, evt.ReviewIDs)
+	entry := storage.AuditEntry{
+		Operation: storage.AuditDelete,
+		SagaID:    sagaID,
+		Filters:   auditFilters(evt),
+		Affected:  deleted,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.audit(ctx, entry)
+	if err != nil {
+		s.logger.Error("Failed to delete reviews", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("review deletion failed: %w", err)
+	}
+
+	s.logger.Info("Deleted reviews",
+		"app_id", evt.AppID,
+		"reviews", len(evt.ReviewIDs),
+		"embeddings", deleted,
+		"saga_id", sagaID)
+
+	return nil
+}
+
+// HandleReembed recomputes the embeddings of the requested reviews, whether
+// or not they are embedded already. While another run holds the app's lock
+// the request fails, to be delivered again once that run is done.
+func (s *VectorizeService) HandleReembed(ctx context.Context, evt payloads.ReembedRequest, sagaID string) error {
+	s.logger.Info("Re-embedding request", "app_id", evt.AppID, "reviews", len(evt.ReviewIDs), "saga_id", sagaID)
+
+	result, err := s.RunOnce(ctx, VectorizeRequest{
+		SagaID:         sagaID,
+		AppID:          evt.AppID,
+		ReviewIDs:      evt.ReviewIDs,
+		ForceRecompute: true,
+		Priority:       PriorityRequest,
+	})
+	if errors.Is(err, ErrRunCancelled) {
+		s.logger.Info("Re-embedding cancelled", "run_id", result.RunID, "saga_id", sagaID)
+		return nil
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		s.logger.Warn("Re-embedding deferred", "run_id", result.RunID, "deferred", result.Deferred, "error", err, "saga_id", sagaID)
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("Re-embedding failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("re-embedding failed: %w", err)
+	}
+
+	completed := payloads.ReembedCompleted{
+		AppID:     evt.AppID,
+		RunID:     result.RunID,
+		Requested: len(evt.ReviewIDs),
+		Processed: result.Processed,
+		Skipped:   result.Skipped,
+		Failed:    result.Failed,
+	}
+
+	s.logger.Info("Re-embedding completed",
+		"run_id", completed.RunID,
+		"processed", completed.Processed,
+		"failed", completed.Failed,
+		"saga_id", sagaID)
+
+	envelope := s.producer.BuildReembedCompletedEnvelope(completed, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish re-embedding completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
+
+// VectorizeReview embeds and stores a single review without a run, bypassing
+// the batch scan, for real-time ingestion. The review is read from
+// clean_reviews unless its text is given inline. An existing embedding of the
+// review is replaced.
+func (s *VectorizeService) VectorizeReview(ctx context.Context, evt payloads.VectorizeReview) (payloads.VectorizeReviewCompleted, error) {
+	ctx = WithPriority(ctx, PriorityRealtime)
+	started := time.Now()
+	completed := payloads.VectorizeReviewCompleted{
+		ReviewID: evt.ReviewID,
+		AppID:    evt.AppID,
+		Model:    s.currentModel().name,
+	}
+
+	review, err := s.singleReview(ctx, evt)
+	if err != nil {
+		return completed, err
+	}
+	if review == nil {
+		completed.Skipped = SkipReasonNotFound
+		return completed, nil
+	}
+	completed.AppID = review.AppID
+
+	if reason := s.skipReason(*review); reason != "" {
+		completed.Skipped = reason
+		return completed, nil
+	}
+
+	meterCtx, meter := withUsageMeter(ctx)
+	vectors, err := s.embedBatch(meterCtx, []storage.CleanReview{*review}, nil)
+	s.addSpend(ctx, "", s.spendOf([]storage.CleanReview{*review}, false, completed.Model, meter.tokens()))
+	if err != nil {
+		return completed, fmt.Errorf("failed to embed review %s: %w", evt.ReviewID, err)
+	}
+	if _, rejected := s.rejectInvalidVectors(vectors, true); len(rejected) > 0 {
+		return completed, fmt.Errorf("failed to embed review %s: %w", evt.ReviewID, rejected[0].err)
+	}
+
+	if err := s.repo.UpsertEmbeddings(ctx, vectors); err != nil {
+		return completed, fmt.Errorf("failed to store embedding of review %s: %w", evt.ReviewID, err)
+	}
+
+	completed.Chunks = len(vectors)
+	completed.LatencyMS = time.Since(started).Milliseconds()
+	return completed, nil
+}
+
+// singleReview returns the review to vectorize: the inline one when the event
+// carries its text, the one in clean_reviews otherwise, or nil when there is
+// none.
+func (s *VectorizeService) singleReview(ctx context.Context, evt payloads.VectorizeReview) (*storage.CleanReview, error) {
+	if evt.Content != "" {
+		// Inline text is embedded whatever the text source, so it serves as
+		// the translation as well.
+		review := &storage.CleanReview{
+			ID:           evt.ReviewID,
+			AppID:        evt.AppID,
+			Country:      evt.Country,
+			Rating:       evt.Rating,
+			Title:        evt.Title,
+			ContentClean: evt.Content,
+			ContentEN:    &evt.Content,
+			Language:     evt.Language,
+			IsContentful: true,
+			ReviewedAt:   time.Now(),
+		}
+		if evt.Response != "" {
+			review.ResponseContentClean = &evt.Response
+		}
+		return review, nil
+	}
+
+	filters := storage.CleanReviewFilters{
+		ForceRecompute: true,
+		Model:          s.currentModel().name,
+		AppID:          evt.AppID,
+		ReviewIDs:      []string{evt.ReviewID},
+	}
+	reviews, err := s.repo.GetCleanReviewsForVectorization(ctx, filters, 1, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch review %s: %w", evt.ReviewID, err)
+	}
+	if len(reviews) == 0 {
+		return nil, nil
+	}
+
+	return &reviews[0], nil
+}
+
+// HandleVectorizeReview vectorizes the single review of the event and
+// publishes the outcome.
+func (s *VectorizeService) HandleVectorizeReview(ctx context.Context, evt payloads.VectorizeReview, sagaID string) error {
+	completed, err := s.VectorizeReview(ctx, evt)
+	if err != nil {
+		s.logger.Error("Single review vectorization failed", "error", err, "review_id", evt.ReviewID, "saga_id", sagaID)
+		return fmt.Errorf("single review vectorization failed: %w", err)
+	}
+
+	if completed.Skipped != "" {
+		s.logger.Warn("Skipped single review", "review_id", evt.ReviewID, "reason", completed.Skipped, "saga_id", sagaID)
+	} else {
+		s.logger.Info("Vectorized single review",
+			"review_id", evt.ReviewID,
+			"chunks", completed.Chunks,
+			"latency_ms", completed.LatencyMS,
+			"saga_id", sagaID)
+	}
+
+	envelope := s.producer.BuildReviewCompletedEnvelope(completed, sagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(sagaID), envelope); err != nil {
+		s.logger.Error("Failed to publish single review completed event", "error", err, "saga_id", sagaID)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+const (
+	defaultRunsLimit = 50
+	maxRunsLimit     = 500
+)
+
+// ErrInvalidRunQuery is returned for run history queries with an unknown
+// status or a malformed date.
+var ErrInvalidRunQuery = errors.New("invalid run query")
+
+// RunQuery selects runs from the run history. Dates are either days
+// (2006-01-02), which cover the whole day in UTC, or RFC 3339 timestamps;
+// runs are selected by the time they started.
+type RunQuery struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	AppID    string `json:"app_id,omitempty"`
+	Status   string `json:"status,omitempty"`
+	DateFrom string `json:"date_from,omitempty"`
+	DateTo   string `json:"date_to,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+}
+
+// ListRuns returns the runs matching the query, most recently started first.
+func (s *VectorizeService) ListRuns(ctx context.Context, query RunQuery) ([]storage.Run, error) {
+	filters := storage.RunFilters{
+		TenantID: query.TenantID,
+		AppID:    query.AppID,
+		Status:   storage.RunStatus(query.Status),
+		Limit:    query.Limit,
+	}
+
+	switch filters.Status {
+	case "", storage.RunStatusRunning, storage.RunStatusCompleted, storage.RunStatusFailed, storage.RunStatusCancelled, storage.RunStatusDeferred:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidRunQuery, query.Status)
+	}
+
+	if query.DateFrom != "" {
+		from, _, err := parseRunDate(query.DateFrom)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date_from: %w", ErrInvalidRunQuery, err)
+		}
+		filters.StartedFrom = &from
+	}
+	if query.DateTo != "" {
+		to, day, err := parseRunDate(query.DateTo)
+		if err != nil {
+			return nil, fmt.Errorf("%w: date_to: %w", ErrInvalidRunQuery, err)
+		}
+		if day {
+			to = to.AddDate(0, 0, 1)
+		} else {
+			to = to.Add(time.Nanosecond)
+		}
+		filters.StartedBefore = &to
+	}
+
+	if filters.Limit <= 0 {
+		filters.Limit = defaultRunsLimit
+	}
+	filters.Limit = min(filters.Limit, maxRunsLimit)
+
+	return s.repo.ListRuns(ctx, filters)
+}
+
+// parseRunDate parses a day or an RFC 3339 timestamp and reports whether it
+// was a day.
+func parseRunDate(value string) (time.Time, bool, error) {
+	if day, err := time.Parse(time.DateOnly, value); err == nil {
+		return day, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is neither a date nor an RFC 3339 timestamp", value)
+	}
+	return t, false, nil
+}
+
+// GetRunErrors returns the run with the given run ID or saga ID together with
+// the per-review failures it left unresolved, or a nil run when there is none.
+func (s *VectorizeService) GetRunErrors(ctx context.Context, id string) (*storage.Run, []storage.ReviewError, error) {
+	run, err := s.GetRun(ctx, id)
+	if err != nil || run == nil {
+		return nil, nil, err
+	}
+
+	reviewErrors, err := s.repo.ListRunErrors(ctx, run.RunID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return run, reviewErrors, nil
+}
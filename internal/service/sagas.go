@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// payloadDigest returns the SHA-256 hex digest of v's JSON encoding along
+// with the encoding itself.
+func payloadDigest(v any) (string, []byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), data, nil
+}
+
+// findProcessed returns the record of the saga's request of eventType having
+// been handled when request is a redelivery of that same request, and nil
+// when it has to be handled. A saga ID reused for a different request is
+// handled again.
+func (s *VectorizeService) findProcessed(ctx context.Context, eventType, sagaID string, request any) *storage.ProcessedSaga {
+	requestDigest, _, err := payloadDigest(request)
+	if err != nil {
+		s.logger.Warn("Failed to digest request", "error", err, "saga_id", sagaID)
+		return nil
+	}
+
+	processed, err := s.repo.GetProcessedSaga(ctx, sagaID, eventType)
+	if err != nil {
+		s.logger.Warn("Failed to look up processed saga", "error", err, "saga_id", sagaID)
+		return nil
+	}
+	if processed == nil {
+		return nil
+	}
+	if processed.RequestDigest != requestDigest {
+		s.logger.Warn("Saga ID reused for a different request, handling it again",
+			"event_type", eventType,
+			"saga_id", sagaID,
+			"processed_at", processed.ProcessedAt)
+		return nil
+	}
+
+	return processed
+}
+
+// recordProcessed records that the saga's request of eventType was handled
+// and answered with reply, so that redeliveries get the same reply. Failing
+// to record it only costs a duplicate run on redelivery, so it is logged
+// rather than returned.
+func (s *VectorizeService) recordProcessed(ctx context.Context, eventType, sagaID string, request, reply any) {
+	requestDigest, _, err := payloadDigest(request)
+	if err != nil {
+		s.logger.Warn("Failed to digest request", "error", err, "saga_id", sagaID)
+		return
+	}
+	resultDigest, replyData, err := payloadDigest(reply)
+	if err != nil {
+		s.logger.Warn("Failed to digest reply", "error", err, "saga_id", sagaID)
+		return
+	}
+
+	processed := &storage.ProcessedSaga{
+		SagaID:        sagaID,
+		EventType:     eventType,
+		RequestDigest: requestDigest,
+		ResultDigest:  resultDigest,
+		Reply:         replyData,
+	}
+	if err := s.repo.RecordProcessedSaga(context.WithoutCancel(ctx), processed); err != nil {
+		s.logger.Warn("Failed to record processed saga", "error", err, "saga_id", sagaID)
+	}
+}
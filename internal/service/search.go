@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 100
+	maxRerankLimit     = 1000
+)
+
+var (
+	// ErrInvalidSearch is returned for searches without exactly one of a
+	// review ID or a text to search for.
+	ErrInvalidSearch = errors.New("either review_id or text is required")
+	// ErrReviewNotEmbedded is returned when searching for reviews similar to
+	// one that has no embedding yet.
+	ErrReviewNotEmbedded = storage.ErrReviewNotEmbedded
+)
+
+// SearchRequest asks for the reviews nearest to an embedded review or to a
+// free text, which is embedded on the fly. Text searches can have the top
+// RerankCandidates vector hits (default rerank.candidates) reranked.
+type SearchRequest struct {
+	ReviewID         string `json:"review_id,omitempty"`
+	Text             string `json:"text,omitempty"`
+	Limit            int    `json:"limit,omitempty"`
+	Rerank           bool   `json:"rerank,omitempty"`
+	RerankCandidates int    `json:"rerank_candidates,omitempty"`
+	storage.SearchFilters
+}
+
+// Search returns the reviews most similar to the request's review or text,
+// best match first. The review searched for is not part of its own results.
+// Reranked searches order the hits by the reranker's score instead.
+func (s *VectorizeService) Search(ctx context.Context, req SearchRequest) ([]storage.SimilarReview, error) {
+	text := s.preprocessor.Process(req.Text)
+	if (req.ReviewID == "") == (text == "") {
+		return nil, ErrInvalidSearch
+	}
+	if req.Rerank {
+		switch {
+		case s.reranker == nil:
+			return nil, ErrRerankDisabled
+		case req.ReviewID != "":
+			return nil, ErrInvalidRerank
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+
+	filters := req.SearchFilters
+	filters.Model = s.currentModel().name
+
+	if req.ReviewID != "" {
+		return s.repo.FindSimilar(ctx, req.ReviewID, limit, filters)
+	}
+
+	vectors, err := s.currentModel().embedder.EmbedBatch(withQuery(ctx), []string{text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed search text: %w", err)
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for the search text", len(vectors))
+	}
+
+	if !req.Rerank {
+		return s.repo.SearchSimilar(ctx, vectors[0], limit, filters)
+	}
+
+	candidates := req.RerankCandidates
+	if candidates <= 0 {
+		candidates = s.cfg.Rerank.Candidates
+	}
+	hits, err := s.repo.SearchSimilar(ctx, vectors[0], min(max(candidates, limit), maxRerankLimit), filters)
+	if err != nil {
+		return nil, err
+	}
+	return s.rerank(ctx, text, hits, limit), nil
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+const (
+	// shadowReportReviews caps the reviews ShadowReport compares; every pair
+	// of them is compared, so the work grows with its square.
+	shadowReportReviews = 500
+	// driftBucketWidth is the width of the drift histogram buckets.
+	driftBucketWidth = 0.05
+)
+
+// ErrNoShadowModel is returned for shadow reports when neither the request
+// nor shadow.model names the candidate model.
+var ErrNoShadowModel = errors.New("no shadow model given and shadow.model is not set")
+
+// inShadowSample reports whether the review is one of the shadow.sample_percent
+// of reviews embedded with the shadow model. The choice only depends on the
+// review ID, so that reruns keep comparing the same reviews.
+func (s *VectorizeService) inShadowSample(reviewID string) bool {
+	h := fnv.New32a()
+	h.Write([]byte(reviewID))
+	return float64(h.Sum32()%10000) < s.cfg.Shadow.SamplePercent*100
+}
+
+// embedShadow embeds the content of the sampled reviews of a batch with the
+// shadow model. Shadow mode must never hold up production, so a failure is
+// logged and leaves the batch without shadow vectors.
+func (s *VectorizeService) embedShadow(ctx context.Context, reviews []storage.CleanReview) []*storage.ShadowVector {
+	var sampled []*storage.ShadowVector
+	var texts []string
+	for _, review := range reviews {
+		if !s.inShadowSample(review.ID) {
+			continue
+		}
+		for i, chunk := range s.chunkReview(review.Text(s.cfg.Vectorizer.TextSource)) {
+			sampled = append(sampled, &storage.ShadowVector{
+				ReviewID:   review.ID,
+				ChunkIndex: i,
+				AppID:      review.AppID,
+				Model:      s.cfg.Shadow.Model,
+			})
+			texts = append(texts, chunk)
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+
+	vectors, err := s.shadow.EmbedBatch(ctx, texts)
+	if err == nil && len(vectors) != len(texts) {
+		err = fmt.Errorf("embedder returned %d vectors for %d inputs", len(vectors), len(texts))
+	}
+	if err != nil {
+		s.logger.Warn("Failed to generate shadow embeddings", "model", s.cfg.Shadow.Model, "count", len(texts), "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	for i, vector := range sampled {
+		vector.ContentVec = vectors[i]
+		vector.CreatedAt = now
+	}
+
+	return sampled
+}
+
+// ShadowReport compares a candidate model with the production one on the
+// reviews embedded with both in shadow mode.
+//
+// The vectors of two models live in unrelated spaces, often of different
+// dimensions, so they are not compared with each other. Instead, every pair
+// of reviews is compared under each model, and the drift of a pair is its
+// cosine similarity under the candidate minus that under the production
+// model. A drift distribution centred on 0 with narrow tails means the
+// candidate ranks reviews like the production model does.
+type ShadowReport struct {
+	AppID           string        `json:"app_id,omitempty"`
+	ProductionModel string        `json:"production_model"`
+	ShadowModel     string        `json:"shadow_model"`
+	Reviews         int           `json:"reviews"`
+	Pairs           int           `json:"pairs"`
+	Drift           DriftStats    `json:"drift"`
+	Histogram       []DriftBucket `json:"histogram"`
+}
+
+// DriftStats summarizes the drift distribution; MeanAbs is the mean of the
+// absolute drift.
+type DriftStats struct {
+	Mean    float64 `json:"mean"`
+	MeanAbs float64 `json:"mean_abs"`
+	Min     float64 `json:"min"`
+	P05     float64 `json:"p05"`
+	P25     float64 `json:"p25"`
+	P50     float64 `json:"p50"`
+	P75     float64 `json:"p75"`
+	P95     float64 `json:"p95"`
+	Max     float64 `json:"max"`
+}
+
+// DriftBucket counts the pairs whose drift is at least From and below To.
+type DriftBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Pairs int     `json:"pairs"`
+}
+
+// ShadowReport compares the shadow model, shadow.model unless model is given,
+// with vectorizer.model on up to 500 random reviews of the app, or of every
+// app when appID is empty, that were embedded with both.
+func (s *VectorizeService) ShadowReport(ctx context.Context, appID, model string) (ShadowReport, error) {
+	if model == "" {
+		model = s.cfg.Shadow.Model
+	}
+	if model == "" {
+		return ShadowReport{}, ErrNoShadowModel
+	}
+
+	report := ShadowReport{
+		AppID:           appID,
+		ProductionModel: s.currentModel().name,
+		ShadowModel:     model,
+	}
+
+	pairs, err := s.repo.ListShadowPairs(ctx, appID, report.ProductionModel, model, shadowReportReviews)
+	if err != nil {
+		return ShadowReport{}, err
+	}
+	report.Reviews = len(pairs)
+
+	production := make([][]float32, len(pairs))
+	shadow := make([][]float32, len(pairs))
+	for i, pair := range pairs {
+		production[i], shadow[i] = unitVector(pair.Production), unitVector(pair.Shadow)
+	}
+
+	drifts := make([]float64, 0, len(pairs)*(len(pairs)-1)/2)
+	for i := range pairs {
+		for j := i + 1; j < len(pairs); j++ {
+			drifts = append(drifts, dotProduct(shadow[i], shadow[j])-dotProduct(production[i], production[j]))
+		}
+	}
+	report.Pairs = len(drifts)
+	if len(drifts) == 0 {
+		return report, nil
+	}
+
+	slices.Sort(drifts)
+	var sum, sumAbs float64
+	for _, drift := range drifts {
+		sum += drift
+		sumAbs += math.Abs(drift)
+	}
+	report.Drift = DriftStats{
+		Mean:    sum / float64(len(drifts)),
+		MeanAbs: sumAbs / float64(len(drifts)),
+		Min:     drifts[0],
+		P05:     quantile(drifts, 0.05),
+		P25:     quantile(drifts, 0.25),
+		P50:     quantile(drifts, 0.5),
+		P75:     quantile(drifts, 0.75),
+		P95:     quantile(drifts, 0.95),
+		Max:     drifts[len(drifts)-1],
+	}
+	report.Histogram = driftHistogram(drifts)
+
+	return report, nil
+}
+
+// unitVector returns v scaled to unit length, so that dot products of unit
+// vectors are cosine similarities.
+func unitVector(v []float32) []float32 {
+	norm := math.Sqrt(dotProduct(v, v))
+	unit := make([]float32, len(v))
+	if norm == 0 {
+		return unit
+	}
+	for i, x := range v {
+		unit[i] = float32(float64(x) / norm)
+	}
+	return unit
+}
+
+func dotProduct(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// quantile returns the q-quantile of sorted values, interpolating between
+// neighbouring values.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lower := int(pos)
+	if lower+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[lower+1]-sorted[lower])*(pos-float64(lower))
+}
+
+// driftHistogram counts sorted drifts into buckets of driftBucketWidth,
+// leaving out empty buckets.
+func driftHistogram(sorted []float64) []DriftBucket {
+	var buckets []DriftBucket
+	for _, drift := range sorted {
+		// The epsilon keeps drifts on a bound, such as 0.3, out of the bucket
+		// below it despite rounding.
+		from := roundDrift(math.Floor(drift/driftBucketWidth+1e-9) * driftBucketWidth)
+		if len(buckets) == 0 || buckets[len(buckets)-1].From != from {
+			buckets = append(buckets, DriftBucket{From: from, To: roundDrift(from + driftBucketWidth)})
+		}
+		buckets[len(buckets)-1].Pairs++
+	}
+	return buckets
+}
+
+// roundDrift rounds a bucket bound to the precision of driftBucketWidth.
+func roundDrift(bound float64) float64 {
+	return math.Round(bound*100) / 100
+}
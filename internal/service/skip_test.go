@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+func TestSkipReasonLanguages(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		denied   []string
+		language string
+		want     string
+	}{
+		{"no lists", nil, nil, "de", ""},
+		{"allowed", []string{"en", "de"}, nil, "de", ""},
+		{"allowed ignoring case", []string{"EN"}, nil, "en", ""},
+		{"not allowed", []string{"en"}, nil, "de", SkipReasonUnsupportedLanguage},
+		{"denied", nil, []string{"ja"}, "ja", SkipReasonUnsupportedLanguage},
+		{"denied ignoring case", nil, []string{"ja"}, "JA", SkipReasonUnsupportedLanguage},
+		{"allowed but denied", []string{"en", "ja"}, []string{"ja"}, "ja", SkipReasonUnsupportedLanguage},
+		{"neither", nil, []string{"ja"}, "en", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeEmbedder{})
+			s.cfg.Preprocessing.AllowedLanguages = tt.allowed
+			s.cfg.Preprocessing.DeniedLanguages = tt.denied
+
+			review := storage.CleanReview{ID: "r1", Language: tt.language, ContentClean: "a review worth embedding"}
+			if got := s.skipReason(review); got != tt.want {
+				t.Errorf("skipReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
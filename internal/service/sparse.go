@@ -0,0 +1,160 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// BM25 term saturation and length normalization, with the usual defaults,
+// and the document length, in words, the normalization is relative to.
+const (
+	bm25K1        = 1.2
+	bm25B         = 0.75
+	bm25AvgLength = 50
+)
+
+// SparseEmbedder makes the sparse companions of the dense content vectors,
+// for hybrid retrieval. Texts without any term get a nil vector.
+type SparseEmbedder interface {
+	EmbedSparse(ctx context.Context, inputs []string) ([]*storage.SparseVector, error)
+}
+
+// newSparseEmbedder returns the embedder of sparse.provider, or nil when
+// sparse.enabled is off. Texts sent to a server are redacted with redactor,
+// like those sent to the dense embedder.
+func newSparseEmbedder(cfg *config.Config, redactor *preprocess.Redactor) SparseEmbedder {
+	sparse := cfg.Sparse
+	if !sparse.Enabled {
+		return nil
+	}
+	if sparse.Provider != "http" {
+		return &bm25Embedder{dim: int32(sparse.Dimensions)}
+	}
+	return &httpSparseEmbedder{
+		url:      sparse.URL,
+		dim:      int32(sparse.Dimensions),
+		client:   &http.Client{Timeout: sparse.Timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+		redactor: redactor,
+	}
+}
+
+// bm25Embedder weighs every term of a text by its BM25 term frequency
+// component, at the dimension its FNV hash falls on. The inverse document
+// frequency is left to query time, where the corpus is known.
+type bm25Embedder struct {
+	dim int32
+}
+
+func (e *bm25Embedder) EmbedSparse(_ context.Context, inputs []string) ([]*storage.SparseVector, error) {
+	vectors := make([]*storage.SparseVector, len(inputs))
+	for i, input := range inputs {
+		terms := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(terms) == 0 {
+			continue
+		}
+
+		counts := make(map[int32]float64)
+		for _, term := range terms {
+			h := fnv.New32a()
+			h.Write([]byte(term))
+			counts[int32(h.Sum32()%uint32(e.dim))]++
+		}
+
+		norm := bm25K1 * (1 - bm25B + bm25B*float64(len(terms))/bm25AvgLength)
+		vector := &storage.SparseVector{Dim: e.dim}
+		for index, tf := range counts {
+			vector.Indices = append(vector.Indices, index)
+			vector.Values = append(vector.Values, float32(tf*(bm25K1+1)/(tf+norm)))
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// httpSparseEmbedder posts the texts to the /embed_sparse route of
+// text-embeddings-inference, or any server answering like it.
+type httpSparseEmbedder struct {
+	url      string
+	dim      int32
+	client   *http.Client
+	redactor *preprocess.Redactor
+}
+
+type sparseWeight struct {
+	Index int32   `json:"index"`
+	Value float32 `json:"value"`
+}
+
+func (e *httpSparseEmbedder) EmbedSparse(ctx context.Context, inputs []string) ([]*storage.SparseVector, error) {
+	if len(inputs) == 0 {
+		return nil, nil
+	}
+	if e.redactor != nil {
+		counts := make(map[string]int)
+		redacted := make([]string, len(inputs))
+		for i, input := range inputs {
+			redacted[i] = e.redactor.Redact(input, counts)
+		}
+		inputs = redacted
+	}
+
+	body, err := json.Marshal(map[string]any{"inputs": inputs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &statusError{status: resp.StatusCode, err: fmt.Errorf("sparse embedder HTTP %d: %s", resp.StatusCode, string(message))}
+	}
+
+	var weights [][]sparseWeight
+	if err := json.NewDecoder(resp.Body).Decode(&weights); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(weights) != len(inputs) {
+		return nil, fmt.Errorf("sparse embedder returned %d vectors for %d inputs", len(weights), len(inputs))
+	}
+
+	vectors := make([]*storage.SparseVector, len(weights))
+	for i, text := range weights {
+		if len(text) == 0 {
+			continue
+		}
+		vector := &storage.SparseVector{Dim: e.dim}
+		for _, w := range text {
+			if w.Index < 0 || w.Index >= e.dim {
+				return nil, fmt.Errorf("sparse embedder returned index %d outside %d dimensions", w.Index, e.dim)
+			}
+			vector.Indices = append(vector.Indices, w.Index)
+			vector.Values = append(vector.Values, w.Value)
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// SpendMonthLayout is the format of the months of spend reports.
+const SpendMonthLayout = "2006-01"
+
+// ErrInvalidMonth is returned for spend reports of a month not formatted as
+// SpendMonthLayout.
+var ErrInvalidMonth = errors.New("invalid month, expected YYYY-MM")
+
+// spendOf counts the reviews embedded with model per app, and splits the
+// tokens of each model among the apps of the reviews they were spent on, in
+// proportion to the characters embedded for each app, priced by
+// vectorizer.pricing. Response backfills embed only the responses.
+func (s *VectorizeService) spendOf(reviews []storage.CleanReview, responses bool, model string, usage map[string]int64) []storage.SpendEntry {
+	var apps []string
+	counts := make(map[string]int64)
+	chars := make(map[string]int64)
+	var total int64
+	for _, review := range reviews {
+		text := s.embeddedText(review, responses)
+		if _, ok := counts[review.AppID]; !ok {
+			apps = append(apps, review.AppID)
+		}
+		counts[review.AppID]++
+		chars[review.AppID] += int64(len(text))
+		total += int64(len(text))
+	}
+	if len(apps) == 0 {
+		return nil
+	}
+
+	if _, ok := usage[model]; !ok {
+		// Served from the caches; the reviews still count.
+		usage[model] = 0
+	}
+
+	month := time.Now().UTC()
+	var entries []storage.SpendEntry
+	for usageModel, tokens := range usage {
+		price := s.cfg.Vectorizer.Price(usageModel)
+		left := tokens
+		for i, appID := range apps {
+			// The last app gets what rounding left over.
+			share := left
+			if i < len(apps)-1 && total > 0 {
+				share = tokens * chars[appID] / total
+			}
+			left -= share
+
+			entry := storage.SpendEntry{
+				AppID:   appID,
+				Month:   month,
+				Model:   usageModel,
+				Tokens:  share,
+				CostUSD: tokenCost(share, price),
+			}
+			if usageModel == model {
+				entry.Reviews = counts[appID]
+			}
+			if entry.Reviews == 0 && entry.Tokens == 0 {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// embeddedText returns the text of a review that is embedded: its response
+// for response backfills, its text otherwise.
+func (s *VectorizeService) embeddedText(review storage.CleanReview, responses bool) string {
+	if !responses {
+		return review.Text(s.cfg.Vectorizer.TextSource)
+	}
+	if review.ResponseContentClean == nil {
+		return ""
+	}
+	return *review.ResponseContentClean
+}
+
+// addSpend records the spend of a batch; spend that fails to be recorded is
+// only logged, the embeddings are made either way.
+func (s *VectorizeService) addSpend(ctx context.Context, tenantID string, entries []storage.SpendEntry) {
+	for i := range entries {
+		entries[i].TenantID = tenantID
+	}
+	if err := s.repo.AddSpend(ctx, entries); err != nil {
+		s.logger.Warn("Failed to record embedding spend", "entries", len(entries), "error", err)
+	}
+}
+
+// tokenCost prices tokens at pricePerMillion USD per million tokens.
+func tokenCost(tokens int64, pricePerMillion float64) float64 {
+	return float64(tokens) / 1_000_000 * pricePerMillion
+}
+
+// SpendReport returns the embedding spend of a month, formatted as
+// SpendMonthLayout, by app and model, narrowed to tenantID and appID when
+// they are set.
+func (s *VectorizeService) SpendReport(ctx context.Context, month, tenantID, appID string) (payloads.SpendReport, error) {
+	start, err := time.Parse(SpendMonthLayout, month)
+	if err != nil {
+		return payloads.SpendReport{}, fmt.Errorf("%w: %q", ErrInvalidMonth, month)
+	}
+
+	entries, err := s.repo.GetSpend(ctx, start, tenantID, appID)
+	if err != nil {
+		return payloads.SpendReport{}, fmt.Errorf("failed to get spend: %w", err)
+	}
+
+	report := payloads.SpendReport{
+		Month:    month,
+		TenantID: tenantID,
+		AppID:    appID,
+		Entries:  entries,
+	}
+	for _, entry := range entries {
+		report.Reviews += entry.Reviews
+		report.Tokens += entry.Tokens
+		report.CostUSD += entry.CostUSD
+	}
+	return report, nil
+}
+
+// PublishSpendReport publishes the spend report of the month before now, for
+// every app, as a pipeline.spend_report event.
+func (s *VectorizeService) PublishSpendReport(ctx context.Context, now time.Time) (payloads.SpendReport, error) {
+	now = now.UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -1, 0)
+
+	report, err := s.SpendReport(ctx, month.Format(SpendMonthLayout), "", "")
+	if err != nil {
+		return report, err
+	}
+
+	envelope := s.producer.BuildSpendReportEnvelope(report)
+	if err := s.producer.PublishEvent(ctx, []byte(report.Month), envelope); err != nil {
+		return report, fmt.Errorf("failed to publish spend report: %w", err)
+	}
+	return report, nil
+}
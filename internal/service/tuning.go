@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Tuning holds the throughput settings that can be changed while runs go on,
+// by reloading the configuration.
+type Tuning struct {
+	// BatchSize is vectorizer.batch_size, the reviews fetched per page and
+	// embedded per request; it applies from the next page on. With
+	// vectorizer.autotune.enabled it is where the batch size of every model
+	// starts over from.
+	BatchSize int
+	// Workers is processing.workers, the batches embedded at once; it
+	// applies right away.
+	Workers int
+	// QueueSize is processing.queue_size; it applies from the next run on.
+	QueueSize int
+	// ProgressEvery is processing.progress_every_batches.
+	ProgressEvery int
+	// RateLimit is openai.rate_limit; it applies from the next embedding
+	// request on.
+	RateLimit config.RateLimitConfig
+}
+
+func tuningFrom(cfg *config.Config) Tuning {
+	return Tuning{
+		BatchSize:     max(cfg.Vectorizer.BatchSize, 1),
+		Workers:       max(cfg.Processing.Workers, 1),
+		QueueSize:     cfg.Processing.QueueSize,
+		ProgressEvery: cfg.Processing.ProgressEvery,
+		RateLimit:     cfg.OpenAI.RateLimit,
+	}
+}
+
+// tuner holds the current tuning. changed is closed and replaced whenever
+// the tuning changes, waking runs waiting for a free worker.
+type tuner struct {
+	mu      sync.Mutex
+	current Tuning
+	changed chan struct{}
+}
+
+func newTuner(tuning Tuning) *tuner {
+	return &tuner{current: tuning, changed: make(chan struct{})}
+}
+
+func (t *tuner) get() Tuning {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.current
+}
+
+// set replaces the tuning and returns the previous one.
+func (t *tuner) set(tuning Tuning) Tuning {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	previous := t.current
+	t.current = tuning
+	close(t.changed)
+	t.changed = make(chan struct{})
+	return previous
+}
+
+func (t *tuner) wait() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.changed
+}
+
+// Tuning returns the throughput settings in effect.
+func (s *VectorizeService) Tuning() Tuning {
+	return s.tuner.get()
+}
+
+// Retune applies the throughput settings of a reloaded configuration to the
+// runs going on and to later ones.
+func (s *VectorizeService) Retune(cfg *config.Config) {
+	tuning := tuningFrom(cfg)
+	previous := s.tuner.set(tuning)
+	if previous.BatchSize != tuning.BatchSize {
+		s.sizer.reset(tuning.BatchSize)
+	}
+	if previous.RateLimit != tuning.RateLimit {
+		s.throttle.setLimits(tuning.RateLimit)
+	}
+	if previous != tuning {
+		s.logger.Info("Applied reloaded tuning",
+			"batch_size", tuning.BatchSize,
+			"workers", tuning.Workers,
+			"queue_size", tuning.QueueSize,
+			"progress_every_batches", tuning.ProgressEvery,
+			"tokens_per_minute", tuning.RateLimit.TokensPerMinute,
+			"requests_per_minute", tuning.RateLimit.RequestsPerMinute,
+			"shared_rate_limit", tuning.RateLimit.Shared)
+	}
+}
+
+// workerLimiter bounds the batches a run embeds at once to the current
+// number of workers, which may change while the run goes on.
+type workerLimiter struct {
+	tuner *tuner
+
+	mu     sync.Mutex
+	active int
+	freed  chan struct{}
+}
+
+func newWorkerLimiter(tuner *tuner) *workerLimiter {
+	return &workerLimiter{tuner: tuner, freed: make(chan struct{})}
+}
+
+// acquire waits for a free worker.
+func (l *workerLimiter) acquire(ctx context.Context) error {
+	for {
+		changed := l.tuner.wait()
+
+		l.mu.Lock()
+		if l.active < l.tuner.get().Workers {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *workerLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
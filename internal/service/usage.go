@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// providerUsage is what the embedding requests of one model cost: the
+// requests sent, retries included, those that failed, their total latency
+// and the tokens the provider billed.
+type providerUsage struct {
+	requests int
+	errors   int
+	latency  time.Duration
+	tokens   int64
+}
+
+// usageMeter records the embedding requests made with a context, by model.
+type usageMeter struct {
+	mu     sync.Mutex
+	models map[string]*providerUsage
+}
+
+type usageMeterKey struct{}
+
+// withUsageMeter returns a context whose embedding requests are recorded by
+// the returned meter.
+func withUsageMeter(ctx context.Context) (context.Context, *usageMeter) {
+	meter := &usageMeter{models: make(map[string]*providerUsage)}
+	return context.WithValue(ctx, usageMeterKey{}, meter), meter
+}
+
+// meterRequest records a request to model against the context's meter, if
+// any.
+func meterRequest(ctx context.Context, model string, latency time.Duration, err error) {
+	meterUpdate(ctx, model, func(u *providerUsage) {
+		u.requests++
+		u.latency += latency
+		if err != nil {
+			u.errors++
+		}
+	})
+}
+
+// meterTokens records the tokens billed for model against the context's
+// meter, if any.
+func meterTokens(ctx context.Context, model string, tokens int) {
+	meterUpdate(ctx, model, func(u *providerUsage) {
+		u.tokens += int64(tokens)
+	})
+}
+
+func meterUpdate(ctx context.Context, model string, update func(*providerUsage)) {
+	meter, _ := ctx.Value(usageMeterKey{}).(*usageMeter)
+	if meter == nil {
+		return
+	}
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	usage, ok := meter.models[model]
+	if !ok {
+		usage = &providerUsage{}
+		meter.models[model] = usage
+	}
+	update(usage)
+}
+
+// snapshot returns the usage recorded so far by model.
+func (m *usageMeter) snapshot() map[string]providerUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snapshot := make(map[string]providerUsage, len(m.models))
+	for model, usage := range m.models {
+		snapshot[model] = *usage
+	}
+	return snapshot
+}
+
+// tokens returns the tokens billed so far by model.
+func (m *usageMeter) tokens() map[string]int64 {
+	tokens := make(map[string]int64)
+	for model, usage := range m.snapshot() {
+		if usage.tokens > 0 {
+			tokens[model] = usage.tokens
+		}
+	}
+	return tokens
+}
+
+// publishUsage publishes a metrics.embedding_usage event per model the
+// batch's embedding requests went to, while flags.enable_usage_events is on.
+// Usage events are best effort: one that fails to be published is logged
+// and dropped.
+func (s *VectorizeService) publishUsage(ctx context.Context, run *storage.Run, reviews []storage.CleanReview, meter *usageMeter) {
+	if s.producer == nil || !s.Flags().UsageEvents {
+		return
+	}
+
+	for model, usage := range meter.snapshot() {
+		event := payloads.EmbeddingUsage{
+			RunID:     run.RunID,
+			AppID:     run.Filters.AppID,
+			TenantID:  run.Filters.TenantID,
+			Model:     model,
+			Reviews:   len(reviews),
+			Requests:  usage.requests,
+			Errors:    usage.errors,
+			Tokens:    usage.tokens,
+			CostUSD:   tokenCost(usage.tokens, s.cfg.Vectorizer.Price(model)),
+			LatencyMS: usage.latency.Milliseconds(),
+			At:        time.Now().UTC(),
+		}
+
+		envelope := s.producer.BuildEmbeddingUsageEnvelope(event)
+		if err := s.producer.PublishEvent(context.WithoutCancel(ctx), []byte(model), envelope); err != nil {
+			s.logger.Warn("Failed to publish usage event", "run_id", run.RunID, "model", model, "error", err)
+		}
+	}
+}
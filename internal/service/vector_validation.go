@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// ErrInvalidVector is wrapped by the errors of vectors rejected before
+// storage, which a provider glitch would otherwise leave in the index.
+var ErrInvalidVector = errors.New("invalid vector")
+
+// validateVector checks that v has dim components, all finite and not all
+// zero.
+func validateVector(v []float32, dim int) error {
+	if len(v) != dim {
+		return fmt.Errorf("%w: %d dimensions, want %d", ErrInvalidVector, len(v), dim)
+	}
+
+	zero := true
+	for i, x := range v {
+		switch {
+		case math.IsNaN(float64(x)):
+			return fmt.Errorf("%w: NaN at component %d", ErrInvalidVector, i)
+		case math.IsInf(float64(x), 0):
+			return fmt.Errorf("%w: infinite value at component %d", ErrInvalidVector, i)
+		case x != 0:
+			zero = false
+		}
+	}
+	if zero {
+		return fmt.Errorf("%w: all components are zero", ErrInvalidVector)
+	}
+
+	return nil
+}
+
+// checkVector validates the vectors of one row. Response, title and
+// translation vectors are optional, and so is the content vector of response backfills.
+func (s *VectorizeService) checkVector(vector *storage.Vector, requireContent bool) error {
+	dim := s.cfg.Vectorizer.MaxVectorLength
+
+	if requireContent || vector.ContentVec != nil {
+		if err := validateVector(vector.ContentVec, dim); err != nil {
+			return fmt.Errorf("content vector of chunk %d: %w", vector.ChunkIndex, err)
+		}
+	}
+	if vector.ResponseVec != nil {
+		if err := validateVector(vector.ResponseVec, dim); err != nil {
+			return fmt.Errorf("response vector: %w", err)
+		}
+	}
+	if vector.TitleVec != nil {
+		if err := validateVector(vector.TitleVec, dim); err != nil {
+			return fmt.Errorf("title vector: %w", err)
+		}
+	}
+	if vector.ContentENVec != nil {
+		if err := validateVector(vector.ContentENVec, dim); err != nil {
+			return fmt.Errorf("translation vector: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rejectedReview is a review whose vectors failed validation, with the first
+// of its rows.
+type rejectedReview struct {
+	vector *storage.Vector
+	err    error
+}
+
+// rejectInvalidVectors splits vectors into those of reviews whose rows are
+// all valid and the reviews with an invalid row, which are left out whole so
+// that their chunks stay together.
+func (s *VectorizeService) rejectInvalidVectors(vectors []*storage.Vector, requireContent bool) ([]*storage.Vector, []rejectedReview) {
+	var rejected []rejectedReview
+	valid := vectors[:0:0]
+
+	for _, group := range groupByReview(vectors) {
+		var err error
+		for _, vector := range group {
+			if err = s.checkVector(vector, requireContent); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			rejected = append(rejected, rejectedReview{vector: group[0], err: err})
+			continue
+		}
+		valid = append(valid, group...)
+	}
+
+	return valid, rejected
+}
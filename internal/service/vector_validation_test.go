@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+func TestValidateVector(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+
+	tests := []struct {
+		name    string
+		v       []float32
+		wantErr bool
+	}{
+		{"valid", []float32{0.1, 0, -0.2}, false},
+		{"single nonzero component", []float32{0, 0, 1e-9}, false},
+		{"NaN", []float32{0.1, nan, 0.2}, true},
+		{"positive infinity", []float32{inf, 0.1, 0.2}, true},
+		{"negative infinity", []float32{0.1, 0.2, -inf}, true},
+		{"all zero", []float32{0, 0, 0}, true},
+		{"too few dimensions", []float32{0.1, 0.2}, true},
+		{"too many dimensions", []float32{0.1, 0.2, 0.3, 0.4}, true},
+		{"missing", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVector(tt.v, 3)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidVector) {
+					t.Errorf("validateVector(%v) = %v, want ErrInvalidVector", tt.v, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("validateVector(%v) = %v, want nil", tt.v, err)
+			}
+		})
+	}
+}
+
+func TestRejectInvalidVectors(t *testing.T) {
+	valid := []float32{0.1, 0.2, 0.3}
+	zero := []float32{0, 0, 0}
+	short := []float32{0.1, 0.2}
+
+	row := func(reviewID string, chunk int, content, response []float32) *storage.Vector {
+		vector := storage.NewVector(reviewID, "app", content)
+		vector.ChunkIndex = chunk
+		vector.ResponseVec = response
+		return vector
+	}
+
+	tests := []struct {
+		name           string
+		vectors        []*storage.Vector
+		requireContent bool
+		wantValid      []string
+		wantRejected   []string
+	}{
+		{
+			name: "all valid",
+			vectors: []*storage.Vector{
+				row("r1", 0, valid, valid),
+				row("r2", 0, valid, nil),
+			},
+			requireContent: true,
+			wantValid:      []string{"r1", "r2"},
+		},
+		{
+			name: "invalid content",
+			vectors: []*storage.Vector{
+				row("r1", 0, valid, nil),
+				row("r2", 0, zero, nil),
+				row("r3", 0, valid, nil),
+			},
+			requireContent: true,
+			wantValid:      []string{"r1", "r3"},
+			wantRejected:   []string{"r2"},
+		},
+		{
+			name: "invalid response",
+			vectors: []*storage.Vector{
+				row("r1", 0, valid, short),
+				row("r2", 0, valid, valid),
+			},
+			requireContent: true,
+			wantValid:      []string{"r2"},
+			wantRejected:   []string{"r1"},
+		},
+		{
+			name: "one invalid chunk rejects the whole review",
+			vectors: []*storage.Vector{
+				row("r1", 0, valid, valid),
+				row("r1", 1, valid, nil),
+				row("r1", 2, short, nil),
+				row("r2", 0, valid, nil),
+			},
+			requireContent: true,
+			wantValid:      []string{"r2"},
+			wantRejected:   []string{"r1"},
+		},
+		{
+			name: "missing content",
+			vectors: []*storage.Vector{
+				row("r1", 0, nil, valid),
+			},
+			requireContent: true,
+			wantRejected:   []string{"r1"},
+		},
+		{
+			name: "response backfill without content",
+			vectors: []*storage.Vector{
+				row("r1", 0, nil, valid),
+				row("r2", 0, nil, zero),
+			},
+			wantValid:    []string{"r1"},
+			wantRejected: []string{"r2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Vectorizer.MaxVectorLength = 3
+			s := &VectorizeService{cfg: cfg}
+
+			vectors, rejected := s.rejectInvalidVectors(tt.vectors, tt.requireContent)
+
+			var validIDs, rejectedIDs []string
+			for _, vector := range vectors {
+				if !slices.Contains(validIDs, vector.ReviewID) {
+					validIDs = append(validIDs, vector.ReviewID)
+				}
+			}
+			for _, review := range rejected {
+				rejectedIDs = append(rejectedIDs, review.vector.ReviewID)
+				if !errors.Is(review.err, ErrInvalidVector) {
+					t.Errorf("review %s was rejected with %v, want ErrInvalidVector", review.vector.ReviewID, review.err)
+				}
+			}
+
+			if !slices.Equal(validIDs, tt.wantValid) {
+				t.Errorf("valid reviews = %v, want %v", validIDs, tt.wantValid)
+			}
+			if !slices.Equal(rejectedIDs, tt.wantRejected) {
+				t.Errorf("rejected reviews = %v, want %v", rejectedIDs, tt.wantRejected)
+			}
+			for _, vector := range vectors {
+				if slices.Contains(rejectedIDs, vector.ReviewID) {
+					t.Errorf("a row of rejected review %s was kept", vector.ReviewID)
+				}
+			}
+		})
+	}
+}
@@ -2,308 +2,1067 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/quiby-ai/common/pkg/events"
 	"github.com/quiby-ai/review-vectorizer/config"
+	"github.com/quiby-ai/review-vectorizer/internal/payloads"
+	"github.com/quiby-ai/review-vectorizer/internal/preprocess"
 	"github.com/quiby-ai/review-vectorizer/internal/producer"
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
 	"github.com/quiby-ai/review-vectorizer/internal/storage"
+	"github.com/quiby-ai/review-vectorizer/internal/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 )
 
+// ErrRunInProgress is returned by RunOnce when another run for the same app
+// already holds the run lock.
+var ErrRunInProgress = errors.New("vectorization run already in progress")
+
+// ErrRunCancelled is returned by RunOnce when the run was stopped by a
+// cancellation request. The run keeps its checkpoint and resumes when its
+// saga is requested again.
+var ErrRunCancelled = errors.New("vectorization run cancelled")
+
+// ErrDeadlineReached is returned by RunOnce when the request's deadline was
+// about to pass, less processing.deadline_margin. Like a cancelled run, the
+// run keeps its checkpoint and resumes when its saga is requested again.
+var ErrDeadlineReached = errors.New("vectorization run reached its deadline")
+
+// ErrResponsesDisabled is returned for response backfill runs while
+// vectorizer.embed_responses is off.
+var ErrResponsesDisabled = errors.New("response embedding is disabled by vectorizer.embed_responses")
+
+// ErrInvalidSamplePercent is returned for runs whose sample percent is not
+// between 0 and 100.
+var ErrInvalidSamplePercent = errors.New("sample percent must be between 0 and 100")
+
 type VectorizeRequest struct {
-	ForceRecompute bool
-	Limit          int
-	AppID          string
-	Countries      []string
-	Languages      []string
-	DateFrom       string
-	DateTo         string
+	SagaID           string
+	TenantID         string
+	ForceRecompute   bool
+	OnlyFailed       bool
+	StaleModel       bool
+	ResponseBackfill bool
+	Incremental      bool
+	DryRun           bool
+	Limit            int
+	AppID            string
+	Countries        []string
+	Languages        []string
+	DateFrom         string
+	DateTo           string
+	MinRating        int
+	MaxRating        int
+	ReviewIDs        []string
+	OnlyWithResponse bool
+	// Order is the order reviews are processed in, one of the storage
+	// Order constants.
+	Order string
+	// SamplePercent confines the run to a sample of the matching reviews,
+	// picked reproducibly by SampleSeed.
+	SamplePercent float64
+	SampleSeed    int64
+	// Partitioned confines the run to the apps of the partitions the replica
+	// owns when partitioning is enabled, for events every replica receives.
+	// RunOnce fills in Partitions and PartitionCount.
+	Partitioned    bool
+	Partitions     []int
+	PartitionCount int
+	// Priority ranks the run's batches in the embedding queue.
+	Priority Priority
+	// Deadline, when set, stops the run processing.deadline_margin before
+	// it with ErrDeadlineReached.
+	Deadline time.Time
+
+	// outcome, when set, returns the event announcing how the run ended, or
+	// nil for none. It is queued in the outbox with the run's final state.
+	outcome func(result VectorizeResult, runErr error) *events.Envelope[any]
 }
 
+// filters returns the storage filters for the request; model is the
+// configured embedding model, against which stale_model compares.
+func (r VectorizeRequest) filters(model string) storage.CleanReviewFilters {
+	return storage.CleanReviewFilters{
+		ForceRecompute:   r.ForceRecompute,
+		OnlyFailed:       r.OnlyFailed,
+		StaleModel:       r.StaleModel,
+		ResponseBackfill: r.ResponseBackfill,
+		Model:            model,
+		TenantID:         r.TenantID,
+		AppID:            r.AppID,
+		Countries:        r.Countries,
+		Languages:        r.Languages,
+		DateFrom:         r.DateFrom,
+		DateTo:           r.DateTo,
+		MinRating:        r.MinRating,
+		MaxRating:        r.MaxRating,
+		ReviewIDs:        r.ReviewIDs,
+		OnlyWithResponse: r.OnlyWithResponse,
+		Order:            r.Order,
+		SamplePercent:    r.SamplePercent,
+		SampleSeed:       r.SampleSeed,
+		Partitions:       r.Partitions,
+		PartitionCount:   r.PartitionCount,
+	}
+}
+
+// Reasons a review is skipped instead of vectorized.
+const (
+	SkipReasonAlreadyEmbedded    = "already_embedded"
+	SkipReasonEmptyText          = "empty_text"
+	SkipReasonFilteredOut        = "filtered_out"
+	SkipReasonMissingTranslation = "missing_translation"
+	// SkipReasonLowContent is given for texts too thin or garbled to be
+	// worth embedding, see the preprocessing content thresholds.
+	SkipReasonLowContent = "low_content"
+	// SkipReasonUnsupportedLanguage is given for reviews in a language
+	// preprocessing.allowed_languages or denied_languages rule out.
+	SkipReasonUnsupportedLanguage = "unsupported_language"
+	// SkipReasonUnchanged is given for reviews whose stored embedding was
+	// made with the current model from the same texts and settings.
+	SkipReasonUnchanged = "unchanged"
+	// SkipReasonNotFound is given for a single review that is not in
+	// clean_reviews, or not contentful.
+	SkipReasonNotFound = "not_found"
+)
+
+// Reasons a review fails to be vectorized, telling the orchestrator whether a
+// retry may help.
+const (
+	// FailureReasonTokenLimit is given when the text exceeds the model's
+	// context; retrying does not help.
+	FailureReasonTokenLimit = "token_limit"
+	// FailureReasonEmptyText is given when the provider rejects the text as
+	// empty. Reviews with no text at all are skipped instead.
+	FailureReasonEmptyText     = "empty_text"
+	FailureReasonProviderError = "provider_error"
+	FailureReasonInvalidVector = "invalid_vector"
+	FailureReasonDBError       = "db_error"
+)
+
+// maxFailedReviewIDs caps the failing review IDs a result lists; the rest are
+// only counted.
+const maxFailedReviewIDs = 100
+
 type VectorizeResult struct {
-	Processed int      `json:"processed"`
-	Skipped   int      `json:"skipped"`
-	Failed    int      `json:"failed"`
-	ReviewIDs []string `json:"review_ids"`
+	RunID          string         `json:"run_id"`
+	Processed      int            `json:"processed"`
+	Skipped        int            `json:"skipped"`
+	Failed         int            `json:"failed"`
+	SkippedReasons map[string]int `json:"skipped_reasons,omitempty"`
+	FailedReasons  map[string]int `json:"failed_reasons,omitempty"`
+	// FailedReviewIDs lists the first failing reviews, up to 100.
+	FailedReviewIDs []string `json:"failed_review_ids,omitempty"`
+	// Tokens and CostUSD are what the provider billed for the run's
+	// embeddings, priced by vectorizer.pricing.
+	Tokens  int64   `json:"tokens,omitempty"`
+	CostUSD float64 `json:"cost_usd,omitempty"`
+	// Deferred counts the reviews left for later by a run stopped at a
+	// quota or at its deadline.
+	Deferred int `json:"deferred,omitempty"`
+
+	// Estimate is only set by dry runs, which process nothing.
+	Estimate *payloads.CostEstimate `json:"estimate,omitempty"`
+
+	// queued reports that the request's outcome event was queued in the
+	// outbox together with the run's final state.
+	queued bool
+	// bundle is the run bundle written under artifacts.destination, if any.
+	bundle *runBundle
+}
+
+func (r *VectorizeResult) skip(reason string, count int) {
+	if count == 0 {
+		return
+	}
+	if r.SkippedReasons == nil {
+		r.SkippedReasons = make(map[string]int)
+	}
+	r.SkippedReasons[reason] += count
+	r.Skipped += count
+}
+
+// fail counts the reviews of reviewErrors as failed, by reason.
+func (r *VectorizeResult) fail(reviewErrors []storage.ReviewError) {
+	for _, reviewError := range reviewErrors {
+		if r.FailedReasons == nil {
+			r.FailedReasons = make(map[string]int)
+		}
+		r.FailedReasons[failureReason(reviewError)]++
+		if len(r.FailedReviewIDs) < maxFailedReviewIDs {
+			r.FailedReviewIDs = append(r.FailedReviewIDs, reviewError.ReviewID)
+		}
+		r.Failed++
+	}
 }
 
 type VectorizeService struct {
 	repo     storage.Repository
-	embedder Embedder
 	cfg      *config.Config
 	logger   *slog.Logger
 	producer *producer.Producer
+	tuner    *tuner
+	model    atomic.Pointer[embeddingModel]
+	flags    atomic.Pointer[config.FlagsConfig]
+	// shadow embeds a sample of reviews with the candidate model of shadow
+	// mode; nil when shadow mode is off.
+	shadow Embedder
+	// sharedCache remembers embedded texts across runs and replicas; nil
+	// without cache.redis_url.
+	sharedCache *redisCache
+	// partitions is the replica's share of the app partitions; nil until
+	// WatchPartitions first assigns them.
+	partitions atomic.Pointer[partitionAssignment]
+	// queue hands out embedding slots by priority; nil without
+	// processing.embed_slots.
+	queue *jobQueue
+	// backpressure paces writes by the database load; nil without
+	// thresholds.
+	backpressure *backpressure
+	// preprocessor cleans texts before they are embedded.
+	preprocessor *preprocess.Pipeline
+	// redactor replaces personal data in the texts sent to the embedders;
+	// nil without redaction.enabled.
+	redactor *preprocess.Redactor
+	// maintenance caches the maintenance mode, see InMaintenance.
+	maintenance maintenanceMode
+	// sizer adapts the batch size of every model; nil without
+	// vectorizer.autotune.enabled.
+	sizer *batchSizer
+	// sparse makes the sparse companions of content vectors; nil without
+	// sparse.enabled.
+	sparse SparseEmbedder
+	// reranker reorders the hits of text searches asking for it; nil
+	// without rerank.provider.
+	reranker Reranker
+	// throttle holds every embedder of the service to openai.rate_limit.
+	throttle *rateLimiter
 }
 
-func NewVectorizeService(repo storage.Repository, cfg *config.Config, logger *slog.Logger, producer *producer.Producer) *VectorizeService {
-	var embedder Embedder
+func NewVectorizeService(repo storage.Repository, cfg *config.Config, logger *slog.Logger, producer *producer.Producer) (*VectorizeService, error) {
+	// Never send unredacted texts out.
+	redactor, err := preprocess.NewRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up redaction: %w", err)
+	}
 
-	if cfg.OpenAI.APIKey != "" {
-		openAIClient, err := NewOpenAIClient(OpenAIConfig{
-			APIKey:     cfg.OpenAI.APIKey,
-			BaseURL:    cfg.OpenAI.BaseURL,
-			Model:      cfg.OpenAI.Model,
-			MaxRetries: cfg.OpenAI.MaxRetries,
-			Timeout:    cfg.OpenAI.Timeout,
-		})
-		if err != nil {
-			logger.Warn("Failed to initialize OpenAI client, falling back to stub", "error", err)
-			embedder = NewStubEmbedder(cfg.Vectorizer.MaxVectorLength, logger)
-		} else {
-			embedder = NewOpenAIEmbedder(openAIClient, logger)
+	switch cfg.Vectorizer.TextSource {
+	case storage.TextSourceContentClean, storage.TextSourceContentEN, storage.TextSourceContentENFallback:
+	default:
+		if cfg.Vectorizer.TextSource != "" {
+			logger.Warn("Unknown text source, embedding content_clean", "text_source", cfg.Vectorizer.TextSource)
 		}
-	} else {
-		logger.Info("No OpenAI API key provided, using stub embedder")
-		embedder = NewStubEmbedder(cfg.Vectorizer.MaxVectorLength, logger)
+		cfg.Vectorizer.TextSource = storage.TextSourceContentClean
 	}
 
-	return &VectorizeService{
+	s := &VectorizeService{
 		repo:     repo,
-		embedder: embedder,
 		cfg:      cfg,
 		logger:   logger,
 		producer: producer,
+		tuner:    newTuner(tuningFrom(cfg)),
+		queue:    newJobQueue(cfg.Processing.EmbedSlots),
+		redactor: redactor,
+	}
+	s.preprocessor = preprocess.New(cfg.Preprocessing)
+	s.throttle = newRateLimiter(cfg.OpenAI.RateLimit, repo, logger)
+	cfg.OpenAI.Throttle = s.throttle.wait
+	s.backpressure = newBackpressure(repo, cfg.Backpressure, logger)
+	s.sizer = newBatchSizer(cfg.Vectorizer.Autotune, s.tuner.get().BatchSize, logger)
+	s.sparse = newSparseEmbedder(cfg, redactor)
+	s.reranker = newReranker(cfg, redactor)
+	s.model.Store(&embeddingModel{name: cfg.Vectorizer.Model, embedder: newEmbedder(cfg, cfg.OpenAI.Model, redactor, logger)})
+	flags := cfg.Flags
+	s.flags.Store(&flags)
+	if cfg.Shadow.Enabled {
+		s.shadow = newEmbedder(cfg, cfg.Shadow.Model, redactor, logger.With("shadow_model", cfg.Shadow.Model))
+	}
+
+	sharedCache, err := newRedisCache(cfg.Cache, logger)
+	if err != nil {
+		logger.Warn("Failed to set up the shared embedding cache, caching within runs only", "error", err)
+	} else if sharedCache != nil {
+		s.sharedCache = sharedCache
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			sharedCache.checkEvictionPolicy(ctx)
+		}()
+	}
+
+	return s, nil
+}
+
+// newEmbedder returns the embedder of model, redacting personal data from
+// its inputs with redactor, if any, and then wrapping them in the model's
+// input template, if it has one.
+func newEmbedder(cfg *config.Config, model string, redactor *preprocess.Redactor, logger *slog.Logger) Embedder {
+	embedder := newProviderEmbedder(cfg, model, logger)
+	if template, ok := cfg.Vectorizer.InputTemplate(model); ok {
+		embedder = &templatedEmbedder{Embedder: embedder, template: template}
+	}
+	if redactor == nil {
+		return embedder
 	}
+	return &redactingEmbedder{Embedder: embedder, redactor: redactor, logger: logger}
+}
+
+func newProviderEmbedder(cfg *config.Config, model string, logger *slog.Logger) Embedder {
+	if cfg.OpenAI.APIKey == "" {
+		logger.Info("No OpenAI API key provided, using stub embedder")
+		return NewStubEmbedder(cfg.Vectorizer.MaxVectorLength, logger)
+	}
+
+	// Larger text-embedding-3 models are shortened to fit the vector
+	// columns.
+	var dimensions int
+	if strings.HasPrefix(model, "text-embedding-3") {
+		dimensions = cfg.Vectorizer.MaxVectorLength
+	}
+
+	policy := retry.New(cfg.Retry, retryableProviderError)
+	if cfg.OpenAI.MaxRetries > 0 {
+		// openai.max_retries predates the retry section and still wins
+		// where it is set.
+		policy.MaxAttempts = cfg.OpenAI.MaxRetries + 1
+	}
+
+	openAIClient, err := NewOpenAIClient(OpenAIConfig{
+		APIKey:       cfg.OpenAI.APIKey,
+		APIKeySource: cfg.OpenAI.APIKeySource,
+		Throttle:     cfg.OpenAI.Throttle,
+		BaseURL:      cfg.OpenAI.BaseURL,
+		Model:        model,
+		Retry:        policy,
+		Timeout:      cfg.OpenAI.Timeout,
+		Dimensions:   dimensions,
+	}, logger)
+	if err != nil {
+		logger.Warn("Failed to initialize OpenAI client, falling back to stub", "error", err)
+		return NewStubEmbedder(cfg.Vectorizer.MaxVectorLength, logger)
+	}
+	return NewOpenAIEmbedder(openAIClient, logger)
 }
 
 func (s *VectorizeService) RunOnce(ctx context.Context, req VectorizeRequest) (VectorizeResult, error) {
+	req, err := s.partitionRequest(req)
+	if err != nil {
+		return VectorizeResult{}, err
+	}
+	ctx = WithPriority(ctx, req.Priority)
+
+	if req.ResponseBackfill && !s.cfg.Vectorizer.EmbedResponses {
+		return VectorizeResult{}, newFailure(events.FailedCodeValidationError, false, ErrResponsesDisabled)
+	}
+	if !(req.SamplePercent >= 0 && req.SamplePercent <= 100) {
+		return VectorizeResult{}, newFailure(events.FailedCodeValidationError, false,
+			fmt.Errorf("%w, got %v", ErrInvalidSamplePercent, req.SamplePercent))
+	}
+
+	if !req.Deadline.IsZero() {
+		stopAt := req.Deadline.Add(-s.cfg.Processing.DeadlineMargin)
+		if !time.Now().Before(stopAt) {
+			return VectorizeResult{}, ErrDeadlineReached
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, stopAt, ErrDeadlineReached)
+		defer cancel()
+	}
+
+	if req.DryRun {
+		estimate, err := s.Estimate(ctx, req)
+		if err != nil {
+			return VectorizeResult{}, newFailure(events.FailedCodeSourceUnavailable, true, err)
+		}
+
+		s.logger.Info("Dry run estimate",
+			"model", estimate.Model,
+			"reviews", estimate.Reviews,
+			"responses", estimate.Responses,
+			"estimated_tokens", estimate.EstimatedTokens,
+			"estimated_cost_usd", estimate.EstimatedCostUSD)
+		return VectorizeResult{Estimate: &estimate}, nil
+	}
+
+	ctx, span := telemetry.Tracer().Start(ctx, "vectorize.run", trace.WithAttributes(
+		attribute.String("app.id", req.AppID),
+		attribute.String("saga.id", req.SagaID),
+	))
+	defer span.End()
+
+	lockKey := runLockKey(req)
+	release, acquired, err := s.repo.TryAdvisoryLock(ctx, lockKey)
+	if err != nil {
+		return VectorizeResult{}, newFailure(events.FailedCodeTempStorageUnavailable, true, fmt.Errorf("failed to take run lock: %w", err))
+	}
+	if !acquired {
+		return VectorizeResult{}, ErrRunInProgress
+	}
+	defer release()
+
 	startTime := time.Now()
 
 	batchSize := s.determineBatchSize(req.Limit)
 
+	run, err := s.startRun(ctx, req)
+	if err != nil {
+		return VectorizeResult{}, newFailure(events.FailedCodeTempStorageUnavailable, true, err)
+	}
+
 	s.logger.Info("Starting vectorization run",
+		"run_id", run.RunID,
 		"batch_size", batchSize,
 		"force_recompute", req.ForceRecompute,
-		"model", s.cfg.Vectorizer.Model,
+		"model", s.currentModel().name,
 		"dim", s.cfg.Vectorizer.MaxVectorLength)
 
-	result, err := s.processAllReviews(ctx, req, batchSize)
+	span.SetAttributes(attribute.String("run.id", run.RunID))
+
+	result, err := s.runPipeline(ctx, run, max(req.Limit, 0))
+	result.RunID = run.RunID
+	result.queued = s.finishRun(ctx, req, run, &result, err)
+	span.SetAttributes(
+		attribute.Int("run.processed", result.Processed),
+		attribute.Int("run.skipped", result.Skipped),
+		attribute.Int("run.failed", result.Failed),
+	)
 	if err != nil {
-		return VectorizeResult{}, fmt.Errorf("failed to process reviews: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return result, fmt.Errorf("failed to process reviews: %w", err)
 	}
 
 	duration := time.Since(startTime)
 	s.logger.Info("Vectorization run completed",
+		"run_id", run.RunID,
 		"duration", duration,
 		"processed", result.Processed,
 		"skipped", result.Skipped,
+		"skipped_reasons", result.SkippedReasons,
 		"failed", result.Failed)
 
 	return result, nil
 }
 
-func (s *VectorizeService) determineBatchSize(limit int) int {
-	if limit > 0 {
-		return limit
-	}
-	return s.cfg.Vectorizer.BatchSize
+// VectorizeReviews re-embeds the given reviews, as announced by change data
+// capture. The reviews may already have embeddings of an earlier version of
+// their text, so they are recomputed.
+func (s *VectorizeService) VectorizeReviews(ctx context.Context, reviewIDs []string) (VectorizeResult, error) {
+	return s.RunOnce(ctx, VectorizeRequest{
+		ReviewIDs:      reviewIDs,
+		ForceRecompute: true,
+		Partitioned:    true,
+		Priority:       PriorityRequest,
+	})
 }
 
-func (s *VectorizeService) processAllReviews(ctx context.Context, req VectorizeRequest, batchSize int) (VectorizeResult, error) {
-	result := VectorizeResult{}
-	offset := 0
-	totalProcessed := 0
+// startRun resumes the saga's unfinished run when there is one, so a
+// redelivered or restarted saga continues from its checkpoint, and creates a
+// new run otherwise.
+func (s *VectorizeService) startRun(ctx context.Context, req VectorizeRequest) (*storage.Run, error) {
+	if req.SagaID != "" {
+		run, err := s.repo.GetResumableRun(ctx, req.SagaID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up resumable run: %w", err)
+		}
+
+		if run != nil {
+			run.Status = storage.RunStatusRunning
+			run.Error = ""
+			run.FinishedAt = nil
+			if err := s.repo.UpdateRun(ctx, run); err != nil {
+				return nil, fmt.Errorf("failed to resume run: %w", err)
+			}
 
-	filters := storage.CleanReviewFilters{
-		ForceRecompute: req.ForceRecompute,
-		AppID:          req.AppID,
-		Countries:      req.Countries,
-		Languages:      req.Languages,
-		DateFrom:       req.DateFrom,
-		DateTo:         req.DateTo,
+			s.logger.Info("Resuming run from checkpoint",
+				"run_id", run.RunID,
+				"saga_id", run.SagaID,
+				"checkpoint", run.Checkpoint,
+				"processed", run.Processed)
+			return run, nil
+		}
 	}
 
-	for {
-		reviews, err := s.repo.GetCleanReviewsForVectorization(ctx, filters, batchSize, offset)
+	filters := req.filters(s.currentModel().name)
+
+	var watermark *time.Time
+	if req.Incremental {
+		var err error
+		filters.ReviewedAfter, err = s.repo.GetWatermark(ctx, storage.WatermarkScope(filters))
 		if err != nil {
-			return result, fmt.Errorf("failed to fetch reviews batch at offset %d: %w", offset, err)
+			return nil, fmt.Errorf("failed to load watermark: %w", err)
 		}
 
-		if len(reviews) == 0 {
-			s.logger.Info("No more reviews to process", "total_processed", totalProcessed)
-			break
+		// Reviews newer than this may arrive while the run pages through the
+		// older ones, so only this point is safe to advance the watermark to.
+		watermark, err = s.repo.GetLatestReviewedAt(ctx, filters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine new watermark: %w", err)
 		}
 
-		s.logger.Info("Processing batch of reviews",
-			"batch_size", len(reviews),
-			"offset", offset,
-			"total_processed", totalProcessed)
+		s.logger.Info("Incremental run",
+			"reviewed_after", filters.ReviewedAfter,
+			"watermark", watermark)
+	}
 
-		batchResult := s.processReviewsInBatches(ctx, reviews)
+	run := storage.NewRun(req.SagaID, filters)
+	run.Watermark = watermark
+	if err := s.repo.CreateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to create run: %w", err)
+	}
 
-		result.Processed += batchResult.Processed
-		result.Skipped += batchResult.Skipped
-		result.Failed += batchResult.Failed
-		result.ReviewIDs = append(result.ReviewIDs, batchResult.ReviewIDs...)
+	return run, nil
+}
 
-		totalProcessed += len(reviews)
+// finishRun records the final state of the run, together with the request's
+// outcome event, and reports whether the event was queued. A completed saga
+// run first gets its bundle written, for the event to reference. It uses a
+// context detached from cancellation so a run interrupted by shutdown is
+// still marked failed.
+func (s *VectorizeService) finishRun(ctx context.Context, req VectorizeRequest, run *storage.Run, result *VectorizeResult, runErr error) bool {
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Processed = result.Processed
+	run.Skipped = result.Skipped
+	run.Failed = result.Failed
+	run.Status = storage.RunStatusCompleted
+	switch {
+	case errors.Is(runErr, ErrRunCancelled):
+		run.Status = storage.RunStatusCancelled
+	case errors.Is(runErr, ErrQuotaExceeded):
+		run.Status = storage.RunStatusDeferred
+		run.Error = runErr.Error()
+	case errors.Is(runErr, ErrDeadlineReached):
+		run.Status = storage.RunStatusFailed
+		run.Error = runErr.Error()
+	case runErr != nil:
+		run.Status = storage.RunStatusFailed
+		run.Error = runErr.Error()
+		if ctx.Err() == nil {
+			// Runs interrupted by shutdown resume after the restart.
+			telemetry.ReportError(ctx, "run_failed", runErr, runTags(run), map[string]any{"filters": run.Filters})
+		}
+	}
 
-		if len(reviews) < batchSize {
-			s.logger.Info("Reached end of reviews", "total_processed", totalProcessed)
-			break
+	if run.Status == storage.RunStatusCompleted && run.SagaID != "" && s.cfg.Artifacts.Destination != "" {
+		bundle, err := s.writeRunBundle(ctx, run, *result)
+		if err != nil {
+			// The completed event falls back to the processed review IDs
+			// recorded in Postgres.
+			s.logger.Warn("Failed to write run bundle", "run_id", run.RunID, "saga_id", run.SagaID, "error", err)
 		}
+		result.bundle = bundle
+	}
 
-		offset += batchSize
+	messages := s.outboxMessages(ctx, req, *result, runErr)
+	queued := len(messages) > 0
+	if m := s.quotaExceededMessage(ctx, req, run, *result, runErr); m != nil {
+		messages = append(messages, *m)
+	}
+	if err := s.repo.FinishRun(context.WithoutCancel(ctx), run, messages); err != nil {
+		s.logger.Error("Failed to record run result", "run_id", run.RunID, "status", run.Status, "error", err)
+		queued = false
+	}
+	if run.Filters.ForceRecompute {
+		s.audit(ctx, storage.AuditEntry{
+			Operation: storage.AuditForceRecompute,
+			SagaID:    run.SagaID,
+			Filters:   auditFilters(run.Filters),
+			Affected:  int64(result.Processed),
+			Error:     run.Error,
+		})
+	}
 
-		select {
-		case <-ctx.Done():
-			s.logger.Info("Context cancelled, stopping review processing", "total_processed", totalProcessed)
-			return result, ctx.Err()
-		default:
+	if run.Status == storage.RunStatusCompleted && run.Watermark != nil {
+		scope := storage.WatermarkScope(run.Filters)
+		if err := s.repo.SetWatermark(context.WithoutCancel(ctx), scope, *run.Watermark); err != nil {
+			s.logger.Error("Failed to advance watermark", "run_id", run.RunID, "scope", scope, "error", err)
 		}
 	}
 
-	return result, nil
+	return queued
 }
 
-func (s *VectorizeService) processReviewsInBatches(ctx context.Context, reviews []storage.CleanReview) VectorizeResult {
-	result := VectorizeResult{}
-	batchSize := s.cfg.Vectorizer.BatchSize
-
-	for i := 0; i < len(reviews); i += batchSize {
-		end := min(i+batchSize, len(reviews))
-
-		batch := reviews[i:end]
-		batchResult, err := s.processBatch(ctx, batch)
-		if err != nil {
-			s.logger.Error("Failed to process batch", "batch_start", i, "batch_end", end, "error", err)
-			result.Failed += len(batch)
-			continue
-		}
+// runTags identifies a run in error reports.
+func runTags(run *storage.Run) map[string]string {
+	return map[string]string{
+		"saga_id":   run.SagaID,
+		"run_id":    run.RunID,
+		"app_id":    run.AppID,
+		"tenant_id": run.Filters.TenantID,
+	}
+}
 
-		result.Processed += batchResult.Processed
-		result.Skipped += batchResult.Skipped
-		result.Failed += batchResult.Failed
-		result.ReviewIDs = append(result.ReviewIDs, batchResult.ReviewIDs...)
+// quotaExceededMessage encodes the pipeline.vectorize_reviews.quota_exceeded
+// event of a run stopped at a quota, whoever requested it, or returns nil.
+func (s *VectorizeService) quotaExceededMessage(ctx context.Context, req VectorizeRequest, run *storage.Run, result VectorizeResult, runErr error) *storage.OutboxMessage {
+	var exceeded *QuotaExceededError
+	if s.producer == nil || !errors.As(runErr, &exceeded) {
+		return nil
 	}
 
-	return result
+	event := payloads.QuotaExceeded{
+		AppID:         req.AppID,
+		TenantID:      req.TenantID,
+		RunID:         run.RunID,
+		QuotaAppID:    exceeded.Quota.AppID,
+		QuotaTenantID: exceeded.Quota.TenantID,
+		Limit:         exceeded.Limit,
+		Used:          exceeded.Used,
+		Max:           exceeded.Max,
+		Processed:     result.Processed,
+		Deferred:      result.Deferred,
+	}
+	m, err := s.producer.NewOutboxMessage(ctx, []byte(run.RunID), s.producer.BuildQuotaExceededEnvelope(event, req.SagaID))
+	if err != nil {
+		s.logger.Error("Failed to encode quota exceeded event", "error", err, "run_id", run.RunID)
+		return nil
+	}
+	return &m
 }
 
-func (s *VectorizeService) processBatch(ctx context.Context, reviews []storage.CleanReview) (VectorizeResult, error) {
-	if len(reviews) == 0 {
-		return VectorizeResult{}, nil
+// outboxMessages encodes the request's outcome event, if it has one, for
+// finishRun to queue.
+func (s *VectorizeService) outboxMessages(ctx context.Context, req VectorizeRequest, result VectorizeResult, runErr error) []storage.OutboxMessage {
+	if req.outcome == nil || s.producer == nil {
+		return nil
 	}
 
-	batchStart := time.Now()
-	s.logger.Debug("Processing batch", "count", len(reviews))
+	envelope := req.outcome(result, runErr)
+	if envelope == nil {
+		return nil
+	}
 
-	contentTexts, responseTexts := s.prepareTexts(reviews)
+	m, err := s.producer.NewOutboxMessage(ctx, []byte(req.SagaID), *envelope)
+	if err != nil {
+		s.logger.Error("Failed to encode outcome event", "error", err, "saga_id", req.SagaID)
+		return nil
+	}
 
-	if len(contentTexts) == 0 {
-		s.logger.Debug("No valid content texts in batch")
-		return VectorizeResult{}, nil
+	return []storage.OutboxMessage{m}
+}
+
+// runLockKey scopes the run lock to the requested tenant, partitions and
+// app so runs for different apps proceed in parallel, while unscoped runs
+// serialize with each other. An unscoped run and a run for one app take
+// different locks and may overlap, at worst embedding some reviews twice.
+func runLockKey(req VectorizeRequest) string {
+	key := "review-vectorizer:"
+	if req.TenantID != "" {
+		key += "tenant:" + req.TenantID + ":"
+	}
+	if req.PartitionCount > 0 {
+		key += "partitions:" + storage.PartitionScope(req.Partitions, req.PartitionCount) + ":"
+	}
+	if req.AppID != "" {
+		return key + "app:" + req.AppID
 	}
+	return key + "all"
+}
 
-	contentVectors, responseVectors, err := s.generateEmbeddings(ctx, contentTexts, responseTexts)
-	if err != nil {
-		return VectorizeResult{}, err
+func (s *VectorizeService) determineBatchSize(limit int) int {
+	if limit > 0 {
+		return limit
 	}
+	return s.tuner.get().BatchSize
+}
 
-	result := s.storeVectors(ctx, reviews, contentVectors, responseVectors)
+// reviewChunk is one piece of a review's text; review is the index of the
+// review in its batch and index the position of the chunk within the review.
+type reviewChunk struct {
+	review int
+	index  int
+	text   string
+}
 
-	batchDuration := time.Since(batchStart)
-	s.logger.Debug("Batch processed",
-		"count", len(reviews),
-		"duration", batchDuration,
-		"processed", result.Processed,
-		"failed", result.Failed)
+// batchTexts holds the texts to embed for a batch of reviews. Content is
+// split into chunks, while responses and titles are aligned by review index
+// and empty for reviews that have none.
+type batchTexts struct {
+	chunks       []reviewChunk
+	responses    []string
+	titles       []string
+	translations []string
+}
 
-	return result, nil
+// batchVectors holds the embeddings of a batch: content vectors aligned with
+// the chunks, response and title vectors aligned by review index and nil where
+// there was nothing to embed.
+type batchVectors struct {
+	content      [][]float32
+	responses    [][]float32
+	titles       [][]float32
+	translations [][]float32
+	// sparse is aligned with content; nil without sparse embedding.
+	sparse []*storage.SparseVector
 }
 
-func (s *VectorizeService) prepareTexts(reviews []storage.CleanReview) ([]string, []string) {
-	contentTexts := make([]string, 0, len(reviews))
-	responseTexts := make([]string, 0, len(reviews))
+func (s *VectorizeService) prepareTexts(reviews []storage.CleanReview) batchTexts {
+	texts := batchTexts{
+		chunks:       make([]reviewChunk, 0, len(reviews)),
+		responses:    make([]string, 0, len(reviews)),
+		titles:       make([]string, 0, len(reviews)),
+		translations: make([]string, 0, len(reviews)),
+	}
+	flags := s.Flags()
 
-	for _, review := range reviews {
-		contentTexts = append(contentTexts, review.ContentClean)
+	for i, review := range reviews {
+		for j, chunk := range s.chunkReview(review.Text(s.cfg.Vectorizer.TextSource)) {
+			texts.chunks = append(texts.chunks, reviewChunk{review: i, index: j, text: chunk})
+		}
 
-		if review.ResponseContentClean != nil && *review.ResponseContentClean != "" {
-			responseTexts = append(responseTexts, *review.ResponseContentClean)
+		if s.embedResponses(flags) && review.ResponseContentClean != nil {
+			texts.responses = append(texts.responses, s.preprocessor.Process(*review.ResponseContentClean))
 		} else {
-			responseTexts = append(responseTexts, "")
+			texts.responses = append(texts.responses, "")
 		}
+
+		if flags.TitleVectors {
+			texts.titles = append(texts.titles, s.preprocessor.Process(review.Title))
+		} else {
+			texts.titles = append(texts.titles, "")
+		}
+
+		texts.translations = append(texts.translations, s.translationText(review))
 	}
 
-	return contentTexts, responseTexts
+	return texts
 }
 
-func (s *VectorizeService) generateEmbeddings(ctx context.Context, contentTexts, responseTexts []string) ([][]float32, [][]float32, error) {
-	contentVectors, err := s.embedder.EmbedBatch(ctx, contentTexts)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate content embeddings: %w", err)
+// embedResponses tells whether developer responses are embedded into
+// response_vec.
+func (s *VectorizeService) embedResponses(flags config.FlagsConfig) bool {
+	return s.cfg.Vectorizer.EmbedResponses && flags.ResponseVectors
+}
+
+// translationText returns the English translation of the review to embed
+// into content_en_vec, cut to the first chunk, or "" when there is none or
+// flags.enable_translation_vectors is off.
+func (s *VectorizeService) translationText(review storage.CleanReview) string {
+	if !s.Flags().TranslationVectors || review.ContentEN == nil {
+		return ""
+	}
+	chunks := s.chunkReview(*review.ContentEN)
+	if len(chunks) == 0 {
+		return ""
+	}
+	return chunks[0]
+}
+
+// chunkReview splits review text longer than vectorizer.chunk_max_tokens into
+// overlapping chunks. Chunks the embedder would reject as empty are dropped.
+func (s *VectorizeService) chunkReview(text string) []string {
+	text = s.preprocessor.Process(text)
+	maxChars := s.cfg.Vectorizer.ChunkMaxTokens * charsPerToken
+	overlapChars := s.cfg.Vectorizer.ChunkOverlapTokens * charsPerToken
+
+	chunks := chunkText(text, maxChars, overlapChars)
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		if s.preprocessor.Process(chunk) != "" {
+			kept = append(kept, chunk)
+		}
 	}
 
-	var responseVectors [][]float32
-	nonEmptyResponses := s.filterNonEmptyResponses(responseTexts)
+	return kept
+}
 
-	if len(nonEmptyResponses) > 0 {
-		responseVectors, err = s.embedder.EmbedBatch(ctx, nonEmptyResponses)
+// generateEmbeddings embeds the content of every review plus the developer
+// responses, titles and translations that are present, and the sparse
+// vectors of the content with sparse.enabled. They are requested at once,
+// each still held to the provider's rate limit; a failure to embed the
+// content fails the batch and stops the others, while a failure to embed any
+// of the others leaves their vectors empty.
+func (s *VectorizeService) generateEmbeddings(ctx context.Context, texts batchTexts, cache *vectorCache) (batchVectors, error) {
+	contentTexts := make([]string, len(texts.chunks))
+	for i, chunk := range texts.chunks {
+		contentTexts[i] = chunk.text
+	}
+
+	var vectors batchVectors
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		var err error
+		vectors.content, err = s.embedPresent(gctx, contentTexts, cache)
 		if err != nil {
-			s.logger.Warn("Failed to generate response embeddings, continuing without them", "error", err)
-			responseVectors = nil
+			return fmt.Errorf("failed to generate content embeddings: %w", err)
 		}
+		return nil
+	})
+	optional := func(kind string, texts []string, out *[][]float32) {
+		g.Go(func() error {
+			var err error
+			*out, err = s.embedPresent(gctx, texts, cache)
+			if err != nil {
+				if gctx.Err() == nil {
+					s.logger.Warn("Failed to generate "+kind+" embeddings, continuing without them", "error", err)
+				}
+				*out = make([][]float32, len(texts))
+			}
+			return nil
+		})
+	}
+	optional("response", texts.responses, &vectors.responses)
+	optional("title", texts.titles, &vectors.titles)
+	optional("translation", texts.translations, &vectors.translations)
+	if s.sparse != nil {
+		g.Go(func() error {
+			var err error
+			vectors.sparse, err = s.sparse.EmbedSparse(gctx, contentTexts)
+			if err != nil {
+				if gctx.Err() == nil {
+					s.logger.Warn("Failed to generate sparse embeddings, continuing without them", "error", err)
+				}
+				vectors.sparse = nil
+			}
+			return nil
+		})
 	}
 
-	return contentVectors, responseVectors, nil
+	if err := g.Wait(); err != nil {
+		return batchVectors{}, err
+	}
+	return vectors, nil
 }
 
-func (s *VectorizeService) filterNonEmptyResponses(responseTexts []string) []string {
-	nonEmpty := make([]string, 0)
-	for _, text := range responseTexts {
-		if text != "" {
-			nonEmpty = append(nonEmpty, text)
+// embedPresent embeds only the non-empty texts and maps every vector back to
+// the index of the text it belongs to. Identical texts, after normalization,
+// are sent to the embedder once, and texts already embedded earlier in the
+// run, or by any replica while flags.enable_cache is on and Redis is
+// configured, are served from the cache.
+func (s *VectorizeService) embedPresent(ctx context.Context, texts []string, cache *vectorCache) ([][]float32, error) {
+	model := s.currentModel()
+	aligned := make([][]float32, len(texts))
+
+	inputs := make([]string, 0, len(texts))
+	keys := make([]string, 0, len(texts))
+	targets := make(map[string][]int)
+	for i, text := range texts {
+		key := dedupeKey(text)
+		if key == "" {
+			continue
+		}
+		if vector, ok := cache.get(key); ok {
+			aligned[i] = vector
+			cache.countDeduplicated(1)
+			continue
+		}
+		if _, ok := targets[key]; ok {
+			cache.countDeduplicated(1)
+		} else {
+			inputs = append(inputs, text)
+			keys = append(keys, key)
 		}
+		targets[key] = append(targets[key], i)
 	}
-	return nonEmpty
-}
 
-func (s *VectorizeService) storeVectors(ctx context.Context, reviews []storage.CleanReview, contentVectors, responseVectors [][]float32) VectorizeResult {
-	result := VectorizeResult{}
+	shared := s.sharedCache
+	if !s.Flags().Cache {
+		shared = nil
+	}
+	// Vectors are only reusable for the same model, dimensions and input
+	// template, and those of redacted texts only with redaction.
+	namespace := fmt.Sprintf("%s:%d", model.name, s.cfg.Vectorizer.MaxVectorLength)
+	if s.cfg.Redaction.Enabled {
+		namespace += ":redacted"
+	}
+	if template, ok := s.cfg.Vectorizer.InputTemplate(model.name); ok && template.Document != "" {
+		namespace += ":" + template.Document
+	}
 
-	for i, review := range reviews {
-		vector := s.createVector(review, contentVectors[i], responseVectors, i)
+	if shared != nil && len(keys) > 0 {
+		cached, err := shared.getMany(ctx, namespace, keys)
+		if err != nil {
+			s.logger.Warn("Failed to read the shared embedding cache", "error", err)
+		}
+		if len(cached) > 0 {
+			missingInputs, missingKeys := inputs[:0:0], keys[:0:0]
+			for j, key := range keys {
+				vector, ok := cached[key]
+				if !ok {
+					missingInputs = append(missingInputs, inputs[j])
+					missingKeys = append(missingKeys, key)
+					continue
+				}
+				cache.put(key, vector)
+				cache.countDeduplicated(len(targets[key]))
+				for _, i := range targets[key] {
+					aligned[i] = vector
+				}
+			}
+			inputs, keys = missingInputs, missingKeys
+		}
+	}
 
-		if err := s.repo.UpsertEmbedding(ctx, vector); err != nil {
-			s.logger.Error("Failed to store embedding", "review_id", review.ID, "error", err)
-			result.Failed++
-		} else {
-			result.Processed++
-			result.ReviewIDs = append(result.ReviewIDs, review.ID)
+	if len(inputs) == 0 {
+		return aligned, nil
+	}
+
+	vectors, err := model.embedder.EmbedBatch(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vectors) != len(inputs) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d inputs", len(vectors), len(inputs))
+	}
+
+	embedded := make(map[string][]float32, len(keys))
+	for j, key := range keys {
+		cache.put(key, vectors[j])
+		embedded[key] = vectors[j]
+		for _, i := range targets[key] {
+			aligned[i] = vectors[j]
 		}
 	}
 
-	return result
+	if shared != nil {
+		if err := shared.putMany(ctx, namespace, embedded); err != nil {
+			s.logger.Warn("Failed to write the shared embedding cache", "error", err)
+		}
+	}
+
+	return aligned, nil
 }
 
-func (s *VectorizeService) createVector(review storage.CleanReview, contentVec []float32, responseVectors [][]float32, index int) *storage.Vector {
+// createVector builds the row for one chunk of a review. Response, title and
+// translation vectors are passed for the first chunk only.
+func (s *VectorizeService) createVector(review storage.CleanReview, chunkIndex int, contentVec, responseVec, titleVec, translationVec []float32) *storage.Vector {
 	vector := storage.NewVector(review.ID, review.AppID, contentVec)
 
+	vector.ChunkIndex = chunkIndex
 	vector.Language = review.Language
 	vector.Rating = review.Rating
 	vector.Country = review.Country
-	vector.Model = s.cfg.Vectorizer.Model
+	vector.AppVersion = review.AppVersion
+	vector.Device = review.Device
+	vector.Platform = review.Platform
+	vector.HelpfulVotes = review.HelpfulVotes
+	vector.Model = s.currentModel().name
 	vector.Dim = s.cfg.Vectorizer.MaxVectorLength
 	vector.CreatedAt = time.Now()
+	vector.ResponseVec = responseVec
+	vector.TitleVec = titleVec
+	vector.ContentENVec = translationVec
+	if contentVec != nil {
+		// Response backfills leave the hash of the full embedding alone.
+		vector.ContentHash = s.contentHash(review)
+	}
 
-	if responseVectors != nil && index < len(responseVectors) {
-		vector.ResponseVec = responseVectors[index]
+	if s.cfg.Vectorizer.Normalize {
+		vector.ContentVec = unitVector(contentVec)
+		if responseVec != nil {
+			vector.ResponseVec = unitVector(responseVec)
+		}
+		if titleVec != nil {
+			vector.TitleVec = unitVector(titleVec)
+		}
+		if translationVec != nil {
+			vector.ContentENVec = unitVector(translationVec)
+		}
+		vector.Normalized = true
 	}
 
 	return vector
 }
 
-func (s *VectorizeService) Handle(ctx context.Context, payload any, sagaID string) error {
-	s.logger.Info("Processing vectorization event", "saga_id", sagaID, "payload_type", fmt.Sprintf("%T", payload))
+// contentHash identifies what a review's vectors are made from: its text,
+// response and title as embedded under the current flags, and the settings
+// that shape the vectors. Reviews whose hash and model match their stored
+// embedding need not be embedded again.
+func (s *VectorizeService) contentHash(review storage.CleanReview) string {
+	flags := s.Flags()
+	var response, title string
+	if s.embedResponses(flags) && review.ResponseContentClean != nil {
+		response = s.preprocessor.Process(*review.ResponseContentClean)
+	}
+	if flags.TitleVectors {
+		title = s.preprocessor.Process(review.Title)
+	}
+
+	parts := []string{
+		"v1",
+		s.preprocessor.Process(review.Text(s.cfg.Vectorizer.TextSource)),
+		response,
+		title,
+		strconv.Itoa(s.cfg.Vectorizer.ChunkMaxTokens),
+		strconv.Itoa(s.cfg.Vectorizer.ChunkOverlapTokens),
+		strconv.Itoa(s.cfg.Vectorizer.MaxVectorLength),
+		strconv.FormatBool(s.cfg.Vectorizer.Normalize),
+	}
+	if flags.TranslationVectors {
+		parts = append(parts, "translation:"+s.translationText(review))
+	}
+	if sparse := s.cfg.Sparse; s.sparse != nil {
+		parts = append(parts, fmt.Sprintf("sparse:%s:%d", sparse.Provider, sparse.Dimensions))
+	}
+	if template, ok := s.cfg.Vectorizer.InputTemplate(s.currentModel().name); ok && template.Document != "" {
+		parts = append(parts, "template:"+template.Document)
+	}
+	if redaction := s.cfg.Redaction; redaction.Enabled {
+		// Redacted texts embed differently from the originals.
+		parts = append(parts, fmt.Sprintf("redaction:%t:%t:%s:%q",
+			redaction.Emails, redaction.Phones, redaction.OrderIDPattern, redaction.NamePatterns))
+	}
+
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unchanged reports whether the review's stored embedding was made with the
+// current model from its current texts.
+func (s *VectorizeService) unchanged(review storage.CleanReview) bool {
+	return s.cfg.Vectorizer.SkipUnchanged &&
+		review.EmbeddedHash != "" &&
+		review.EmbeddedModel == s.currentModel().name &&
+		review.EmbeddedHash == s.contentHash(review)
+}
 
-	req := s.extractRequestFromPayload(payload)
+func (s *VectorizeService) Handle(ctx context.Context, evt payloads.VectorizeRequest, sagaID string) error {
+	s.logger.Info("Processing vectorization event", "saga_id", sagaID)
+
+	if evt.TenantID != "" {
+		ctx = producer.WithHeaders(ctx, kafka.Header{Key: "tenant_id", Value: []byte(evt.TenantID)})
+	}
+
+	if processed := s.findProcessed(ctx, events.PipelineVectorizeRequest, sagaID, evt); processed != nil {
+		s.logger.Info("Saga already processed, replying with its completed event",
+			"saga_id", sagaID,
+			"result_digest", processed.ResultDigest,
+			"processed_at", processed.ProcessedAt)
+		return s.republishCompletedEvent(ctx, processed, sagaID)
+	}
+
+	req := newVectorizeRequest(evt)
+	req.SagaID = sagaID
+	req.outcome = s.outcome(ctx, evt, req)
 
 	s.logger.Info("Vectorization request",
 		"force_recompute", req.ForceRecompute,
+		"stale_model", req.StaleModel,
+		"response_backfill", req.ResponseBackfill,
+		"incremental", req.Incremental,
+		"dry_run", req.DryRun,
 		"limit", req.Limit,
+		"tenant_id", req.TenantID,
 		"app_id", req.AppID,
 		"countries", req.Countries,
 		"languages", req.Languages,
@@ -312,6 +1071,30 @@ func (s *VectorizeService) Handle(ctx context.Context, payload any, sagaID strin
 		"saga_id", sagaID)
 
 	result, err := s.RunOnce(ctx, req)
+
+	s.publishOutcome(ctx, req, result, err)
+
+	if errors.Is(err, ErrRunInProgress) {
+		// Redelivered until the other run is done, or failed once its
+		// attempts are used up, so the saga never waits for nothing.
+		s.logger.Warn("Deferring vectorization request, a run for this app is already in progress",
+			"app_id", req.AppID,
+			"saga_id", sagaID)
+		return fmt.Errorf("vectorization deferred: %w", err)
+	}
+
+	if errors.Is(err, ErrRunCancelled) {
+		s.logger.Info("Vectorization cancelled", "run_id", result.RunID, "processed", result.Processed, "saga_id", sagaID)
+		return nil
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		s.logger.Warn("Vectorization deferred", "run_id", result.RunID, "processed", result.Processed, "deferred", result.Deferred, "error", err, "saga_id", sagaID)
+		return nil
+	}
+	if errors.Is(err, ErrDeadlineReached) {
+		s.logger.Warn("Vectorization stopped at its deadline", "run_id", result.RunID, "processed", result.Processed, "deferred", result.Deferred, "deadline", req.Deadline, "saga_id", sagaID)
+		return nil
+	}
 	if err != nil {
 		s.logger.Error("Vectorization failed", "error", err, "saga_id", sagaID)
 		return fmt.Errorf("vectorization failed: %w", err)
@@ -320,73 +1103,301 @@ func (s *VectorizeService) Handle(ctx context.Context, payload any, sagaID strin
 	s.logger.Info("Vectorization completed successfully",
 		"processed", result.Processed,
 		"skipped", result.Skipped,
+		"skipped_reasons", result.SkippedReasons,
 		"failed", result.Failed,
 		"saga_id", sagaID)
 
-	if err = s.publishCompletedEvent(ctx, payload, sagaID); err != nil {
-		s.logger.Error("Failed to publish completed event", "error", err, "saga_id", sagaID)
-	}
+	s.recordProcessed(ctx, events.PipelineVectorizeRequest, sagaID, evt, newCompletedEvent(evt, sagaID, result))
 
 	return nil
 }
 
-func (s *VectorizeService) extractRequestFromPayload(payload any) VectorizeRequest {
-	var req VectorizeRequest
-
-	switch p := payload.(type) {
-	case map[string]any:
-		if force, ok := p["force_recompute"].(bool); ok {
-			req.ForceRecompute = force
-		}
-		if limit, ok := p["limit"].(float64); ok {
-			req.Limit = int(limit)
-		}
-		if batchSize, ok := p["batch_size"].(float64); ok {
-			req.Limit = int(batchSize)
-		}
-		if appID, ok := p["app_id"].(string); ok {
-			req.AppID = appID
-		}
-		if countries, ok := p["countries"].([]any); ok {
-			req.Countries = make([]string, len(countries))
-			for i, country := range countries {
-				if countryStr, ok := country.(string); ok {
-					req.Countries[i] = countryStr
-				}
-			}
-		}
-		if languages, ok := p["languages"].([]any); ok {
-			req.Languages = make([]string, len(languages))
-			for i, language := range languages {
-				if languageStr, ok := language.(string); ok {
-					req.Languages[i] = languageStr
-				}
+// outcome returns the function building the event that announces how the
+// saga's run ended: completed, cancelled or failed. A failure that will be
+// retried is not announced yet.
+func (s *VectorizeService) outcome(ctx context.Context, evt payloads.VectorizeRequest, req VectorizeRequest) func(VectorizeResult, error) *events.Envelope[any] {
+	return func(result VectorizeResult, runErr error) *events.Envelope[any] {
+		var envelope events.Envelope[any]
+		switch {
+		case errors.Is(runErr, ErrRunCancelled):
+			envelope = s.producer.BuildCancelledEnvelope(newCancelledEvent(req, result), req.SagaID)
+		case errors.Is(runErr, ErrQuotaExceeded):
+			// Announced by the quota exceeded event of every run.
+			return nil
+		case errors.Is(runErr, ErrDeadlineReached):
+			// Never retried: the orchestrator is about to give up on the saga.
+			envelope = s.producer.BuildFailedEnvelope(newFailedEvent(req, result, runErr), req.SagaID)
+		case runErr != nil:
+			if willRetry(ctx, runErr) {
+				return nil
 			}
+			envelope = s.producer.BuildFailedEnvelope(newFailedEvent(req, result, runErr), req.SagaID)
+		default:
+			envelope = s.producer.BuildEnvelope(newCompletedEvent(evt, req.SagaID, result), req.SagaID)
 		}
-		if dateFrom, ok := p["date_from"].(string); ok {
-			req.DateFrom = dateFrom
-		}
-		if dateTo, ok := p["date_to"].(string); ok {
-			req.DateTo = dateTo
-		}
-	case string:
-		if p == "force" || p == "recompute" {
-			req.ForceRecompute = true
-		}
-	default:
-		s.logger.Info("Unknown payload type, using default vectorization request")
+		return &envelope
 	}
+}
 
-	return req
+// publishOutcome publishes the request's outcome event right away when the
+// run did not get to queue it in the outbox, e.g. for dry runs or runs that
+// failed to start. It uses a context detached from cancellation so failures
+// caused by shutdown are still reported.
+func (s *VectorizeService) publishOutcome(ctx context.Context, req VectorizeRequest, result VectorizeResult, runErr error) {
+	if result.queued || req.outcome == nil || s.producer == nil {
+		return
+	}
+
+	envelope := req.outcome(result, runErr)
+	if envelope == nil {
+		return
+	}
+
+	if err := s.producer.PublishEvent(context.WithoutCancel(ctx), []byte(req.SagaID), *envelope); err != nil {
+		s.logger.Error("Failed to publish outcome event", "error", err, "type", envelope.Type, "saga_id", req.SagaID)
+	}
+}
+
+// HandleRetry reprocesses the reviews of the app that are recorded in the
+// error ledger. Reviews that succeed are removed from the ledger, the others
+// have their attempt count bumped.
+func (s *VectorizeService) HandleRetry(ctx context.Context, evt payloads.VectorizeRetry, sagaID string) error {
+	req := VectorizeRequest{
+		SagaID:     sagaID,
+		AppID:      evt.AppID,
+		OnlyFailed: true,
+		Priority:   PriorityRequest,
+	}
+
+	s.logger.Info("Retrying failed reviews", "app_id", req.AppID, "saga_id", sagaID)
+
+	result, err := s.RunOnce(ctx, req)
+	if errors.Is(err, ErrRunInProgress) {
+		// Redelivered until the other run is done.
+		s.logger.Warn("Deferring retry request, a run for this app is already in progress",
+			"app_id", req.AppID,
+			"saga_id", sagaID)
+		return fmt.Errorf("retry deferred: %w", err)
+	}
+	if errors.Is(err, ErrRunCancelled) {
+		s.logger.Info("Retry of failed reviews cancelled", "run_id", result.RunID, "saga_id", sagaID)
+		return nil
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		s.logger.Warn("Retry of failed reviews deferred", "run_id", result.RunID, "deferred", result.Deferred, "error", err, "saga_id", sagaID)
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("Retry of failed reviews failed", "error", err, "saga_id", sagaID)
+		return fmt.Errorf("retry failed: %w", err)
+	}
+
+	s.logger.Info("Retry of failed reviews completed",
+		"run_id", result.RunID,
+		"processed", result.Processed,
+		"failed", result.Failed,
+		"saga_id", sagaID)
+
+	return nil
 }
 
-func (s *VectorizeService) publishCompletedEvent(ctx context.Context, payload any, sagaID string) error {
-	evt := payload.(events.VectorizeRequest)
+// GetRun looks a run up by its run ID or, failing that, returns the latest
+// run of the saga with that ID. It returns nil when neither exists.
+func (s *VectorizeService) GetRun(ctx context.Context, id string) (*storage.Run, error) {
+	run, err := s.repo.GetRun(ctx, id)
+	if err != nil || run != nil {
+		return run, err
+	}
 
-	completedEvent := events.VectorizeCompleted{
-		VectorizeRequest: evt,
+	return s.repo.GetLatestRun(ctx, id)
+}
+
+// Readiness checks the dependencies a run needs and returns the outcome of
+// each check by name; a nil error means the dependency is available.
+func (s *VectorizeService) Readiness(ctx context.Context) map[string]error {
+	checks := map[string]error{
+		"postgres": s.repo.Ping(ctx),
+		"embedder": s.currentModel().embedder.Check(ctx),
+	}
+	if s.producer != nil {
+		checks["kafka"] = s.producer.Ping(ctx)
 	}
+	return checks
+}
+
+// Stats returns the embedding table statistics.
+func (s *VectorizeService) Stats(ctx context.Context) (map[string]any, error) {
+	return s.repo.GetTableStats(ctx)
+}
+
+// QueueStats returns the embedding slots in use and the jobs waiting for
+// one, or nil without a queue.
+func (s *VectorizeService) QueueStats() *QueueStats {
+	return s.queue.stats()
+}
 
+// CacheStats returns the hits and misses of the shared embedding cache since
+// startup, or nil without one.
+func (s *VectorizeService) CacheStats() *CacheStats {
+	if s.sharedCache == nil {
+		return nil
+	}
+	stats := s.sharedCache.stats()
+	return &stats
+}
+
+// CoverageReport compares clean reviews with stored embeddings for the app,
+// broken down by model, language and country.
+func (s *VectorizeService) CoverageReport(ctx context.Context, appID string) ([]storage.CoverageRow, error) {
+	report, err := s.repo.GetCoverageReport(ctx, appID, s.currentModel().name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build coverage report: %w", err)
+	}
+	return report, nil
+}
+
+// newVectorizeRequest converts a request event into run options.
+func newVectorizeRequest(evt payloads.VectorizeRequest) VectorizeRequest {
+	req := VectorizeRequest{
+		Priority:         PriorityRequest,
+		TenantID:         evt.TenantID,
+		AppID:            evt.AppID,
+		Countries:        evt.Countries,
+		DateFrom:         evt.DateFrom,
+		DateTo:           evt.DateTo,
+		ForceRecompute:   evt.ForceRecompute,
+		StaleModel:       evt.StaleModel,
+		ResponseBackfill: evt.ResponseBackfill,
+		Incremental:      evt.Incremental,
+		Limit:            evt.Limit,
+		Languages:        evt.Languages,
+		DryRun:           evt.DryRun,
+		MinRating:        evt.MinRating,
+		MaxRating:        evt.MaxRating,
+		ReviewIDs:        evt.ReviewIDs,
+		OnlyWithResponse: evt.OnlyWithResponse,
+		Order:            evt.Order,
+		SamplePercent:    evt.SamplePercent,
+		SampleSeed:       evt.SampleSeed,
+	}
+	if evt.Deadline != nil {
+		req.Deadline = *evt.Deadline
+	}
+	return req
+}
+
+func newCompletedEvent(evt payloads.VectorizeRequest, sagaID string, result VectorizeResult) payloads.VectorizeCompleted {
+	completedEvent := payloads.VectorizeCompleted{
+		VectorizeCompleted: events.VectorizeCompleted{VectorizeRequest: evt.VectorizeRequest},
+		TenantID:           evt.TenantID,
+		Processed:          result.Processed,
+		Skipped:            result.Skipped,
+		SkippedReasons:     result.SkippedReasons,
+		Failed:             result.Failed,
+		FailedReasons:      result.FailedReasons,
+		FailedReviewIDs:    result.FailedReviewIDs,
+		Tokens:             result.Tokens,
+		CostUSD:            result.CostUSD,
+		ReviewsArtifact:    storage.RunReviewsArtifact(sagaID),
+		DryRun:             result.Estimate != nil,
+		Estimate:           result.Estimate,
+	}
+	if completedEvent.DryRun {
+		completedEvent.ReviewsArtifact = ""
+	}
+	if result.bundle != nil {
+		// The bundle lists every failing review.
+		completedEvent.Bundle = result.bundle.manifest
+		completedEvent.ReviewsArtifact = result.bundle.reviews
+		completedEvent.FailedReviewIDs = nil
+	}
+
+	return completedEvent
+}
+
+func (s *VectorizeService) publishCompletedEvent(ctx context.Context, completedEvent payloads.VectorizeCompleted, sagaID string) error {
 	envelope := s.producer.BuildEnvelope(completedEvent, sagaID)
 	return s.producer.PublishEvent(ctx, []byte(sagaID), envelope)
 }
+
+// republishCompletedEvent answers a redelivered request with the completed
+// event recorded when it was first handled.
+func (s *VectorizeService) republishCompletedEvent(ctx context.Context, processed *storage.ProcessedSaga, sagaID string) error {
+	var completedEvent payloads.VectorizeCompleted
+	if err := json.Unmarshal(processed.Reply, &completedEvent); err != nil {
+		return fmt.Errorf("failed to decode recorded completed event of saga %s: %w", sagaID, err)
+	}
+
+	if err := s.publishCompletedEvent(ctx, completedEvent, sagaID); err != nil {
+		return fmt.Errorf("failed to republish completed event: %w", err)
+	}
+
+	return nil
+}
+
+// HandleCancel flags the saga's running vectorization for cancellation. The
+// run stops before its next batch, on whichever instance runs it, and
+// publishes a cancelled event.
+func (s *VectorizeService) HandleCancel(ctx context.Context, evt payloads.VectorizeCancel, sagaID string) error {
+	cancelled, err := s.repo.RequestRunCancel(ctx, sagaID)
+	if err != nil {
+		return fmt.Errorf("cancel failed: %w", err)
+	}
+
+	if cancelled == 0 {
+		s.logger.Warn("No running run to cancel", "saga_id", sagaID, "reason", evt.Reason)
+		return nil
+	}
+
+	s.logger.Info("Requested run cancellation", "saga_id", sagaID, "runs", cancelled, "reason", evt.Reason)
+	return nil
+}
+
+func newCancelledEvent(req VectorizeRequest, result VectorizeResult) payloads.VectorizeCancelled {
+	return payloads.VectorizeCancelled{
+		AppID:     req.AppID,
+		RunID:     result.RunID,
+		Processed: result.Processed,
+		Skipped:   result.Skipped,
+		Failed:    result.Failed,
+	}
+}
+
+// newFailedEvent reports a failed run with its partial counts.
+func newFailedEvent(req VectorizeRequest, result VectorizeResult, runErr error) payloads.VectorizeFailed {
+	code, recoverable := classifyFailure(runErr)
+
+	return payloads.VectorizeFailed{
+		Step:        events.SagaStepVectorize,
+		Code:        code,
+		Recoverable: recoverable,
+		AppID:       req.AppID,
+		RunID:       result.RunID,
+		Message:     runErr.Error(),
+		Processed:   result.Processed,
+		Skipped:     result.Skipped,
+		Failed:      result.Failed,
+		Deferred:    result.Deferred,
+	}
+}
+
+func (s *VectorizeService) publishProgressEvent(ctx context.Context, run *storage.Run, tracker *progress) {
+	if run.SagaID == "" || s.producer == nil {
+		return
+	}
+
+	progressEvent := payloads.VectorizeProgress{
+		AppID:               run.AppID,
+		RunID:               run.RunID,
+		Processed:           run.Processed,
+		Skipped:             run.Skipped,
+		Failed:              run.Failed,
+		Remaining:           tracker.remaining(),
+		EstimatedCompletion: tracker.estimatedCompletion(),
+	}
+
+	envelope := s.producer.BuildProgressEnvelope(progressEvent, run.SagaID)
+	if err := s.producer.PublishEvent(ctx, []byte(run.SagaID), envelope); err != nil {
+		s.logger.Warn("Failed to publish progress event", "error", err, "saga_id", run.SagaID)
+	}
+}
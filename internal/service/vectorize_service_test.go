@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestRunOnceRejectsSamplePercent(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent float64
+	}{
+		{"negative", -1},
+		{"above 100", 100.5},
+		{"not a number", math.NaN()},
+		{"infinite", math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(&fakeEmbedder{})
+
+			_, err := s.RunOnce(context.Background(), VectorizeRequest{SamplePercent: tt.percent})
+			if !errors.Is(err, ErrInvalidSamplePercent) {
+				t.Fatalf("RunOnce() = %v, want %v", err, ErrInvalidSamplePercent)
+			}
+			if !IsPermanent(err) {
+				t.Error("expected the error to be permanent")
+			}
+		})
+	}
+}
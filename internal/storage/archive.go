@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Archived rows are review_embeddings rows as JSON, compressed with zstd.
+// Encoders and decoders are safe for concurrent use through EncodeAll and
+// DecodeAll.
+var (
+	archiveEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	archiveDecoder, _ = zstd.NewReader(nil)
+)
+
+// ArchiveFilters selects archived embeddings to rehydrate; at least one of
+// AppID and ReviewIDs is set.
+type ArchiveFilters struct {
+	AppID     string
+	ReviewIDs []string
+}
+
+// ArchiveStats describes the archive table.
+type ArchiveStats struct {
+	Rows            int64      `json:"rows"`
+	Reviews         int64      `json:"reviews"`
+	CompressedBytes int64      `json:"compressed_bytes"`
+	OldestEmbedded  *time.Time `json:"oldest_embedded,omitempty"`
+	LastArchived    *time.Time `json:"last_archived,omitempty"`
+}
+
+// ArchiveEmbeddings moves up to limit embedding rows last embedded before
+// cutoff from review_embeddings, and so out of its vector indexes, into
+// review_embeddings_archive, in one transaction. Rows locked by a
+// concurrent write are left for the next call. It returns the number of rows
+// moved.
+func (r *postgresRepository) ArchiveEmbeddings(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	var archived int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		query := `
+			DELETE FROM review_embeddings e
+			WHERE e.embedding_id IN (
+				SELECT embedding_id FROM review_embeddings
+				WHERE COALESCE(updated_at, created_at) < $1
+				ORDER BY COALESCE(updated_at, created_at)
+				LIMIT $2
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING e.review_id, e.chunk_index, e.app_id, e.tenant_id, e.model,
+				COALESCE(e.updated_at, e.created_at), to_jsonb(e)::text;
+		`
+
+		rows, err := tx.Query(ctx, query, cutoff, limit)
+		if err != nil {
+			return fmt.Errorf("failed to take embeddings to archive: %w", err)
+		}
+		defer rows.Close()
+
+		insert := `
+			INSERT INTO review_embeddings_archive (review_id, chunk_index, app_id, tenant_id, model, embedded_at, payload)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (review_id, chunk_index) DO UPDATE
+			SET app_id = EXCLUDED.app_id, tenant_id = EXCLUDED.tenant_id, model = EXCLUDED.model,
+				embedded_at = EXCLUDED.embedded_at, payload = EXCLUDED.payload, archived_at = NOW();
+		`
+
+		batch := &pgx.Batch{}
+		for rows.Next() {
+			var (
+				reviewID, appID, model string
+				tenantID               *string
+				chunkIndex             int
+				embeddedAt             time.Time
+				row                    string
+			)
+			if err := rows.Scan(&reviewID, &chunkIndex, &appID, &tenantID, &model, &embeddedAt, &row); err != nil {
+				return fmt.Errorf("failed to scan embedding to archive: %w", err)
+			}
+			payload := archiveEncoder.EncodeAll([]byte(row), nil)
+			batch.Queue(insert, reviewID, chunkIndex, appID, tenantID, model, embeddedAt, payload)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to take embeddings to archive: %w", err)
+		}
+		if batch.Len() == 0 {
+			return nil
+		}
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to store archived embeddings: %w", err)
+		}
+		archived = int64(batch.Len())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to archive embeddings: %w", err)
+	}
+
+	return archived, nil
+}
+
+// RehydrateEmbeddings moves up to limit archived embedding rows matching the
+// filters back into review_embeddings, in one transaction. A row whose
+// review was embedded again since it was archived is dropped in favour of
+// the newer one. It returns the number of rows taken out of the archive.
+func (r *postgresRepository) RehydrateEmbeddings(ctx context.Context, filters ArchiveFilters, limit int) (int64, error) {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	whereClause := "TRUE"
+	var args []any
+	if filters.AppID != "" {
+		args = append(args, filters.AppID)
+		whereClause += fmt.Sprintf(" AND app_id = $%d", len(args))
+	}
+	if len(filters.ReviewIDs) > 0 {
+		args = append(args, filters.ReviewIDs)
+		whereClause += fmt.Sprintf(" AND review_id = ANY($%d)", len(args))
+	}
+	args = append(args, limit)
+
+	var rehydrated int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		query := fmt.Sprintf(`
+			DELETE FROM review_embeddings_archive
+			WHERE (review_id, chunk_index) IN (
+				SELECT review_id, chunk_index FROM review_embeddings_archive
+				WHERE %s
+				LIMIT $%d
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING review_id, payload;
+		`, whereClause, len(args))
+
+		rows, err := tx.Query(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to take archived embeddings: %w", err)
+		}
+		defer rows.Close()
+
+		insert := `
+			INSERT INTO review_embeddings
+			SELECT * FROM jsonb_populate_record(NULL::review_embeddings, $1::jsonb)
+			ON CONFLICT DO NOTHING;
+		`
+
+		batch := &pgx.Batch{}
+		for rows.Next() {
+			var reviewID string
+			var payload []byte
+			if err := rows.Scan(&reviewID, &payload); err != nil {
+				return fmt.Errorf("failed to scan archived embedding: %w", err)
+			}
+			row, err := archiveDecoder.DecodeAll(payload, nil)
+			if err != nil {
+				return fmt.Errorf("failed to decompress archived embedding of review %s: %w", reviewID, err)
+			}
+			batch.Queue(insert, string(row))
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to take archived embeddings: %w", err)
+		}
+		if batch.Len() == 0 {
+			return nil
+		}
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to restore archived embeddings: %w", err)
+		}
+		rehydrated = int64(batch.Len())
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rehydrate embeddings: %w", err)
+	}
+
+	return rehydrated, nil
+}
+
+// GetArchiveStats returns the size of the archive table.
+func (r *postgresRepository) GetArchiveStats(ctx context.Context) (ArchiveStats, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	query := `
+		SELECT COUNT(*), COUNT(DISTINCT review_id), COALESCE(SUM(octet_length(payload)), 0),
+			MIN(embedded_at), MAX(archived_at)
+		FROM review_embeddings_archive;
+	`
+
+	var stats ArchiveStats
+	if err := r.db.QueryRow(ctx, query).Scan(&stats.Rows, &stats.Reviews, &stats.CompressedBytes, &stats.OldestEmbedded, &stats.LastArchived); err != nil {
+		return ArchiveStats{}, fmt.Errorf("failed to get archive stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Audited operations.
+const (
+	AuditDelete         = "delete"
+	AuditForceRecompute = "force_recompute"
+	AuditModelMigration = "model_migration"
+)
+
+// AuditEntry records one destructive operation: who or what triggered it,
+// what it was asked to cover, and how many rows it affected.
+type AuditEntry struct {
+	AuditID   int64  `json:"audit_id"`
+	Operation string `json:"operation"`
+	// Actor is who triggered the operation, e.g. the initiator of the event
+	// or the caller of the admin API; Trigger is how, e.g. the event type.
+	Actor    string         `json:"actor"`
+	Trigger  string         `json:"trigger"`
+	SagaID   string         `json:"saga_id,omitempty"`
+	Filters  map[string]any `json:"filters,omitempty"`
+	Affected int64          `json:"affected"`
+	// Error is set when the operation failed, possibly after affecting some
+	// rows.
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditFilters selects audit entries; unset fields don't narrow the
+// selection.
+type AuditFilters struct {
+	Operation     string
+	Actor         string
+	SagaID        string
+	CreatedFrom   *time.Time
+	CreatedBefore *time.Time
+	Limit         int
+}
+
+// RecordAudit appends the entry to the audit log.
+func (r *postgresRepository) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	query := `
+		INSERT INTO vectorize_audit_log (operation, actor, trigger, saga_id, filters, affected, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	if _, err := r.db.Exec(ctx, query, entry.Operation, entry.Actor, entry.Trigger, entry.SagaID, entry.Filters, entry.Affected, entry.Error); err != nil {
+		return fmt.Errorf("failed to record %s audit entry: %w", entry.Operation, err)
+	}
+	return nil
+}
+
+// ListAudit returns the audit entries matching the filters, most recent
+// first.
+func (r *postgresRepository) ListAudit(ctx context.Context, filters AuditFilters) ([]AuditEntry, error) {
+	whereClause := "TRUE"
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		whereClause += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	if filters.Operation != "" {
+		add("operation = $%d", filters.Operation)
+	}
+	if filters.Actor != "" {
+		add("actor = $%d", filters.Actor)
+	}
+	if filters.SagaID != "" {
+		add("saga_id = $%d", filters.SagaID)
+	}
+	if filters.CreatedFrom != nil {
+		add("created_at >= $%d", *filters.CreatedFrom)
+	}
+	if filters.CreatedBefore != nil {
+		add("created_at < $%d", *filters.CreatedBefore)
+	}
+	args = append(args, filters.Limit)
+
+	query := fmt.Sprintf(`
+		SELECT audit_id, operation, actor, trigger, saga_id, filters, affected, error, created_at
+		FROM vectorize_audit_log
+		WHERE %s
+		ORDER BY created_at DESC, audit_id DESC
+		LIMIT $%d;
+	`, whereClause, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.AuditID, &entry.Operation, &entry.Actor, &entry.Trigger, &entry.SagaID, &entry.Filters, &entry.Affected, &entry.Error, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// ComputeCentroids averages the content vectors the filters select per ISO
+// week of the review date (e.g. 2024-W05) and rating bucket and upserts the
+// averages into review_centroids. It returns the number of centroids
+// written.
+func (r *postgresRepository) ComputeCentroids(ctx context.Context, filters EmbeddingFilters) (int64, error) {
+	whereClause, args := buildEmbeddingWhere(filters)
+
+	query := fmt.Sprintf(`
+		INSERT INTO review_centroids (app_id, model, iso_week, rating_bucket, reviews, centroid)
+		SELECT
+			re.app_id,
+			re.model,
+			to_char(cr.reviewed_at, 'IYYY-"W"IW') AS iso_week,
+			CASE
+				WHEN re.rating IS NULL THEN '%[2]s'
+				WHEN re.rating <= 2 THEN '%[3]s'
+				WHEN re.rating = 3 THEN '%[4]s'
+				ELSE '%[5]s'
+			END AS rating_bucket,
+			COUNT(*),
+			AVG(re.content_vec)
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %[1]s
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT (app_id, model, iso_week, rating_bucket) DO UPDATE
+		SET reviews = EXCLUDED.reviews, centroid = EXCLUDED.centroid, computed_at = NOW();
+	`, whereClause, RatingBucketUnrated, RatingBucketNegative, RatingBucketNeutral, RatingBucketPositive)
+
+	tag, err := r.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute centroids of app %s: %w", filters.AppID, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
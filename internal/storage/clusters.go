@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+)
+
+// buildEmbeddingWhere builds the WHERE clause over review_embeddings re
+// joined with clean_reviews cr that selects the first-chunk content vectors
+// of the filters, starting its placeholders at $1.
+func buildEmbeddingWhere(filters EmbeddingFilters) (string, []any) {
+	whereClause := "re.app_id = $1 AND re.model = $2 AND re.chunk_index = 0 AND re.content_vec IS NOT NULL"
+	args := []any{filters.AppID, filters.Model}
+
+	if filters.DateFrom != "" {
+		args = append(args, filters.DateFrom)
+		whereClause += fmt.Sprintf(" AND cr.reviewed_at >= $%d", len(args))
+	}
+	if filters.DateTo != "" {
+		args = append(args, filters.DateTo)
+		whereClause += fmt.Sprintf(" AND cr.reviewed_at <= $%d", len(args))
+	}
+
+	return whereClause, args
+}
+
+// SampleContentVectors returns the content vectors of up to n reviews picked
+// at random among those the filters select.
+func (r *postgresRepository) SampleContentVectors(ctx context.Context, filters EmbeddingFilters, n int) ([]ReviewVector, error) {
+	whereClause, args := buildEmbeddingWhere(filters)
+	args = append(args, n)
+
+	query := fmt.Sprintf(`
+		SELECT re.review_id, re.content_vec
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %s
+		ORDER BY random()
+		LIMIT $%d;
+	`, whereClause, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample content vectors: %w", err)
+	}
+
+	return scanReviewVectors(rows)
+}
+
+// ListContentVectors returns the content vectors the filters select in
+// review ID order, up to limit of them after afterReviewID, for paging
+// through all of them.
+func (r *postgresRepository) ListContentVectors(ctx context.Context, filters EmbeddingFilters, afterReviewID string, limit int) ([]ReviewVector, error) {
+	whereClause, args := buildEmbeddingWhere(filters)
+	args = append(args, afterReviewID, limit)
+
+	query := fmt.Sprintf(`
+		SELECT re.review_id, re.content_vec
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %s AND re.review_id > $%d
+		ORDER BY re.review_id
+		LIMIT $%d;
+	`, whereClause, len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list content vectors: %w", err)
+	}
+
+	return scanReviewVectors(rows)
+}
+
+func scanReviewVectors(rows pgx.Rows) ([]ReviewVector, error) {
+	defer rows.Close()
+
+	var vectors []ReviewVector
+	for rows.Next() {
+		var reviewID string
+		var vector pgvector.Vector
+		if err := rows.Scan(&reviewID, &vector); err != nil {
+			return nil, fmt.Errorf("failed to scan content vector: %w", err)
+		}
+		vectors = append(vectors, ReviewVector{ReviewID: reviewID, Vector: vector.Slice()})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating content vectors: %w", err)
+	}
+
+	return vectors, nil
+}
+
+func (r *postgresRepository) CreateClustering(ctx context.Context, clustering *Clustering) error {
+	query := `
+		INSERT INTO review_clusterings
+			(clustering_id, saga_id, app_id, model, k, filters, status, started_at)
+		VALUES
+			($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8);
+	`
+
+	if _, err := r.db.Exec(ctx, query,
+		clustering.ClusteringID,
+		clustering.SagaID,
+		clustering.AppID,
+		clustering.Model,
+		clustering.K,
+		clustering.Filters,
+		clustering.Status,
+		clustering.StartedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create clustering %s: %w", clustering.ClusteringID, err)
+	}
+
+	return nil
+}
+
+// RecordClusterAssignments stores the cluster of each review in one round
+// trip.
+func (r *postgresRepository) RecordClusterAssignments(ctx context.Context, clusteringID string, assignments []ClusterAssignment) error {
+	if len(assignments) == 0 {
+		return nil
+	}
+
+	reviewIDs := make([]string, len(assignments))
+	clusters := make([]int32, len(assignments))
+	distances := make([]float64, len(assignments))
+	for i, assignment := range assignments {
+		reviewIDs[i] = assignment.ReviewID
+		clusters[i] = int32(assignment.ClusterIndex)
+		distances[i] = assignment.Distance
+	}
+
+	query := `
+		INSERT INTO review_cluster_assignments (clustering_id, review_id, cluster_index, distance)
+		SELECT $1, unnest($2::varchar[]), unnest($3::integer[]), unnest($4::double precision[])
+		ON CONFLICT (clustering_id, review_id) DO UPDATE
+		SET cluster_index = EXCLUDED.cluster_index, distance = EXCLUDED.distance;
+	`
+
+	if _, err := r.db.Exec(ctx, query, clusteringID, reviewIDs, clusters, distances); err != nil {
+		return fmt.Errorf("failed to record assignments of clustering %s: %w", clusteringID, err)
+	}
+
+	return nil
+}
+
+// FinishClustering stores the centroids and persists the clustering's
+// status, counts, error and finish time in one transaction.
+func (r *postgresRepository) FinishClustering(ctx context.Context, clustering *Clustering, centroids []ClusterCentroid) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		for _, centroid := range centroids {
+			batch.Queue(`
+				INSERT INTO review_cluster_centroids (clustering_id, cluster_index, size, centroid)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (clustering_id, cluster_index) DO UPDATE
+				SET size = EXCLUDED.size, centroid = EXCLUDED.centroid;
+			`, clustering.ClusteringID, centroid.ClusterIndex, centroid.Size, pgvector.NewVector(centroid.Centroid))
+		}
+		batch.Queue(`
+			UPDATE review_clusterings
+			SET status = $2, reviews = $3, inertia = $4, error = NULLIF($5, ''), finished_at = $6
+			WHERE clustering_id = $1;
+		`, clustering.ClusteringID, clustering.Status, clustering.Reviews, clustering.Inertia, clustering.Error, clustering.FinishedAt)
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to finish clustering %s: %w", clustering.ClusteringID, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeleteReviews removes everything stored about the reviews: their
+// embeddings, archived ones included, error ledger entries, cluster assignments and near-duplicate
+// pairs, in one transaction. It returns the number of embedding rows
+// deleted. Aggregates such as centroids are left for their next
+// recomputation.
+func (r *postgresRepository) DeleteReviews(ctx context.Context, reviewIDs []string) (int64, error) {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if len(reviewIDs) == 0 {
+		return 0, nil
+	}
+
+	var deleted int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM review_embeddings WHERE review_id = ANY($1);`, reviewIDs)
+		if err != nil {
+			return fmt.Errorf("failed to delete embeddings: %w", err)
+		}
+		deleted = tag.RowsAffected()
+
+		batch := &pgx.Batch{}
+		batch.Queue(`DELETE FROM review_embeddings_archive WHERE review_id = ANY($1);`, reviewIDs)
+		batch.Queue(`DELETE FROM vectorize_errors WHERE review_id = ANY($1);`, reviewIDs)
+		batch.Queue(`DELETE FROM review_cluster_assignments WHERE review_id = ANY($1);`, reviewIDs)
+		batch.Queue(`DELETE FROM review_projection_points WHERE review_id = ANY($1);`, reviewIDs)
+		batch.Queue(`DELETE FROM review_duplicates WHERE review_id_a = ANY($1) OR review_id_b = ANY($1);`, reviewIDs)
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to delete derived rows: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete %d reviews: %w", len(reviewIDs), err)
+	}
+
+	return deleted, nil
+}
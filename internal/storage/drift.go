@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+)
+
+// DriftBaseline is the distribution of an app's content vectors of a model
+// that the drift monitor compares recent vectors with, and the outcome of
+// the last comparison.
+type DriftBaseline struct {
+	AppID         string     `json:"app_id"`
+	Model         string     `json:"model"`
+	Samples       int        `json:"samples"`
+	Mean          []float32  `json:"-"`
+	NormHistogram []float64  `json:"norm_histogram"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CheckedAt     *time.Time `json:"checked_at,omitempty"`
+	MeanDistance  *float64   `json:"mean_distance,omitempty"`
+	NormDistance  *float64   `json:"norm_distance,omitempty"`
+	Drifted       bool       `json:"drifted"`
+}
+
+// ListRecentlyEmbeddedApps returns the apps with content vectors of the model
+// embedded since the given time.
+func (r *postgresRepository) ListRecentlyEmbeddedApps(ctx context.Context, model string, since time.Time) ([]string, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	query := `
+		SELECT DISTINCT app_id FROM review_embeddings
+		WHERE model = $1 AND content_vec IS NOT NULL AND COALESCE(updated_at, created_at) >= $2
+		ORDER BY app_id;
+	`
+
+	rows, err := r.db.Query(ctx, query, model, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recently embedded apps: %w", err)
+	}
+	apps, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recently embedded apps: %w", err)
+	}
+	return apps, nil
+}
+
+// ListRecentContentVectors returns up to limit of the app's content vectors
+// of the model embedded since the given time, most recent first.
+func (r *postgresRepository) ListRecentContentVectors(ctx context.Context, appID, model string, since time.Time, limit int) ([][]float32, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT content_vec FROM review_embeddings
+		WHERE app_id = $1 AND model = $2 AND content_vec IS NOT NULL
+			AND COALESCE(updated_at, created_at) >= $3
+		ORDER BY COALESCE(updated_at, created_at) DESC
+		LIMIT $4;
+	`
+
+	rows, err := r.db.Query(ctx, query, appID, model, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent content vectors of app %s: %w", appID, err)
+	}
+	defer rows.Close()
+
+	var vectors [][]float32
+	for rows.Next() {
+		var vector pgvector.Vector
+		if err := rows.Scan(&vector); err != nil {
+			return nil, fmt.Errorf("failed to scan content vector: %w", err)
+		}
+		vectors = append(vectors, vector.Slice())
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating content vectors: %w", err)
+	}
+
+	return vectors, nil
+}
+
+// GetDriftBaseline returns the drift baseline of the app and model, or nil
+// when there is none yet.
+func (r *postgresRepository) GetDriftBaseline(ctx context.Context, appID, model string) (*DriftBaseline, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT app_id, model, samples, mean_vec, norm_histogram, created_at,
+			checked_at, mean_distance, norm_distance, drifted
+		FROM embedding_drift_baselines
+		WHERE app_id = $1 AND model = $2;
+	`
+
+	baseline, err := scanDriftBaseline(r.db.QueryRow(ctx, query, appID, model))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get drift baseline of app %s: %w", appID, err)
+	}
+	return &baseline, nil
+}
+
+// ListDriftBaselines returns the drift baselines of the app, or of every app
+// when appID is empty.
+func (r *postgresRepository) ListDriftBaselines(ctx context.Context, appID string) ([]DriftBaseline, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT app_id, model, samples, mean_vec, norm_histogram, created_at,
+			checked_at, mean_distance, norm_distance, drifted
+		FROM embedding_drift_baselines
+		WHERE $1 = '' OR app_id = $1
+		ORDER BY app_id, model;
+	`
+
+	rows, err := r.db.Query(ctx, query, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drift baselines: %w", err)
+	}
+	defer rows.Close()
+
+	var baselines []DriftBaseline
+	for rows.Next() {
+		baseline, err := scanDriftBaseline(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan drift baseline: %w", err)
+		}
+		baselines = append(baselines, baseline)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating drift baselines: %w", err)
+	}
+
+	return baselines, nil
+}
+
+func scanDriftBaseline(row pgx.Row) (DriftBaseline, error) {
+	var baseline DriftBaseline
+	var mean pgvector.Vector
+	err := row.Scan(&baseline.AppID, &baseline.Model, &baseline.Samples, &mean, &baseline.NormHistogram,
+		&baseline.CreatedAt, &baseline.CheckedAt, &baseline.MeanDistance, &baseline.NormDistance, &baseline.Drifted)
+	baseline.Mean = mean.Slice()
+	return baseline, err
+}
+
+// SaveDriftBaseline stores the baseline of its app and model, replacing the
+// previous one and the outcome of its last check.
+func (r *postgresRepository) SaveDriftBaseline(ctx context.Context, baseline DriftBaseline) error {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+		INSERT INTO embedding_drift_baselines (app_id, model, samples, mean_vec, norm_histogram)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (app_id, model) DO UPDATE
+		SET samples = EXCLUDED.samples, mean_vec = EXCLUDED.mean_vec, norm_histogram = EXCLUDED.norm_histogram,
+			created_at = NOW(), checked_at = NULL, mean_distance = NULL, norm_distance = NULL, drifted = FALSE;
+	`
+
+	if _, err := r.db.Exec(ctx, query, baseline.AppID, baseline.Model, baseline.Samples,
+		pgvector.NewVector(baseline.Mean), baseline.NormHistogram); err != nil {
+		return fmt.Errorf("failed to save drift baseline of app %s: %w", baseline.AppID, err)
+	}
+	return nil
+}
+
+// RecordDriftCheck stores the outcome of a check against the baseline of the
+// app and model.
+func (r *postgresRepository) RecordDriftCheck(ctx context.Context, appID, model string, meanDistance, normDistance float64, drifted bool) error {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	query := `
+		UPDATE embedding_drift_baselines
+		SET checked_at = NOW(), mean_distance = $3, norm_distance = $4, drifted = $5
+		WHERE app_id = $1 AND model = $2;
+	`
+
+	if _, err := r.db.Exec(ctx, query, appID, model, meanDistance, normDistance, drifted); err != nil {
+		return fmt.Errorf("failed to record drift check of app %s: %w", appID, err)
+	}
+	return nil
+}
+
+// DeleteDriftBaselines deletes the drift baselines of the app, or of every
+// app when appID is empty, so that the next checks take new ones. It returns
+// the number of baselines deleted.
+func (r *postgresRepository) DeleteDriftBaselines(ctx context.Context, appID string) (int64, error) {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM embedding_drift_baselines WHERE $1 = '' OR app_id = $1;`, appID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete drift baselines: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// ListEmbeddedReviewIDs returns the IDs of the reviews the filters select in
+// ID order, up to limit of them after afterReviewID, for paging through them
+// without loading their vectors.
+func (r *postgresRepository) ListEmbeddedReviewIDs(ctx context.Context, filters EmbeddingFilters, afterReviewID string, limit int) ([]string, error) {
+	whereClause, args := buildEmbeddingWhere(filters)
+	args = append(args, afterReviewID, limit)
+
+	query := fmt.Sprintf(`
+		SELECT re.review_id
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %s AND re.review_id > $%d
+		ORDER BY re.review_id
+		LIMIT $%d;
+	`, whereClause, len(args)-1, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedded reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviewIDs []string
+	for rows.Next() {
+		var reviewID string
+		if err := rows.Scan(&reviewID); err != nil {
+			return nil, fmt.Errorf("failed to scan review id: %w", err)
+		}
+		reviewIDs = append(reviewIDs, reviewID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating embedded reviews: %w", err)
+	}
+
+	return reviewIDs, nil
+}
+
+// FindNearDuplicates looks up, for each of the given reviews, its closest
+// neighbors among the reviews the filters select and returns the pairs with
+// a cosine similarity of at least minSimilarity. Each pair is returned once,
+// with the smaller review ID first. Only the nearest neighbors of each review
+// are compared, so a review with more duplicates than that is still linked to
+// the rest through them.
+func (r *postgresRepository) FindNearDuplicates(ctx context.Context, filters EmbeddingFilters, reviewIDs []string, neighbors int, minSimilarity float64) ([]DuplicatePair, error) {
+	if len(reviewIDs) == 0 {
+		return nil, nil
+	}
+
+	// The same clause and placeholders select both the page of reviews and
+	// their neighbors.
+	whereClause, args := buildEmbeddingWhere(filters)
+	args = append(args, reviewIDs, neighbors, minSimilarity)
+	n := len(args)
+
+	query := fmt.Sprintf(`
+		WITH page AS (
+			SELECT re.review_id, re.content_vec
+			FROM review_embeddings re
+			JOIN clean_reviews cr ON cr.id = re.review_id
+			WHERE %[1]s AND re.review_id = ANY($%[2]d::varchar[])
+		)
+		SELECT DISTINCT
+			LEAST(p.review_id, nb.review_id), GREATEST(p.review_id, nb.review_id), nb.similarity
+		FROM page p
+		CROSS JOIN LATERAL (
+			SELECT re.review_id, 1 - (re.content_vec <=> p.content_vec) AS similarity
+			FROM review_embeddings re
+			JOIN clean_reviews cr ON cr.id = re.review_id
+			WHERE %[1]s AND re.review_id <> p.review_id
+			ORDER BY re.content_vec <=> p.content_vec
+			LIMIT $%[3]d
+		) nb
+		WHERE nb.similarity >= $%[4]d;
+	`, whereClause, n-2, n-1, n)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find near duplicates: %w", err)
+	}
+	defer rows.Close()
+
+	var pairs []DuplicatePair
+	for rows.Next() {
+		var pair DuplicatePair
+		if err := rows.Scan(&pair.ReviewIDA, &pair.ReviewIDB, &pair.Similarity); err != nil {
+			return nil, fmt.Errorf("failed to scan near duplicate: %w", err)
+		}
+		pairs = append(pairs, pair)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating near duplicates: %w", err)
+	}
+
+	return pairs, nil
+}
+
+// RecordDuplicates stores the pairs in one round trip, refreshing the
+// similarity and detection time of pairs found before.
+func (r *postgresRepository) RecordDuplicates(ctx context.Context, appID, model string, pairs []DuplicatePair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	reviewIDsA := make([]string, len(pairs))
+	reviewIDsB := make([]string, len(pairs))
+	similarities := make([]float64, len(pairs))
+	for i, pair := range pairs {
+		reviewIDsA[i] = pair.ReviewIDA
+		reviewIDsB[i] = pair.ReviewIDB
+		similarities[i] = pair.Similarity
+	}
+
+	query := `
+		INSERT INTO review_duplicates (review_id_a, review_id_b, app_id, model, similarity)
+		SELECT unnest($1::varchar[]), unnest($2::varchar[]), $3, $4, unnest($5::double precision[])
+		ON CONFLICT (review_id_a, review_id_b) DO UPDATE
+		SET model = EXCLUDED.model, similarity = EXCLUDED.similarity, detected_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query, reviewIDsA, reviewIDsB, appID, model, similarities); err != nil {
+		return fmt.Errorf("failed to record duplicates of app %s: %w", appID, err)
+	}
+
+	return nil
+}
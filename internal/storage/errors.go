@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// The kinds of repository failures. Errors of the review fetches and counts,
+// the embedding writes and the similarity searches match one of them with
+// errors.Is when they have a kind, keeping their message and the driver
+// error they wrap, so that callers can decide whether to retry, skip or give
+// up without reading error text.
+var (
+	// ErrNotFound matches errors about a row that does not exist. Lookups of
+	// a single row return nil instead when it is missing.
+	ErrNotFound = errors.New("not found")
+	// ErrDimensionMismatch matches writes and comparisons of vectors of
+	// another dimension than their column or each other, which no retry
+	// fixes.
+	ErrDimensionMismatch = errors.New("vector dimension mismatch")
+	// ErrConflict matches writes that conflict with rows already stored,
+	// such as unique violations or embeddings of another tenant.
+	ErrConflict = errors.New("conflict with stored rows")
+	// ErrTransient matches failures that retrying later may get past: lost
+	// or refused connections, failovers, serialization failures and
+	// deadlocks. Retried operations only fail with it once the retry policy
+	// gave up.
+	ErrTransient = errors.New("transient database failure")
+)
+
+// ErrReviewNotEmbedded is returned by FindSimilar for a review that has no
+// content embedding to compare against.
+var ErrReviewNotEmbedded error = &kindError{kind: ErrNotFound, err: errors.New("review has no embedding")}
+
+// ErrForeignTenant is returned for writes to embeddings owned by a tenant
+// other than the writer's.
+var ErrForeignTenant error = &kindError{kind: ErrConflict, err: errors.New("embedding belongs to another tenant")}
+
+// kindError tags err with its kind, one of the errors above.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classify tags err with its kind when it has one and is not tagged yet.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := errorKind(err)
+	if kind == nil || errors.Is(err, kind) {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+func errorKind(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "22000": // data_exception
+			// pgvector reports "expected 1536 dimensions, not 3072" and
+			// "different vector dimensions 1536 and 3072" with this code.
+			if strings.Contains(pgErr.Message, "dimensions") {
+				return ErrDimensionMismatch
+			}
+		case "23505", // unique_violation
+			"23P01": // exclusion_violation
+			return ErrConflict
+		}
+	}
+
+	if retryableError(err) {
+		return ErrTransient
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// ListEmbeddings returns up to limit embeddings made with filters.Model that
+// match the filters, in (review_id, chunk_index) order after the cursor, for
+// streaming them out page by page. Every chunk of a long review is returned.
+func (r *postgresRepository) ListEmbeddings(ctx context.Context, filters SearchFilters, after EmbeddingCursor, limit int) ([]StoredEmbedding, error) {
+	whereClause, args := appendSearchFilters(
+		"re.content_vec IS NOT NULL AND re.model = $1 AND (re.review_id, re.chunk_index) > ($2, $3)",
+		[]any{filters.Model, after.ReviewID, after.ChunkIndex},
+		filters,
+	)
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		SELECT
+			re.embedding_id, re.review_id, re.chunk_index, re.app_id,
+			COALESCE(re.language, ''), COALESCE(re.rating, 0), COALESCE(re.country, ''),
+			re.model, re.dim, re.content_vec, re.response_vec, re.title_vec,
+			re.normalized, COALESCE(re.tenant_id, ''), COALESCE(re.content_hash, ''), re.content_en_vec,
+			COALESCE(re.app_version, ''), COALESCE(re.device, ''), COALESCE(re.platform, ''), re.helpful_votes,
+			re.created_at, cr.reviewed_at
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %s
+		ORDER BY re.review_id, re.chunk_index
+		LIMIT $%d;
+	`, whereClause, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var embeddings []StoredEmbedding
+	for rows.Next() {
+		var embedding StoredEmbedding
+		var contentVec pgvector.Vector
+		var responseVec, titleVec, contentENVec *pgvector.Vector
+		if err := rows.Scan(
+			&embedding.EmbeddingID,
+			&embedding.ReviewID,
+			&embedding.ChunkIndex,
+			&embedding.AppID,
+			&embedding.Language,
+			&embedding.Rating,
+			&embedding.Country,
+			&embedding.Model,
+			&embedding.Dim,
+			&contentVec,
+			&responseVec,
+			&titleVec,
+			&embedding.Normalized,
+			&embedding.TenantID,
+			&embedding.ContentHash,
+			&contentENVec,
+			&embedding.AppVersion,
+			&embedding.Device,
+			&embedding.Platform,
+			&embedding.HelpfulVotes,
+			&embedding.CreatedAt,
+			&embedding.ReviewedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+
+		embedding.ContentVec = contentVec.Slice()
+		if responseVec != nil {
+			embedding.ResponseVec = responseVec.Slice()
+		}
+		if titleVec != nil {
+			embedding.TitleVec = titleVec.Slice()
+		}
+		if contentENVec != nil {
+			embedding.ContentENVec = contentENVec.Slice()
+		}
+		embeddings = append(embeddings, embedding)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating embeddings: %w", err)
+	}
+
+	return embeddings, nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DatabaseLoad is how busy the Postgres cluster is: the replay lag of its
+// most lagging replica and the number of sessions running a query.
+type DatabaseLoad struct {
+	ReplicationLag    time.Duration
+	ActiveConnections int
+}
+
+// GetDatabaseLoad samples the load of the cluster. Replication lag is read
+// from pg_stat_replication and is zero without replicas or on a replica.
+func (r *postgresRepository) GetDatabaseLoad(ctx context.Context) (DatabaseLoad, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	query := `
+		SELECT
+			COALESCE((SELECT MAX(EXTRACT(EPOCH FROM replay_lag)) FROM pg_stat_replication), 0)::float8,
+			(SELECT COUNT(*) FROM pg_stat_activity WHERE state = 'active' AND backend_type = 'client backend');
+	`
+
+	var lagSeconds float64
+	var load DatabaseLoad
+	if err := r.db.QueryRow(ctx, query).Scan(&lagSeconds, &load.ActiveConnections); err != nil {
+		return DatabaseLoad{}, fmt.Errorf("failed to get database load: %w", err)
+	}
+	load.ReplicationLag = time.Duration(lagSeconds * float64(time.Second))
+
+	return load, nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Maintenance is the maintenance mode switched by control events, shared by
+// all instances.
+type Maintenance struct {
+	Enabled   bool      `json:"enabled"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetMaintenance returns the maintenance mode last switched, or a disabled
+// one when it never was.
+func (r *postgresRepository) GetMaintenance(ctx context.Context) (Maintenance, error) {
+	var m Maintenance
+	err := r.db.QueryRow(ctx, `SELECT enabled, reason, updated_at FROM vectorize_maintenance WHERE id;`).
+		Scan(&m.Enabled, &m.Reason, &m.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Maintenance{}, nil
+	}
+	if err != nil {
+		return Maintenance{}, fmt.Errorf("failed to get maintenance mode: %w", err)
+	}
+	return m, nil
+}
+
+// SetMaintenance switches maintenance mode on or off.
+func (r *postgresRepository) SetMaintenance(ctx context.Context, enabled bool, reason string) error {
+	query := `
+		INSERT INTO vectorize_maintenance (id, enabled, reason, updated_at)
+		VALUES (TRUE, $1, $2, NOW())
+		ON CONFLICT (id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, reason = EXCLUDED.reason, updated_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query, enabled, reason); err != nil {
+		return fmt.Errorf("failed to set maintenance mode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// metadataColumns are the optional clean_reviews columns copied into
+// review_embeddings, so that consumers can filter embeddings without joining
+// back to clean_reviews, with the expressions reading them when present and
+// when missing.
+var metadataColumns = []struct {
+	name    string
+	read    string
+	missing string
+}{
+	{"app_version", "COALESCE(cr.app_version::text, '')", "''"},
+	{"device", "COALESCE(cr.device::text, '')", "''"},
+	{"platform", "COALESCE(cr.platform::text, '')", "''"},
+	{"helpful_votes", "cr.helpful_votes::integer", "NULL::integer"},
+}
+
+// detectMetadataColumns finds which of the metadata columns clean_reviews
+// has; reviews are read without the others.
+func (r *postgresRepository) detectMetadataColumns(ctx context.Context) error {
+	names := make([]string, len(metadataColumns))
+	for i, column := range metadataColumns {
+		names[i] = column.name
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'clean_reviews' AND column_name = ANY($1);
+	`, names)
+	if err != nil {
+		return fmt.Errorf("failed to inspect clean_reviews columns: %w", err)
+	}
+	defer rows.Close()
+
+	present := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan column name: %w", err)
+		}
+		present[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating columns: %w", err)
+	}
+
+	selects := make([]string, len(metadataColumns))
+	for i, column := range metadataColumns {
+		if present[column.name] {
+			selects[i] = column.read
+		} else {
+			selects[i] = column.missing
+		}
+	}
+	r.metadataSelect = strings.Join(selects, ", ")
+	return nil
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetCurrentModel returns the model marked as current by the last model
+// migration, or "" when no migration has finished yet.
+func (r *postgresRepository) GetCurrentModel(ctx context.Context) (string, error) {
+	var model string
+	err := r.db.QueryRow(ctx, `SELECT model FROM embedding_model;`).Scan(&model)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get current model: %w", err)
+	}
+
+	return model, nil
+}
+
+// CountModelMigration returns how many reviews embedded with fromModel are
+// still to be migrated to toModel and how many are staged already.
+func (r *postgresRepository) CountModelMigration(ctx context.Context, fromModel, toModel string) (remaining int64, staged int64, err error) {
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE m.review_id IS NULL),
+			COUNT(*) FILTER (WHERE m.review_id IS NOT NULL)
+		FROM review_embeddings re
+		LEFT JOIN review_embeddings_migration m
+			ON m.review_id = re.review_id AND m.chunk_index = 0 AND m.model = $2
+		WHERE re.model = $1 AND re.chunk_index = 0;
+	`
+
+	if err := r.db.QueryRow(ctx, query, fromModel, toModel).Scan(&remaining, &staged); err != nil {
+		return 0, 0, fmt.Errorf("failed to count reviews to migrate: %w", err)
+	}
+
+	return remaining, staged, nil
+}
+
+// ListReviewsToMigrate returns, in ID order after afterReviewID, up to limit
+// reviews embedded with fromModel that have no staged embedding made with
+// toModel yet.
+func (r *postgresRepository) ListReviewsToMigrate(ctx context.Context, fromModel, toModel, afterReviewID string, limit int) ([]string, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT re.review_id
+		FROM review_embeddings re
+		WHERE re.model = $1 AND re.chunk_index = 0 AND re.review_id > $3
+			AND NOT EXISTS (
+				SELECT 1 FROM review_embeddings_migration m
+				WHERE m.review_id = re.review_id AND m.model = $2
+			)
+		ORDER BY re.review_id
+		LIMIT $4;
+	`
+
+	rows, err := r.db.Query(ctx, query, fromModel, toModel, afterReviewID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reviews to migrate: %w", err)
+	}
+	defer rows.Close()
+
+	var reviewIDs []string
+	for rows.Next() {
+		var reviewID string
+		if err := rows.Scan(&reviewID); err != nil {
+			return nil, fmt.Errorf("failed to scan review id: %w", err)
+		}
+		reviewIDs = append(reviewIDs, reviewID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating reviews to migrate: %w", err)
+	}
+
+	return reviewIDs, nil
+}
+
+// StageMigrationEmbeddings stores embeddings made with the target model of a
+// migration next to the production ones, replacing those staged earlier for
+// the same review chunks.
+func (r *postgresRepository) StageMigrationEmbeddings(ctx context.Context, vectors []*Vector) error {
+	return r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Write)
+		defer cancel()
+		return r.stageMigrationEmbeddings(ctx, vectors)
+	})
+}
+
+func (r *postgresRepository) stageMigrationEmbeddings(ctx context.Context, vectors []*Vector) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO review_embeddings_migration
+			(embedding_id, review_id, chunk_index, app_id, language, rating, country, model, dim, content_vec, response_vec, title_vec, normalized, tenant_id, content_hash, content_en_vec,
+			app_version, device, platform, helpful_votes)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), NULLIF($15, ''), $16,
+			NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), $20)
+		ON CONFLICT (review_id, chunk_index, model) DO UPDATE
+		SET app_id = EXCLUDED.app_id,
+			language = EXCLUDED.language,
+			rating = EXCLUDED.rating,
+			country = EXCLUDED.country,
+			dim = EXCLUDED.dim,
+			content_vec = EXCLUDED.content_vec,
+			response_vec = EXCLUDED.response_vec,
+			title_vec = EXCLUDED.title_vec,
+			normalized = EXCLUDED.normalized,
+			content_hash = EXCLUDED.content_hash,
+			content_en_vec = EXCLUDED.content_en_vec,
+			app_version = EXCLUDED.app_version,
+			device = EXCLUDED.device,
+			platform = EXCLUDED.platform,
+			helpful_votes = EXCLUDED.helpful_votes,
+			created_at = NOW();
+	`
+
+	batch := &pgx.Batch{}
+	for _, vector := range vectors {
+		batch.Queue(query, upsertEmbeddingArgs(vector)...)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for _, vector := range vectors {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to stage embedding for review %s chunk %d: %w", vector.ReviewID, vector.ChunkIndex, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *postgresRepository) CreateModelMigration(ctx context.Context, migration *ModelMigration) error {
+	query := `
+		INSERT INTO model_migrations
+			(migration_id, from_model, to_model, status, total, started_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	if _, err := r.db.Exec(ctx, query,
+		migration.MigrationID,
+		migration.FromModel,
+		migration.ToModel,
+		migration.Status,
+		migration.Total,
+		migration.StartedAt,
+		migration.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create model migration %s: %w", migration.MigrationID, err)
+	}
+
+	return nil
+}
+
+// UpdateModelMigration persists the migration's status, counts, error and
+// finish time.
+func (r *postgresRepository) UpdateModelMigration(ctx context.Context, migration *ModelMigration) error {
+	return updateModelMigration(ctx, r.db, migration)
+}
+
+func updateModelMigration(ctx context.Context, db execer, migration *ModelMigration) error {
+	migration.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE model_migrations
+		SET status = $2, total = $3, migrated = $4, failed = $5, swapped = $6,
+			error = NULLIF($7, ''), updated_at = $8, finished_at = $9
+		WHERE migration_id = $1;
+	`
+
+	if _, err := db.Exec(ctx, query,
+		migration.MigrationID,
+		migration.Status,
+		migration.Total,
+		migration.Migrated,
+		migration.Failed,
+		migration.Swapped,
+		migration.Error,
+		migration.UpdatedAt,
+		migration.FinishedAt,
+	); err != nil {
+		return fmt.Errorf("failed to update model migration %s: %w", migration.MigrationID, err)
+	}
+
+	return nil
+}
+
+// FlipModel replaces, in one transaction, the embeddings of every review with
+// a staged embedding made with the migration's target model by the staged
+// ones, marks the target model as current and completes the migration.
+// Readers see either every review on the old model or every migrated review
+// on the new one. Staged embeddings of reviews that lost their embedding in
+// the meantime, e.g. because the review was deleted, are dropped.
+func (r *postgresRepository) FlipModel(ctx context.Context, migration *ModelMigration) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM review_embeddings_migration m
+			WHERE m.model = $2 AND NOT EXISTS (
+				SELECT 1 FROM review_embeddings re
+				WHERE re.review_id = m.review_id AND re.model = $1
+			);
+		`, migration.FromModel, migration.ToModel); err != nil {
+			return fmt.Errorf("failed to drop orphaned staged embeddings: %w", err)
+		}
+
+		// Re-embedded reviews keep the tenant of the embeddings they replace.
+		if _, err := tx.Exec(ctx, `
+			UPDATE review_embeddings_migration m
+			SET tenant_id = re.tenant_id
+			FROM review_embeddings re
+			WHERE m.model = $1 AND re.review_id = m.review_id AND re.chunk_index = 0;
+		`, migration.ToModel); err != nil {
+			return fmt.Errorf("failed to carry over tenants of staged embeddings: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			DELETE FROM review_embeddings re
+			WHERE re.review_id IN (
+				SELECT review_id FROM review_embeddings_migration WHERE model = $1
+			);
+		`, migration.ToModel); err != nil {
+			return fmt.Errorf("failed to delete migrated embeddings: %w", err)
+		}
+
+		tag, err := tx.Exec(ctx, `
+			INSERT INTO review_embeddings
+				(embedding_id, review_id, chunk_index, app_id, language, rating, country, model, dim,
+				content_vec, response_vec, title_vec, normalized, tenant_id, content_hash, content_en_vec,
+				app_version, device, platform, helpful_votes, created_at)
+			SELECT
+				embedding_id, review_id, chunk_index, app_id, language, rating, country, model, dim,
+				content_vec, response_vec, title_vec, normalized, tenant_id, content_hash, content_en_vec,
+				app_version, device, platform, helpful_votes, created_at
+			FROM review_embeddings_migration
+			WHERE model = $1;
+		`, migration.ToModel)
+		if err != nil {
+			return fmt.Errorf("failed to insert migrated embeddings: %w", err)
+		}
+		migration.Swapped = tag.RowsAffected()
+
+		if _, err := tx.Exec(ctx, `DELETE FROM review_embeddings_migration WHERE model = $1;`, migration.ToModel); err != nil {
+			return fmt.Errorf("failed to clear staged embeddings: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO embedding_model (singleton, model, updated_at)
+			VALUES (TRUE, $1, NOW())
+			ON CONFLICT (singleton) DO UPDATE
+			SET model = EXCLUDED.model, updated_at = NOW();
+		`, migration.ToModel); err != nil {
+			return fmt.Errorf("failed to mark %s as current model: %w", migration.ToModel, err)
+		}
+
+		now := time.Now()
+		migration.Status = RunStatusCompleted
+		migration.FinishedAt = &now
+		return updateModelMigration(ctx, tx, migration)
+	})
+}
@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,11 +23,23 @@ type CleanReview struct {
 	ReviewedAt           time.Time  `json:"reviewed_at"`
 	ResponseDate         *time.Time `json:"response_date"`
 	ResponseContentClean *string    `json:"response_content_clean"`
+	// EmbeddedHash and EmbeddedModel describe the review's stored embedding,
+	// when it has one: the content hash of the texts it was made from and
+	// its model.
+	EmbeddedHash  string `json:"embedded_hash,omitempty"`
+	EmbeddedModel string `json:"embedded_model,omitempty"`
+	// Metadata copied into the stored rows, when clean_reviews has the
+	// columns.
+	AppVersion   string `json:"app_version,omitempty"`
+	Device       string `json:"device,omitempty"`
+	Platform     string `json:"platform,omitempty"`
+	HelpfulVotes *int32 `json:"helpful_votes,omitempty"`
 }
 
 type Vector struct {
 	EmbeddingID string    `json:"embedding_id"`
 	ReviewID    string    `json:"review_id"`
+	ChunkIndex  int       `json:"chunk_index"`
 	AppID       string    `json:"app_id"`
 	Language    string    `json:"language"`
 	Rating      int16     `json:"rating"`
@@ -32,7 +48,436 @@ type Vector struct {
 	Dim         int       `json:"dim"`
 	ContentVec  []float32 `json:"content_vec"`
 	ResponseVec []float32 `json:"response_vec,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	TitleVec    []float32 `json:"title_vec,omitempty"`
+	// ContentENVec embeds the English translation of the review next to
+	// its original text in ContentVec.
+	ContentENVec []float32 `json:"content_en_vec,omitempty"`
+	// Normalized reports whether the vectors were scaled to unit length
+	// before they were stored.
+	Normalized bool `json:"normalized"`
+	// TenantID is the tenant owning the row; rows without one belong to no
+	// tenant and may be claimed by any.
+	TenantID string `json:"tenant_id,omitempty"`
+	// ContentHash identifies the texts and settings the vectors were made
+	// from, so unchanged reviews need not be embedded again.
+	ContentHash string `json:"content_hash,omitempty"`
+	// SparseVec is the sparse companion of ContentVec, for hybrid
+	// retrieval; nil without sparse embedding.
+	SparseVec *SparseVector `json:"sparse_vec,omitempty"`
+	// Review metadata, for filtering without a join to clean_reviews.
+	AppVersion   string    `json:"app_version,omitempty"`
+	Device       string    `json:"device,omitempty"`
+	Platform     string    `json:"platform,omitempty"`
+	HelpfulVotes *int32    `json:"helpful_votes,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SparseVector is a sparse vector of Dim dimensions, given by the weights of
+// its non-zero ones.
+type SparseVector struct {
+	Dim     int32     `json:"dim"`
+	Indices []int32   `json:"indices"`
+	Values  []float32 `json:"values"`
+}
+
+// StoredEmbedding is an embedding as read back from review_embeddings, with
+// the date of its review.
+type StoredEmbedding struct {
+	Vector
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+// EmbeddingCursor is the position after the last embedding read when paging
+// through review_embeddings in (review_id, chunk_index) order.
+type EmbeddingCursor struct {
+	ReviewID   string `json:"review_id"`
+	ChunkIndex int    `json:"chunk_index"`
+}
+
+// CoverageRow compares the number of vectorizable clean reviews with the number
+// of stored embeddings for one model/language/country combination.
+type CoverageRow struct {
+	Model        string `json:"model"`
+	Language     string `json:"language"`
+	Country      string `json:"country"`
+	CleanReviews int64  `json:"clean_reviews"`
+	Embedded     int64  `json:"embedded"`
+	Remaining    int64  `json:"remaining"`
+}
+
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusCompleted RunStatus = "completed"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCancelled RunStatus = "cancelled"
+	// RunStatusDeferred marks a run stopped at a monthly quota; resuming
+	// its saga continues from the checkpoint.
+	RunStatusDeferred RunStatus = "deferred"
+)
+
+// Run is one vectorization run as tracked in vectorize_runs.
+type Run struct {
+	RunID      string             `json:"run_id"`
+	SagaID     string             `json:"saga_id"`
+	AppID      string             `json:"app_id"`
+	Filters    CleanReviewFilters `json:"filters"`
+	Status     RunStatus          `json:"status"`
+	Processed  int                `json:"processed"`
+	Skipped    int                `json:"skipped"`
+	Failed     int                `json:"failed"`
+	Error      string             `json:"error,omitempty"`
+	Checkpoint *ReviewCursor      `json:"checkpoint,omitempty"`
+	Watermark  *time.Time         `json:"watermark,omitempty"`
+	StartedAt  time.Time          `json:"started_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+}
+
+func NewRun(sagaID string, filters CleanReviewFilters) *Run {
+	now := time.Now()
+	return &Run{
+		RunID:     uuid.New().String(),
+		SagaID:    sagaID,
+		AppID:     filters.AppID,
+		Filters:   filters,
+		Status:    RunStatusRunning,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// RunFilters selects the runs ListRuns returns. Zero fields match every run;
+// StartedFrom is inclusive and StartedBefore exclusive.
+type RunFilters struct {
+	TenantID      string
+	AppID         string
+	Status        RunStatus
+	StartedFrom   *time.Time
+	StartedBefore *time.Time
+	Limit         int
+}
+
+// WatermarkScope identifies the reviews an incremental run with the filters
+// covers, so runs over different tenants, partitions, apps, countries or
+// languages keep separate watermarks.
+func WatermarkScope(filters CleanReviewFilters) string {
+	countries := append([]string(nil), filters.Countries...)
+	languages := append([]string(nil), filters.Languages...)
+	sort.Strings(countries)
+	sort.Strings(languages)
+
+	scope := strings.Join([]string{
+		filters.AppID,
+		strings.Join(countries, ","),
+		strings.Join(languages, ","),
+	}, "|")
+	if filters.SamplePercent > 0 && filters.SamplePercent < 100 {
+		scope += "|sample:" + strconv.FormatFloat(filters.SamplePercent, 'f', -1, 64) + ":" + strconv.FormatInt(filters.SampleSeed, 10)
+	}
+	if filters.PartitionCount > 0 {
+		scope = PartitionScope(filters.Partitions, filters.PartitionCount) + "|" + scope
+	}
+	if filters.TenantID != "" {
+		scope = filters.TenantID + "|" + scope
+	}
+	return scope
+}
+
+// PartitionScope names a set of app partitions out of count, e.g. "0,4,8/12".
+func PartitionScope(partitions []int, count int) string {
+	names := make([]string, len(partitions))
+	for i, p := range partitions {
+		names[i] = strconv.Itoa(p)
+	}
+	return strings.Join(names, ",") + "/" + strconv.Itoa(count)
+}
+
+// EmbeddingFilters selects the embeddings an analysis job such as clustering
+// runs over: the content vectors of an app's reviews made with Model,
+// optionally limited to a review date range.
+type EmbeddingFilters struct {
+	AppID    string `json:"app_id"`
+	Model    string `json:"model"`
+	DateFrom string `json:"date_from,omitempty"`
+	DateTo   string `json:"date_to,omitempty"`
+}
+
+// ReviewVector is the content vector of one review.
+type ReviewVector struct {
+	ReviewID string
+	Vector   []float32
+}
+
+// Clustering is one clustering of an app's reviews as tracked in
+// review_clusterings.
+type Clustering struct {
+	ClusteringID string           `json:"clustering_id"`
+	SagaID       string           `json:"saga_id,omitempty"`
+	AppID        string           `json:"app_id"`
+	Model        string           `json:"model"`
+	K            int              `json:"k"`
+	Filters      EmbeddingFilters `json:"filters"`
+	Status       RunStatus        `json:"status"`
+	Reviews      int              `json:"reviews"`
+	Inertia      float64          `json:"inertia"`
+	Error        string           `json:"error,omitempty"`
+	StartedAt    time.Time        `json:"started_at"`
+	FinishedAt   *time.Time       `json:"finished_at,omitempty"`
+}
+
+func NewClustering(sagaID string, k int, filters EmbeddingFilters) *Clustering {
+	return &Clustering{
+		ClusteringID: uuid.New().String(),
+		SagaID:       sagaID,
+		AppID:        filters.AppID,
+		Model:        filters.Model,
+		K:            k,
+		Filters:      filters,
+		Status:       RunStatusRunning,
+		StartedAt:    time.Now(),
+	}
+}
+
+// Projection is one 2D projection of an app's reviews as tracked in
+// review_projections. ExplainedVariance is the share of the variance of the
+// vectors the two axes keep.
+type Projection struct {
+	ProjectionID      string           `json:"projection_id"`
+	SagaID            string           `json:"saga_id,omitempty"`
+	AppID             string           `json:"app_id"`
+	Model             string           `json:"model"`
+	Filters           EmbeddingFilters `json:"filters"`
+	Status            RunStatus        `json:"status"`
+	Reviews           int              `json:"reviews"`
+	ExplainedVariance float64          `json:"explained_variance"`
+	Error             string           `json:"error,omitempty"`
+	StartedAt         time.Time        `json:"started_at"`
+	FinishedAt        *time.Time       `json:"finished_at,omitempty"`
+}
+
+func NewProjection(sagaID string, filters EmbeddingFilters) *Projection {
+	return &Projection{
+		ProjectionID: uuid.New().String(),
+		SagaID:       sagaID,
+		AppID:        filters.AppID,
+		Model:        filters.Model,
+		Filters:      filters,
+		Status:       RunStatusRunning,
+		StartedAt:    time.Now(),
+	}
+}
+
+// ProjectionPoint is the position of a review on a 2D projection.
+type ProjectionPoint struct {
+	ReviewID string  `json:"review_id"`
+	X        float32 `json:"x"`
+	Y        float32 `json:"y"`
+}
+
+// ClusterCentroid is the center of one cluster and the number of reviews
+// assigned to it.
+type ClusterCentroid struct {
+	ClusterIndex int       `json:"cluster_index"`
+	Size         int       `json:"size"`
+	Centroid     []float32 `json:"-"`
+}
+
+// ClusterAssignment places a review in a cluster, with its Euclidean
+// distance to the cluster's centroid.
+type ClusterAssignment struct {
+	ReviewID     string
+	ClusterIndex int
+	Distance     float64
+}
+
+// Rating buckets centroids are computed per.
+const (
+	RatingBucketNegative = "negative" // 1-2 stars
+	RatingBucketNeutral  = "neutral"  // 3 stars
+	RatingBucketPositive = "positive" // 4-5 stars
+	RatingBucketUnrated  = "unrated"
+)
+
+// DuplicatePair is two reviews of an app whose content vectors are at least
+// as similar as the near-duplicate threshold. ReviewIDA sorts before
+// ReviewIDB.
+type DuplicatePair struct {
+	ReviewIDA  string  `json:"review_id_a"`
+	ReviewIDB  string  `json:"review_id_b"`
+	Similarity float64 `json:"similarity"`
+}
+
+// SearchFilters narrows a similarity search down by review metadata.
+type SearchFilters struct {
+	Model           string `json:"-"`
+	AppID           string `json:"app_id,omitempty"`
+	Language        string `json:"language,omitempty"`
+	Country         string `json:"country,omitempty"`
+	MinRating       int    `json:"min_rating,omitempty"`
+	MaxRating       int    `json:"max_rating,omitempty"`
+	DateFrom        string `json:"date_from,omitempty"`
+	DateTo          string `json:"date_to,omitempty"`
+	ExcludeReviewID string `json:"-"`
+}
+
+// SimilarReview is one result of a similarity search.
+type SimilarReview struct {
+	ReviewID   string    `json:"review_id"`
+	AppID      string    `json:"app_id"`
+	Language   string    `json:"language"`
+	Country    string    `json:"country"`
+	Rating     int16     `json:"rating"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+	Content    string    `json:"content"`
+	Similarity float64   `json:"similarity"`
+	// RerankScore is the reranker's relevance score, set on reranked
+	// searches only.
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+}
+
+// Review fields that can be embedded as the review text, selected by
+// vectorizer.text_source.
+const (
+	TextSourceContentClean      = "content_clean"
+	TextSourceContentEN         = "content_en"
+	TextSourceContentENFallback = "content_en_fallback"
+)
+
+// Text returns the review text to embed for the given text source. It is
+// empty when the source field is missing.
+func (r CleanReview) Text(source string) string {
+	switch source {
+	case TextSourceContentEN:
+		if r.ContentEN != nil {
+			return *r.ContentEN
+		}
+		return ""
+	case TextSourceContentENFallback:
+		if r.ContentEN != nil && *r.ContentEN != "" {
+			return *r.ContentEN
+		}
+		return r.ContentClean
+	default:
+		return r.ContentClean
+	}
+}
+
+// TextVolume is the amount of review and response text matching a set of
+// filters.
+type TextVolume struct {
+	Reviews       int64 `json:"reviews"`
+	ContentChars  int64 `json:"content_chars"`
+	Responses     int64 `json:"responses"`
+	ResponseChars int64 `json:"response_chars"`
+}
+
+// Stages a review can fail in, as recorded in the vectorize_errors ledger.
+const (
+	ErrorStageEmbed    = "embed"
+	ErrorStageValidate = "validate"
+	ErrorStageStore    = "store"
+)
+
+// ReviewError is one entry of the per-review error ledger.
+type ReviewError struct {
+	ReviewID string `json:"review_id"`
+	AppID    string `json:"app_id"`
+	RunID    string `json:"run_id"`
+	Stage    string `json:"stage"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+}
+
+// ProcessedSaga records that a saga's request was handled, so redeliveries of
+// it are answered with Reply, the payload of the original completed event,
+// instead of being handled again. The digests are SHA-256 hex digests of the
+// request and reply payloads.
+type ProcessedSaga struct {
+	SagaID        string          `json:"saga_id"`
+	EventType     string          `json:"event_type"`
+	RequestDigest string          `json:"request_digest"`
+	ResultDigest  string          `json:"result_digest"`
+	Reply         json.RawMessage `json:"reply"`
+	ProcessedAt   time.Time       `json:"processed_at"`
+}
+
+// OutboxMessage is an event recorded in event_outbox together with the state
+// change it announces, waiting to be published to Topic as it is.
+type OutboxMessage struct {
+	ID        int64          `json:"id"`
+	SagaID    string         `json:"saga_id"`
+	Topic     string         `json:"topic"`
+	Key       []byte         `json:"key"`
+	Value     []byte         `json:"value"`
+	Headers   []OutboxHeader `json:"headers"`
+	CreatedAt time.Time      `json:"created_at"`
+	SentAt    *time.Time     `json:"sent_at,omitempty"`
+}
+
+// OutboxHeader is a Kafka header of an OutboxMessage.
+type OutboxHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// ShadowVector is the content vector of one chunk of a review made with a
+// candidate model in shadow mode, kept apart from review_embeddings so that
+// production reads never see it.
+type ShadowVector struct {
+	ReviewID   string
+	ChunkIndex int
+	AppID      string
+	Model      string
+	ContentVec []float32
+	CreatedAt  time.Time
+}
+
+// ShadowPair holds the production and shadow content vectors of the first
+// chunk of a review.
+type ShadowPair struct {
+	ReviewID   string
+	Production []float32
+	Shadow     []float32
+}
+
+// ModelMigration is one run of the migration of the embeddings of FromModel
+// to ToModel, as tracked in model_migrations.
+type ModelMigration struct {
+	MigrationID string     `json:"migration_id"`
+	FromModel   string     `json:"from_model"`
+	ToModel     string     `json:"to_model"`
+	Status      RunStatus  `json:"status"`
+	Total       int64      `json:"total"`
+	Migrated    int64      `json:"migrated"`
+	Failed      int64      `json:"failed"`
+	Swapped     int64      `json:"swapped"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+func NewModelMigration(fromModel, toModel string) *ModelMigration {
+	now := time.Now()
+	return &ModelMigration{
+		MigrationID: uuid.New().String(),
+		FromModel:   fromModel,
+		ToModel:     toModel,
+		Status:      RunStatusRunning,
+		StartedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+// RunReviewsArtifact returns the reference to the vectorize_run_reviews rows
+// recorded for a saga, as published in the completed event.
+func RunReviewsArtifact(sagaID string) string {
+	return "postgres:vectorize_run_reviews?saga_id=" + sagaID
 }
 
 func NewVector(reviewID, appID string, contentVec []float32) *Vector {
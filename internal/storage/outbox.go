@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// FinishRun records the run's final state and queues the messages announcing
+// it in one transaction, so the outcome of a run is published even when the
+// process dies right after recording it.
+func (r *postgresRepository) FinishRun(ctx context.Context, run *Run, messages []OutboxMessage) error {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		if err := updateRun(ctx, tx, run); err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		query := `
+			INSERT INTO event_outbox (saga_id, topic, message_key, value, headers)
+			VALUES (NULLIF($1, ''), $2, $3, $4, $5);
+		`
+
+		batch := &pgx.Batch{}
+		for _, m := range messages {
+			batch.Queue(query, m.SagaID, m.Topic, m.Key, m.Value, m.Headers)
+		}
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to queue outbox messages of run %s: %w", run.RunID, err)
+		}
+		return nil
+	})
+}
+
+// RelayOutbox hands up to limit unsent messages, oldest first, to publish and
+// marks them sent once it succeeds. The messages stay locked until then, so
+// concurrent relays skip them instead of publishing them twice. It returns
+// the number of messages sent.
+func (r *postgresRepository) RelayOutbox(ctx context.Context, limit int, publish func([]OutboxMessage) error) (int, error) {
+	var sent int
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, COALESCE(saga_id, ''), topic, message_key, value, headers, created_at
+			FROM event_outbox
+			WHERE sent_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED;
+		`
+
+		rows, err := tx.Query(ctx, query, limit)
+		if err != nil {
+			return fmt.Errorf("failed to query outbox: %w", err)
+		}
+
+		messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (OutboxMessage, error) {
+			var m OutboxMessage
+			err := row.Scan(&m.ID, &m.SagaID, &m.Topic, &m.Key, &m.Value, &m.Headers, &m.CreatedAt)
+			return m, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan outbox messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		if err := publish(messages); err != nil {
+			return err
+		}
+
+		ids := make([]int64, len(messages))
+		for i, m := range messages {
+			ids[i] = m.ID
+		}
+		if _, err := tx.Exec(ctx, `UPDATE event_outbox SET sent_at = NOW() WHERE id = ANY($1);`, ids); err != nil {
+			return fmt.Errorf("failed to mark outbox messages sent: %w", err)
+		}
+
+		sent = len(messages)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return sent, nil
+}
+
+// PurgeOutbox deletes the messages sent before sentBefore and returns how
+// many it deleted.
+func (r *postgresRepository) PurgeOutbox(ctx context.Context, sentBefore time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM event_outbox WHERE sent_at < $1;`, sentBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
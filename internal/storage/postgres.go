@@ -2,34 +2,238 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pgvector/pgvector-go"
+
+	"github.com/quiby-ai/review-vectorizer/internal/retry"
 )
 
 type CleanReviewFilters struct {
-	ForceRecompute bool
-	AppID          string
-	Countries      []string
-	Languages      []string
-	DateFrom       string
-	DateTo         string
+	ForceRecompute   bool   `json:"force_recompute"`
+	OnlyFailed       bool   `json:"only_failed,omitempty"`
+	StaleModel       bool   `json:"stale_model,omitempty"`
+	ResponseBackfill bool   `json:"response_backfill,omitempty"`
+	Model            string `json:"model,omitempty"`
+	// TenantID confines a run to the clean reviews and embeddings of the
+	// tenant; runs without one only touch embeddings without a tenant.
+	TenantID         string   `json:"tenant_id,omitempty"`
+	AppID            string   `json:"app_id,omitempty"`
+	Countries        []string `json:"countries,omitempty"`
+	Languages        []string `json:"languages,omitempty"`
+	DateFrom         string   `json:"date_from,omitempty"`
+	DateTo           string   `json:"date_to,omitempty"`
+	MinRating        int      `json:"min_rating,omitempty"`
+	MaxRating        int      `json:"max_rating,omitempty"`
+	ReviewIDs        []string `json:"review_ids,omitempty"`
+	OnlyWithResponse bool     `json:"only_with_response,omitempty"`
+	// Order is the order reviews are processed in, one of the Order
+	// constants; empty means OrderNewestFirst.
+	Order string `json:"order,omitempty"`
+	// SamplePercent confines a run to a sample of about this percentage of
+	// the matching reviews, picked by hashing each review ID with
+	// SampleSeed, so the same seed always picks the same reviews. 0 and 100
+	// take every review; other values are rounded to hundredths of a
+	// percent, and to at least 0.01.
+	SamplePercent float64 `json:"sample_percent,omitempty"`
+	SampleSeed    int64   `json:"sample_seed,omitempty"`
+	// Partitions confines a run to the apps whose hash falls in one of the
+	// partitions out of PartitionCount, see AppPartitionCondition.
+	Partitions     []int `json:"partitions,omitempty"`
+	PartitionCount int   `json:"partition_count,omitempty"`
+	// ReviewedAfter limits incremental runs to reviews newer than the
+	// watermark of the previous run.
+	ReviewedAfter *time.Time `json:"reviewed_after,omitempty"`
+}
+
+// ReviewCursor marks the last review returned by a page of
+// GetCleanReviewsForVectorization; the next page starts strictly after it.
+// Keyset pagination stays stable while rows are being embedded concurrently,
+// which shifts OFFSET-based pages.
+type ReviewCursor struct {
+	ReviewedAt time.Time `json:"reviewed_at"`
+	ID         string    `json:"id"`
+	// Rating is only part of the cursor in the rating orders.
+	Rating int16 `json:"rating,omitempty"`
+}
+
+// Orders in which runs process reviews. Reviews of equal rating are
+// processed newest first.
+const (
+	OrderNewestFirst        = "newest_first"
+	OrderOldestFirst        = "oldest_first"
+	OrderLowestRatingFirst  = "lowest_rating_first"
+	OrderHighestRatingFirst = "highest_rating_first"
+)
+
+// reviewOrder returns the ORDER BY clause of the order and the keyset
+// condition selecting the reviews after a cursor, whose reviewed_at and ID
+// are passed as parameters argIndex and argIndex+1, followed in the rating
+// orders by its rating.
+func reviewOrder(order string, argIndex int) (orderBy, after string) {
+	switch order {
+	case OrderOldestFirst:
+		return "cr.reviewed_at ASC, cr.id ASC",
+			fmt.Sprintf("(cr.reviewed_at, cr.id) > ($%d, $%d)", argIndex, argIndex+1)
+	case OrderLowestRatingFirst:
+		return "cr.rating ASC, cr.reviewed_at DESC, cr.id DESC",
+			fmt.Sprintf("(cr.rating > $%[3]d OR (cr.rating = $%[3]d AND (cr.reviewed_at, cr.id) < ($%[1]d, $%[2]d)))", argIndex, argIndex+1, argIndex+2)
+	case OrderHighestRatingFirst:
+		return "cr.rating DESC, cr.reviewed_at DESC, cr.id DESC",
+			fmt.Sprintf("(cr.rating, cr.reviewed_at, cr.id) < ($%d, $%d, $%d)", argIndex+2, argIndex, argIndex+1)
+	default:
+		return "cr.reviewed_at DESC, cr.id DESC",
+			fmt.Sprintf("(cr.reviewed_at, cr.id) < ($%d, $%d)", argIndex, argIndex+1)
+	}
+}
+
+// ratingOrder reports whether the order's cursor includes the rating.
+func ratingOrder(order string) bool {
+	return order == OrderLowestRatingFirst || order == OrderHighestRatingFirst
 }
 
 type Repository interface {
-	GetCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, limit int, offset int) ([]CleanReview, error)
+	GetCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, limit int, after *ReviewCursor) ([]CleanReview, error)
+	CountCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, after *ReviewCursor) (int64, error)
+	CountSkippedReviews(ctx context.Context, filters CleanReviewFilters) (alreadyEmbedded int64, filteredOut int64, err error)
+	GetTextVolume(ctx context.Context, filters CleanReviewFilters, textSource string) (TextVolume, error)
 	UpsertEmbedding(ctx context.Context, vector *Vector) error
+	UpsertEmbeddings(ctx context.Context, vectors []*Vector) error
+	UpdateResponseVectors(ctx context.Context, vectors []*Vector) error
+	RecordRunReviews(ctx context.Context, sagaID string, reviewIDs []string) error
+	ListRunReviews(ctx context.Context, sagaID, afterReviewID string, limit int) ([]string, error)
+	CreateRun(ctx context.Context, run *Run) error
+	UpdateRun(ctx context.Context, run *Run) error
+	GetRun(ctx context.Context, runID string) (*Run, error)
+	GetLatestRun(ctx context.Context, sagaID string) (*Run, error)
+	GetResumableRun(ctx context.Context, sagaID string) (*Run, error)
+	ListRuns(ctx context.Context, filters RunFilters) ([]Run, error)
+	RequestRunCancel(ctx context.Context, sagaID string) (int64, error)
+	IsRunCancelRequested(ctx context.Context, runID string) (bool, error)
+	RecordReviewErrors(ctx context.Context, reviewErrors []ReviewError) error
+	ResolveReviewErrors(ctx context.Context, reviewIDs []string) error
+	ListRunErrors(ctx context.Context, runID string) ([]ReviewError, error)
+	UpsertShadowEmbeddings(ctx context.Context, vectors []*ShadowVector) error
+	ListShadowPairs(ctx context.Context, appID, productionModel, shadowModel string, limit int) ([]ShadowPair, error)
+	GetCurrentModel(ctx context.Context) (string, error)
+	CountModelMigration(ctx context.Context, fromModel, toModel string) (remaining int64, staged int64, err error)
+	ListReviewsToMigrate(ctx context.Context, fromModel, toModel, afterReviewID string, limit int) ([]string, error)
+	StageMigrationEmbeddings(ctx context.Context, vectors []*Vector) error
+	CreateModelMigration(ctx context.Context, migration *ModelMigration) error
+	UpdateModelMigration(ctx context.Context, migration *ModelMigration) error
+	FlipModel(ctx context.Context, migration *ModelMigration) error
+	ReserveRateLimit(ctx context.Context, window time.Time, tokens int, limits RateLimits) (bool, error)
+	PruneRateLimits(ctx context.Context, before time.Time) error
+	AddSpend(ctx context.Context, entries []SpendEntry) error
+	GetSpend(ctx context.Context, month time.Time, tenantID, appID string) ([]SpendEntry, error)
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+	ListAudit(ctx context.Context, filters AuditFilters) ([]AuditEntry, error)
+	GetMaintenance(ctx context.Context) (Maintenance, error)
+	SetMaintenance(ctx context.Context, enabled bool, reason string) error
+	ArchiveEmbeddings(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+	RehydrateEmbeddings(ctx context.Context, filters ArchiveFilters, limit int) (int64, error)
+	GetArchiveStats(ctx context.Context) (ArchiveStats, error)
+	ListRecentlyEmbeddedApps(ctx context.Context, model string, since time.Time) ([]string, error)
+	ListRecentContentVectors(ctx context.Context, appID, model string, since time.Time, limit int) ([][]float32, error)
+	GetDriftBaseline(ctx context.Context, appID, model string) (*DriftBaseline, error)
+	ListDriftBaselines(ctx context.Context, appID string) ([]DriftBaseline, error)
+	SaveDriftBaseline(ctx context.Context, baseline DriftBaseline) error
+	RecordDriftCheck(ctx context.Context, appID, model string, meanDistance, normDistance float64, drifted bool) error
+	DeleteDriftBaselines(ctx context.Context, appID string) (int64, error)
+	GetDatabaseLoad(ctx context.Context) (DatabaseLoad, error)
+	HeartbeatReplica(ctx context.Context, replicaID string) error
+	ListLiveReplicas(ctx context.Context, ttl time.Duration) ([]string, error)
+	DeregisterReplica(ctx context.Context, replicaID string) error
+	DeleteReviews(ctx context.Context, reviewIDs []string) (int64, error)
 	GetTableStats(ctx context.Context) (map[string]any, error)
+	GetContentVector(ctx context.Context, reviewID string) ([]float32, error)
+	SearchSimilar(ctx context.Context, vector []float32, k int, filters SearchFilters) ([]SimilarReview, error)
+	FindSimilar(ctx context.Context, reviewID string, k int, filters SearchFilters) ([]SimilarReview, error)
+	GetCoverageReport(ctx context.Context, appID string, model string) ([]CoverageRow, error)
+	ListEmbeddings(ctx context.Context, filters SearchFilters, after EmbeddingCursor, limit int) ([]StoredEmbedding, error)
+	GetLatestReviewedAt(ctx context.Context, filters CleanReviewFilters) (*time.Time, error)
+	GetWatermark(ctx context.Context, scope string) (*time.Time, error)
+	SetWatermark(ctx context.Context, scope string, reviewedAt time.Time) error
+	Listen(ctx context.Context, channel string, notify func(payload string)) error
+	SampleContentVectors(ctx context.Context, filters EmbeddingFilters, n int) ([]ReviewVector, error)
+	ListContentVectors(ctx context.Context, filters EmbeddingFilters, afterReviewID string, limit int) ([]ReviewVector, error)
+	CreateClustering(ctx context.Context, clustering *Clustering) error
+	RecordClusterAssignments(ctx context.Context, clusteringID string, assignments []ClusterAssignment) error
+	FinishClustering(ctx context.Context, clustering *Clustering, centroids []ClusterCentroid) error
+	CreateProjection(ctx context.Context, projection *Projection) error
+	RecordProjectionPoints(ctx context.Context, projectionID string, points []ProjectionPoint) error
+	FinishProjection(ctx context.Context, projection *Projection) error
+	GetLatestProjection(ctx context.Context, appID, model string) (*Projection, error)
+	ListProjectionPoints(ctx context.Context, projectionID, afterReviewID string, limit int) ([]ProjectionPoint, error)
+	ListEmbeddedReviewIDs(ctx context.Context, filters EmbeddingFilters, afterReviewID string, limit int) ([]string, error)
+	FindNearDuplicates(ctx context.Context, filters EmbeddingFilters, reviewIDs []string, neighbors int, minSimilarity float64) ([]DuplicatePair, error)
+	RecordDuplicates(ctx context.Context, appID, model string, pairs []DuplicatePair) error
+	ComputeCentroids(ctx context.Context, filters EmbeddingFilters) (int64, error)
+	GetProcessedSaga(ctx context.Context, sagaID, eventType string) (*ProcessedSaga, error)
+	RecordProcessedSaga(ctx context.Context, saga *ProcessedSaga) error
+	FinishRun(ctx context.Context, run *Run, messages []OutboxMessage) error
+	RelayOutbox(ctx context.Context, limit int, publish func([]OutboxMessage) error) (int, error)
+	PurgeOutbox(ctx context.Context, sentBefore time.Time) (int64, error)
+	Ping(ctx context.Context) error
+	TryAdvisoryLock(ctx context.Context, key string) (release func(), acquired bool, err error)
+	TryAdvisoryLease(ctx context.Context, key string) (*AdvisoryLease, error)
 	Close() error
 }
 
 type postgresRepository struct {
 	db *pgxpool.Pool
+	// metadataSelect reads the metadata columns clean_reviews has, see
+	// detectMetadataColumns.
+	metadataSelect string
+	// retry retries the review fetches and embedding writes, see
+	// retryableError.
+	retry    retry.Policy
+	timeouts Timeouts
 }
 
-func NewPostgresRepository(dsn string) (Repository, error) {
-	pool, err := pgxpool.New(context.Background(), dsn)
+// NewPostgresRepository connects to the database at dsn and creates missing
+// tables. When dsnSource is not nil, every new connection takes its user and
+// password from the DSN it returns, so rotated credentials are picked up.
+// Review fetches and embedding writes that fail transiently are retried by
+// policy, and queries are bounded by timeouts.
+func NewPostgresRepository(dsn string, dsnSource func(ctx context.Context) (string, error), policy retry.Policy, timeouts Timeouts) (Repository, error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database DSN: %w", err)
+	}
+	// Every query gets a span under the caller's trace.
+	poolConfig.ConnConfig.Tracer = otelpgx.NewTracer()
+	if timeouts.Statement > 0 {
+		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(timeouts.Statement.Milliseconds(), 10)
+	}
+	if dsnSource != nil {
+		poolConfig.BeforeConnect = func(ctx context.Context, connConfig *pgx.ConnConfig) error {
+			current, err := dsnSource(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to get database DSN: %w", err)
+			}
+			parsed, err := pgx.ParseConfig(current)
+			if err != nil {
+				return fmt.Errorf("failed to parse database DSN: %w", err)
+			}
+			connConfig.User, connConfig.Password = parsed.User, parsed.Password
+			return nil
+		}
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -38,20 +242,66 @@ func NewPostgresRepository(dsn string) (Repository, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	repo := &postgresRepository{db: pool}
+	policy.Retryable = retryableError
+	repo := &postgresRepository{db: pool, retry: policy, timeouts: timeouts}
 
 	if err := repo.initTables(context.Background()); err != nil {
 		return nil, fmt.Errorf("failed to initialize tables: %w", err)
 	}
+	if err := repo.detectMetadataColumns(context.Background()); err != nil {
+		return nil, err
+	}
 
 	return repo, nil
 }
 
+// retryableError tells the failures that a failover or a concurrent
+// transaction causes: lost or refused connections, a server shutting down or
+// starting up, serialization failures and deadlocks. Retrying is safe for the
+// operations wrapped, which are reads or idempotent upserts running in one
+// transaction each, even when the first attempt may have reached the server.
+func retryableError(err error) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+		// Class 08: connection exceptions.
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// retried runs op under the retry policy and classifies the error it ends
+// with, see classify.
+func (r *postgresRepository) retried(ctx context.Context, op func(ctx context.Context) error) error {
+	return classify(r.retry.Do(ctx, op))
+}
+
 func (r *postgresRepository) initTables(ctx context.Context) error {
 	queries := []string{
 		`CREATE TABLE IF NOT EXISTS review_embeddings (
 			embedding_id VARCHAR(255) PRIMARY KEY,
-			review_id VARCHAR(255) UNIQUE NOT NULL,
+			review_id VARCHAR(255) NOT NULL,
 			app_id VARCHAR(255) NOT NULL,
 			language VARCHAR(10),
 			rating SMALLINT,
@@ -70,6 +320,282 @@ func (r *postgresRepository) initTables(ctx context.Context) error {
 		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_model ON review_embeddings(model);`,
 		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_created_at ON review_embeddings(created_at);`,
 		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_updated_at ON review_embeddings(updated_at);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS title_vec vector(1536);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS chunk_index INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE review_embeddings DROP CONSTRAINT IF EXISTS review_embeddings_review_id_key;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_review_embeddings_review_chunk ON review_embeddings(review_id, chunk_index);`,
+		`CREATE TABLE IF NOT EXISTS vectorize_run_reviews (
+			saga_id VARCHAR(255) NOT NULL,
+			review_id VARCHAR(255) NOT NULL,
+			recorded_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (saga_id, review_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS vectorize_runs (
+			run_id VARCHAR(255) PRIMARY KEY,
+			saga_id VARCHAR(255),
+			app_id VARCHAR(255),
+			filters JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL,
+			processed INTEGER NOT NULL DEFAULT 0,
+			skipped INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			error TEXT,
+			started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			finished_at TIMESTAMP WITH TIME ZONE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_runs_saga_id ON vectorize_runs(saga_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_runs_app_id ON vectorize_runs(app_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_runs_status ON vectorize_runs(status);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_runs_started_at ON vectorize_runs(started_at DESC);`,
+		`ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_reviewed_at TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_review_id VARCHAR(255);`,
+		`ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_rating SMALLINT;`,
+		`CREATE TABLE IF NOT EXISTS vectorize_errors (
+			review_id VARCHAR(255) NOT NULL,
+			stage VARCHAR(20) NOT NULL,
+			app_id VARCHAR(255) NOT NULL,
+			run_id VARCHAR(255),
+			error TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 1,
+			first_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			last_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (review_id, stage)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_errors_app_id ON vectorize_errors(app_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_errors_run_id ON vectorize_errors(run_id);`,
+		`ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS watermark TIMESTAMP WITH TIME ZONE;`,
+		`ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMP WITH TIME ZONE;`,
+		`CREATE TABLE IF NOT EXISTS vectorize_watermarks (
+			scope VARCHAR(512) PRIMARY KEY,
+			reviewed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);`,
+		`CREATE TABLE IF NOT EXISTS review_clusterings (
+			clustering_id VARCHAR(255) PRIMARY KEY,
+			saga_id VARCHAR(255),
+			app_id VARCHAR(255) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			k INTEGER NOT NULL,
+			filters JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL,
+			reviews INTEGER NOT NULL DEFAULT 0,
+			inertia DOUBLE PRECISION,
+			error TEXT,
+			started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			finished_at TIMESTAMP WITH TIME ZONE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_clusterings_app_id ON review_clusterings(app_id, started_at DESC);`,
+		`CREATE TABLE IF NOT EXISTS review_cluster_centroids (
+			clustering_id VARCHAR(255) NOT NULL REFERENCES review_clusterings(clustering_id) ON DELETE CASCADE,
+			cluster_index INTEGER NOT NULL,
+			size INTEGER NOT NULL,
+			centroid vector(1536) NOT NULL,
+			PRIMARY KEY (clustering_id, cluster_index)
+		);`,
+		`CREATE TABLE IF NOT EXISTS review_cluster_assignments (
+			clustering_id VARCHAR(255) NOT NULL REFERENCES review_clusterings(clustering_id) ON DELETE CASCADE,
+			review_id VARCHAR(255) NOT NULL,
+			cluster_index INTEGER NOT NULL,
+			distance DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (clustering_id, review_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_cluster_assignments_cluster ON review_cluster_assignments(clustering_id, cluster_index);`,
+		`CREATE TABLE IF NOT EXISTS review_projections (
+			projection_id VARCHAR(255) PRIMARY KEY,
+			saga_id VARCHAR(255),
+			app_id VARCHAR(255) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			filters JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL,
+			reviews INTEGER NOT NULL DEFAULT 0,
+			explained_variance DOUBLE PRECISION,
+			error TEXT,
+			started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			finished_at TIMESTAMP WITH TIME ZONE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_projections_app_id ON review_projections(app_id, model, started_at DESC);`,
+		`CREATE TABLE IF NOT EXISTS review_projection_points (
+			projection_id VARCHAR(255) NOT NULL REFERENCES review_projections(projection_id) ON DELETE CASCADE,
+			review_id VARCHAR(255) NOT NULL,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			PRIMARY KEY (projection_id, review_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS review_duplicates (
+			review_id_a VARCHAR(255) NOT NULL,
+			review_id_b VARCHAR(255) NOT NULL,
+			app_id VARCHAR(255) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			similarity DOUBLE PRECISION NOT NULL,
+			detected_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (review_id_a, review_id_b)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_duplicates_app_id ON review_duplicates(app_id, detected_at DESC);`,
+		`CREATE TABLE IF NOT EXISTS review_centroids (
+			app_id VARCHAR(255) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			iso_week VARCHAR(8) NOT NULL,
+			rating_bucket VARCHAR(10) NOT NULL,
+			reviews INTEGER NOT NULL,
+			centroid vector(1536) NOT NULL,
+			computed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (app_id, model, iso_week, rating_bucket)
+		);`,
+		`CREATE TABLE IF NOT EXISTS processed_sagas (
+			saga_id VARCHAR(255) NOT NULL,
+			event_type VARCHAR(255) NOT NULL,
+			request_digest CHAR(64) NOT NULL,
+			result_digest CHAR(64) NOT NULL,
+			reply JSONB NOT NULL,
+			processed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (saga_id, event_type)
+		);`,
+		`CREATE TABLE IF NOT EXISTS event_outbox (
+			id BIGSERIAL PRIMARY KEY,
+			saga_id VARCHAR(255),
+			topic VARCHAR(255) NOT NULL,
+			message_key BYTEA,
+			value BYTEA NOT NULL,
+			headers JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			sent_at TIMESTAMP WITH TIME ZONE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox (id) WHERE sent_at IS NULL;`,
+		`CREATE TABLE IF NOT EXISTS review_embeddings_shadow (
+			review_id VARCHAR(255) NOT NULL,
+			chunk_index INTEGER NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			app_id VARCHAR(255) NOT NULL,
+			dim INTEGER NOT NULL,
+			content_vec vector NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (review_id, chunk_index, model)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_shadow_model ON review_embeddings_shadow(model, app_id);`,
+		`CREATE TABLE IF NOT EXISTS review_embeddings_migration (
+			embedding_id VARCHAR(255) NOT NULL,
+			review_id VARCHAR(255) NOT NULL,
+			chunk_index INTEGER NOT NULL DEFAULT 0,
+			app_id VARCHAR(255) NOT NULL,
+			language VARCHAR(10),
+			rating SMALLINT,
+			country VARCHAR(10),
+			model VARCHAR(100) NOT NULL,
+			dim INTEGER NOT NULL,
+			content_vec vector(1536),
+			response_vec vector(1536),
+			title_vec vector(1536),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (review_id, chunk_index, model)
+		);`,
+		`CREATE TABLE IF NOT EXISTS model_migrations (
+			migration_id VARCHAR(255) PRIMARY KEY,
+			from_model VARCHAR(100) NOT NULL,
+			to_model VARCHAR(100) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			total BIGINT NOT NULL DEFAULT 0,
+			migrated BIGINT NOT NULL DEFAULT 0,
+			failed BIGINT NOT NULL DEFAULT 0,
+			swapped BIGINT NOT NULL DEFAULT 0,
+			error TEXT,
+			started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			finished_at TIMESTAMP WITH TIME ZONE
+		);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS normalized BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS normalized BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`CREATE TABLE IF NOT EXISTS embedding_model (
+			singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+			model VARCHAR(100) NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_tenant_app ON review_embeddings(tenant_id, app_id);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS content_en_vec vector(1536);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS content_en_vec vector(1536);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS app_version VARCHAR(50);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS device VARCHAR(100);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS platform VARCHAR(50);`,
+		`ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS helpful_votes INTEGER;`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS app_version VARCHAR(50);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS device VARCHAR(100);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS platform VARCHAR(50);`,
+		`ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS helpful_votes INTEGER;`,
+		`CREATE TABLE IF NOT EXISTS embedding_rate_limits (
+			window_start TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+			requests INTEGER NOT NULL DEFAULT 0,
+			tokens BIGINT NOT NULL DEFAULT 0
+		);`,
+		`CREATE TABLE IF NOT EXISTS vectorize_replicas (
+			replica_id VARCHAR(255) PRIMARY KEY,
+			heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);`,
+		`CREATE TABLE IF NOT EXISTS vectorize_spend (
+			tenant_id VARCHAR(255) NOT NULL DEFAULT '',
+			app_id VARCHAR(255) NOT NULL,
+			month DATE NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			tokens BIGINT NOT NULL DEFAULT 0,
+			cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			PRIMARY KEY (tenant_id, app_id, month, model)
+		);`,
+		`ALTER TABLE vectorize_spend ADD COLUMN IF NOT EXISTS reviews BIGINT NOT NULL DEFAULT 0;`,
+		`CREATE TABLE IF NOT EXISTS vectorize_audit_log (
+			audit_id BIGSERIAL PRIMARY KEY,
+			operation VARCHAR(50) NOT NULL,
+			actor VARCHAR(255) NOT NULL,
+			trigger VARCHAR(255) NOT NULL,
+			saga_id VARCHAR(255) NOT NULL DEFAULT '',
+			filters JSONB,
+			affected BIGINT NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_vectorize_audit_log_created_at ON vectorize_audit_log(created_at);`,
+		`CREATE TABLE IF NOT EXISTS vectorize_maintenance (
+			id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+			enabled BOOLEAN NOT NULL DEFAULT FALSE,
+			reason TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);`,
+		`CREATE TABLE IF NOT EXISTS review_embeddings_archive (
+			review_id VARCHAR(255) NOT NULL,
+			chunk_index INTEGER NOT NULL DEFAULT 0,
+			app_id VARCHAR(255) NOT NULL,
+			tenant_id VARCHAR(255),
+			model VARCHAR(100) NOT NULL,
+			embedded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			payload BYTEA NOT NULL,
+			archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (review_id, chunk_index)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_review_embeddings_archive_app_id ON review_embeddings_archive(app_id);`,
+		// sparsevec arrived with pgvector 0.7; older versions go without
+		// sparse vectors.
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_type WHERE typname = 'sparsevec') THEN
+				ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS sparse_vec sparsevec;
+			END IF;
+		END $$;`,
+		`CREATE TABLE IF NOT EXISTS embedding_drift_baselines (
+			app_id VARCHAR(255) NOT NULL,
+			model VARCHAR(100) NOT NULL,
+			samples INTEGER NOT NULL,
+			mean_vec vector NOT NULL,
+			norm_histogram DOUBLE PRECISION[] NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+			checked_at TIMESTAMP WITH TIME ZONE,
+			mean_distance DOUBLE PRECISION,
+			norm_distance DOUBLE PRECISION,
+			drifted BOOLEAN NOT NULL DEFAULT FALSE,
+			PRIMARY KEY (app_id, model)
+		);`,
 	}
 
 	for i, query := range queries {
@@ -82,6 +608,9 @@ func (r *postgresRepository) initTables(ctx context.Context) error {
 }
 
 func (r *postgresRepository) GetTableStats(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
 	query := `
 		SELECT 
 			COUNT(*) as total_embeddings,
@@ -125,74 +654,486 @@ func (r *postgresRepository) GetTableStats(ctx context.Context) (map[string]any,
 	return stats, nil
 }
 
-func (r *postgresRepository) GetCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, limit int, offset int) ([]CleanReview, error) {
-	whereClause := "WHERE cr.is_contentful = true AND cr.content_clean IS NOT NULL"
-	args := []any{}
-	argIndex := 1
+// GetContentVector returns the content vector of the review's first chunk,
+// or nil when the review has no embedding.
+func (r *postgresRepository) GetContentVector(ctx context.Context, reviewID string) ([]float32, error) {
+	var vector pgvector.Vector
+	err := r.db.QueryRow(ctx, `
+		SELECT content_vec FROM review_embeddings
+		WHERE review_id = $1 AND chunk_index = 0 AND content_vec IS NOT NULL;
+	`, reviewID).Scan(&vector)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content vector of review %s: %w", reviewID, err)
+	}
 
-	if filters.ForceRecompute {
-		whereClause += " AND (re.review_id IS NULL OR $1::bool = true)"
-		args = append(args, true)
-		argIndex++
-	} else {
-		whereClause += " AND re.review_id IS NULL"
+	return vector.Slice(), nil
+}
+
+// searchOverfetch is how many chunks are fetched per requested review, so
+// that reviews matching with several chunks still fill k results.
+const searchOverfetch = 4
+
+// SearchSimilar returns up to k reviews whose content is closest to vector
+// by cosine distance, best match first. Long reviews match with their
+// closest chunk. Only embeddings made with filters.Model are compared, since
+// vectors of different models live in different spaces.
+func (r *postgresRepository) SearchSimilar(ctx context.Context, vector []float32, k int, filters SearchFilters) ([]SimilarReview, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	whereClause, args := appendSearchFilters(
+		"re.content_vec IS NOT NULL AND re.model = $2",
+		[]any{pgvector.NewVector(vector), filters.Model},
+		filters,
+	)
+	args = append(args, k*searchOverfetch)
+
+	query := fmt.Sprintf(`
+		SELECT
+			re.review_id, re.app_id, COALESCE(re.language, ''), COALESCE(re.country, ''),
+			COALESCE(re.rating, 0), cr.reviewed_at, cr.content_clean,
+			1 - (re.content_vec <=> $1) AS similarity
+		FROM review_embeddings re
+		JOIN clean_reviews cr ON cr.id = re.review_id
+		WHERE %s
+		ORDER BY re.content_vec <=> $1
+		LIMIT $%d;
+	`, whereClause, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, classify(fmt.Errorf("failed to search similar reviews: %w", err))
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var results []SimilarReview
+	for rows.Next() {
+		var result SimilarReview
+		if err := rows.Scan(
+			&result.ReviewID,
+			&result.AppID,
+			&result.Language,
+			&result.Country,
+			&result.Rating,
+			&result.ReviewedAt,
+			&result.Content,
+			&result.Similarity,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan similar review: %w", err)
+		}
+		if seen[result.ReviewID] || len(results) == k {
+			continue
+		}
+		seen[result.ReviewID] = true
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, classify(fmt.Errorf("error iterating similar reviews: %w", err))
+	}
+
+	return results, nil
+}
+
+// FindSimilar returns up to k reviews whose content is closest to the given
+// review's, best match first, excluding the review itself. It returns
+// ErrReviewNotEmbedded when the review has no content vector.
+func (r *postgresRepository) FindSimilar(ctx context.Context, reviewID string, k int, filters SearchFilters) ([]SimilarReview, error) {
+	vector, err := r.GetContentVector(ctx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if vector == nil {
+		return nil, fmt.Errorf("%w: %s", ErrReviewNotEmbedded, reviewID)
+	}
+
+	filters.ExcludeReviewID = reviewID
+	return r.SearchSimilar(ctx, vector, k, filters)
+}
+
+// appendSearchFilters adds the metadata conditions of the filters, except the
+// model, to a WHERE clause over review_embeddings re joined with
+// clean_reviews cr, numbering their placeholders after args.
+func appendSearchFilters(whereClause string, args []any, filters SearchFilters) (string, []any) {
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		whereClause += fmt.Sprintf(" AND "+condition, len(args))
 	}
 
 	if filters.AppID != "" {
-		whereClause += fmt.Sprintf(" AND cr.app_id = $%d", argIndex)
-		args = append(args, filters.AppID)
-		argIndex++
+		add("re.app_id = $%d", filters.AppID)
+	}
+	if filters.Language != "" {
+		add("re.language = $%d", filters.Language)
+	}
+	if filters.Country != "" {
+		add("re.country = $%d", filters.Country)
+	}
+	if filters.MinRating > 0 {
+		add("re.rating >= $%d", filters.MinRating)
+	}
+	if filters.MaxRating > 0 {
+		add("re.rating <= $%d", filters.MaxRating)
+	}
+	if filters.DateFrom != "" {
+		add("cr.reviewed_at >= $%d", filters.DateFrom)
+	}
+	if filters.DateTo != "" {
+		add("cr.reviewed_at <= $%d", filters.DateTo)
+	}
+	if filters.ExcludeReviewID != "" {
+		add("re.review_id <> $%d", filters.ExcludeReviewID)
+	}
+
+	return whereClause, args
+}
+
+// GetCoverageReport returns, for every model that has embeddings for the app
+// plus the given (configured) model, how many vectorizable clean reviews exist
+// per language and country and how many of them are embedded with that model.
+// An empty appID reports across all apps.
+func (r *postgresRepository) GetCoverageReport(ctx context.Context, appID string, model string) ([]CoverageRow, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	query := `
+		WITH reviews AS (
+			SELECT cr.id, COALESCE(cr.language, '') AS language, COALESCE(cr.country, '') AS country
+			FROM clean_reviews cr
+			WHERE cr.is_contentful = true AND cr.content_clean IS NOT NULL
+				AND ($1 = '' OR cr.app_id = $1)
+		),
+		models AS (
+			SELECT DISTINCT model FROM review_embeddings WHERE $1 = '' OR app_id = $1
+			UNION
+			SELECT $2::varchar
+		)
+		SELECT
+			m.model, r.language, r.country,
+			COUNT(r.id) AS clean_reviews,
+			COUNT(re.review_id) AS embedded
+		FROM reviews r
+		CROSS JOIN models m
+		LEFT JOIN review_embeddings re ON re.review_id = r.id AND re.chunk_index = 0 AND re.model = m.model
+		GROUP BY m.model, r.language, r.country
+		ORDER BY m.model, r.language, r.country;
+	`
+
+	rows, err := r.db.Query(ctx, query, appID, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query coverage report: %w", err)
 	}
+	defer rows.Close()
 
-	if len(filters.Countries) > 0 {
-		placeholders := make([]string, len(filters.Countries))
-		for i := range filters.Countries {
-			placeholders[i] = fmt.Sprintf("$%d", argIndex)
-			args = append(args, filters.Countries[i])
-			argIndex++
+	var report []CoverageRow
+	for rows.Next() {
+		var row CoverageRow
+		if err := rows.Scan(&row.Model, &row.Language, &row.Country, &row.CleanReviews, &row.Embedded); err != nil {
+			return nil, fmt.Errorf("failed to scan coverage row: %w", err)
 		}
-		whereClause += fmt.Sprintf(" AND cr.country = ANY($%d)", argIndex)
-		args = append(args, filters.Countries)
-		argIndex++
+		row.Remaining = row.CleanReviews - row.Embedded
+		report = append(report, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating coverage rows: %w", err)
+	}
+
+	return report, nil
+}
+
+// buildCleanReviewsWhere renders the conditions selecting reviews eligible
+// for vectorization under filters, starting after the cursor when one is
+// given. It returns the conditions, their arguments and the next free
+// placeholder.
+//
+// The conditions read the same for every run in an order, with or without a
+// tenant: filters that are not set pass NULL or false rather than leaving
+// their condition out, so that fetching a page is a prepared statement whose
+// plan Postgres can reuse across the pages of a backfill. Each condition
+// comes before the NULL check of its parameter, so that its column gives the
+// parameter its type.
+func buildCleanReviewsWhere(filters CleanReviewFilters, after *ReviewCursor) (string, []any, int) {
+	// Runs without a tenant do not touch clean_reviews.tenant_id, which only
+	// databases serving tenants need.
+	tenantCondition := "$5::varchar IS NULL"
+	if filters.TenantID != "" {
+		tenantCondition = "cr.tenant_id = $5"
 	}
 
-	if len(filters.Languages) > 0 {
-		placeholders := make([]string, len(filters.Languages))
-		for i := range filters.Languages {
-			placeholders[i] = fmt.Sprintf("$%d", argIndex)
-			args = append(args, filters.Languages[i])
-			argIndex++
+	// Response backfills select embedded reviews whose developer response
+	// arrived afterwards, forced runs every review, and other runs those
+	// without an embedding, or with one of another model in stale_model
+	// mode. Archived reviews are embedded already; they come back by
+	// rehydration, not by a new embedding.
+	whereClause := `cr.is_contentful = true AND cr.content_clean IS NOT NULL
+		AND CASE
+			WHEN $1::boolean THEN re.review_id IS NOT NULL AND re.response_vec IS NULL
+				AND COALESCE(cr.response_content_clean, '') <> ''
+			WHEN $2::boolean THEN true
+			ELSE (re.review_id IS NULL OR re.model <> $3)
+				AND NOT EXISTS (SELECT 1 FROM review_embeddings_archive ra WHERE ra.review_id = cr.id)
+		END
+		AND (EXISTS (SELECT 1 FROM vectorize_errors ve WHERE ve.review_id = cr.id) OR NOT $4::boolean)
+		AND ` + tenantCondition + `
+		AND (` + AppPartitionCondition("cr.app_id", 6) + ` OR $6 IS NULL)
+		AND (cr.app_id = $8 OR $8 IS NULL)
+		AND (cr.country = ANY($9) OR $9 IS NULL)
+		AND (cr.language = ANY($10) OR $10 IS NULL)
+		AND (cr.reviewed_at >= $11 OR $11 IS NULL)
+		AND (cr.reviewed_at <= $12 OR $12 IS NULL)
+		AND (cr.rating >= $13 OR $13 IS NULL)
+		AND (cr.rating <= $14 OR $14 IS NULL)
+		AND (cr.id = ANY($15) OR $15 IS NULL)
+		AND (COALESCE(cr.response_content_clean, '') <> '' OR NOT $16::boolean)
+		AND (` + sampleCondition("cr.id", 17) + ` OR $18 IS NULL)
+		AND (cr.reviewed_at > $19 OR $19 IS NULL)`
+
+	var staleModel any
+	if filters.StaleModel {
+		staleModel = filters.Model
+	}
+	var samplePoints any
+	if filters.SamplePercent > 0 && filters.SamplePercent < 100 {
+		samplePoints = max(int(math.Round(filters.SamplePercent*100)), 1)
+	}
+
+	args := []any{
+		filters.ResponseBackfill,
+		filters.ForceRecompute,
+		staleModel,
+		filters.OnlyFailed,
+		nullIfZero(filters.TenantID),
+		nullIfZero(filters.PartitionCount),
+		filters.Partitions,
+		nullIfZero(filters.AppID),
+		nullIfEmpty(filters.Countries),
+		nullIfEmpty(filters.Languages),
+		nullIfZero(filters.DateFrom),
+		nullIfZero(filters.DateTo),
+		nullIfZero(filters.MinRating),
+		nullIfZero(filters.MaxRating),
+		nullIfEmpty(filters.ReviewIDs),
+		filters.OnlyWithResponse,
+		strconv.FormatInt(filters.SampleSeed, 10),
+		samplePoints,
+		filters.ReviewedAfter,
+	}
+	argIndex := len(args) + 1
+
+	// The first page passes a NULL cursor.
+	_, afterCursor := reviewOrder(filters.Order, argIndex)
+	whereClause += fmt.Sprintf("\n\t\tAND (%s OR $%d IS NULL)", afterCursor, argIndex)
+	if after != nil {
+		args = append(args, after.ReviewedAt, after.ID)
+	} else {
+		args = append(args, nil, nil)
+	}
+	argIndex += 2
+	if ratingOrder(filters.Order) {
+		if after != nil {
+			args = append(args, after.Rating)
+		} else {
+			args = append(args, nil)
 		}
-		whereClause += fmt.Sprintf(" AND cr.language = ANY($%d)", argIndex)
-		args = append(args, filters.Languages)
 		argIndex++
 	}
 
-	if filters.DateFrom != "" {
-		whereClause += fmt.Sprintf(" AND cr.reviewed_at >= $%d", argIndex)
-		args = append(args, filters.DateFrom)
-		argIndex++
+	return whereClause, args, argIndex
+}
+
+// nullIfZero passes value as a query parameter, or NULL when it is the zero
+// value.
+func nullIfZero[T comparable](value T) any {
+	var zero T
+	if value == zero {
+		return nil
 	}
-	if filters.DateTo != "" {
-		whereClause += fmt.Sprintf(" AND cr.reviewed_at <= $%d", argIndex)
-		args = append(args, filters.DateTo)
+	return value
+}
+
+// nullIfEmpty passes values as a query parameter, or NULL when there are
+// none.
+func nullIfEmpty[T any](values []T) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// CountCleanReviewsForVectorization counts the reviews that
+// GetCleanReviewsForVectorization would return across all pages.
+func (r *postgresRepository) CountCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, after *ReviewCursor) (int64, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	whereClause, args, _ := buildCleanReviewsWhere(filters, after)
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM clean_reviews cr
+		LEFT JOIN review_embeddings re ON re.review_id = cr.id AND re.chunk_index = 0
+		WHERE %s;
+	`, whereClause)
+
+	var count int64
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&count); err != nil {
+		return 0, classify(fmt.Errorf("failed to count clean reviews: %w", err))
+	}
+
+	return count, nil
+}
+
+// textSourceExpression mirrors CleanReview.Text in SQL.
+func textSourceExpression(source string) string {
+	switch source {
+	case TextSourceContentEN:
+		return "cr.content_en"
+	case TextSourceContentENFallback:
+		return "COALESCE(NULLIF(cr.content_en, ''), cr.content_clean)"
+	default:
+		return "cr.content_clean"
+	}
+}
+
+// GetTextVolume sums up the text a run with the given filters would embed
+// when embedding the given text source.
+func (r *postgresRepository) GetTextVolume(ctx context.Context, filters CleanReviewFilters, textSource string) (TextVolume, error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	whereClause, args, _ := buildCleanReviewsWhere(filters, nil)
+
+	query := fmt.Sprintf(`
+		SELECT
+			COUNT(*) FILTER (WHERE COALESCE(%[2]s, '') <> ''),
+			COALESCE(SUM(length(%[2]s)), 0),
+			COUNT(*) FILTER (WHERE COALESCE(cr.response_content_clean, '') <> ''),
+			COALESCE(SUM(length(cr.response_content_clean)), 0)
+		FROM clean_reviews cr
+		LEFT JOIN review_embeddings re ON re.review_id = cr.id AND re.chunk_index = 0
+		WHERE %[1]s;
+	`, whereClause, textSourceExpression(textSource))
+
+	var volume TextVolume
+	if err := r.db.QueryRow(ctx, query, args...).Scan(
+		&volume.Reviews,
+		&volume.ContentChars,
+		&volume.Responses,
+		&volume.ResponseChars,
+	); err != nil {
+		return TextVolume{}, fmt.Errorf("failed to get text volume: %w", err)
+	}
+
+	return volume, nil
+}
+
+// AppPartitionCondition returns the condition that the app in column hashes
+// into one of the partitions passed as parameter argIndex+1, out of the
+// partition count passed as parameter argIndex. Postgres' hashtext keeps an
+// app in the same partition on every replica and across restarts.
+func AppPartitionCondition(column string, argIndex int) string {
+	return fmt.Sprintf("mod(abs(hashtext(%s)::bigint), $%d) = ANY($%d)", column, argIndex, argIndex+1)
+}
+
+// sampleCondition returns the condition that the review ID in column, hashed
+// with the seed passed as parameter argIndex, falls among the first
+// basis points of 10000 passed as parameter argIndex+1.
+func sampleCondition(column string, argIndex int) string {
+	return fmt.Sprintf("mod(abs(hashtext(%s::text || ':' || $%d)::bigint), 10000) < $%d", column, argIndex, argIndex+1)
+}
+
+// CountSkippedReviews counts the reviews in the filters' app and review ID
+// scope that a run leaves out: those matching the filters that already
+// have an embedding, and those excluded by the filters (not contentful,
+// other countries, languages or dates).
+func (r *postgresRepository) CountSkippedReviews(ctx context.Context, filters CleanReviewFilters) (alreadyEmbedded int64, filteredOut int64, err error) {
+	ctx, cancel := within(ctx, r.timeouts.Stats)
+	defer cancel()
+
+	matching := filters
+	matching.TenantID = ""
+	matching.PartitionCount, matching.Partitions = 0, nil
+	matching.AppID = ""
+	matching.ReviewIDs = nil
+	matching.ForceRecompute = true
+	conditions, args, argIndex := buildCleanReviewsWhere(matching, nil)
+
+	// In stale_model mode only embeddings made with the current model count
+	// as done; the others are re-embedded.
+	embedded := "re.review_id IS NOT NULL"
+	if filters.StaleModel {
+		embedded += fmt.Sprintf(" AND re.model = $%d", argIndex)
+		args = append(args, filters.Model)
 		argIndex++
 	}
 
-	args = append(args, limit, offset)
+	scope := "true"
+	if filters.TenantID != "" {
+		scope = fmt.Sprintf("cr.tenant_id = $%d", argIndex)
+		args = append(args, filters.TenantID)
+		argIndex++
+	}
+	if filters.PartitionCount > 0 {
+		scope += " AND " + AppPartitionCondition("cr.app_id", argIndex)
+		args = append(args, filters.PartitionCount, filters.Partitions)
+		argIndex += 2
+	}
+	if filters.AppID != "" {
+		scope += fmt.Sprintf(" AND cr.app_id = $%d", argIndex)
+		args = append(args, filters.AppID)
+		argIndex++
+	}
+	if len(filters.ReviewIDs) > 0 {
+		scope += fmt.Sprintf(" AND cr.id = ANY($%d)", argIndex)
+		args = append(args, filters.ReviewIDs)
+	}
 
 	query := fmt.Sprintf(`
 		SELECT
-			cr.id, cr.app_id, cr.country, cr.rating, cr.language,
-			cr.content_clean, cr.content_en, cr.response_content_clean
+			COUNT(*) FILTER (WHERE %[1]s AND %[3]s) AS already_embedded,
+			COUNT(*) FILTER (WHERE (%[1]s) IS NOT TRUE) AS filtered_out
 		FROM clean_reviews cr
-		LEFT JOIN review_embeddings re ON re.review_id = cr.id
-		%s
-		ORDER BY cr.reviewed_at DESC
-		LIMIT $%d OFFSET $%d;
-	`, whereClause, argIndex, argIndex+1)
+		LEFT JOIN review_embeddings re ON re.review_id = cr.id AND re.chunk_index = 0
+		WHERE %[2]s;
+	`, conditions, scope, embedded)
 
-	rows, err := r.db.Query(ctx, query, args...)
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&alreadyEmbedded, &filteredOut); err != nil {
+		return 0, 0, fmt.Errorf("failed to count skipped reviews: %w", err)
+	}
+
+	return alreadyEmbedded, filteredOut, nil
+}
+
+func (r *postgresRepository) GetCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, limit int, after *ReviewCursor) ([]CleanReview, error) {
+	var reviews []CleanReview
+	err := r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Fetch)
+		defer cancel()
+		var err error
+		reviews, err = r.getCleanReviewsForVectorization(ctx, filters, limit, after)
+		return err
+	})
+	return reviews, err
+}
+
+func (r *postgresRepository) getCleanReviewsForVectorization(ctx context.Context, filters CleanReviewFilters, limit int, after *ReviewCursor) ([]CleanReview, error) {
+	whereClause, args, argIndex := buildCleanReviewsWhere(filters, after)
+	fetch := r.fetchStatement(filters, whereClause, argIndex)
+
+	args = append(args, limit)
+
+	conn, err := r.acquirePrepared(ctx, fetch)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, fetch.name, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query clean reviews: %w", err)
 	}
@@ -210,6 +1151,14 @@ func (r *postgresRepository) GetCleanReviewsForVectorization(ctx context.Context
 			&review.ContentClean,
 			&review.ContentEN,
 			&review.ResponseContentClean,
+			&review.ReviewedAt,
+			&review.Title,
+			&review.EmbeddedHash,
+			&review.EmbeddedModel,
+			&review.AppVersion,
+			&review.Device,
+			&review.Platform,
+			&review.HelpfulVotes,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan review: %w", err)
 		}
@@ -223,25 +1172,81 @@ func (r *postgresRepository) GetCleanReviewsForVectorization(ctx context.Context
 	return reviews, nil
 }
 
-func (r *postgresRepository) UpsertEmbedding(ctx context.Context, vector *Vector) error {
-	query := `
-		INSERT INTO review_embeddings
-			(embedding_id, review_id, app_id, language, rating, country, model, dim, content_vec, response_vec)
-		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (review_id) DO NOTHING;
-	`
+const upsertEmbeddingQuery = `
+	INSERT INTO review_embeddings
+		(embedding_id, review_id, chunk_index, app_id, language, rating, country, model, dim, content_vec, response_vec, title_vec, normalized, tenant_id, content_hash, content_en_vec,
+		app_version, device, platform, helpful_votes)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), NULLIF($15, ''), $16,
+		NULLIF($17, ''), NULLIF($18, ''), NULLIF($19, ''), $20)
+	ON CONFLICT (review_id, chunk_index) DO UPDATE
+	SET app_id = EXCLUDED.app_id,
+		language = EXCLUDED.language,
+		rating = EXCLUDED.rating,
+		country = EXCLUDED.country,
+		model = EXCLUDED.model,
+		dim = EXCLUDED.dim,
+		content_vec = EXCLUDED.content_vec,
+		response_vec = EXCLUDED.response_vec,
+		title_vec = EXCLUDED.title_vec,
+		normalized = EXCLUDED.normalized,
+		tenant_id = EXCLUDED.tenant_id,
+		content_hash = EXCLUDED.content_hash,
+		content_en_vec = EXCLUDED.content_en_vec,
+		app_version = EXCLUDED.app_version,
+		device = EXCLUDED.device,
+		platform = EXCLUDED.platform,
+		helpful_votes = EXCLUDED.helpful_votes,
+		updated_at = NOW()
+	WHERE review_embeddings.tenant_id IS NULL OR review_embeddings.tenant_id = EXCLUDED.tenant_id;
+`
 
+// updateSparseVectorQuery sets the sparse vector of a row just upserted. It
+// is separate from the upsert so that databases without sparsevec work as
+// long as sparse embedding is off.
+const updateSparseVectorQuery = `
+	UPDATE review_embeddings SET sparse_vec = $3
+	WHERE review_id = $1 AND chunk_index = $2;
+`
+
+func sparseVectorArg(vector *SparseVector) pgvector.SparseVector {
+	elements := make(map[int32]float32, len(vector.Indices))
+	for i, index := range vector.Indices {
+		elements[index] += vector.Values[i]
+	}
+	return pgvector.NewSparseVectorFromMap(elements, vector.Dim)
+}
+
+// deleteTrailingChunksQuery drops chunks left over from an earlier embedding
+// of a review that was split into more chunks than now.
+const deleteTrailingChunksQuery = `
+	DELETE FROM review_embeddings
+	WHERE review_id = $1 AND chunk_index > $2
+		AND (tenant_id IS NULL OR tenant_id = NULLIF($3, ''));
+`
+
+func upsertEmbeddingArgs(vector *Vector) []any {
 	contentVec := pgvector.NewVector(vector.ContentVec)
 	var responseVec *pgvector.Vector
 	if len(vector.ResponseVec) > 0 {
 		vec := pgvector.NewVector(vector.ResponseVec)
 		responseVec = &vec
 	}
+	var titleVec *pgvector.Vector
+	if len(vector.TitleVec) > 0 {
+		vec := pgvector.NewVector(vector.TitleVec)
+		titleVec = &vec
+	}
+	var contentENVec *pgvector.Vector
+	if len(vector.ContentENVec) > 0 {
+		vec := pgvector.NewVector(vector.ContentENVec)
+		contentENVec = &vec
+	}
 
-	_, err := r.db.Exec(ctx, query,
+	return []any{
 		vector.EmbeddingID,
 		vector.ReviewID,
+		vector.ChunkIndex,
 		vector.AppID,
 		vector.Language,
 		vector.Rating,
@@ -250,12 +1255,794 @@ func (r *postgresRepository) UpsertEmbedding(ctx context.Context, vector *Vector
 		vector.Dim,
 		contentVec,
 		responseVec,
-	)
+		titleVec,
+		vector.Normalized,
+		vector.TenantID,
+		vector.ContentHash,
+		contentENVec,
+		vector.AppVersion,
+		vector.Device,
+		vector.Platform,
+		vector.HelpfulVotes,
+	}
+}
+
+func (r *postgresRepository) UpsertEmbedding(ctx context.Context, vector *Vector) error {
+	return r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Write)
+		defer cancel()
+		return r.upsertEmbedding(ctx, vector)
+	})
+}
+
+func (r *postgresRepository) upsertEmbedding(ctx context.Context, vector *Vector) error {
+	if err := r.checkTenants(ctx, []*Vector{vector}); err != nil {
+		return err
+	}
+
+	statements := []statement{upsertEmbeddingStatement}
+	if vector.SparseVec != nil {
+		statements = append(statements, updateSparseVectorStatement)
+	}
+	conn, err := r.acquirePrepared(ctx, statements...)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
 
+	tag, err := conn.Exec(ctx, upsertEmbeddingStatement.name, upsertEmbeddingArgs(vector)...)
 	if err != nil {
 		return fmt.Errorf("failed to upsert embedding for review %s: %w", vector.ReviewID, err)
 	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("failed to upsert embedding for review %s: %w", vector.ReviewID, ErrForeignTenant)
+	}
+
+	if vector.SparseVec != nil {
+		if _, err := conn.Exec(ctx, updateSparseVectorStatement.name, vector.ReviewID, vector.ChunkIndex, sparseVectorArg(vector.SparseVec)); err != nil {
+			return fmt.Errorf("failed to store sparse vector for review %s: %w", vector.ReviewID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkTenants fails with ErrForeignTenant when any of the vectors would
+// replace an embedding owned by another tenant. Embeddings without a tenant
+// may be claimed by one. The upsert itself skips such rows as well, but
+// checking first keeps a batch from being written in part.
+func (r *postgresRepository) checkTenants(ctx context.Context, vectors []*Vector) error {
+	reviewIDs := make([]string, len(vectors))
+	tenantIDs := make([]string, len(vectors))
+	for i, vector := range vectors {
+		reviewIDs[i], tenantIDs[i] = vector.ReviewID, vector.TenantID
+	}
 
+	query := `
+		SELECT v.review_id
+		FROM unnest($1::varchar[], $2::varchar[]) AS v(review_id, tenant_id)
+		JOIN review_embeddings re ON re.review_id = v.review_id
+		WHERE re.tenant_id IS NOT NULL AND re.tenant_id IS DISTINCT FROM NULLIF(v.tenant_id, '')
+		LIMIT 1;
+	`
+
+	var reviewID string
+	err := r.db.QueryRow(ctx, query, reviewIDs, tenantIDs).Scan(&reviewID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check embedding tenants: %w", err)
+	}
+
+	return fmt.Errorf("failed to upsert embedding for review %s: %w", reviewID, ErrForeignTenant)
+}
+
+// UpsertEmbeddings writes all vectors in a single batch, replacing
+// existing embeddings of the same reviews including chunks they no longer
+// have. The batch runs in one transaction, so either every row is written or
+// none is.
+func (r *postgresRepository) UpsertEmbeddings(ctx context.Context, vectors []*Vector) error {
+	return r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Write)
+		defer cancel()
+		return r.upsertEmbeddings(ctx, vectors)
+	})
+}
+
+func (r *postgresRepository) upsertEmbeddings(ctx context.Context, vectors []*Vector) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+	if err := r.checkTenants(ctx, vectors); err != nil {
+		return err
+	}
+
+	lastChunk := make(map[string]int)
+	tenants := make(map[string]string)
+	var reviewIDs []string
+	batch := &pgx.Batch{}
+	for _, vector := range vectors {
+		batch.Queue(upsertEmbeddingStatement.name, upsertEmbeddingArgs(vector)...)
+		if last, ok := lastChunk[vector.ReviewID]; !ok || vector.ChunkIndex > last {
+			if !ok {
+				reviewIDs = append(reviewIDs, vector.ReviewID)
+			}
+			lastChunk[vector.ReviewID] = vector.ChunkIndex
+			tenants[vector.ReviewID] = vector.TenantID
+		}
+	}
+	var sparse []*Vector
+	for _, vector := range vectors {
+		if vector.SparseVec != nil {
+			batch.Queue(updateSparseVectorStatement.name, vector.ReviewID, vector.ChunkIndex, sparseVectorArg(vector.SparseVec))
+			sparse = append(sparse, vector)
+		}
+	}
+	for _, reviewID := range reviewIDs {
+		batch.Queue(deleteTrailingChunksStatement.name, reviewID, lastChunk[reviewID], tenants[reviewID])
+	}
+
+	statements := []statement{upsertEmbeddingStatement, deleteTrailingChunksStatement}
+	if len(sparse) > 0 {
+		statements = append(statements, updateSparseVectorStatement)
+	}
+	conn, err := r.acquirePrepared(ctx, statements...)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		for _, vector := range vectors {
+			tag, err := results.Exec()
+			if err != nil {
+				return fmt.Errorf("failed to upsert embedding for review %s chunk %d: %w", vector.ReviewID, vector.ChunkIndex, err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("failed to upsert embedding for review %s chunk %d: %w", vector.ReviewID, vector.ChunkIndex, ErrForeignTenant)
+			}
+		}
+		for _, vector := range sparse {
+			if _, err := results.Exec(); err != nil {
+				return fmt.Errorf("failed to store sparse vector for review %s chunk %d: %w", vector.ReviewID, vector.ChunkIndex, err)
+			}
+		}
+		for _, reviewID := range reviewIDs {
+			if _, err := results.Exec(); err != nil {
+				return fmt.Errorf("failed to delete stale chunks for review %s: %w", reviewID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+const updateResponseVectorQuery = `
+	UPDATE review_embeddings
+	SET response_vec = $2, updated_at = NOW()
+	WHERE review_id = $1 AND chunk_index = 0
+		AND (tenant_id IS NULL OR tenant_id = NULLIF($3, ''));
+`
+
+// UpdateResponseVectors sets the response vector of already embedded
+// reviews, leaving their content vectors untouched. Like UpsertEmbeddings it
+// writes all vectors in one batch and transaction.
+func (r *postgresRepository) UpdateResponseVectors(ctx context.Context, vectors []*Vector) error {
+	return r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Write)
+		defer cancel()
+		return r.updateResponseVectors(ctx, vectors)
+	})
+}
+
+func (r *postgresRepository) updateResponseVectors(ctx context.Context, vectors []*Vector) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, vector := range vectors {
+		batch.Queue(updateResponseVectorStatement.name, vector.ReviewID, pgvector.NewVector(vector.ResponseVec), vector.TenantID)
+	}
+
+	conn, err := r.acquirePrepared(ctx, updateResponseVectorStatement)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		for _, vector := range vectors {
+			if _, err := results.Exec(); err != nil {
+				return fmt.Errorf("failed to update response vector for review %s: %w", vector.ReviewID, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RecordRunReviews appends processed review IDs to the saga's run artifact.
+func (r *postgresRepository) RecordRunReviews(ctx context.Context, sagaID string, reviewIDs []string) error {
+	if len(reviewIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO vectorize_run_reviews (saga_id, review_id)
+		SELECT $1, unnest($2::varchar[])
+		ON CONFLICT (saga_id, review_id) DO NOTHING;
+	`
+
+	if _, err := r.db.Exec(ctx, query, sagaID, reviewIDs); err != nil {
+		return fmt.Errorf("failed to record run reviews for saga %s: %w", sagaID, err)
+	}
+
+	return nil
+}
+
+// ListRunReviews returns the processed review IDs recorded for the saga in
+// order, up to limit of them after afterReviewID, for paging through all of
+// them.
+func (r *postgresRepository) ListRunReviews(ctx context.Context, sagaID, afterReviewID string, limit int) ([]string, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT review_id FROM vectorize_run_reviews
+		WHERE saga_id = $1 AND review_id > $2
+		ORDER BY review_id
+		LIMIT $3;
+	`
+
+	rows, err := r.db.Query(ctx, query, sagaID, afterReviewID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run reviews of saga %s: %w", sagaID, err)
+	}
+	reviewIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run reviews of saga %s: %w", sagaID, err)
+	}
+	return reviewIDs, nil
+}
+
+func (r *postgresRepository) CreateRun(ctx context.Context, run *Run) error {
+	query := `
+		INSERT INTO vectorize_runs
+			(run_id, saga_id, app_id, filters, status, watermark, started_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8);
+	`
+
+	if _, err := r.db.Exec(ctx, query,
+		run.RunID,
+		run.SagaID,
+		run.AppID,
+		run.Filters,
+		run.Status,
+		run.Watermark,
+		run.StartedAt,
+		run.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create run %s: %w", run.RunID, err)
+	}
+
+	return nil
+}
+
+// UpdateRun persists the run's status, counts, error, checkpoint and finish
+// time. A pending cancellation request is dropped once the run stops
+// running, so a resumed run starts without one.
+func (r *postgresRepository) UpdateRun(ctx context.Context, run *Run) error {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	return updateRun(ctx, r.db, run)
+}
+
+// execer is what pools and transactions have in common for statements that
+// return no rows.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func updateRun(ctx context.Context, db execer, run *Run) error {
+	run.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE vectorize_runs
+		SET status = $2, processed = $3, skipped = $4, failed = $5,
+			error = NULLIF($6, ''), updated_at = $7, finished_at = $8,
+			checkpoint_reviewed_at = $9, checkpoint_review_id = $10, checkpoint_rating = $11,
+			cancel_requested_at = CASE WHEN $2 = 'running' THEN cancel_requested_at END
+		WHERE run_id = $1;
+	`
+
+	var checkpointReviewedAt *time.Time
+	var checkpointReviewID *string
+	var checkpointRating *int16
+	if run.Checkpoint != nil {
+		checkpointReviewedAt = &run.Checkpoint.ReviewedAt
+		checkpointReviewID = &run.Checkpoint.ID
+		checkpointRating = &run.Checkpoint.Rating
+	}
+
+	if _, err := db.Exec(ctx, query,
+		run.RunID,
+		run.Status,
+		run.Processed,
+		run.Skipped,
+		run.Failed,
+		run.Error,
+		run.UpdatedAt,
+		run.FinishedAt,
+		checkpointReviewedAt,
+		checkpointReviewID,
+		checkpointRating,
+	); err != nil {
+		return fmt.Errorf("failed to update run %s: %w", run.RunID, err)
+	}
+
+	return nil
+}
+
+const selectRunColumns = `
+	SELECT
+		run_id, COALESCE(saga_id, ''), COALESCE(app_id, ''), filters, status,
+		processed, skipped, failed, COALESCE(error, ''),
+		checkpoint_reviewed_at, checkpoint_review_id, COALESCE(checkpoint_rating, 0), watermark,
+		started_at, updated_at, finished_at
+	FROM vectorize_runs
+`
+
+func scanRun(row pgx.Row) (*Run, error) {
+	var run Run
+	var checkpointReviewedAt *time.Time
+	var checkpointReviewID *string
+	var checkpointRating int16
+
+	if err := row.Scan(
+		&run.RunID,
+		&run.SagaID,
+		&run.AppID,
+		&run.Filters,
+		&run.Status,
+		&run.Processed,
+		&run.Skipped,
+		&run.Failed,
+		&run.Error,
+		&checkpointReviewedAt,
+		&checkpointReviewID,
+		&checkpointRating,
+		&run.Watermark,
+		&run.StartedAt,
+		&run.UpdatedAt,
+		&run.FinishedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if checkpointReviewedAt != nil && checkpointReviewID != nil {
+		run.Checkpoint = &ReviewCursor{ReviewedAt: *checkpointReviewedAt, ID: *checkpointReviewID, Rating: checkpointRating}
+	}
+
+	return &run, nil
+}
+
+// GetRun returns the run with the given ID, or nil when there is none.
+func (r *postgresRepository) GetRun(ctx context.Context, runID string) (*Run, error) {
+	run, err := scanRun(r.db.QueryRow(ctx, selectRunColumns+` WHERE run_id = $1;`, runID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+
+	return run, nil
+}
+
+// GetLatestRun returns the most recently started run of the saga, or nil
+// when the saga has no run.
+func (r *postgresRepository) GetLatestRun(ctx context.Context, sagaID string) (*Run, error) {
+	query := selectRunColumns + `
+		WHERE saga_id = $1
+		ORDER BY started_at DESC
+		LIMIT 1;
+	`
+
+	run, err := scanRun(r.db.QueryRow(ctx, query, sagaID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest run for saga %s: %w", sagaID, err)
+	}
+
+	return run, nil
+}
+
+// GetResumableRun returns the latest unfinished or failed run of the saga, or
+// nil when the saga has no run to resume.
+func (r *postgresRepository) GetResumableRun(ctx context.Context, sagaID string) (*Run, error) {
+	query := selectRunColumns + `
+		WHERE saga_id = $1 AND status <> 'completed'
+		ORDER BY started_at DESC
+		LIMIT 1;
+	`
+
+	run, err := scanRun(r.db.QueryRow(ctx, query, sagaID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resumable run for saga %s: %w", sagaID, err)
+	}
+
+	return run, nil
+}
+
+// ListRuns returns the runs matching the filters, most recently started
+// first.
+func (r *postgresRepository) ListRuns(ctx context.Context, filters RunFilters) ([]Run, error) {
+	whereClause := "TRUE"
+	var args []any
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		whereClause += fmt.Sprintf(" AND "+condition, len(args))
+	}
+
+	if filters.TenantID != "" {
+		add("filters->>'tenant_id' = $%d", filters.TenantID)
+	}
+	if filters.AppID != "" {
+		add("app_id = $%d", filters.AppID)
+	}
+	if filters.Status != "" {
+		add("status = $%d", filters.Status)
+	}
+	if filters.StartedFrom != nil {
+		add("started_at >= $%d", *filters.StartedFrom)
+	}
+	if filters.StartedBefore != nil {
+		add("started_at < $%d", *filters.StartedBefore)
+	}
+	args = append(args, filters.Limit)
+
+	query := selectRunColumns + fmt.Sprintf(`
+		WHERE %s
+		ORDER BY started_at DESC
+		LIMIT $%d;
+	`, whereClause, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// RequestRunCancel flags the saga's running runs for cancellation and returns
+// how many it flagged. Runs check the flag between batches.
+func (r *postgresRepository) RequestRunCancel(ctx context.Context, sagaID string) (int64, error) {
+	query := `
+		UPDATE vectorize_runs
+		SET cancel_requested_at = NOW()
+		WHERE saga_id = $1 AND status = 'running';
+	`
+
+	tag, err := r.db.Exec(ctx, query, sagaID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to request cancellation of saga %s: %w", sagaID, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// IsRunCancelRequested reports whether the run has been flagged for
+// cancellation.
+func (r *postgresRepository) IsRunCancelRequested(ctx context.Context, runID string) (bool, error) {
+	query := `
+		SELECT cancel_requested_at IS NOT NULL
+		FROM vectorize_runs
+		WHERE run_id = $1;
+	`
+
+	var requested bool
+	err := r.db.QueryRow(ctx, query, runID).Scan(&requested)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check cancellation of run %s: %w", runID, err)
+	}
+
+	return requested, nil
+}
+
+// RecordReviewErrors adds failures to the error ledger, bumping the attempt
+// count of reviews that already failed in the same stage.
+func (r *postgresRepository) RecordReviewErrors(ctx context.Context, reviewErrors []ReviewError) error {
+	ctx, cancel := within(ctx, r.timeouts.Write)
+	defer cancel()
+
+	if len(reviewErrors) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO vectorize_errors (review_id, stage, app_id, run_id, error)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (review_id, stage) DO UPDATE
+		SET run_id = EXCLUDED.run_id,
+			error = EXCLUDED.error,
+			attempts = vectorize_errors.attempts + 1,
+			last_failed_at = NOW();
+	`
+
+	batch := &pgx.Batch{}
+	for _, reviewErr := range reviewErrors {
+		batch.Queue(query, reviewErr.ReviewID, reviewErr.Stage, reviewErr.AppID, reviewErr.RunID, reviewErr.Error)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for _, reviewErr := range reviewErrors {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to record error for review %s: %w", reviewErr.ReviewID, err)
+		}
+	}
+
+	return nil
+}
+
+// ResolveReviewErrors removes ledger entries of reviews that have since been
+// vectorized successfully.
+func (r *postgresRepository) ResolveReviewErrors(ctx context.Context, reviewIDs []string) error {
+	if len(reviewIDs) == 0 {
+		return nil
+	}
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM vectorize_errors WHERE review_id = ANY($1);`, reviewIDs); err != nil {
+		return fmt.Errorf("failed to resolve review errors: %w", err)
+	}
+
+	return nil
+}
+
+// ListRunErrors returns the error ledger entries last recorded by the run,
+// by review. Failures later retried by another run belong to that run, and
+// those since resolved are gone.
+func (r *postgresRepository) ListRunErrors(ctx context.Context, runID string) ([]ReviewError, error) {
+	query := `
+		SELECT review_id, app_id, COALESCE(run_id, ''), stage, error, attempts,
+			first_failed_at, last_failed_at
+		FROM vectorize_errors
+		WHERE run_id = $1
+		ORDER BY review_id, stage;
+	`
+
+	rows, err := r.db.Query(ctx, query, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list errors of run %s: %w", runID, err)
+	}
+	defer rows.Close()
+
+	var reviewErrors []ReviewError
+	for rows.Next() {
+		var reviewErr ReviewError
+		if err := rows.Scan(
+			&reviewErr.ReviewID,
+			&reviewErr.AppID,
+			&reviewErr.RunID,
+			&reviewErr.Stage,
+			&reviewErr.Error,
+			&reviewErr.Attempts,
+			&reviewErr.FirstFailedAt,
+			&reviewErr.LastFailedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan review error: %w", err)
+		}
+		reviewErrors = append(reviewErrors, reviewErr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list errors of run %s: %w", runID, err)
+	}
+
+	return reviewErrors, nil
+}
+
+// GetLatestReviewedAt returns the newest reviewed_at among the reviews
+// matching filters, embedded or not, or nil when none match.
+func (r *postgresRepository) GetLatestReviewedAt(ctx context.Context, filters CleanReviewFilters) (*time.Time, error) {
+	filters.ForceRecompute = true
+	whereClause, args, _ := buildCleanReviewsWhere(filters, nil)
+
+	query := fmt.Sprintf(`
+		SELECT MAX(cr.reviewed_at)
+		FROM clean_reviews cr
+		LEFT JOIN review_embeddings re ON re.review_id = cr.id AND re.chunk_index = 0
+		WHERE %s;
+	`, whereClause)
+
+	var latest *time.Time
+	if err := r.db.QueryRow(ctx, query, args...).Scan(&latest); err != nil {
+		return nil, fmt.Errorf("failed to get latest reviewed_at: %w", err)
+	}
+
+	return latest, nil
+}
+
+// GetWatermark returns the reviewed_at up to which incremental runs of the
+// scope have vectorized everything, or nil before the first such run.
+func (r *postgresRepository) GetWatermark(ctx context.Context, scope string) (*time.Time, error) {
+	var reviewedAt time.Time
+	err := r.db.QueryRow(ctx, `SELECT reviewed_at FROM vectorize_watermarks WHERE scope = $1;`, scope).Scan(&reviewedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get watermark %s: %w", scope, err)
+	}
+
+	return &reviewedAt, nil
+}
+
+// SetWatermark advances the scope's watermark; it never moves backwards.
+func (r *postgresRepository) SetWatermark(ctx context.Context, scope string, reviewedAt time.Time) error {
+	query := `
+		INSERT INTO vectorize_watermarks (scope, reviewed_at)
+		VALUES ($1, $2)
+		ON CONFLICT (scope) DO UPDATE
+		SET reviewed_at = GREATEST(vectorize_watermarks.reviewed_at, EXCLUDED.reviewed_at),
+			updated_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query, scope, reviewedAt); err != nil {
+		return fmt.Errorf("failed to set watermark %s: %w", scope, err)
+	}
+
+	return nil
+}
+
+// Listen subscribes to a NOTIFY channel on a dedicated pool connection and
+// calls notify with the payload of every notification until ctx is done or
+// the connection fails.
+func (r *postgresRepository) Listen(ctx context.Context, channel string, notify func(payload string)) error {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection for listening: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on channel %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The connection may be mid-wait; drop it instead of returning
+				// it to the pool still subscribed.
+				conn.Conn().Close(context.Background())
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to wait for notification on channel %s: %w", channel, err)
+		}
+		notify(notification.Payload)
+	}
+}
+
+// TryAdvisoryLock takes a session-level advisory lock derived from key on a
+// dedicated pool connection. The lock is held until release is called; when
+// another session already holds it, acquired is false and release is nil.
+func (r *postgresRepository) TryAdvisoryLock(ctx context.Context, key string) (func(), bool, error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection for advisory lock: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, key).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to take advisory lock %s: %w", key, err)
+	}
+
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release := func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, key); err != nil {
+			// Closing the session drops every advisory lock it still holds.
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}
+
+	return release, true, nil
+}
+
+// AdvisoryLease is a session-level advisory lock held on a dedicated pool
+// connection for as long as the session lives.
+type AdvisoryLease struct {
+	release func()
+	conn    *pgxpool.Conn
+}
+
+// TryAdvisoryLease takes the advisory lock derived from key like
+// TryAdvisoryLock, returning nil when another session holds it. Unlike a run
+// lock, a lease is meant to be held indefinitely, so its holder checks with
+// Alive that the session, and with it the lock, still exists.
+func (r *postgresRepository) TryAdvisoryLease(ctx context.Context, key string) (*AdvisoryLease, error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection for advisory lease: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock(hashtextextended($1, 0))`, key).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, fmt.Errorf("failed to take advisory lease %s: %w", key, err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, nil
+	}
+
+	return &AdvisoryLease{
+		conn: conn,
+		release: func() {
+			if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtextextended($1, 0))`, key); err != nil {
+				conn.Conn().Close(context.Background())
+			}
+			conn.Release()
+		},
+	}, nil
+}
+
+// Alive reports an error when the lease's session is gone, in which case
+// Postgres has dropped the lock and another session may hold it by now.
+func (l *AdvisoryLease) Alive(ctx context.Context) error {
+	if err := l.conn.Ping(ctx); err != nil {
+		return fmt.Errorf("advisory lease lost: %w", err)
+	}
+	return nil
+}
+
+// Release gives the lease up.
+func (l *AdvisoryLease) Release() {
+	l.release()
+}
+
+func (r *postgresRepository) Ping(ctx context.Context) error {
+	if err := r.db.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
 	return nil
 }
 
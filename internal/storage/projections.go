@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *postgresRepository) CreateProjection(ctx context.Context, projection *Projection) error {
+	query := `
+		INSERT INTO review_projections
+			(projection_id, saga_id, app_id, model, filters, status, started_at)
+		VALUES
+			($1, NULLIF($2, ''), $3, $4, $5, $6, $7);
+	`
+
+	if _, err := r.db.Exec(ctx, query,
+		projection.ProjectionID,
+		projection.SagaID,
+		projection.AppID,
+		projection.Model,
+		projection.Filters,
+		projection.Status,
+		projection.StartedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create projection %s: %w", projection.ProjectionID, err)
+	}
+
+	return nil
+}
+
+// RecordProjectionPoints stores the coordinates of each review in one round
+// trip.
+func (r *postgresRepository) RecordProjectionPoints(ctx context.Context, projectionID string, points []ProjectionPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	reviewIDs := make([]string, len(points))
+	xs := make([]float32, len(points))
+	ys := make([]float32, len(points))
+	for i, point := range points {
+		reviewIDs[i], xs[i], ys[i] = point.ReviewID, point.X, point.Y
+	}
+
+	query := `
+		INSERT INTO review_projection_points (projection_id, review_id, x, y)
+		SELECT $1, unnest($2::varchar[]), unnest($3::real[]), unnest($4::real[])
+		ON CONFLICT (projection_id, review_id) DO UPDATE
+		SET x = EXCLUDED.x, y = EXCLUDED.y;
+	`
+
+	if _, err := r.db.Exec(ctx, query, projectionID, reviewIDs, xs, ys); err != nil {
+		return fmt.Errorf("failed to record points of projection %s: %w", projectionID, err)
+	}
+
+	return nil
+}
+
+// FinishProjection persists the projection's status, counts, error and
+// finish time. A completed projection replaces the earlier projections of
+// its app and model, which are deleted in the same transaction.
+func (r *postgresRepository) FinishProjection(ctx context.Context, projection *Projection) error {
+	return pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		batch := &pgx.Batch{}
+		batch.Queue(`
+			UPDATE review_projections
+			SET status = $2, reviews = $3, explained_variance = $4, error = NULLIF($5, ''), finished_at = $6
+			WHERE projection_id = $1;
+		`, projection.ProjectionID, projection.Status, projection.Reviews, projection.ExplainedVariance, projection.Error, projection.FinishedAt)
+		if projection.Status == RunStatusCompleted {
+			batch.Queue(`
+				DELETE FROM review_projections
+				WHERE app_id = $1 AND model = $2 AND projection_id <> $3 AND status <> $4 AND started_at < $5;
+			`, projection.AppID, projection.Model, projection.ProjectionID, RunStatusRunning, projection.StartedAt)
+		}
+
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return fmt.Errorf("failed to finish projection %s: %w", projection.ProjectionID, err)
+		}
+		return nil
+	})
+}
+
+// GetLatestProjection returns the latest completed projection of the app
+// and model, or nil when there is none.
+func (r *postgresRepository) GetLatestProjection(ctx context.Context, appID, model string) (*Projection, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT projection_id, COALESCE(saga_id, ''), app_id, model, filters, status, reviews,
+			COALESCE(explained_variance, 0), COALESCE(error, ''), started_at, finished_at
+		FROM review_projections
+		WHERE app_id = $1 AND model = $2 AND status = $3
+		ORDER BY started_at DESC
+		LIMIT 1;
+	`
+
+	var projection Projection
+	err := r.db.QueryRow(ctx, query, appID, model, RunStatusCompleted).Scan(
+		&projection.ProjectionID,
+		&projection.SagaID,
+		&projection.AppID,
+		&projection.Model,
+		&projection.Filters,
+		&projection.Status,
+		&projection.Reviews,
+		&projection.ExplainedVariance,
+		&projection.Error,
+		&projection.StartedAt,
+		&projection.FinishedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest projection of app %s: %w", appID, err)
+	}
+
+	return &projection, nil
+}
+
+// ListProjectionPoints returns the points of the projection in review ID
+// order, up to limit of them after afterReviewID, for paging through all of
+// them.
+func (r *postgresRepository) ListProjectionPoints(ctx context.Context, projectionID, afterReviewID string, limit int) ([]ProjectionPoint, error) {
+	ctx, cancel := within(ctx, r.timeouts.Fetch)
+	defer cancel()
+
+	query := `
+		SELECT review_id, x, y
+		FROM review_projection_points
+		WHERE projection_id = $1 AND review_id > $2
+		ORDER BY review_id
+		LIMIT $3;
+	`
+
+	rows, err := r.db.Query(ctx, query, projectionID, afterReviewID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list points of projection %s: %w", projectionID, err)
+	}
+	defer rows.Close()
+
+	var points []ProjectionPoint
+	for rows.Next() {
+		var point ProjectionPoint
+		if err := rows.Scan(&point.ReviewID, &point.X, &point.Y); err != nil {
+			return nil, fmt.Errorf("failed to scan projection point: %w", err)
+		}
+		points = append(points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating projection points: %w", err)
+	}
+
+	return points, nil
+}
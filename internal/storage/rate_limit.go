@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RateLimits caps the embedding requests and tokens of a one-minute window;
+// 0 leaves a limit off.
+type RateLimits struct {
+	Requests int
+	Tokens   int
+}
+
+// ReserveRateLimit counts one request of the given tokens against the window
+// starting at window, shared by all replicas, and reports whether it fit in
+// the limits. Nothing is counted when it does not. The first request of a
+// window always fits, so that a request larger than the token limit still
+// goes through.
+func (r *postgresRepository) ReserveRateLimit(ctx context.Context, window time.Time, tokens int, limits RateLimits) (bool, error) {
+	query := `
+		INSERT INTO embedding_rate_limits (window_start, requests, tokens)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (window_start) DO UPDATE
+		SET requests = embedding_rate_limits.requests + 1,
+			tokens = embedding_rate_limits.tokens + EXCLUDED.tokens
+		WHERE ($3 = 0 OR embedding_rate_limits.requests < $3)
+			AND ($4 = 0 OR embedding_rate_limits.tokens + EXCLUDED.tokens <= $4 OR embedding_rate_limits.requests = 0)
+		RETURNING requests;
+	`
+
+	var requests int
+	err := r.db.QueryRow(ctx, query, window, tokens, limits.Requests, limits.Tokens).Scan(&requests)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve rate limit: %w", err)
+	}
+
+	return true, nil
+}
+
+// PruneRateLimits deletes the rate limit windows that started before before.
+func (r *postgresRepository) PruneRateLimits(ctx context.Context, before time.Time) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM embedding_rate_limits WHERE window_start < $1;`, before); err != nil {
+		return fmt.Errorf("failed to prune rate limits: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HeartbeatReplica records that the replica is alive.
+func (r *postgresRepository) HeartbeatReplica(ctx context.Context, replicaID string) error {
+	query := `
+		INSERT INTO vectorize_replicas (replica_id, heartbeat_at)
+		VALUES ($1, NOW())
+		ON CONFLICT (replica_id) DO UPDATE
+		SET heartbeat_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query, replicaID); err != nil {
+		return fmt.Errorf("failed to record heartbeat of replica %s: %w", replicaID, err)
+	}
+
+	return nil
+}
+
+// ListLiveReplicas returns the IDs of the replicas that sent a heartbeat
+// within ttl, in order, and deletes those that did not.
+func (r *postgresRepository) ListLiveReplicas(ctx context.Context, ttl time.Duration) ([]string, error) {
+	if _, err := r.db.Exec(ctx, `DELETE FROM vectorize_replicas WHERE heartbeat_at < NOW() - make_interval(secs => $1);`, ttl.Seconds()); err != nil {
+		return nil, fmt.Errorf("failed to delete expired replicas: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT replica_id FROM vectorize_replicas ORDER BY replica_id;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicas: %w", err)
+	}
+	defer rows.Close()
+
+	var replicas []string
+	for rows.Next() {
+		var replicaID string
+		if err := rows.Scan(&replicaID); err != nil {
+			return nil, fmt.Errorf("failed to scan replica: %w", err)
+		}
+		replicas = append(replicas, replicaID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list replicas: %w", err)
+	}
+
+	return replicas, nil
+}
+
+// DeregisterReplica removes the replica, so that its partitions are dealt out
+// to the others without waiting for its heartbeat to expire.
+func (r *postgresRepository) DeregisterReplica(ctx context.Context, replicaID string) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM vectorize_replicas WHERE replica_id = $1;`, replicaID); err != nil {
+		return fmt.Errorf("failed to deregister replica %s: %w", replicaID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetProcessedSaga returns the record of the saga's request of eventType
+// having been handled, or nil when it hasn't been.
+func (r *postgresRepository) GetProcessedSaga(ctx context.Context, sagaID, eventType string) (*ProcessedSaga, error) {
+	query := `
+		SELECT saga_id, event_type, request_digest, result_digest, reply, processed_at
+		FROM processed_sagas
+		WHERE saga_id = $1 AND event_type = $2;
+	`
+
+	var saga ProcessedSaga
+	err := r.db.QueryRow(ctx, query, sagaID, eventType).Scan(
+		&saga.SagaID,
+		&saga.EventType,
+		&saga.RequestDigest,
+		&saga.ResultDigest,
+		&saga.Reply,
+		&saga.ProcessedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get processed saga %s: %w", sagaID, err)
+	}
+
+	return &saga, nil
+}
+
+// RecordProcessedSaga records that the saga's request was handled, replacing
+// the record of an earlier, different request under the same saga ID.
+func (r *postgresRepository) RecordProcessedSaga(ctx context.Context, saga *ProcessedSaga) error {
+	query := `
+		INSERT INTO processed_sagas (saga_id, event_type, request_digest, result_digest, reply)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (saga_id, event_type) DO UPDATE
+		SET request_digest = EXCLUDED.request_digest,
+			result_digest = EXCLUDED.result_digest,
+			reply = EXCLUDED.reply,
+			processed_at = NOW();
+	`
+
+	if _, err := r.db.Exec(ctx, query, saga.SagaID, saga.EventType, saga.RequestDigest, saga.ResultDigest, saga.Reply); err != nil {
+		return fmt.Errorf("failed to record processed saga %s: %w", saga.SagaID, err)
+	}
+
+	return nil
+}
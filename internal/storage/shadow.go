@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pgvector/pgvector-go"
+)
+
+// UpsertShadowEmbeddings stores shadow vectors, replacing those of the same
+// review chunk and model.
+func (r *postgresRepository) UpsertShadowEmbeddings(ctx context.Context, vectors []*ShadowVector) error {
+	return r.retried(ctx, func(ctx context.Context) error {
+		ctx, cancel := within(ctx, r.timeouts.Write)
+		defer cancel()
+		return r.upsertShadowEmbeddings(ctx, vectors)
+	})
+}
+
+func (r *postgresRepository) upsertShadowEmbeddings(ctx context.Context, vectors []*ShadowVector) error {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO review_embeddings_shadow (review_id, chunk_index, model, app_id, dim, content_vec, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (review_id, chunk_index, model) DO UPDATE
+		SET app_id = EXCLUDED.app_id,
+			dim = EXCLUDED.dim,
+			content_vec = EXCLUDED.content_vec,
+			created_at = EXCLUDED.created_at;
+	`
+
+	batch := &pgx.Batch{}
+	for _, vector := range vectors {
+		batch.Queue(query,
+			vector.ReviewID,
+			vector.ChunkIndex,
+			vector.Model,
+			vector.AppID,
+			len(vector.ContentVec),
+			pgvector.NewVector(vector.ContentVec),
+			vector.CreatedAt,
+		)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for _, vector := range vectors {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to store shadow embedding for review %s: %w", vector.ReviewID, err)
+		}
+	}
+
+	return nil
+}
+
+// ListShadowPairs returns up to limit reviews of the app, all apps when appID
+// is empty, that have a content vector made with both models, in random
+// order.
+func (r *postgresRepository) ListShadowPairs(ctx context.Context, appID, productionModel, shadowModel string, limit int) ([]ShadowPair, error) {
+	query := `
+		SELECT re.review_id, re.content_vec, rs.content_vec
+		FROM review_embeddings_shadow rs
+		JOIN review_embeddings re
+			ON re.review_id = rs.review_id AND re.chunk_index = rs.chunk_index
+		WHERE rs.chunk_index = 0 AND rs.model = $1 AND re.model = $2
+			AND re.content_vec IS NOT NULL
+			AND ($3 = '' OR rs.app_id = $3)
+		ORDER BY random()
+		LIMIT $4;
+	`
+
+	rows, err := r.db.Query(ctx, query, shadowModel, productionModel, appID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shadow embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var pairs []ShadowPair
+	for rows.Next() {
+		var pair ShadowPair
+		var production, shadow pgvector.Vector
+		if err := rows.Scan(&pair.ReviewID, &production, &shadow); err != nil {
+			return nil, fmt.Errorf("failed to scan shadow embedding: %w", err)
+		}
+		pair.Production, pair.Shadow = production.Slice(), shadow.Slice()
+		pairs = append(pairs, pair)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shadow embeddings: %w", err)
+	}
+
+	return pairs, nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SpendEntry is what one model's embeddings of an app cost in a month, and
+// how many reviews they covered.
+type SpendEntry struct {
+	TenantID string    `json:"tenant_id,omitempty"`
+	AppID    string    `json:"app_id"`
+	Month    time.Time `json:"month"`
+	Model    string    `json:"model"`
+	Reviews  int64     `json:"reviews"`
+	Tokens   int64     `json:"tokens"`
+	CostUSD  float64   `json:"cost_usd"`
+}
+
+// AddSpend adds the reviews, tokens and cost of the entries to the spend of their
+// app, model and month.
+func (r *postgresRepository) AddSpend(ctx context.Context, entries []SpendEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO vectorize_spend (tenant_id, app_id, month, model, reviews, tokens, cost_usd, updated_at)
+		VALUES ($1, $2, date_trunc('month', $3::timestamptz AT TIME ZONE 'UTC')::date, $4, $5, $6, $7, NOW())
+		ON CONFLICT (tenant_id, app_id, month, model) DO UPDATE
+		SET reviews = vectorize_spend.reviews + EXCLUDED.reviews,
+			tokens = vectorize_spend.tokens + EXCLUDED.tokens,
+			cost_usd = vectorize_spend.cost_usd + EXCLUDED.cost_usd,
+			updated_at = NOW();
+	`
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		batch.Queue(query, entry.TenantID, entry.AppID, entry.Month, entry.Model, entry.Reviews, entry.Tokens, entry.CostUSD)
+	}
+
+	results := r.db.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for _, entry := range entries {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to add spend for app %s: %w", entry.AppID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetSpend returns the spend of the month month falls in, by app and model,
+// narrowed to tenantID and appID when they are set.
+func (r *postgresRepository) GetSpend(ctx context.Context, month time.Time, tenantID, appID string) ([]SpendEntry, error) {
+	query := `
+		SELECT tenant_id, app_id, month, model, reviews, tokens, cost_usd
+		FROM vectorize_spend
+		WHERE month = date_trunc('month', $1::timestamptz AT TIME ZONE 'UTC')::date
+			AND ($2 = '' OR tenant_id = $2)
+			AND ($3 = '' OR app_id = $3)
+		ORDER BY cost_usd DESC, app_id, model;
+	`
+
+	rows, err := r.db.Query(ctx, query, month, tenantID, appID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query spend: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []SpendEntry
+	for rows.Next() {
+		var entry SpendEntry
+		if err := rows.Scan(&entry.TenantID, &entry.AppID, &entry.Month, &entry.Model, &entry.Reviews, &entry.Tokens, &entry.CostUSD); err != nil {
+			return nil, fmt.Errorf("failed to scan spend: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spend: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// statement is a query of a hot path run as a named prepared statement: the
+// review fetch and the embedding writes, which a backfill runs thousands of
+// times with the same text. Postgres parses each one once per connection
+// and, once a few runs show that a generic plan costs no more than planning
+// for the parameters, keeps reusing that plan.
+type statement struct {
+	name string
+	sql  string
+}
+
+// The statements of the embedding writes.
+var (
+	upsertEmbeddingStatement      = statement{"upsert_embedding", upsertEmbeddingQuery}
+	updateSparseVectorStatement   = statement{"update_sparse_vector", updateSparseVectorQuery}
+	deleteTrailingChunksStatement = statement{"delete_trailing_chunks", deleteTrailingChunksQuery}
+	updateResponseVectorStatement = statement{"update_response_vector", updateResponseVectorQuery}
+)
+
+// acquirePrepared takes a connection from the pool with the statements
+// prepared on it, preparing those the connection has not prepared yet, so
+// that the statements run by name. Statements are prepared on first use
+// rather than on connect, since the tables they read may not exist before
+// initTables and sparse_vec only with sparse embedding on. The caller
+// releases the connection.
+func (r *postgresRepository) acquirePrepared(ctx context.Context, statements ...statement) (*pgxpool.Conn, error) {
+	conn, err := r.db.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+
+	for _, s := range statements {
+		if _, err := conn.Conn().Prepare(ctx, s.name, s.sql); err != nil {
+			conn.Release()
+			return nil, fmt.Errorf("failed to prepare statement %s: %w", s.name, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// fetchStatement is the statement fetching a page of reviews in the
+// filters' order, with the given conditions. Its text only depends on the
+// order and on whether the run has a tenant, see buildCleanReviewsWhere.
+func (r *postgresRepository) fetchStatement(filters CleanReviewFilters, whereClause string, limitIndex int) statement {
+	order := filters.Order
+	if order == "" {
+		order = OrderNewestFirst
+	}
+	name := "fetch_clean_reviews_" + order
+	if filters.TenantID != "" {
+		name += "_tenant"
+	}
+
+	orderBy, _ := reviewOrder(filters.Order, 0)
+	return statement{name: name, sql: fmt.Sprintf(`
+		SELECT
+			cr.id, cr.app_id, cr.country, cr.rating, cr.language,
+			cr.content_clean, cr.content_en, cr.response_content_clean, cr.reviewed_at,
+			COALESCE(cr.title, ''), COALESCE(re.content_hash, ''), COALESCE(re.model, ''),
+			%s
+		FROM clean_reviews cr
+		LEFT JOIN review_embeddings re ON re.review_id = cr.id AND re.chunk_index = 0
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d;
+	`, r.metadataSelect, whereClause, orderBy, limitIndex)}
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound the queries of the repository, so that a wedged query
+// can't hold a worker forever. Statement is enforced by the server for every
+// statement; Fetch, Write and Stats bound the per-batch review reads, the
+// embedding and run writes, and the counts and statistics as context
+// deadlines. Zero leaves a bound off.
+type Timeouts struct {
+	Statement time.Duration
+	Fetch     time.Duration
+	Write     time.Duration
+	Stats     time.Duration
+}
+
+// within returns ctx bounded by timeout, unless timeout is zero.
+func within(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,296 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorQueueSize bounds the reports waiting to be sent; more are dropped
+// rather than slowing down the code reporting them.
+const errorQueueSize = 100
+
+// Report levels.
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+// ErrorReport is an error sent to the configured error sinks.
+type ErrorReport struct {
+	EventID   string    `json:"event_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	// Kind names what failed, e.g. "run_failed".
+	Kind        string            `json:"kind"`
+	Environment string            `json:"environment,omitempty"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	Stack       string            `json:"stack,omitempty"`
+}
+
+// errorSink delivers reports to one destination.
+type errorSink interface {
+	send(ctx context.Context, report ErrorReport) error
+}
+
+type errorReporter struct {
+	sinks       []errorSink
+	environment string
+	timeout     time.Duration
+	logger      *slog.Logger
+	done        chan struct{}
+	dropped     atomic.Int64
+
+	mu     sync.RWMutex
+	queue  chan ErrorReport
+	closed bool
+}
+
+var (
+	reporter   atomic.Pointer[errorReporter]
+	serverName = sync.OnceValue(func() string {
+		name, _ := os.Hostname()
+		return name
+	})
+)
+
+// SetupErrorReporting installs the error sinks of cfg, which ReportError and
+// ReportPanic send to from then on. It returns a function sending the
+// reports still queued on shutdown. When no sink is configured nothing is
+// installed, reports are dropped, and the shutdown function is a no-op.
+func SetupErrorReporting(cfg config.ErrorReportingConfig, logger *slog.Logger) (func(context.Context) error, error) {
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	client := &http.Client{Timeout: cfg.Timeout}
+	r := &errorReporter{
+		environment: cfg.Environment,
+		timeout:     cfg.Timeout,
+		logger:      logger,
+		queue:       make(chan ErrorReport, errorQueueSize),
+		done:        make(chan struct{}),
+	}
+	if cfg.SentryDSN != "" {
+		sink, err := newSentrySink(cfg.SentryDSN, client)
+		if err != nil {
+			return nil, err
+		}
+		r.sinks = append(r.sinks, sink)
+	}
+	if cfg.WebhookURL != "" {
+		r.sinks = append(r.sinks, &webhookSink{url: cfg.WebhookURL, client: client})
+	}
+
+	go r.run()
+	reporter.Store(r)
+
+	return func(ctx context.Context) error {
+		reporter.CompareAndSwap(r, nil)
+		r.mu.Lock()
+		r.closed = true
+		close(r.queue)
+		r.mu.Unlock()
+		select {
+		case <-r.done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("failed to send queued error reports: %w", ctx.Err())
+		}
+	}, nil
+}
+
+// ReportError sends err to the error sinks, tagged with the trace ID of ctx
+// and tags, e.g. the saga ID, and carrying extra, e.g. a run's filters. kind
+// names what failed.
+func ReportError(ctx context.Context, kind string, err error, tags map[string]string, extra map[string]any) {
+	report(ctx, ErrorReport{Level: LevelError, Kind: kind, Message: err.Error(), Tags: tags, Extra: extra})
+}
+
+// ReportPanic sends a recovered panic value with the stack of the goroutine
+// recovering it; call it from the deferred function calling recover.
+func ReportPanic(ctx context.Context, kind string, value any, tags map[string]string) {
+	report(ctx, ErrorReport{Level: LevelFatal, Kind: kind, Message: fmt.Sprintf("panic: %v", value), Tags: tags, Stack: string(debug.Stack())})
+}
+
+func report(ctx context.Context, rep ErrorReport) {
+	r := reporter.Load()
+	if r == nil {
+		return
+	}
+
+	rep.EventID = newEventID()
+	rep.Timestamp = time.Now().UTC()
+	rep.Environment = r.environment
+	rep.ServerName = serverName()
+	tags := make(map[string]string, len(rep.Tags)+1)
+	for k, v := range rep.Tags {
+		if v != "" {
+			tags[k] = v
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		tags["trace_id"] = sc.TraceID().String()
+	}
+	rep.Tags = tags
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- rep:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *errorReporter) run() {
+	defer close(r.done)
+	for rep := range r.queue {
+		if dropped := r.dropped.Swap(0); dropped > 0 {
+			r.logger.Warn("Dropped error reports, the queue was full", "count", dropped)
+		}
+		for _, sink := range r.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+			if err := sink.send(ctx, rep); err != nil {
+				r.logger.Warn("Failed to send error report", "kind", rep.Kind, "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func newEventID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// webhookSink posts each report as JSON.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) send(ctx context.Context, report ErrorReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal error report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return do(s.client, req)
+}
+
+// sentrySink sends each report as an event to the envelope endpoint of the
+// Sentry project its DSN names.
+type sentrySink struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+func newSentrySink(dsn string, client *http.Client) (*sentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Sentry DSN: %w", err)
+	}
+	path := strings.Trim(u.Path, "/")
+	if u.User == nil || path == "" {
+		return nil, fmt.Errorf("failed to parse Sentry DSN: missing key or project")
+	}
+
+	// The project ID is the last path segment; any before it prefix the API.
+	prefix, project := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	return &sentrySink{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:     "Sentry sentry_version=7, sentry_client=review-vectorizer/1.0, sentry_key=" + u.User.Username(),
+		client:   client,
+	}, nil
+}
+
+func (s *sentrySink) send(ctx context.Context, report ErrorReport) error {
+	event := map[string]any{
+		"event_id":    report.EventID,
+		"timestamp":   report.Timestamp.Format(time.RFC3339Nano),
+		"level":       report.Level,
+		"platform":    "go",
+		"logger":      report.Kind,
+		"server_name": report.ServerName,
+		"environment": report.Environment,
+		"tags":        report.Tags,
+		"extra":       report.Extra,
+		"fingerprint": []string{report.Kind, "{{ default }}"},
+		"exception": map[string]any{
+			"values": []map[string]any{{"type": report.Kind, "value": report.Message}},
+		},
+	}
+	if report.Stack != "" {
+		extra := map[string]any{"stack": report.Stack}
+		for k, v := range report.Extra {
+			extra[k] = v
+		}
+		event["extra"] = extra
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, item := range []any{
+		map[string]any{"event_id": report.EventID, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)},
+		map[string]any{"type": "event"},
+		event,
+	} {
+		if err := enc.Encode(item); err != nil {
+			return fmt.Errorf("failed to marshal Sentry event: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+	return do(s.client, req)
+}
+
+func do(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// NewLogger builds the service logger from the logging configuration: a JSON
+// or text handler writing to w at the configured level, sampling repeated
+// debug and info records when SampleEvery is above 1.
+func NewLogger(cfg config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	if err := SetLogLevel(cfg.Level); err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: &logLevel}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", cfg.Format)
+	}
+
+	if cfg.SampleEvery > 1 {
+		handler = &samplingHandler{
+			Handler: handler,
+			every:   uint64(cfg.SampleEvery),
+			counts:  &sync.Map{},
+		}
+	}
+
+	return slog.New(handler), nil
+}
+
+// logLevel is the level of the loggers built by NewLogger, which SetLogLevel
+// changes while they are in use.
+var logLevel slog.LevelVar
+
+// SetLogLevel changes the level of the service logger; an empty level means
+// info.
+func SetLogLevel(level string) error {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+
+	logLevel.Set(l)
+	return nil
+}
+
+// LogLevel returns the level of the service logger.
+func LogLevel() slog.Level {
+	return logLevel.Level()
+}
+
+// samplingHandler passes on the first of every `every` debug and info records
+// with the same message. Warnings and errors are never dropped.
+type samplingHandler struct {
+	slog.Handler
+	every  uint64
+	counts *sync.Map // message -> *atomic.Uint64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		counter, _ := h.counts.LoadOrStore(r.Message, &atomic.Uint64{})
+		if (counter.(*atomic.Uint64).Add(1)-1)%h.every != 0 {
+			return nil
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), every: h.every, counts: h.counts}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), every: h.every, counts: h.counts}
+}
@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quiby-ai/review-vectorizer/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName names the tracer the service's own spans are created with.
+const TracerName = "github.com/quiby-ai/review-vectorizer"
+
+// Tracer returns the service's tracer from the global provider. Until
+// SetupTracing installs an exporting provider, spans are no-ops.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// SetupTracing installs a global tracer provider exporting spans over OTLP
+// HTTP and the W3C trace context propagator. It returns a function flushing
+// and stopping the exporter on shutdown. When tracing is disabled nothing is
+// installed and the shutdown function is a no-op.
+func SetupTracing(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracehttp.Option{}
+	if cfg.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "review-vectorizer"
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
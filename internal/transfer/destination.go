@@ -0,0 +1,163 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// gcsEndpoint is the S3-compatible XML API of Google Cloud Storage, used for
+// gs:// destinations with HMAC keys as AWS credentials.
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// Destination is a file being written. Commit completes it; Abort discards
+// what was written so far, so a failed export leaves no partial file behind.
+type Destination interface {
+	io.Writer
+	Commit() error
+	Abort(err error)
+}
+
+// Create creates the file at uri: s3://bucket/key, gs://bucket/key or a
+// local path.
+func Create(ctx context.Context, uri string, cfg config.ExportConfig) (Destination, error) {
+	loc, err := parseLocation(uri)
+	if err != nil {
+		return nil, err
+	}
+	if loc.bucket == "" {
+		return createFile(loc.path)
+	}
+	return createObject(ctx, loc, cfg)
+}
+
+// location is a local path or, with bucket set, an object in a bucket of an
+// S3-compatible store.
+type location struct {
+	path     string
+	bucket   string
+	key      string
+	endpoint string
+}
+
+func parseLocation(uri string) (location, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		return location{path: strings.TrimPrefix(uri, "file://")}, nil
+	}
+
+	loc := location{bucket: u.Host, key: strings.TrimPrefix(u.Path, "/")}
+	switch u.Scheme {
+	case "s3":
+	case "gs":
+		loc.endpoint = gcsEndpoint
+	default:
+		return location{}, fmt.Errorf("unsupported file location scheme %q", u.Scheme)
+	}
+	if loc.bucket == "" || loc.key == "" {
+		return location{}, fmt.Errorf("invalid file location %q, expected %s://bucket/key", uri, u.Scheme)
+	}
+
+	return loc, nil
+}
+
+func newS3Client(ctx context.Context, loc location, cfg config.ExportConfig) (*s3.Client, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.S3Region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load object storage credentials: %w", err)
+	}
+
+	endpoint := loc.endpoint
+	if endpoint == "" {
+		endpoint = cfg.S3Endpoint
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = cfg.S3PathStyle
+	}), nil
+}
+
+type fileDestination struct {
+	*os.File
+}
+
+func createFile(name string) (Destination, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	return fileDestination{file}, nil
+}
+
+func (d fileDestination) Commit() error {
+	return d.Close()
+}
+
+func (d fileDestination) Abort(error) {
+	d.Close()
+	os.Remove(d.Name())
+}
+
+// objectDestination streams what is written to it into a multipart upload.
+type objectDestination struct {
+	pipe *io.PipeWriter
+	done chan error
+}
+
+func createObject(ctx context.Context, loc location, cfg config.ExportConfig) (Destination, error) {
+	client, err := newS3Client(ctx, loc, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	d := &objectDestination{pipe: writer, done: make(chan error, 1)}
+
+	go func() {
+		_, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(loc.bucket),
+			Key:    aws.String(loc.key),
+			Body:   reader,
+		})
+		// Unblock writers if the upload gave up early.
+		reader.CloseWithError(err)
+		d.done <- err
+	}()
+
+	return d, nil
+}
+
+func (d *objectDestination) Write(p []byte) (int, error) {
+	return d.pipe.Write(p)
+}
+
+func (d *objectDestination) Commit() error {
+	d.pipe.Close()
+	if err := <-d.done; err != nil {
+		return fmt.Errorf("failed to upload export: %w", err)
+	}
+	return nil
+}
+
+// Abort fails the upload, which aborts the multipart upload instead of
+// completing the object.
+func (d *objectDestination) Abort(err error) {
+	d.pipe.CloseWithError(err)
+	<-d.done
+}
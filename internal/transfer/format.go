@@ -0,0 +1,142 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// File formats embeddings can be exported as.
+const (
+	FormatJSONL   = "jsonl"
+	FormatParquet = "parquet"
+)
+
+// FormatFromPath returns the format matching the extension of the file name,
+// or "" when it matches none.
+func FormatFromPath(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".parquet":
+		return FormatParquet
+	default:
+		return ""
+	}
+}
+
+// RecordWriter encodes records into a file format. Close flushes buffered
+// records and writes the file's footer, if any, without closing the
+// underlying writer.
+type RecordWriter interface {
+	Write(records []Record) error
+	Close() error
+}
+
+func NewRecordWriter(format string, w io.Writer) (RecordWriter, error) {
+	switch format {
+	case FormatJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case FormatParquet:
+		return &parquetWriter{writer: parquet.NewGenericWriter[Record](w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q, expected %s or %s", format, FormatJSONL, FormatParquet)
+	}
+}
+
+// RecordReader decodes records from a file. Read returns up to n records
+// and io.EOF once the file is exhausted.
+type RecordReader interface {
+	Read(n int) ([]Record, error)
+}
+
+func NewRecordReader(format string, source *Source) (RecordReader, error) {
+	switch format {
+	case FormatJSONL:
+		return &jsonlReader{decoder: json.NewDecoder(bufio.NewReader(source))}, nil
+	case FormatParquet:
+		return &parquetReader{reader: parquet.NewGenericReader[Record](source)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported import format %q, expected %s or %s", format, FormatJSONL, FormatParquet)
+	}
+}
+
+type jsonlReader struct {
+	decoder *json.Decoder
+	line    int
+}
+
+func (r *jsonlReader) Read(n int) ([]Record, error) {
+	records := make([]Record, 0, n)
+	for len(records) < n {
+		var record Record
+		if err := r.decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to decode record %d: %w", r.line+1, err)
+		}
+		r.line++
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil, io.EOF
+	}
+	return records, nil
+}
+
+type parquetReader struct {
+	reader *parquet.GenericReader[Record]
+}
+
+func (r *parquetReader) Read(n int) ([]Record, error) {
+	records := make([]Record, n)
+	read, err := r.reader.Read(records)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read parquet rows: %w", err)
+	}
+	if read == 0 {
+		return nil, io.EOF
+	}
+	return records[:read], nil
+}
+
+// jsonlWriter writes one JSON object per line.
+type jsonlWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *jsonlWriter) Write(records []Record) error {
+	for i := range records {
+		if err := w.encoder.Encode(&records[i]); err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+	}
+	return nil
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.buffered.Flush()
+}
+
+type parquetWriter struct {
+	writer *parquet.GenericWriter[Record]
+}
+
+func (w *parquetWriter) Write(records []Record) error {
+	if _, err := w.writer.Write(records); err != nil {
+		return fmt.Errorf("failed to write parquet rows: %w", err)
+	}
+	return nil
+}
+
+func (w *parquetWriter) Close() error {
+	return w.writer.Close()
+}
@@ -0,0 +1,99 @@
+package transfer
+
+import (
+	"time"
+
+	"github.com/quiby-ai/review-vectorizer/internal/storage"
+)
+
+// Record is one embedding with its review metadata as exported to or
+// imported from a file. Vectors absent from the table are exported as empty
+// lists.
+type Record struct {
+	EmbeddingID string    `json:"embedding_id" parquet:"embedding_id"`
+	ReviewID    string    `json:"review_id" parquet:"review_id"`
+	ChunkIndex  int32     `json:"chunk_index" parquet:"chunk_index"`
+	AppID       string    `json:"app_id" parquet:"app_id"`
+	Language    string    `json:"language" parquet:"language"`
+	Country     string    `json:"country" parquet:"country"`
+	Rating      int32     `json:"rating" parquet:"rating"`
+	Model       string    `json:"model" parquet:"model"`
+	Dim         int32     `json:"dim" parquet:"dim"`
+	ReviewedAt  time.Time `json:"reviewed_at" parquet:"reviewed_at,timestamp(millisecond)"`
+	CreatedAt   time.Time `json:"created_at" parquet:"created_at,timestamp(millisecond)"`
+	ContentVec  []float32 `json:"content_vec" parquet:"content_vec,list"`
+	ResponseVec []float32 `json:"response_vec,omitempty" parquet:"response_vec,list"`
+	TitleVec    []float32 `json:"title_vec,omitempty" parquet:"title_vec,list"`
+	Normalized  bool      `json:"normalized,omitempty" parquet:"normalized"`
+	TenantID    string    `json:"tenant_id,omitempty" parquet:"tenant_id,optional"`
+	ContentHash string    `json:"content_hash,omitempty" parquet:"content_hash,optional"`
+	// ContentENVec is the vector of the English translation.
+	ContentENVec []float32 `json:"content_en_vec,omitempty" parquet:"content_en_vec,list"`
+	AppVersion   string    `json:"app_version,omitempty" parquet:"app_version,optional"`
+	Device       string    `json:"device,omitempty" parquet:"device,optional"`
+	Platform     string    `json:"platform,omitempty" parquet:"platform,optional"`
+	HelpfulVotes *int32    `json:"helpful_votes,omitempty" parquet:"helpful_votes,optional"`
+}
+
+func NewRecord(embedding storage.StoredEmbedding) Record {
+	return Record{
+		EmbeddingID:  embedding.EmbeddingID,
+		ReviewID:     embedding.ReviewID,
+		ChunkIndex:   int32(embedding.ChunkIndex),
+		AppID:        embedding.AppID,
+		Language:     embedding.Language,
+		Country:      embedding.Country,
+		Rating:       int32(embedding.Rating),
+		Model:        embedding.Model,
+		Dim:          int32(embedding.Dim),
+		ReviewedAt:   embedding.ReviewedAt,
+		CreatedAt:    embedding.CreatedAt,
+		ContentVec:   embedding.ContentVec,
+		ResponseVec:  embedding.ResponseVec,
+		TitleVec:     embedding.TitleVec,
+		Normalized:   embedding.Normalized,
+		TenantID:     embedding.TenantID,
+		ContentHash:  embedding.ContentHash,
+		ContentENVec: embedding.ContentENVec,
+		AppVersion:   embedding.AppVersion,
+		Device:       embedding.Device,
+		Platform:     embedding.Platform,
+		HelpfulVotes: embedding.HelpfulVotes,
+	}
+}
+
+// Vector returns the row to store for the record. A record without an
+// embedding ID gets a new one.
+func (r Record) Vector() *storage.Vector {
+	vector := storage.NewVector(r.ReviewID, r.AppID, r.ContentVec)
+	if r.EmbeddingID != "" {
+		vector.EmbeddingID = r.EmbeddingID
+	}
+
+	vector.ChunkIndex = int(r.ChunkIndex)
+	vector.Language = r.Language
+	vector.Country = r.Country
+	vector.Rating = int16(r.Rating)
+	vector.Model = r.Model
+	vector.Dim = len(r.ContentVec)
+	vector.ResponseVec = nonEmpty(r.ResponseVec)
+	vector.TitleVec = nonEmpty(r.TitleVec)
+	vector.ContentENVec = nonEmpty(r.ContentENVec)
+	vector.AppVersion = r.AppVersion
+	vector.Device = r.Device
+	vector.Platform = r.Platform
+	vector.HelpfulVotes = r.HelpfulVotes
+	vector.Normalized = r.Normalized
+	vector.TenantID = r.TenantID
+	vector.ContentHash = r.ContentHash
+
+	return vector
+}
+
+// nonEmpty maps the empty lists absent vectors are exported as back to nil.
+func nonEmpty(v []float32) []float32 {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
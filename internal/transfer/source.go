@@ -0,0 +1,65 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/quiby-ai/review-vectorizer/config"
+)
+
+// Source is a file opened for reading. Objects are downloaded to a temporary
+// file first, since Parquet is read from the end; Close removes it.
+type Source struct {
+	*os.File
+	temporary bool
+}
+
+// Open opens the file at uri: s3://bucket/key, gs://bucket/key or a local
+// path.
+func Open(ctx context.Context, uri string, cfg config.ExportConfig) (*Source, error) {
+	loc, err := parseLocation(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if loc.bucket == "" {
+		file, err := os.Open(loc.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open import file: %w", err)
+		}
+		return &Source{File: file}, nil
+	}
+
+	client, err := newS3Client(ctx, loc, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "review-vectorizer-import-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	source := &Source{File: file, temporary: true}
+
+	if _, err := manager.NewDownloader(client).Download(ctx, file, &s3.GetObjectInput{
+		Bucket: aws.String(loc.bucket),
+		Key:    aws.String(loc.key),
+	}); err != nil {
+		source.Close()
+		return nil, fmt.Errorf("failed to download %s: %w", uri, err)
+	}
+
+	return source, nil
+}
+
+func (s *Source) Close() error {
+	err := s.File.Close()
+	if s.temporary {
+		os.Remove(s.Name())
+	}
+	return err
+}
@@ -0,0 +1,16 @@
+-- Announces inserted and changed clean reviews on the clean_reviews_changed
+-- channel for the vectorizer's CDC mode (cdc.enabled = true).
+CREATE OR REPLACE FUNCTION notify_clean_reviews_changed() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('clean_reviews_changed', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS clean_reviews_changed ON clean_reviews;
+
+CREATE TRIGGER clean_reviews_changed
+    AFTER INSERT OR UPDATE OF title, content_clean, content_en, response_content_clean, is_contentful
+    ON clean_reviews
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_clean_reviews_changed();
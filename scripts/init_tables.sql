@@ -7,7 +7,7 @@ CREATE EXTENSION IF NOT EXISTS vector;
 -- Create the review_embeddings table
 CREATE TABLE IF NOT EXISTS review_embeddings (
     embedding_id VARCHAR(255) PRIMARY KEY,
-    review_id VARCHAR(255) UNIQUE NOT NULL,
+    review_id VARCHAR(255) NOT NULL,
     app_id VARCHAR(255) NOT NULL,
     language VARCHAR(10),
     rating SMALLINT,
@@ -30,6 +30,56 @@ CREATE INDEX IF NOT EXISTS idx_review_embeddings_created_at ON review_embeddings
 -- Add migration columns (for future use)
 ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW();
 CREATE INDEX IF NOT EXISTS idx_review_embeddings_updated_at ON review_embeddings(updated_at);
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS title_vec vector(1536);
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS chunk_index INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE review_embeddings DROP CONSTRAINT IF EXISTS review_embeddings_review_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_review_embeddings_review_chunk ON review_embeddings(review_id, chunk_index);
+
+-- Processed review IDs per saga, referenced from the completed event
+CREATE TABLE IF NOT EXISTS vectorize_run_reviews (
+    saga_id VARCHAR(255) NOT NULL,
+    review_id VARCHAR(255) NOT NULL,
+    recorded_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (saga_id, review_id)
+);
+
+-- Vectorization runs and their lifecycle state
+CREATE TABLE IF NOT EXISTS vectorize_runs (
+    run_id VARCHAR(255) PRIMARY KEY,
+    saga_id VARCHAR(255),
+    app_id VARCHAR(255),
+    filters JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL,
+    processed INTEGER NOT NULL DEFAULT 0,
+    skipped INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_vectorize_runs_saga_id ON vectorize_runs(saga_id);
+CREATE INDEX IF NOT EXISTS idx_vectorize_runs_app_id ON vectorize_runs(app_id);
+CREATE INDEX IF NOT EXISTS idx_vectorize_runs_status ON vectorize_runs(status);
+CREATE INDEX IF NOT EXISTS idx_vectorize_runs_started_at ON vectorize_runs(started_at DESC);
+ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_reviewed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_review_id VARCHAR(255);
+ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS checkpoint_rating SMALLINT;
+
+-- Per-review failures, used to retry only the reviews that failed
+CREATE TABLE IF NOT EXISTS vectorize_errors (
+    review_id VARCHAR(255) NOT NULL,
+    stage VARCHAR(20) NOT NULL,
+    app_id VARCHAR(255) NOT NULL,
+    run_id VARCHAR(255),
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    first_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (review_id, stage)
+);
+CREATE INDEX IF NOT EXISTS idx_vectorize_errors_app_id ON vectorize_errors(app_id);
+CREATE INDEX IF NOT EXISTS idx_vectorize_errors_run_id ON vectorize_errors(run_id);
 
 -- Verify the table structure
 SELECT 
@@ -40,3 +90,299 @@ SELECT
 FROM information_schema.columns 
 WHERE table_name = 'review_embeddings' 
 ORDER BY ordinal_position;
+
+ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS watermark TIMESTAMP WITH TIME ZONE;
+ALTER TABLE vectorize_runs ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS vectorize_watermarks (
+    scope VARCHAR(512) PRIMARY KEY,
+    reviewed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS review_clusterings (
+    clustering_id VARCHAR(255) PRIMARY KEY,
+    saga_id VARCHAR(255),
+    app_id VARCHAR(255) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    k INTEGER NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL,
+    reviews INTEGER NOT NULL DEFAULT 0,
+    inertia DOUBLE PRECISION,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_review_clusterings_app_id ON review_clusterings(app_id, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS review_cluster_centroids (
+    clustering_id VARCHAR(255) NOT NULL REFERENCES review_clusterings(clustering_id) ON DELETE CASCADE,
+    cluster_index INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    centroid vector(1536) NOT NULL,
+    PRIMARY KEY (clustering_id, cluster_index)
+);
+
+CREATE TABLE IF NOT EXISTS review_cluster_assignments (
+    clustering_id VARCHAR(255) NOT NULL REFERENCES review_clusterings(clustering_id) ON DELETE CASCADE,
+    review_id VARCHAR(255) NOT NULL,
+    cluster_index INTEGER NOT NULL,
+    distance DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (clustering_id, review_id)
+);
+CREATE INDEX IF NOT EXISTS idx_review_cluster_assignments_cluster ON review_cluster_assignments(clustering_id, cluster_index);
+
+-- 2D coordinates of an app's reviews for review maps; only the latest
+-- completed projection of an app and model is kept
+CREATE TABLE IF NOT EXISTS review_projections (
+    projection_id VARCHAR(255) PRIMARY KEY,
+    saga_id VARCHAR(255),
+    app_id VARCHAR(255) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    filters JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL,
+    reviews INTEGER NOT NULL DEFAULT 0,
+    explained_variance DOUBLE PRECISION,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+CREATE INDEX IF NOT EXISTS idx_review_projections_app_id ON review_projections(app_id, model, started_at DESC);
+
+CREATE TABLE IF NOT EXISTS review_projection_points (
+    projection_id VARCHAR(255) NOT NULL REFERENCES review_projections(projection_id) ON DELETE CASCADE,
+    review_id VARCHAR(255) NOT NULL,
+    x REAL NOT NULL,
+    y REAL NOT NULL,
+    PRIMARY KEY (projection_id, review_id)
+);
+
+CREATE TABLE IF NOT EXISTS review_duplicates (
+    review_id_a VARCHAR(255) NOT NULL,
+    review_id_b VARCHAR(255) NOT NULL,
+    app_id VARCHAR(255) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    similarity DOUBLE PRECISION NOT NULL,
+    detected_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (review_id_a, review_id_b)
+);
+CREATE INDEX IF NOT EXISTS idx_review_duplicates_app_id ON review_duplicates(app_id, detected_at DESC);
+
+CREATE TABLE IF NOT EXISTS review_centroids (
+    app_id VARCHAR(255) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    iso_week VARCHAR(8) NOT NULL,
+    rating_bucket VARCHAR(10) NOT NULL,
+    reviews INTEGER NOT NULL,
+    centroid vector(1536) NOT NULL,
+    computed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (app_id, model, iso_week, rating_bucket)
+);
+
+CREATE TABLE IF NOT EXISTS processed_sagas (
+    saga_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(255) NOT NULL,
+    request_digest CHAR(64) NOT NULL,
+    result_digest CHAR(64) NOT NULL,
+    reply JSONB NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (saga_id, event_type)
+);
+
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    saga_id VARCHAR(255),
+    topic VARCHAR(255) NOT NULL,
+    message_key BYTEA,
+    value BYTEA NOT NULL,
+    headers JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_outbox_pending ON event_outbox (id) WHERE sent_at IS NULL;
+
+-- Vectors of a candidate model in shadow mode, kept out of production reads
+CREATE TABLE IF NOT EXISTS review_embeddings_shadow (
+    review_id VARCHAR(255) NOT NULL,
+    chunk_index INTEGER NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    app_id VARCHAR(255) NOT NULL,
+    dim INTEGER NOT NULL,
+    content_vec vector NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (review_id, chunk_index, model)
+);
+CREATE INDEX IF NOT EXISTS idx_review_embeddings_shadow_model ON review_embeddings_shadow(model, app_id);
+
+-- Embeddings re-made with the target model of a model migration, swapped
+-- into review_embeddings when the migration flips the current model
+CREATE TABLE IF NOT EXISTS review_embeddings_migration (
+    embedding_id VARCHAR(255) NOT NULL,
+    review_id VARCHAR(255) NOT NULL,
+    chunk_index INTEGER NOT NULL DEFAULT 0,
+    app_id VARCHAR(255) NOT NULL,
+    language VARCHAR(10),
+    rating SMALLINT,
+    country VARCHAR(10),
+    model VARCHAR(100) NOT NULL,
+    dim INTEGER NOT NULL,
+    content_vec vector(1536),
+    response_vec vector(1536),
+    title_vec vector(1536),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (review_id, chunk_index, model)
+);
+
+CREATE TABLE IF NOT EXISTS model_migrations (
+    migration_id VARCHAR(255) PRIMARY KEY,
+    from_model VARCHAR(100) NOT NULL,
+    to_model VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    total BIGINT NOT NULL DEFAULT 0,
+    migrated BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    swapped BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Whether the vectors of a row were scaled to unit length (vectorizer.normalize)
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS normalized BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS normalized BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Tenant owning the embedding; NULL for embeddings written by runs without a
+-- tenant. Runs of a tenant only replace the tenant's embeddings or unowned ones.
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255);
+CREATE INDEX IF NOT EXISTS idx_review_embeddings_tenant_app ON review_embeddings(tenant_id, app_id);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255);
+
+-- SHA-256 of the texts and settings the vectors were made from, so unchanged
+-- reviews are not embedded again (vectorizer.skip_unchanged)
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+
+-- Vector of the English translation (content_en) next to content_vec, stored
+-- with flags.enable_translation_vectors
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS content_en_vec vector(1536);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS content_en_vec vector(1536);
+
+-- Review metadata copied from clean_reviews, when it has these columns, so
+-- consumers can filter embeddings without joining back to it
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS app_version VARCHAR(50);
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS device VARCHAR(100);
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS platform VARCHAR(50);
+ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS helpful_votes INTEGER;
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS app_version VARCHAR(50);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS device VARCHAR(100);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS platform VARCHAR(50);
+ALTER TABLE review_embeddings_migration ADD COLUMN IF NOT EXISTS helpful_votes INTEGER;
+
+-- The current model, set by the last model migration; overrides
+-- vectorizer.model
+CREATE TABLE IF NOT EXISTS embedding_model (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    model VARCHAR(100) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Embedding requests and tokens sent per minute by all replicas, for
+-- openai.rate_limit.shared
+CREATE TABLE IF NOT EXISTS embedding_rate_limits (
+    window_start TIMESTAMP WITH TIME ZONE PRIMARY KEY,
+    requests INTEGER NOT NULL DEFAULT 0,
+    tokens BIGINT NOT NULL DEFAULT 0
+);
+
+-- Replicas splitting the apps among them (partitioning.enabled), with their
+-- last heartbeat
+CREATE TABLE IF NOT EXISTS vectorize_replicas (
+    replica_id VARCHAR(255) PRIMARY KEY,
+    heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Embedding tokens and their cost per app, model and month, by
+-- vectorizer.pricing
+CREATE TABLE IF NOT EXISTS vectorize_spend (
+    tenant_id VARCHAR(255) NOT NULL DEFAULT '',
+    app_id VARCHAR(255) NOT NULL,
+    month DATE NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, app_id, month, model)
+);
+
+-- Reviews embedded per app, model and month, for the review quotas
+ALTER TABLE vectorize_spend ADD COLUMN IF NOT EXISTS reviews BIGINT NOT NULL DEFAULT 0;
+
+-- Deletes, force recomputes and model migrations, with who triggered them,
+-- their filters and the rows they affected
+CREATE TABLE IF NOT EXISTS vectorize_audit_log (
+    audit_id BIGSERIAL PRIMARY KEY,
+    operation VARCHAR(50) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    trigger VARCHAR(255) NOT NULL,
+    saga_id VARCHAR(255) NOT NULL DEFAULT '',
+    filters JSONB,
+    affected BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vectorize_audit_log_created_at ON vectorize_audit_log(created_at);
+
+-- Maintenance mode as last switched by a maintenance event; a single row
+CREATE TABLE IF NOT EXISTS vectorize_maintenance (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    reason TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Embeddings moved out of review_embeddings and its vector indexes once they
+-- are old enough; payload is the review_embeddings row as JSON, compressed
+-- with zstd
+CREATE TABLE IF NOT EXISTS review_embeddings_archive (
+    review_id VARCHAR(255) NOT NULL,
+    chunk_index INTEGER NOT NULL DEFAULT 0,
+    app_id VARCHAR(255) NOT NULL,
+    tenant_id VARCHAR(255),
+    model VARCHAR(100) NOT NULL,
+    embedded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    payload BYTEA NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (review_id, chunk_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_embeddings_archive_app_id ON review_embeddings_archive(app_id);
+
+-- Sparse companion vectors for hybrid retrieval, with sparse.enabled; needs
+-- pgvector 0.7 or later, and is skipped on older versions
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_type WHERE typname = 'sparsevec') THEN
+        ALTER TABLE review_embeddings ADD COLUMN IF NOT EXISTS sparse_vec sparsevec;
+    END IF;
+END $$;
+
+-- Distribution of an app's content vectors the drift monitor compares recent
+-- ones with, per model, and the outcome of the last check; mean_vec has no
+-- fixed dimension so that a provider changing it is caught too
+CREATE TABLE IF NOT EXISTS embedding_drift_baselines (
+    app_id VARCHAR(255) NOT NULL,
+    model VARCHAR(100) NOT NULL,
+    samples INTEGER NOT NULL,
+    mean_vec vector NOT NULL,
+    norm_histogram DOUBLE PRECISION[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    checked_at TIMESTAMP WITH TIME ZONE,
+    mean_distance DOUBLE PRECISION,
+    norm_distance DOUBLE PRECISION,
+    drifted BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (app_id, model)
+);